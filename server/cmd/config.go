@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/minorcell/pfss/internal/config"
+)
+
+// loadConfig loads and validates the configuration from the config file, the
+// environment and the flags in args
+func loadConfig(name string, args []string) (*config.Config, error) {
+	cfg, err := config.Load(name, args)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(0)
+		}
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration:\n%v", err)
+	}
+	return cfg, nil
+}
+
+// printConfig implements `pfss config print`: it writes the effective
+// configuration as YAML with secrets redacted and returns the exit code,
+// which is non-zero if the configuration is invalid
+func printConfig(args []string) int {
+	cfg, err := config.Load("pfss config print", args)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if err := cfg.Print(os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid configuration:\n%v\n", err)
+		return 1
+	}
+	return 0
+}
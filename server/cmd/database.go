@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+
+	"github.com/glebarez/sqlite"
+	"github.com/minorcell/pfss/internal/config"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// openDatabase connects to the database of the configured driver
+func openDatabase(cfg config.DatabaseConfig) (*gorm.DB, error) {
+	var dialector gorm.Dialector
+	switch cfg.Driver {
+	case config.DriverPostgres:
+		dialector = postgres.Open(postgresDSN(cfg))
+	case config.DriverSQLite:
+		dialector = sqlite.Open(sqliteDSN(cfg))
+	case config.DriverMySQL:
+		dialector = mysql.Open(mysqlDSN(cfg))
+	default:
+		return nil, fmt.Errorf("unsupported database driver %q", cfg.Driver)
+	}
+	return gorm.Open(dialector, &gorm.Config{})
+}
+
+// databaseName identifies the database in metrics
+func databaseName(cfg config.DatabaseConfig) string {
+	if cfg.Driver == config.DriverSQLite {
+		return cfg.Path
+	}
+	return cfg.Name
+}
+
+// mysqlDSN returns the MySQL connection string
+func mysqlDSN(cfg config.DatabaseConfig) string {
+	if cfg.DSN != "" {
+		return cfg.DSN
+	}
+	const mysqlDSNFormat = "%s:%s@tcp(%s)/%s?charset=utf8mb4&parseTime=True&loc=Local"
+	return fmt.Sprintf(mysqlDSNFormat, cfg.User, cfg.Password, hostPort(cfg, 3306), cfg.Name)
+}
+
+// postgresDSN returns the PostgreSQL connection URL
+func postgresDSN(cfg config.DatabaseConfig) string {
+	if cfg.DSN != "" {
+		return cfg.DSN
+	}
+	dsn := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(cfg.User, cfg.Password),
+		Host:     hostPort(cfg, 5432),
+		Path:     "/" + cfg.Name,
+		RawQuery: url.Values{"sslmode": {cfg.SSLMode}}.Encode(),
+	}
+	return dsn.String()
+}
+
+// sqliteDSN returns the SQLite connection string. Foreign keys are enforced
+// like on the other databases, and WAL mode with a busy timeout lets reads
+// continue while a write is in progress.
+func sqliteDSN(cfg config.DatabaseConfig) string {
+	if cfg.DSN != "" {
+		return cfg.DSN
+	}
+	return "file:" + cfg.Path + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+}
+
+// hostPort joins the configured host and port, using defaultPort if none is set
+func hostPort(cfg config.DatabaseConfig, defaultPort int) string {
+	port := cfg.Port
+	if port == 0 {
+		port = defaultPort
+	}
+	return net.JoinHostPort(cfg.Host, strconv.Itoa(port))
+}
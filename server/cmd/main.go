@@ -1,21 +1,38 @@
 package main
 
 import (
-	"fmt"
+	"context"
+	"errors"
+	"io/fs"
 	"log"
+	"log/slog"
+	"net"
+	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 	_ "github.com/minorcell/pfss/docs" // 导入 swagger docs
+	"github.com/minorcell/pfss/internal/authz"
+	"github.com/minorcell/pfss/internal/config"
 	"github.com/minorcell/pfss/internal/handler"
-	"github.com/minorcell/pfss/internal/model"
+	"github.com/minorcell/pfss/internal/migrate"
 	"github.com/minorcell/pfss/internal/service"
+	"github.com/minorcell/pfss/pkg/health"
+	"github.com/minorcell/pfss/pkg/metrics"
 	"github.com/minorcell/pfss/pkg/middleware"
+	"github.com/minorcell/pfss/pkg/tlsconfig"
+	"github.com/minorcell/pfss/pkg/tracing"
+	"github.com/minorcell/pfss/pkg/util"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
-	"gorm.io/driver/mysql"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 	"gorm.io/gorm"
+	gormtracing "gorm.io/plugin/opentelemetry/tracing"
 )
 
 // @title PFSS 接口文档
@@ -27,89 +44,321 @@ import (
 // @in header
 // @name Authorization
 func main() {
-	// 加载环境变量
-	if err := godotenv.Load(); err != nil {
-		log.Fatal("Error loading .env file")
+	// 加载 .env 文件中的环境变量；文件不存在时忽略，已设置的环境变量不会被覆盖
+	if err := godotenv.Load(); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Fatal("Error loading .env file: ", err)
 	}
 
-	// 初始化数据库连接
-	const mysqlDSNFormat = "%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local"
+	// 子命令：pfss [serve] [flags] 启动服务器，pfss config print [flags] 输出生效的配置，
+	// pfss migrate up|down|status [flags] 管理数据库结构迁移
+	args := os.Args[1:]
+	switch {
+	case len(args) >= 2 && args[0] == "config" && args[1] == "print":
+		os.Exit(printConfig(args[2:]))
+	case len(args) >= 1 && args[0] == "migrate":
+		os.Exit(runMigrate(args[1:]))
+	case len(args) >= 1 && args[0] == "serve":
+		args = args[1:]
+	}
+
+	cfg, err := loadConfig("pfss", args)
+	if err != nil {
+		log.Fatal(err)
+	}
+	serve(cfg)
+}
+
+// serve runs the server until it receives SIGINT or SIGTERM
+func serve(cfg *config.Config) {
+	// 初始化结构化日志，log 包的输出也会经由 slog 统一格式
+	logger, err := util.NewLogger(os.Stderr, cfg.Log.Format, cfg.Log.Level)
+	if err != nil {
+		log.Fatal(err)
+	}
+	slog.SetDefault(logger)
+	util.ConfigureJWT(cfg.JWT.Secret, cfg.JWT.Expiration)
+
+	// 收到 SIGINT 或 SIGTERM 后 ctx 结束，后台任务随之停止，服务器开始优雅关闭
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	// 初始化数据库连接，从环境变量中获取配置，data base name: DNS
-	dsn := fmt.Sprintf(mysqlDSNFormat,
-		os.Getenv("DB_USER"),
-		os.Getenv("DB_PASSWORD"),
-		os.Getenv("DB_HOST"),
-		os.Getenv("DB_PORT"),
-		os.Getenv("DB_NAME"),
-	)
+	// 初始化 OpenTelemetry 链路追踪，tracing.exporter=none（默认）时不导出
+	shutdownTracing, err := tracing.Setup(context.Background(), newTracingConfig(cfg))
+	if err != nil {
+		log.Fatal("Failed to initialize tracing:", err)
+	}
+	defer shutdownTracing(context.Background())
 
-	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
+	// 初始化数据库连接，database.driver 选择 mysql（默认）、postgres 或 sqlite
+	db, err := openDatabase(cfg.Database)
 	if err != nil {
 		log.Fatal("Failed to connect to database:", err)
 	}
 
-	// 初始化数据库模型
-	if err := model.InitDB(db); err != nil {
-		log.Fatal("Failed to initialize database:", err)
+	// 为 GORM 查询创建 span，不记录查询参数以免泄露密码哈希等数据
+	if err := db.Use(gormtracing.NewPlugin(gormtracing.WithoutQueryVariables(), gormtracing.WithoutMetrics())); err != nil {
+		log.Fatal("Failed to initialize database tracing:", err)
 	}
 
-	// 初始化 Gin 路由器
-	router := gin.Default()
+	// 数据库结构由内嵌的版本化迁移管理，database.auto_migrate 开启时启动即执行待应用的迁移，
+	// 否则需先运行 pfss migrate up；数据库结构比当前版本新时拒绝启动
+	migrator, err := migrate.New(db, cfg.Database.MigrationLockTimeout)
+	if err != nil {
+		log.Fatal("Failed to load migrations:", err)
+	}
+	if cfg.Database.AutoMigrate {
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			log.Fatal("Failed to migrate database:", err)
+		}
+		for _, m := range applied {
+			slog.Info("Applied migration", "version", m.Version, "name", m.Name)
+		}
+	}
+	if err := migrator.Check(ctx); err != nil {
+		log.Fatal("Database schema is not usable:", err)
+	}
+
+	// 初始化 Gin 路由器，请求日志由 LoggerMiddleware 输出，因此不使用 gin.Default() 自带的 Logger
+	router := gin.New()
 
 	/*
 		添加中间件
 		1. ErrorHandler() 是自定义的中间件，用于处理错误。
-		2. LoggerMiddleware() 是自定义的中间件，用于记录请求日志。
+		   otelgin.Middleware() 为每个请求创建 span，并按 W3C trace-context 继承上游链路，需在日志中间件之前注册。
+		2. LoggerMiddleware() 是自定义的中间件，用于记录结构化请求日志，敏感字段会被脱敏。
 		3. gin.Recovery() 是 Gin 框架提供的一个中间件，用于捕获并处理 panic，防止程序崩溃。其主要功能是在请求处理过程中捕获并处理 panic，防止程序崩溃。当一个请求在处理过程中发生 panic，Gin 会自动调用 Recovery 中间件来恢复程序的正常运行
 	*/
 	router.Use(middleware.ErrorHandler())
-	router.Use(middleware.LoggerMiddleware())
+	router.Use(otelgin.Middleware(cfg.Tracing.ServiceName))
+	router.Use(middleware.LoggerMiddleware(newLoggerConfig(cfg, logger)))
+	router.Use(middleware.MetricsMiddleware())
 	router.Use(gin.Recovery())
 
+	// Prometheus 指标，抓取时需携带 metrics.token 作为 Bearer token
+	if cfg.Metrics.Enabled {
+		sqlDB, err := db.DB()
+		if err != nil {
+			log.Fatal("Failed to get database handle:", err)
+		}
+		if err := metrics.RegisterDB(sqlDB, databaseName(cfg.Database)); err != nil {
+			log.Fatal("Failed to register database metrics:", err)
+		}
+		router.GET("/metrics", middleware.MetricsHandler(cfg.Metrics.Token))
+	}
+
 	// 初始化路由，并将数据库连接传递给路由处理函数
-	initializeRoutes(router, db)
+	checker, err := initializeRoutes(ctx, cfg, router, db, migrator)
+	if err != nil {
+		log.Fatal("Failed to initialize routes:", err)
+	}
 
-	// 配置静态文件路由，使得 /upload 目录下的文件可以通过 /upload 访问到
-	router.Static("/upload", "upload")
+	// 配置读写超时、空闲超时和请求头大小限制，避免慢速客户端长期占用连接
+	addr := net.JoinHostPort(cfg.Server.Host, strconv.Itoa(cfg.Server.Port))
+	server := newHTTPServer(cfg, addr, router)
 
-	// 启动服务器
-	port := os.Getenv("SERVER_PORT")
-	if port == "" {
-		port = "8080"
+	// 配置 tls.cert_file 后直接以 HTTPS 提供服务，证书文件变化时自动重新加载，无需重启
+	if cfg.TLS.CertFile != "" {
+		reloader, err := tlsconfig.New(newTLSConfig(cfg))
+		if err != nil {
+			log.Fatal("Failed to initialize TLS:", err)
+		}
+		server.TLSConfig = reloader.TLSConfig()
+		if cfg.TLS.ReloadInterval > 0 {
+			go reloader.Run(ctx, cfg.TLS.ReloadInterval)
+		}
 	}
 
-	log.Printf("Server starting on port %s...\n", port)
+	// 请求的 context 派生自 requestCtx，关闭超时后取消它以中断仍未完成的上传
+	requestCtx, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
+	server.BaseContext = func(net.Listener) context.Context { return requestCtx }
 
 	// 启动服务器，并监听指定端口
-	if err := router.Run(":" + port); err != nil {
+	serverErr := make(chan error, 1)
+	go func() {
+		if server.TLSConfig != nil {
+			log.Printf("Server starting on %s with TLS...\n", addr)
+			serverErr <- server.ListenAndServeTLS("", "")
+			return
+		}
+		log.Printf("Server starting on %s...\n", addr)
+		serverErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serverErr:
 		log.Fatal("Failed to start server:", err)
+	case <-ctx.Done():
+	}
+	// 再次收到信号时直接退出
+	stop()
+
+	shutdown(server, checker, cancelRequests, cfg.Server.ShutdownDrainDelay, cfg.Server.ShutdownTimeout)
+
+	// 所有请求结束后关闭数据库连接池
+	if sqlDB, err := db.DB(); err == nil {
+		if err := sqlDB.Close(); err != nil {
+			log.Printf("Failed to close database: %v", err)
+		}
+	}
+	log.Println("Server stopped")
+}
+
+// shutdown marks the server as not ready, waits drainDelay for load balancers to
+// notice, then stops accepting connections and waits up to timeout for active
+// requests to finish. Requests still running after that are cancelled, which
+// removes the partial content of interrupted uploads.
+func shutdown(server *http.Server, checker *health.Checker, cancelRequests context.CancelFunc, drainDelay, timeout time.Duration) {
+	log.Println("Shutting down server...")
+	checker.Drain()
+	time.Sleep(drainDelay)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	err := server.Shutdown(ctx)
+	if err == nil {
+		return
+	}
+	log.Printf("Active requests did not finish within %s, cancelling them: %v", timeout, err)
+	cancelRequests()
+
+	// 给被取消的请求留出清理时间，之后强制关闭剩余连接
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		server.Close()
+	}
+}
+
+// newHTTPServer builds the HTTP server with the configured timeouts and header limits
+func newHTTPServer(cfg *config.Config, addr string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+		MaxHeaderBytes:    cfg.Server.MaxHeaderBytes,
 	}
 }
 
-func initializeRoutes(router *gin.Engine, db *gorm.DB) {
+func initializeRoutes(ctx context.Context, cfg *config.Config, router *gin.Engine, db *gorm.DB, migrator *migrate.Migrator) (*health.Checker, error) {
 
 	// 初始化服务层和处理器
-	authService := service.NewAuthService(db)
-	userService := service.NewUserService(db)
-	bucketService := service.NewBucketService(db)
-	fileService := service.NewFileService(db, bucketService)
+	passwordPolicy, err := newPasswordPolicy(cfg)
+	if err != nil {
+		return nil, err
+	}
+	authConfig := service.AuthConfig{
+		RegistrationMode: cfg.Auth.RegistrationMode,
+		PasswordPolicy:   passwordPolicy,
+		PasswordResetTTL: cfg.Auth.PasswordResetTTL,
+		// mTLS：客户端证书中的用户名（CN 或邮箱）映射到已有的活跃用户
+		ClientCertField: cfg.TLS.ClientCertUsername,
+	}
+
+	// LDAP 认证，仅在配置了 ldap.url 时启用；目录中不存在的用户仍使用本地密码
+	if cfg.LDAP.URL != "" {
+		directory, err := service.NewLDAPDirectory(service.LDAPConfig{
+			URL:                cfg.LDAP.URL,
+			StartTLS:           cfg.LDAP.StartTLS,
+			InsecureSkipVerify: cfg.LDAP.InsecureSkipVerify,
+			BindDN:             cfg.LDAP.BindDN,
+			BindPassword:       cfg.LDAP.BindPassword,
+			BaseDN:             cfg.LDAP.BaseDN,
+			UserFilter:         cfg.LDAP.UserFilter,
+			UsernameAttribute:  cfg.LDAP.UsernameAttribute,
+			GroupAttribute:     cfg.LDAP.GroupAttribute,
+			DisabledFilter:     cfg.LDAP.DisabledFilter,
+			AllowedGroups:      cfg.LDAP.AllowedGroups,
+			RootGroups:         cfg.LDAP.RootGroups,
+		})
+		if err != nil {
+			return nil, err
+		}
+		authConfig.Directory = directory
+		authConfig.DirectoryProvision = cfg.LDAP.Provision
+	}
+
+	// 审计日志：登录、权限变更、上传、删除等安全相关操作写入 audit_events 表
+	auditService := service.NewAuditService(db)
+	authService := service.NewAuthService(db, newLoginGuard(cfg, db, auditService), auditService, authConfig)
+
+	// 定期将目录中已删除或禁用的账户同步为 inactive
+	if authConfig.Directory != nil {
+		go authService.RunDirectorySync(ctx, cfg.LDAP.SyncInterval)
+	}
+	authorizer, err := authz.New(db, authz.Config{
+		DefaultGrants: cfg.Authz.DefaultGrants,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	userService := service.NewUserService(db, authorizer)
+	bucketService := service.NewBucketService(db, authorizer, auditService)
+	quotaService := service.NewQuotaService(db, authorizer, newQuotaConfig(cfg))
+	fileConfig := service.DefaultFileConfig()
+	fileConfig.MaxUploadBytes = cfg.Upload.MaxBytes
+	fileService := service.NewFileService(db, bucketService, quotaService, authorizer, auditService, fileConfig)
+
+	// 清理上次异常退出时遗留的未完成上传
+	if removed, err := fileService.RemovePartialUploads(); err != nil {
+		log.Printf("Failed to remove partial uploads: %v", err)
+	} else if removed > 0 {
+		log.Printf("Removed %d partial uploads", removed)
+	}
+	// 早期版本按桶名存放文件内容，现改为按桶 ID 存放，重命名桶时无需移动内容
+	if moved, err := fileService.MoveLegacyBucketDirs(ctx); err != nil {
+		return nil, err
+	} else if moved > 0 {
+		log.Printf("Moved the content of %d buckets to directories named by bucket ID", moved)
+	}
+	groupService := service.NewGroupService(db, authorizer)
+	lifecycleService := service.NewLifecycleService(db, authorizer, fileService, auditService)
+
+	// 定期清理已过期的桶授权
+	go bucketService.RunPermissionSweeper(ctx, cfg.Authz.PermissionSweepInterval)
+
+	// 定期采样每个桶的文件数和存储用量，供 /metrics 导出；metrics.storage_interval=0 时禁用
+	if cfg.Metrics.Enabled && cfg.Metrics.StorageInterval > 0 {
+		go bucketService.RunStorageSampler(ctx, cfg.Metrics.StorageInterval)
+	}
+	invitationService := service.NewInvitationService(db)
+
+	// 定期执行桶生命周期规则，lifecycle.interval=0 时禁用
+	if cfg.Lifecycle.Interval > 0 {
+		go lifecycleService.RunScheduler(ctx, cfg.Lifecycle.Interval)
+	}
+
+	// 初始化 root 账户：使用 auth.root_password_hash，或在日志中输出一次性 setup token
+	if err := authService.BootstrapRoot(cfg.Auth.RootPasswordHash); err != nil {
+		return nil, err
+	}
 
 	// 初始化处理器
-	authHandler := handler.NewAuthHandler(authService)
-	userHandler := handler.NewUserHandler(userService)
-	bucketHandler := handler.NewBucketHandler(bucketService)
-	fileHandler := handler.NewFileHandler(fileService)
+	authHandler := handler.NewAuthHandler(authService, auditService)
+	userHandler := handler.NewUserHandler(userService, auditService)
+	bucketHandler := handler.NewBucketHandler(bucketService, auditService)
+	fileHandler := handler.NewFileHandler(fileService, auditService)
+	groupHandler := handler.NewGroupHandler(groupService, auditService)
+	quotaHandler := handler.NewQuotaHandler(quotaService, auditService)
+	lifecycleHandler := handler.NewLifecycleHandler(lifecycleService, auditService)
+	invitationHandler := handler.NewInvitationHandler(invitationService, auditService)
+	auditHandler := handler.NewAuditHandler(auditService)
 
 	// 配置 Swagger 路由
 	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
-	// 健康检查路由，用于检查服务是否正常
-	router.GET("/health", func(c *gin.Context) {
-		c.JSON(200, gin.H{
-			"status": "ok",
-		})
-	})
+	// 存活与就绪探针：/livez 只表示进程存活，/readyz 检查数据库、存储目录和迁移版本，
+	// 任一检查失败或服务正在停止时返回 503。/health 保留为 /livez 的别名
+	checker := newHealthChecker(cfg, db, migrator, fileService.StoragePath())
+	healthHandler := handler.NewHealthHandler(checker)
+	router.GET("/livez", healthHandler.Livez)
+	router.GET("/readyz", healthHandler.Readyz)
+	router.GET("/health", healthHandler.Livez)
 
 	// 定义路由组，用于分组管理路由，所有v1版本的路由都以/api/v1开头
 	v1 := router.Group("/api/v1")
@@ -123,10 +372,45 @@ func initializeRoutes(router *gin.Engine, db *gorm.DB) {
 		auth.POST("/register", authHandler.Register)
 		// 当路由为 /api/v1/auth/login 时，会调用 authHandler.Login 方法处理请求
 		auth.POST("/login", authHandler.Login)
+		// 首次启动时使用一次性 setup token 设置 root 密码
+		auth.POST("/setup", authHandler.Setup)
+		// 使用 root 签发的一次性重置 token 重置密码
+		auth.POST("/password-reset", authHandler.ResetPassword)
+	}
+
+	// OIDC 单点登录，仅在配置了 oidc.issuer_url 时启用
+	if cfg.OIDC.IssuerURL != "" {
+		oidcService, err := service.NewOIDCService(context.Background(), authService, service.OIDCConfig{
+			IssuerURL:     cfg.OIDC.IssuerURL,
+			ClientID:      cfg.OIDC.ClientID,
+			ClientSecret:  cfg.OIDC.ClientSecret,
+			RedirectURL:   cfg.OIDC.RedirectURL,
+			Scopes:        cfg.OIDC.Scopes,
+			UsernameClaim: cfg.OIDC.UsernameClaim,
+			GroupsClaim:   cfg.OIDC.GroupsClaim,
+			AllowedGroups: cfg.OIDC.AllowedGroups,
+			RootGroups:    cfg.OIDC.RootGroups,
+			Provision:     cfg.OIDC.Provision,
+		})
+		if err != nil {
+			return nil, err
+		}
+		oidcHandler := handler.NewOIDCHandler(oidcService, auditService)
+		auth.GET("/oidc/login", oidcHandler.Login)
+		auth.GET("/oidc/callback", oidcHandler.Callback)
 	}
 
 	// 受保护的路由，需要认证才能访问
+	// 启用 tls.client_cert_auth 后，携带已验证客户端证书且没有 Authorization 头的请求以证书对应的用户身份访问
+	if cfg.TLS.ClientCertAuth {
+		v1.Use(middleware.ClientCertAuth(authService.AuthenticateCertificate))
+	}
 	v1.Use(middleware.AuthMiddleware())
+
+	// 强制修改密码时签发的 token 只能访问修改密码接口，因此该路由注册在 PasswordChangeEnforced 之前
+	v1.POST("/users/change-password", authHandler.ChangePassword)
+
+	v1.Use(middleware.PasswordChangeEnforced())
 	{
 		// 用户管理路由组
 		users := v1.Group("/users")
@@ -135,14 +419,24 @@ func initializeRoutes(router *gin.Engine, db *gorm.DB) {
 			users.GET("", userHandler.ListUsers)
 			users.GET("/:id", userHandler.GetUser)
 
-			// 个人信息路由
-			users.POST("/change-password", authHandler.ChangePassword)
+			// 权限由 authz 在服务层统一检查（root、user_permissions 授权或本人）
+			users.PUT("/:id", userHandler.UpdateUser)
+			users.DELETE("/:id", userHandler.DeleteUser)
+			users.PUT("/:id/status", userHandler.UpdateUserStatus)
+			users.PUT("/:id/permissions", userHandler.UpdateUserPermissions)
+			users.GET("/:id/usage", quotaHandler.GetUserUsage)
+		}
 
-			// 管理员权限路由
-			users.PUT("/:id", middleware.RootRequired(), userHandler.UpdateUser)
-			users.DELETE("/:id", middleware.RootRequired(), userHandler.DeleteUser)
-			users.PUT("/:id/status", middleware.RootRequired(), userHandler.UpdateUserStatus)
-			users.PUT("/:id/permissions", middleware.RootRequired(), userHandler.UpdateUserPermissions)
+		// 用户组管理路由组，组可以被授予桶权限
+		groups := v1.Group("/groups")
+		{
+			groups.POST("", groupHandler.CreateGroup)
+			groups.GET("", groupHandler.ListGroups)
+			groups.GET("/:id", groupHandler.GetGroup)
+			groups.PUT("/:id", groupHandler.UpdateGroup)
+			groups.DELETE("/:id", groupHandler.DeleteGroup)
+			groups.POST("/:id/members", groupHandler.AddGroupMember)
+			groups.DELETE("/:id/members/:user_id", groupHandler.RemoveGroupMember)
 		}
 
 		// 文件管理路由组
@@ -152,9 +446,15 @@ func initializeRoutes(router *gin.Engine, db *gorm.DB) {
 			files.POST("", fileHandler.CreateFile)
 			files.GET("/bucket/:bucket_id", fileHandler.ListFiles)
 			files.GET("/:id", fileHandler.GetFile)
+			files.GET("/:id/content", fileHandler.DownloadFile)
 			files.DELETE("/:id", fileHandler.DeleteFile)
+			files.PUT("/:id/retention", fileHandler.SetFileRetention)
+			files.PUT("/:id/legal-hold", fileHandler.SetFileLegalHold)
 		}
 
+		// 即将过期的桶授权：root 和全局桶管理员可见全部，其他用户只能看到自己管理的桶
+		v1.GET("/bucket-permissions/expiring", bucketHandler.ListExpiringPermissions)
+
 		// 桶管理路由组
 		buckets := v1.Group("/buckets")
 		{
@@ -164,16 +464,149 @@ func initializeRoutes(router *gin.Engine, db *gorm.DB) {
 			buckets.PUT("/:id", bucketHandler.UpdateBucket)
 			buckets.DELETE("/:id", bucketHandler.DeleteBucket)
 
+			// 桶权限：整体替换需要携带 If-Match 版本号，单个授权/撤销和所有权转移可选
+			buckets.GET("/:id/permissions", bucketHandler.ListBucketPermissions)
 			buckets.PUT("/:id/permissions", bucketHandler.UpdateBucketPermissions)
+			buckets.POST("/:id/permissions", bucketHandler.GrantBucketPermission)
+			buckets.DELETE("/:id/permissions/users/:user_id", bucketHandler.RevokeUserBucketPermission)
+			buckets.DELETE("/:id/permissions/groups/:group_id", bucketHandler.RevokeGroupBucketPermission)
+			buckets.PUT("/:id/owner", bucketHandler.TransferBucketOwnership)
+
+			// 桶内按路径前缀的允许/拒绝规则，最长匹配前缀优先
+			buckets.GET("/:id/path-rules", bucketHandler.ListPathRules)
+			buckets.POST("/:id/path-rules", bucketHandler.CreatePathRule)
+			buckets.DELETE("/:id/path-rules/:rule_id", bucketHandler.DeletePathRule)
 
 			buckets.GET("/:id/stats", bucketHandler.GetBucketStats)
+			buckets.GET("/:id/usage", quotaHandler.GetBucketUsage)
+			buckets.PUT("/:id/upload-policy", bucketHandler.UpdateUploadPolicy)
+			buckets.PUT("/:id/object-lock", bucketHandler.UpdateObjectLock)
+
+			// 桶生命周期规则：按时间过期、保留最近 N 个版本、清理未完成的上传
+			buckets.GET("/:id/lifecycle-rules", lifecycleHandler.ListRules)
+			buckets.POST("/:id/lifecycle-rules", lifecycleHandler.CreateRule)
+			buckets.PUT("/:id/lifecycle-rules/:rule_id", lifecycleHandler.UpdateRule)
+			buckets.DELETE("/:id/lifecycle-rules/:rule_id", lifecycleHandler.DeleteRule)
+			buckets.GET("/:id/lifecycle/dry-run", lifecycleHandler.DryRun)
 		}
 
 		// 管理员权限路由组
 		admin := v1.Group("/admin")
 		admin.Use(middleware.RootRequired())
 		{
-			// TODO: Add admin routes
+			admin.POST("/users", authHandler.CreateUser)
+			admin.POST("/users/:id/password-reset", authHandler.IssuePasswordReset)
+			admin.POST("/invitations", invitationHandler.CreateInvitation)
+			admin.GET("/invitations", invitationHandler.ListInvitations)
+			admin.DELETE("/invitations/:id", invitationHandler.RevokeInvitation)
+			admin.POST("/login-lockouts/unlock", authHandler.Unlock)
+			admin.GET("/quotas", quotaHandler.ListQuotas)
+			admin.PUT("/quotas/:scope/:id", quotaHandler.SetQuota)
+			admin.DELETE("/quotas/:scope/:id", quotaHandler.DeleteQuota)
+			admin.GET("/lifecycle/dry-run", lifecycleHandler.DryRunAll)
+			admin.GET("/audit-events", auditHandler.ListEvents)
+			admin.GET("/audit-events/export", auditHandler.ExportEvents)
+		}
+	}
+
+	return checker, nil
+}
+
+// newHealthChecker builds the readiness checks of the database, the storage
+// directory and the schema version
+func newHealthChecker(cfg *config.Config, db *gorm.DB, migrator *migrate.Migrator, storagePath string) *health.Checker {
+	checker := health.NewChecker(cfg.Health.CheckTimeout)
+	if sqlDB, err := db.DB(); err == nil {
+		checker.Add("database", health.DatabaseCheck(sqlDB))
+	}
+	checker.Add("migrations", migrator.Check)
+	checker.Add("storage_writable", health.WritableCheck(storagePath))
+	checker.Add("storage_free_space", health.FreeSpaceCheck(storagePath, uint64(cfg.Health.MinFreeBytes)))
+	return checker
+}
+
+// newTLSConfig builds the TLS configuration
+func newTLSConfig(cfg *config.Config) tlsconfig.Config {
+	return tlsconfig.Config{
+		CertFile:     cfg.TLS.CertFile,
+		KeyFile:      cfg.TLS.KeyFile,
+		MinVersion:   cfg.TLS.MinVersion,
+		CipherSuites: cfg.TLS.CipherSuites,
+		ClientCAFile: cfg.TLS.ClientCAFile,
+		ClientAuth:   cfg.TLS.ClientAuth,
+	}
+}
+
+// newTracingConfig builds the tracing configuration
+func newTracingConfig(cfg *config.Config) tracing.Config {
+	return tracing.Config{
+		Exporter:    cfg.Tracing.Exporter,
+		FilePath:    cfg.Tracing.File,
+		ServiceName: cfg.Tracing.ServiceName,
+		SampleRatio: cfg.Tracing.SampleRatio,
+	}
+}
+
+// newLoggerConfig builds the request logger configuration
+func newLoggerConfig(cfg *config.Config, logger *slog.Logger) middleware.LoggerConfig {
+	loggerConfig := middleware.DefaultLoggerConfig()
+	loggerConfig.Logger = logger
+	loggerConfig.LogBodies = cfg.Log.Bodies
+	loggerConfig.MaxBodyBytes = cfg.Log.BodyMaxBytes
+	loggerConfig.RedactFields = append(loggerConfig.RedactFields, cfg.Log.RedactFields...)
+	return loggerConfig
+}
+
+// newQuotaConfig builds the default quotas
+func newQuotaConfig(cfg *config.Config) service.QuotaConfig {
+	return service.QuotaConfig{
+		UserMaxBytes:   cfg.Quota.UserMaxBytes,
+		UserMaxFiles:   cfg.Quota.UserMaxFiles,
+		BucketMaxBytes: cfg.Quota.BucketMaxBytes,
+		BucketMaxFiles: cfg.Quota.BucketMaxFiles,
+		WarnPercent:    cfg.Quota.WarnPercent,
+	}
+}
+
+// newLoginGuard builds the login brute-force guard
+func newLoginGuard(cfg *config.Config, db *gorm.DB, auditService *service.AuditService) *service.LoginGuard {
+	guardConfig := service.LoginGuardConfig{
+		MaxUserFailures: cfg.Login.MaxUserFailures,
+		MaxIPFailures:   cfg.Login.MaxIPFailures,
+		BaseDelay:       cfg.Login.BackoffBase,
+		MaxDelay:        cfg.Login.BackoffMax,
+		LockoutDuration: cfg.Login.LockoutDuration,
+	}
+
+	// 失败登录计数的存储方式：memory（默认，单实例）或 database（多实例共享）
+	var store service.LoginAttemptStore
+	if cfg.Login.AttemptStore == "database" {
+		store = service.NewDBAttemptStore(db)
+	} else {
+		// 超过锁定时长（且不短于最大退避时间）没有新的失败即清除计数，避免内存无限增长
+		maxAge := cfg.Login.LockoutDuration
+		if cfg.Login.BackoffMax > maxAge {
+			maxAge = cfg.Login.BackoffMax
+		}
+		store = service.NewMemoryAttemptStore(maxAge)
+	}
+
+	return service.NewLoginGuard(store, auditService, guardConfig)
+}
+
+// newPasswordPolicy builds the password policy
+func newPasswordPolicy(cfg *config.Config) (*util.PasswordPolicy, error) {
+	policy := util.DefaultPasswordPolicy()
+	policy.MinLength = cfg.Password.MinLength
+	policy.RequireUpper = cfg.Password.RequireUpper
+	policy.RequireLower = cfg.Password.RequireLower
+	policy.RequireDigit = cfg.Password.RequireDigit
+	policy.RequireSymbol = cfg.Password.RequireSymbol
+
+	if cfg.Password.BreachedList != "" {
+		if err := policy.LoadBreachedPasswords(cfg.Password.BreachedList); err != nil {
+			return nil, err
 		}
 	}
+	return policy, nil
 }
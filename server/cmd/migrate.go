@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/minorcell/pfss/internal/migrate"
+)
+
+const migrateUsage = "usage: pfss migrate up|down|status [flags]"
+
+// runMigrate implements `pfss migrate`: up applies the pending migrations,
+// down reverts the newest applied one and status lists them. It returns the
+// exit code.
+func runMigrate(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+	command := args[0]
+	if command != "up" && command != "down" && command != "status" {
+		fmt.Fprintf(os.Stderr, "unknown migrate command %q\n%s\n", command, migrateUsage)
+		return 2
+	}
+
+	cfg, err := loadConfig("pfss migrate "+command, args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	db, err := openDatabase(cfg.Database)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to connect to database:", err)
+		return 1
+	}
+	if sqlDB, err := db.DB(); err == nil {
+		defer sqlDB.Close()
+	}
+	migrator, err := migrate.New(db, cfg.Database.MigrationLockTimeout)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	switch command {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		for _, m := range applied {
+			fmt.Printf("Applied migration %d %s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if len(applied) == 0 {
+			fmt.Printf("Database schema is up to date at version %d\n", migrator.Latest())
+		}
+	case "down":
+		reverted, err := migrator.Down(ctx)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if reverted == nil {
+			fmt.Println("No migration is applied")
+		} else {
+			fmt.Printf("Reverted migration %d %s\n", reverted.Version, reverted.Name)
+		}
+	case "status":
+		states, err := migrator.Status(ctx)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+		for _, state := range states {
+			applied := "pending"
+			if !state.AppliedAt.IsZero() {
+				applied = state.AppliedAt.Local().Format(time.RFC3339)
+			}
+			if state.Unknown {
+				applied += " (unknown to this build)"
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", state.Version, state.Name, applied)
+		}
+		w.Flush()
+	}
+	return 0
+}
@@ -0,0 +1,319 @@
+// Package authz is the central authorization layer. It combines the root flag,
+// global user permission grants, bucket permission levels and path rules inside
+// buckets to decide whether a user may perform an action on a resource.
+package authz
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/minorcell/pfss/internal/model"
+	"gorm.io/gorm"
+)
+
+// Actions
+const (
+	ActionRead   = "read"
+	ActionWrite  = "write"
+	ActionCreate = "create"
+	ActionDelete = "delete"
+	ActionAdmin  = "admin"
+	// ActionBypassGovernance lets a user delete or change files under governance
+	// retention. It is only granted globally, never through bucket access.
+	ActionBypassGovernance = "bypass_governance"
+)
+
+// Resource kinds
+const (
+	KindBucket = "bucket"
+	KindFile   = "file"
+	KindUser   = "user"
+	KindGroup  = "group"
+)
+
+// Bucket access levels, in increasing order of privilege
+const (
+	AccessRead  = "read"
+	AccessWrite = "write"
+	AccessAdmin = "admin"
+)
+
+var (
+	// ErrPermissionDenied is wrapped by every error returned from Require
+	ErrPermissionDenied = errors.New("permission denied")
+	// ErrNoBucketAccess is returned when a user has no permission on a bucket
+	ErrNoBucketAccess = errors.New("permission not found")
+)
+
+// Subject is the user an authorization decision is made for
+type Subject struct {
+	UserID uint
+	IsRoot bool
+}
+
+// Resource identifies what an action is performed on. A zero ID refers to the
+// whole collection of the kind, e.g. creating a bucket or listing users.
+// Path is the path of a file inside its bucket and is checked against the
+// bucket's path rules when set.
+type Resource struct {
+	Kind     string
+	ID       uint
+	BucketID uint
+	Path     string
+}
+
+// Bucket returns the resource of a single bucket
+func Bucket(id uint) Resource {
+	return Resource{Kind: KindBucket, ID: id, BucketID: id}
+}
+
+// Buckets returns the resource of the bucket collection
+func Buckets() Resource {
+	return Resource{Kind: KindBucket}
+}
+
+// File returns the resource of a file, or of all files in a bucket if id is 0
+func File(bucketID, id uint) Resource {
+	return Resource{Kind: KindFile, ID: id, BucketID: bucketID}
+}
+
+// FileAt returns the resource of a file at path, or of a file to be created at path if id is 0
+func FileAt(bucketID, id uint, path string) Resource {
+	return Resource{Kind: KindFile, ID: id, BucketID: bucketID, Path: path}
+}
+
+// User returns the resource of a single user
+func User(id uint) Resource {
+	return Resource{Kind: KindUser, ID: id}
+}
+
+// Users returns the resource of the user collection
+func Users() Resource {
+	return Resource{Kind: KindUser}
+}
+
+// Group returns the resource of a single group
+func Group(id uint) Resource {
+	return Resource{Kind: KindGroup, ID: id}
+}
+
+// Groups returns the resource of the group collection
+func Groups() Resource {
+	return Resource{Kind: KindGroup}
+}
+
+// Config configures the authorizer
+type Config struct {
+	// DefaultGrants are global grants every user has, as "resource:action"
+	DefaultGrants []string
+}
+
+// Authorizer decides whether subjects may perform actions on resources
+type Authorizer struct {
+	db            *gorm.DB
+	defaultGrants []model.UserPermission
+}
+
+// New creates a new authorizer
+func New(db *gorm.DB, config Config) (*Authorizer, error) {
+	a := &Authorizer{db: db}
+	for _, grant := range config.DefaultGrants {
+		resource, action, ok := strings.Cut(grant, ":")
+		if !ok || resource == "" || action == "" {
+			return nil, fmt.Errorf("invalid default grant %q, expected resource:action", grant)
+		}
+		a.defaultGrants = append(a.defaultGrants, model.UserPermission{Resource: resource, Action: action})
+	}
+	return a, nil
+}
+
+// Can reports whether sub may perform action on res
+func (a *Authorizer) Can(ctx context.Context, sub Subject, action string, res Resource) (bool, error) {
+	if sub.IsRoot {
+		return true, nil
+	}
+
+	granted, err := a.hasGlobalGrant(ctx, sub.UserID, action, res.Kind)
+	if err != nil || granted {
+		return granted, err
+	}
+
+	switch res.Kind {
+	case KindUser:
+		// Users may view and manage their own account, but not administer it
+		return res.ID != 0 && res.ID == sub.UserID && action != ActionAdmin, nil
+	case KindBucket, KindFile:
+		if res.BucketID == 0 {
+			return false, nil
+		}
+		level, err := a.BucketAccess(ctx, res.BucketID, sub.UserID)
+		if err != nil {
+			return false, err
+		}
+		required := requiredAccess(res.Kind, action)
+		if res.Kind == KindFile && res.Path != "" {
+			// Path rules match by prefix, so an alias like //secret/a would
+			// escape a rule on /secret/; only canonical paths are decided
+			if path.Clean(res.Path) != res.Path {
+				return false, nil
+			}
+			return a.canAccessPath(ctx, res.BucketID, sub.UserID, level, res.Path, required)
+		}
+		return accessRank(level) >= accessRank(required), nil
+	}
+
+	return false, nil
+}
+
+// Require returns an error wrapping ErrPermissionDenied unless sub may perform action on res
+func (a *Authorizer) Require(ctx context.Context, sub Subject, action string, res Resource) error {
+	ok, err := a.Can(ctx, sub, action, res)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%w: requires %s access to %s", ErrPermissionDenied, action, res.Kind)
+	}
+	return nil
+}
+
+// HasGlobalGrant reports whether sub may perform action on every resource of kind,
+// e.g. to list all buckets rather than only those with a bucket permission
+func (a *Authorizer) HasGlobalGrant(ctx context.Context, sub Subject, action, kind string) (bool, error) {
+	if sub.IsRoot {
+		return true, nil
+	}
+	return a.hasGlobalGrant(ctx, sub.UserID, action, kind)
+}
+
+// BucketPermission returns the permission record that grants userID access to
+// bucketID, or an error if the user has no access. Both grants to the user and
+// grants to groups the user belongs to count; the most privileged one is
+// returned. Grants that have not started yet or have expired are ignored.
+func (a *Authorizer) BucketPermission(ctx context.Context, bucketID, userID uint) (*model.BucketPermission, error) {
+	var perms []model.BucketPermission
+	err := a.db.WithContext(ctx).Scopes(model.ActiveBucketPermissions(time.Now())).
+		Where("bucket_id = ?", bucketID).
+		Where("user_id = ? OR group_id IN (?)", userID,
+			a.db.Model(&model.GroupMember{}).Select("group_id").Where("user_id = ?", userID)).
+		Find(&perms).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(perms) == 0 {
+		return nil, ErrNoBucketAccess
+	}
+
+	best := &perms[0]
+	for i := range perms {
+		if accessRank(perms[i].Access) > accessRank(best.Access) {
+			best = &perms[i]
+		}
+	}
+	return best, nil
+}
+
+// AccessibleBuckets returns a subquery selecting the IDs of buckets userID has
+// an active user or group grant on
+func (a *Authorizer) AccessibleBuckets(ctx context.Context, userID uint) *gorm.DB {
+	return a.db.WithContext(ctx).Model(&model.BucketPermission{}).
+		Scopes(model.ActiveBucketPermissions(time.Now())).
+		Select("bucket_id").
+		Where("user_id = ? OR group_id IN (?)", userID,
+			a.db.Model(&model.GroupMember{}).Select("group_id").Where("user_id = ?", userID))
+}
+
+// AdministeredBuckets returns a subquery selecting the IDs of the buckets
+// userID has admin access to, directly or through a group
+func (a *Authorizer) AdministeredBuckets(ctx context.Context, userID uint) *gorm.DB {
+	return a.AccessibleBuckets(ctx, userID).Where("access = ?", AccessAdmin)
+}
+
+// BucketAccess returns the access level of userID on bucketID, or "" if none
+func (a *Authorizer) BucketAccess(ctx context.Context, bucketID, userID uint) (string, error) {
+	perm, err := a.BucketPermission(ctx, bucketID, userID)
+	if err != nil {
+		if errors.Is(err, ErrNoBucketAccess) {
+			return "", nil
+		}
+		return "", err
+	}
+	return perm.Access, nil
+}
+
+// hasGlobalGrant checks the default grants and the user's permission grants.
+// An admin grant on a resource kind implies every action on it.
+func (a *Authorizer) hasGlobalGrant(ctx context.Context, userID uint, action, kind string) (bool, error) {
+	for _, grant := range a.defaultGrants {
+		if grantMatches(grant, action, kind) {
+			return true, nil
+		}
+	}
+
+	var grants []model.UserPermission
+	if err := a.db.WithContext(ctx).Where("user_id = ? AND resource = ?", userID, kind).Find(&grants).Error; err != nil {
+		return false, err
+	}
+	for _, grant := range grants {
+		if grantMatches(grant, action, kind) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ValidGrant reports whether resource:action is a global grant the authorizer
+// understands. Governance bypass only applies to files.
+func ValidGrant(resource, action string) bool {
+	switch resource {
+	case KindBucket, KindFile, KindUser, KindGroup:
+	default:
+		return false
+	}
+	switch action {
+	case ActionRead, ActionWrite, ActionCreate, ActionDelete, ActionAdmin:
+		return true
+	case ActionBypassGovernance:
+		return resource == KindFile
+	}
+	return false
+}
+
+// grantMatches reports whether grant allows action on kind
+func grantMatches(grant model.UserPermission, action, kind string) bool {
+	return grant.Resource == kind && (grant.Action == action || grant.Action == ActionAdmin)
+}
+
+// requiredAccess maps an action on a bucket or file onto the bucket access level it requires
+func requiredAccess(kind, action string) string {
+	switch action {
+	case ActionRead:
+		return AccessRead
+	case ActionWrite, ActionCreate:
+		return AccessWrite
+	case ActionDelete:
+		// Deleting files is a write, deleting the bucket itself is administrative
+		if kind == KindFile {
+			return AccessWrite
+		}
+		return AccessAdmin
+	}
+	return AccessAdmin
+}
+
+// accessRank orders access levels; unknown levels rank lowest
+func accessRank(access string) int {
+	switch access {
+	case AccessRead:
+		return 1
+	case AccessWrite:
+		return 2
+	case AccessAdmin:
+		return 3
+	}
+	return 0
+}
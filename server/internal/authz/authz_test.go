@@ -0,0 +1,237 @@
+package authz
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/minorcell/pfss/internal/migrate"
+	"github.com/minorcell/pfss/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// openTestDB returns a migrated SQLite database in a temporary directory
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := "file:" + filepath.Join(t.TempDir(), "pfss.db") + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	migrator, err := migrate.New(db, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// create inserts records into db
+func create(t *testing.T, db *gorm.DB, records ...interface{}) {
+	t.Helper()
+	for _, record := range records {
+		if err := db.Create(record).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCan(t *testing.T) {
+	db := openTestDB(t)
+	a, err := New(db, Config{DefaultGrants: []string{"group:read"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const (
+		alice   = 1 // reads bucket 1
+		bob     = 2 // writes bucket 1 through a group
+		carol   = 3 // administers users globally
+		dave    = 4 // had write access to bucket 1, but it expired
+		bucket  = 1
+		another = 2
+	)
+	past := time.Now().Add(-time.Hour)
+	create(t, db,
+		&model.Group{ID: 1, Name: "writers", CreatedBy: carol},
+		&model.GroupMember{GroupID: 1, UserID: bob},
+		&model.BucketPermission{BucketID: bucket, UserID: alice, Access: AccessRead},
+		&model.BucketPermission{BucketID: bucket, GroupID: 1, Access: AccessWrite},
+		&model.BucketPermission{BucketID: bucket, UserID: dave, Access: AccessWrite, ExpiresAt: &past},
+		&model.UserPermission{UserID: carol, Resource: KindUser, Action: ActionAdmin},
+	)
+
+	tests := []struct {
+		name   string
+		sub    Subject
+		action string
+		res    Resource
+		want   bool
+	}{
+		{"root may do anything", Subject{UserID: 99, IsRoot: true}, ActionDelete, Bucket(another), true},
+		{"reader reads files", Subject{UserID: alice}, ActionRead, File(bucket, 0), true},
+		{"reader does not write files", Subject{UserID: alice}, ActionCreate, FileAt(bucket, 0, "/a.txt"), false},
+		{"reader has no access to other buckets", Subject{UserID: alice}, ActionRead, File(another, 0), false},
+		{"group writer writes files", Subject{UserID: bob}, ActionWrite, FileAt(bucket, 1, "/a.txt"), true},
+		{"group writer deletes files", Subject{UserID: bob}, ActionDelete, File(bucket, 1), true},
+		{"group writer does not delete the bucket", Subject{UserID: bob}, ActionDelete, Bucket(bucket), false},
+		{"expired grants are ignored", Subject{UserID: dave}, ActionRead, File(bucket, 0), false},
+		{"bucket access needs a bucket", Subject{UserID: alice}, ActionRead, Buckets(), false},
+		{"users view themselves", Subject{UserID: alice}, ActionWrite, User(alice), true},
+		{"users do not administer themselves", Subject{UserID: alice}, ActionAdmin, User(alice), false},
+		{"users do not view others", Subject{UserID: alice}, ActionRead, User(bob), false},
+		{"user admins manage users", Subject{UserID: carol}, ActionDelete, User(alice), true},
+		{"user admins list users", Subject{UserID: carol}, ActionRead, Users(), true},
+		{"user admins do not manage buckets", Subject{UserID: carol}, ActionRead, Bucket(bucket), false},
+		{"default grants apply to everyone", Subject{UserID: dave}, ActionRead, Group(1), true},
+		{"default grants are limited to their action", Subject{UserID: dave}, ActionCreate, Groups(), false},
+	}
+	ctx := context.Background()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := a.Can(ctx, tt.sub, tt.action, tt.res)
+			if err != nil {
+				t.Fatalf("Can: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Can = %t, want %t", got, tt.want)
+			}
+
+			err = a.Require(ctx, tt.sub, tt.action, tt.res)
+			if tt.want && err != nil {
+				t.Errorf("Require: %v", err)
+			}
+			if !tt.want && !errors.Is(err, ErrPermissionDenied) {
+				t.Errorf("Require = %v, want %v", err, ErrPermissionDenied)
+			}
+		})
+	}
+}
+
+func TestHasGlobalGrant(t *testing.T) {
+	db := openTestDB(t)
+	a, err := New(db, Config{DefaultGrants: []string{"bucket:read"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	create(t, db,
+		&model.UserPermission{UserID: 1, Resource: KindBucket, Action: ActionCreate},
+		&model.UserPermission{UserID: 2, Resource: KindFile, Action: ActionAdmin},
+	)
+
+	tests := []struct {
+		name   string
+		sub    Subject
+		action string
+		kind   string
+		want   bool
+	}{
+		{"root", Subject{UserID: 3, IsRoot: true}, ActionAdmin, KindUser, true},
+		{"own grant", Subject{UserID: 1}, ActionCreate, KindBucket, true},
+		{"other action", Subject{UserID: 1}, ActionDelete, KindBucket, false},
+		{"admin implies every action", Subject{UserID: 2}, ActionBypassGovernance, KindFile, true},
+		{"admin is limited to its kind", Subject{UserID: 2}, ActionRead, KindUser, false},
+		{"default grant", Subject{UserID: 3}, ActionRead, KindBucket, true},
+		{"no grant", Subject{UserID: 3}, ActionRead, KindFile, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := a.HasGlobalGrant(context.Background(), tt.sub, tt.action, tt.kind)
+			if err != nil {
+				t.Fatalf("HasGlobalGrant: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("HasGlobalGrant = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewRejectsInvalidDefaultGrants(t *testing.T) {
+	for _, grant := range []string{"bucket", ":read", "bucket:"} {
+		if _, err := New(nil, Config{DefaultGrants: []string{grant}}); err == nil {
+			t.Errorf("New accepted default grant %q", grant)
+		}
+	}
+}
+
+func TestPathRules(t *testing.T) {
+	db := openTestDB(t)
+	a, err := New(db, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const (
+		reader = 1
+		writer = 2
+		admin  = 3
+		bucket = 1
+	)
+	create(t, db,
+		&model.Group{ID: 1, Name: "writers", CreatedBy: admin},
+		&model.GroupMember{GroupID: 1, UserID: writer},
+		&model.BucketPermission{BucketID: bucket, UserID: reader, Access: AccessRead},
+		&model.BucketPermission{BucketID: bucket, UserID: writer, Access: AccessWrite},
+		&model.BucketPermission{BucketID: bucket, UserID: admin, Access: AccessAdmin},
+		// Nobody reads /secret/ except its public subdirectory
+		&model.BucketPathRule{BucketID: bucket, Prefix: "/secret/", Effect: EffectDeny, Access: AccessRead, CreatedBy: admin},
+		&model.BucketPathRule{BucketID: bucket, Prefix: "/secret/public/", Effect: EffectAllow, Access: AccessRead, CreatedBy: admin},
+		// The reader may write /inbox/, but not /inbox/sealed/
+		&model.BucketPathRule{BucketID: bucket, UserID: reader, Prefix: "/inbox/", Effect: EffectAllow, Access: AccessWrite, CreatedBy: admin},
+		&model.BucketPathRule{BucketID: bucket, UserID: reader, Prefix: "/inbox/sealed/", Effect: EffectDeny, Access: AccessWrite, CreatedBy: admin},
+		// On the same prefix deny beats allow
+		&model.BucketPathRule{BucketID: bucket, GroupID: 1, Prefix: "/shared/", Effect: EffectAllow, Access: AccessWrite, CreatedBy: admin},
+		&model.BucketPathRule{BucketID: bucket, UserID: writer, Prefix: "/shared/", Effect: EffectDeny, Access: AccessWrite, CreatedBy: admin},
+	)
+
+	tests := []struct {
+		name   string
+		userID uint
+		action string
+		path   string
+		want   bool
+	}{
+		{"no rule falls back to the bucket level", reader, ActionRead, "/a.txt", true},
+		{"no rule falls back to the bucket level for writes", reader, ActionCreate, "/a.txt", false},
+		{"deny rule", reader, ActionRead, "/secret/a.txt", false},
+		{"denying read denies write", writer, ActionWrite, "/secret/a.txt", false},
+		{"longer allow prefix wins over deny", reader, ActionRead, "/secret/public/a.txt", true},
+		{"allow rule raises the bucket level", reader, ActionCreate, "/inbox/a.txt", true},
+		{"allowing write allows read", reader, ActionRead, "/inbox/a.txt", true},
+		{"longer deny prefix wins over allow", reader, ActionCreate, "/inbox/sealed/a.txt", false},
+		{"denying write keeps read", reader, ActionRead, "/inbox/sealed/a.txt", true},
+		{"deny beats allow on the same prefix", writer, ActionWrite, "/shared/a.txt", false},
+		{"rules of other users do not apply", writer, ActionCreate, "/inbox/sealed/a.txt", true},
+		{"prefixes match whole directories", reader, ActionRead, "/secret.txt", true},
+		{"bucket admins ignore path rules", admin, ActionRead, "/secret/a.txt", true},
+		{"double slash alias", reader, ActionRead, "//secret/a.txt", false},
+		{"dot alias", reader, ActionRead, "/./secret/a.txt", false},
+		{"dot-dot alias", reader, ActionRead, "/public/../secret/a.txt", false},
+		{"aliases are refused even without a rule", reader, ActionRead, "//a.txt", false},
+	}
+	ctx := context.Background()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := a.Can(ctx, Subject{UserID: tt.userID}, tt.action, FileAt(bucket, 0, tt.path))
+			if err != nil {
+				t.Fatalf("Can: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Can(%s %s) = %t, want %t", tt.action, tt.path, got, tt.want)
+			}
+		})
+	}
+}
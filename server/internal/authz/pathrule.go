@@ -0,0 +1,125 @@
+package authz
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/minorcell/pfss/internal/model"
+	"gorm.io/gorm"
+)
+
+// Path rule effects
+const (
+	EffectAllow = "allow"
+	EffectDeny  = "deny"
+)
+
+// pathRules returns the path rules of bucketID that apply to userID, directly,
+// through one of the user's groups or because they apply to everyone. The rules
+// are ordered from the most to the least specific prefix, deny before allow.
+func (a *Authorizer) pathRules(ctx context.Context, bucketID, userID uint) ([]model.BucketPathRule, error) {
+	var rules []model.BucketPathRule
+	err := a.db.WithContext(ctx).Where("bucket_id = ?", bucketID).
+		Where("(user_id = 0 AND group_id = 0) OR user_id = ? OR group_id IN (?)", userID,
+			a.db.Model(&model.GroupMember{}).Select("group_id").Where("user_id = ?", userID)).
+		Find(&rules).Error
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(rules, func(i, j int) bool {
+		if len(rules[i].Prefix) != len(rules[j].Prefix) {
+			return len(rules[i].Prefix) > len(rules[j].Prefix)
+		}
+		return rules[i].Effect == EffectDeny && rules[j].Effect != EffectDeny
+	})
+	return rules, nil
+}
+
+// ruleApplies reports whether rule decides requests that need the given access
+// level. Allowing write also allows read; denying read also denies write.
+func ruleApplies(rule model.BucketPathRule, access string) bool {
+	if rule.Effect == EffectDeny {
+		return accessRank(rule.Access) <= accessRank(access)
+	}
+	return accessRank(rule.Access) >= accessRank(access)
+}
+
+// pathDecision returns the decision of the most specific rule matching path for
+// the given access level. matched is false when no rule matches.
+func pathDecision(rules []model.BucketPathRule, path, access string) (allowed, matched bool) {
+	for _, rule := range rules {
+		if ruleApplies(rule, access) && strings.HasPrefix(path, rule.Prefix) {
+			return rule.Effect == EffectAllow, true
+		}
+	}
+	return false, false
+}
+
+// canAccessPath decides access to a file path for a user whose bucket access
+// level is level. Bucket admins are not restricted by path rules; for everyone
+// else the most specific matching rule wins over the bucket access level.
+func (a *Authorizer) canAccessPath(ctx context.Context, bucketID, userID uint, level, path, required string) (bool, error) {
+	if level == "" || level == AccessAdmin {
+		return level == AccessAdmin, nil
+	}
+
+	rules, err := a.pathRules(ctx, bucketID, userID)
+	if err != nil {
+		return false, err
+	}
+	if allowed, matched := pathDecision(rules, path, required); matched {
+		return allowed, nil
+	}
+	return accessRank(level) >= accessRank(required), nil
+}
+
+// ReadableFiles returns a scope limiting a query on files of bucketID to those
+// sub may read according to the bucket's path rules. Callers must have checked
+// read access to the bucket's files first.
+func (a *Authorizer) ReadableFiles(ctx context.Context, sub Subject, bucketID uint) (func(db *gorm.DB) *gorm.DB, error) {
+	unrestricted := func(db *gorm.DB) *gorm.DB { return db }
+
+	if sub.IsRoot {
+		return unrestricted, nil
+	}
+	granted, err := a.hasGlobalGrant(ctx, sub.UserID, ActionRead, KindFile)
+	if err != nil || granted {
+		return unrestricted, err
+	}
+	level, err := a.BucketAccess(ctx, bucketID, sub.UserID)
+	if err != nil || level == AccessAdmin {
+		return unrestricted, err
+	}
+
+	rules, err := a.pathRules(ctx, bucketID, sub.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Translate the ordered rules into a CASE expression so the first matching
+	// prefix decides, just like pathDecision
+	var expr strings.Builder
+	var args []interface{}
+	for _, rule := range rules {
+		if !ruleApplies(rule, AccessRead) {
+			continue
+		}
+		decision := 0
+		if rule.Effect == EffectAllow {
+			decision = 1
+		}
+		expr.WriteString("WHEN SUBSTR(files.path, 1, ?) = ? THEN ? ")
+		args = append(args, utf8.RuneCountInString(rule.Prefix), rule.Prefix, decision)
+	}
+	if len(args) == 0 {
+		return unrestricted, nil
+	}
+	query := "CASE " + expr.String() + "ELSE 1 END = 1"
+
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where(query, args...)
+	}, nil
+}
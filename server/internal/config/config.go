@@ -0,0 +1,422 @@
+// Package config loads the server configuration from defaults, a YAML or
+// TOML file, environment variables and command line flags, in increasing
+// order of precedence
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/minorcell/pfss/internal/service"
+	"github.com/minorcell/pfss/pkg/middleware"
+	"github.com/minorcell/pfss/pkg/tlsconfig"
+	"github.com/minorcell/pfss/pkg/tracing"
+	"github.com/minorcell/pfss/pkg/util"
+)
+
+// Config is the configuration of the server. Each field is read from the file
+// key of its section and field names, from the environment variable in its env
+// tag, or from that variable with a _FILE suffix naming a file that holds the
+// value, and from the flag -<section>.<field>. Fields tagged secret are
+// redacted when the configuration is printed.
+type Config struct {
+	Server    ServerConfig    `key:"server"`
+	TLS       TLSConfig       `key:"tls"`
+	Database  DatabaseConfig  `key:"database"`
+	JWT       JWTConfig       `key:"jwt"`
+	Auth      AuthConfig      `key:"auth"`
+	Login     LoginConfig     `key:"login"`
+	Password  PasswordConfig  `key:"password"`
+	OIDC      OIDCConfig      `key:"oidc"`
+	LDAP      LDAPConfig      `key:"ldap"`
+	Authz     AuthzConfig     `key:"authz"`
+	Quota     QuotaConfig     `key:"quota"`
+	Upload    UploadConfig    `key:"upload"`
+	Lifecycle LifecycleConfig `key:"lifecycle"`
+	Log       LogConfig       `key:"log"`
+	Metrics   MetricsConfig   `key:"metrics"`
+	Tracing   TracingConfig   `key:"tracing"`
+	Health    HealthConfig    `key:"health"`
+}
+
+// ServerConfig configures the HTTP server
+type ServerConfig struct {
+	// Host is the address to listen on; empty listens on all interfaces
+	Host               string        `key:"host" env:"SERVER_HOST"`
+	Port               int           `key:"port" env:"SERVER_PORT"`
+	ReadHeaderTimeout  time.Duration `key:"read_header_timeout" env:"HTTP_READ_HEADER_TIMEOUT"`
+	ReadTimeout        time.Duration `key:"read_timeout" env:"HTTP_READ_TIMEOUT"`
+	WriteTimeout       time.Duration `key:"write_timeout" env:"HTTP_WRITE_TIMEOUT"`
+	IdleTimeout        time.Duration `key:"idle_timeout" env:"HTTP_IDLE_TIMEOUT"`
+	MaxHeaderBytes     int           `key:"max_header_bytes" env:"HTTP_MAX_HEADER_BYTES"`
+	ShutdownDrainDelay time.Duration `key:"shutdown_drain_delay" env:"SHUTDOWN_DRAIN_DELAY"`
+	ShutdownTimeout    time.Duration `key:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT"`
+}
+
+// TLSConfig configures HTTPS, which is enabled when CertFile is set
+type TLSConfig struct {
+	CertFile           string        `key:"cert_file" env:"TLS_CERT_FILE"`
+	KeyFile            string        `key:"key_file" env:"TLS_KEY_FILE"`
+	ReloadInterval     time.Duration `key:"reload_interval" env:"TLS_RELOAD_INTERVAL"`
+	MinVersion         string        `key:"min_version" env:"TLS_MIN_VERSION"`
+	CipherSuites       []string      `key:"cipher_suites" env:"TLS_CIPHER_SUITES"`
+	ClientCAFile       string        `key:"client_ca_file" env:"TLS_CLIENT_CA_FILE"`
+	ClientAuth         string        `key:"client_auth" env:"TLS_CLIENT_AUTH"`
+	ClientCertAuth     bool          `key:"client_cert_auth" env:"TLS_CLIENT_CERT_AUTH"`
+	ClientCertUsername string        `key:"client_cert_username" env:"TLS_CLIENT_CERT_USERNAME"`
+}
+
+// Database drivers
+const (
+	DriverMySQL    = "mysql"
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
+// DatabaseConfig configures the database connection
+type DatabaseConfig struct {
+	// Driver is one of mysql, postgres or sqlite
+	Driver string `key:"driver" env:"DB_DRIVER"`
+	// DSN is a driver specific connection string that replaces the other settings
+	DSN  string `key:"dsn" env:"DB_DSN" secret:"true"`
+	Host string `key:"host" env:"DB_HOST"`
+	// Port of the database server; 0 uses the driver's default port
+	Port     int    `key:"port" env:"DB_PORT"`
+	User     string `key:"user" env:"DB_USER"`
+	Password string `key:"password" env:"DB_PASSWORD" secret:"true"`
+	Name     string `key:"name" env:"DB_NAME"`
+	// SSLMode is the PostgreSQL sslmode, e.g. disable, require or verify-full
+	SSLMode string `key:"ssl_mode" env:"DB_SSL_MODE"`
+	// Path is the SQLite database file
+	Path string `key:"path" env:"DB_PATH"`
+	// AutoMigrate applies pending schema migrations at startup; otherwise the
+	// server refuses to start until `pfss migrate up` has run
+	AutoMigrate bool `key:"auto_migrate" env:"DB_AUTO_MIGRATE"`
+	// MigrationLockTimeout bounds the wait for migrations run by another process
+	MigrationLockTimeout time.Duration `key:"migration_lock_timeout" env:"DB_MIGRATION_LOCK_TIMEOUT"`
+}
+
+// JWTConfig configures the signing of access tokens
+type JWTConfig struct {
+	Secret     string        `key:"secret" env:"JWT_SECRET" secret:"true"`
+	Expiration time.Duration `key:"expiration" env:"JWT_EXPIRATION"`
+}
+
+// AuthConfig configures registration and the root account
+type AuthConfig struct {
+	RegistrationMode string        `key:"registration_mode" env:"REGISTRATION_MODE"`
+	RootPasswordHash string        `key:"root_password_hash" env:"ROOT_PASSWORD_HASH" secret:"true"`
+	PasswordResetTTL time.Duration `key:"password_reset_ttl" env:"PASSWORD_RESET_TTL"`
+}
+
+// LoginConfig configures the login brute-force protection
+type LoginConfig struct {
+	AttemptStore    string        `key:"attempt_store" env:"LOGIN_ATTEMPT_STORE"`
+	MaxUserFailures int           `key:"max_user_failures" env:"LOGIN_MAX_USER_FAILURES"`
+	MaxIPFailures   int           `key:"max_ip_failures" env:"LOGIN_MAX_IP_FAILURES"`
+	BackoffBase     time.Duration `key:"backoff_base" env:"LOGIN_BACKOFF_BASE"`
+	BackoffMax      time.Duration `key:"backoff_max" env:"LOGIN_BACKOFF_MAX"`
+	LockoutDuration time.Duration `key:"lockout_duration" env:"LOGIN_LOCKOUT_DURATION"`
+}
+
+// PasswordConfig configures the password policy
+type PasswordConfig struct {
+	MinLength     int    `key:"min_length" env:"PASSWORD_MIN_LENGTH"`
+	RequireUpper  bool   `key:"require_upper" env:"PASSWORD_REQUIRE_UPPER"`
+	RequireLower  bool   `key:"require_lower" env:"PASSWORD_REQUIRE_LOWER"`
+	RequireDigit  bool   `key:"require_digit" env:"PASSWORD_REQUIRE_DIGIT"`
+	RequireSymbol bool   `key:"require_symbol" env:"PASSWORD_REQUIRE_SYMBOL"`
+	BreachedList  string `key:"breached_list" env:"PASSWORD_BREACHED_LIST"`
+}
+
+// OIDCConfig configures OpenID Connect single sign-on, which is enabled when IssuerURL is set
+type OIDCConfig struct {
+	IssuerURL     string   `key:"issuer_url" env:"OIDC_ISSUER_URL"`
+	ClientID      string   `key:"client_id" env:"OIDC_CLIENT_ID"`
+	ClientSecret  string   `key:"client_secret" env:"OIDC_CLIENT_SECRET" secret:"true"`
+	RedirectURL   string   `key:"redirect_url" env:"OIDC_REDIRECT_URL"`
+	Scopes        []string `key:"scopes" env:"OIDC_SCOPES"`
+	UsernameClaim string   `key:"username_claim" env:"OIDC_USERNAME_CLAIM"`
+	GroupsClaim   string   `key:"groups_claim" env:"OIDC_GROUPS_CLAIM"`
+	AllowedGroups []string `key:"allowed_groups" env:"OIDC_ALLOWED_GROUPS"`
+	RootGroups    []string `key:"root_groups" env:"OIDC_ROOT_GROUPS"`
+	Provision     bool     `key:"provision" env:"OIDC_PROVISION"`
+}
+
+// LDAPConfig configures LDAP authentication, which is enabled when URL is set
+type LDAPConfig struct {
+	URL                string        `key:"url" env:"LDAP_URL"`
+	StartTLS           bool          `key:"start_tls" env:"LDAP_START_TLS"`
+	InsecureSkipVerify bool          `key:"insecure_skip_verify" env:"LDAP_INSECURE_SKIP_VERIFY"`
+	BindDN             string        `key:"bind_dn" env:"LDAP_BIND_DN"`
+	BindPassword       string        `key:"bind_password" env:"LDAP_BIND_PASSWORD" secret:"true"`
+	BaseDN             string        `key:"base_dn" env:"LDAP_BASE_DN"`
+	UserFilter         string        `key:"user_filter" env:"LDAP_USER_FILTER"`
+	UsernameAttribute  string        `key:"username_attribute" env:"LDAP_USERNAME_ATTRIBUTE"`
+	GroupAttribute     string        `key:"group_attribute" env:"LDAP_GROUP_ATTRIBUTE"`
+	DisabledFilter     string        `key:"disabled_filter" env:"LDAP_DISABLED_FILTER"`
+	AllowedGroups      []string      `key:"allowed_groups" env:"LDAP_ALLOWED_GROUPS"`
+	RootGroups         []string      `key:"root_groups" env:"LDAP_ROOT_GROUPS"`
+	Provision          bool          `key:"provision" env:"LDAP_PROVISION"`
+	SyncInterval       time.Duration `key:"sync_interval" env:"LDAP_SYNC_INTERVAL"`
+}
+
+// AuthzConfig configures authorization
+type AuthzConfig struct {
+	// DefaultGrants are the resource:action grants every user has
+	DefaultGrants           []string      `key:"default_grants" env:"AUTHZ_DEFAULT_GRANTS"`
+	PermissionSweepInterval time.Duration `key:"permission_sweep_interval" env:"PERMISSION_SWEEP_INTERVAL"`
+}
+
+// QuotaConfig configures the default quotas; 0 means unlimited
+type QuotaConfig struct {
+	UserMaxBytes   int64 `key:"user_max_bytes" env:"QUOTA_USER_MAX_BYTES"`
+	UserMaxFiles   int64 `key:"user_max_files" env:"QUOTA_USER_MAX_FILES"`
+	BucketMaxBytes int64 `key:"bucket_max_bytes" env:"QUOTA_BUCKET_MAX_BYTES"`
+	BucketMaxFiles int64 `key:"bucket_max_files" env:"QUOTA_BUCKET_MAX_FILES"`
+	WarnPercent    int   `key:"warn_percent" env:"QUOTA_WARN_PERCENT"`
+}
+
+// UploadConfig configures uploads
+type UploadConfig struct {
+	// MaxBytes is the size limit of a single file; 0 means unlimited
+	MaxBytes int64 `key:"max_bytes" env:"UPLOAD_MAX_BYTES"`
+}
+
+// LifecycleConfig configures the lifecycle rule scheduler
+type LifecycleConfig struct {
+	// Interval of applying lifecycle rules; 0 disables the scheduler
+	Interval time.Duration `key:"interval" env:"LIFECYCLE_INTERVAL"`
+}
+
+// LogConfig configures logging
+type LogConfig struct {
+	Format       string   `key:"format" env:"LOG_FORMAT"`
+	Level        string   `key:"level" env:"LOG_LEVEL"`
+	Bodies       bool     `key:"bodies" env:"LOG_BODIES"`
+	BodyMaxBytes int64    `key:"body_max_bytes" env:"LOG_BODY_MAX_BYTES"`
+	RedactFields []string `key:"redact_fields" env:"LOG_REDACT_FIELDS"`
+}
+
+// MetricsConfig configures the Prometheus metrics endpoint
+type MetricsConfig struct {
+	Enabled         bool          `key:"enabled" env:"METRICS_ENABLED"`
+	Token           string        `key:"token" env:"METRICS_TOKEN" secret:"true"`
+	StorageInterval time.Duration `key:"storage_interval" env:"METRICS_STORAGE_INTERVAL"`
+}
+
+// TracingConfig configures OpenTelemetry tracing
+type TracingConfig struct {
+	Exporter    string  `key:"exporter" env:"TRACING_EXPORTER"`
+	File        string  `key:"file" env:"TRACING_FILE"`
+	ServiceName string  `key:"service_name" env:"TRACING_SERVICE_NAME"`
+	SampleRatio float64 `key:"sample_ratio" env:"TRACING_SAMPLE_RATIO"`
+}
+
+// HealthConfig configures the readiness probe
+type HealthConfig struct {
+	CheckTimeout time.Duration `key:"check_timeout" env:"READY_CHECK_TIMEOUT"`
+	MinFreeBytes int64         `key:"min_free_bytes" env:"READY_MIN_FREE_BYTES"`
+}
+
+// Default returns the default configuration
+func Default() *Config {
+	loginGuard := service.DefaultLoginGuardConfig()
+	passwordPolicy := util.DefaultPasswordPolicy()
+	quota := service.DefaultQuotaConfig()
+	logger := middleware.DefaultLoggerConfig()
+	tlsDefaults := tlsconfig.DefaultConfig()
+	tracingDefaults := tracing.DefaultConfig()
+
+	return &Config{
+		Server: ServerConfig{
+			Port:              8080,
+			ReadHeaderTimeout: 10 * time.Second,
+			ReadTimeout:       30 * time.Minute,
+			WriteTimeout:      30 * time.Minute,
+			IdleTimeout:       2 * time.Minute,
+			MaxHeaderBytes:    1 << 20,
+			ShutdownTimeout:   30 * time.Second,
+		},
+		TLS: TLSConfig{
+			ReloadInterval:     30 * time.Second,
+			MinVersion:         tlsDefaults.MinVersion,
+			ClientAuth:         tlsDefaults.ClientAuth,
+			ClientCertUsername: service.ClientCertFieldCN,
+		},
+		Database: DatabaseConfig{
+			Driver:               DriverMySQL,
+			Host:                 "localhost",
+			SSLMode:              "disable",
+			Path:                 "pfss.db",
+			AutoMigrate:          true,
+			MigrationLockTimeout: 5 * time.Minute,
+		},
+		JWT: JWTConfig{
+			Expiration: 24 * time.Hour,
+		},
+		Auth: AuthConfig{
+			RegistrationMode: service.RegistrationInvite,
+			PasswordResetTTL: 24 * time.Hour,
+		},
+		Login: LoginConfig{
+			AttemptStore:    "memory",
+			MaxUserFailures: loginGuard.MaxUserFailures,
+			MaxIPFailures:   loginGuard.MaxIPFailures,
+			BackoffBase:     loginGuard.BaseDelay,
+			BackoffMax:      loginGuard.MaxDelay,
+			LockoutDuration: loginGuard.LockoutDuration,
+		},
+		Password: PasswordConfig{
+			MinLength: passwordPolicy.MinLength,
+		},
+		OIDC: OIDCConfig{
+			Scopes:        []string{"profile", "email"},
+			UsernameClaim: "preferred_username",
+			GroupsClaim:   "groups",
+			Provision:     true,
+		},
+		LDAP: LDAPConfig{
+			UserFilter:        "(uid=%s)",
+			UsernameAttribute: "uid",
+			GroupAttribute:    "memberOf",
+			Provision:         true,
+			SyncInterval:      15 * time.Minute,
+		},
+		Authz: AuthzConfig{
+			DefaultGrants:           []string{"bucket:create"},
+			PermissionSweepInterval: 5 * time.Minute,
+		},
+		Quota: QuotaConfig{
+			UserMaxBytes:   quota.UserMaxBytes,
+			UserMaxFiles:   quota.UserMaxFiles,
+			BucketMaxBytes: quota.BucketMaxBytes,
+			BucketMaxFiles: quota.BucketMaxFiles,
+			WarnPercent:    quota.WarnPercent,
+		},
+		Upload: UploadConfig{
+			MaxBytes: service.DefaultFileConfig().MaxUploadBytes,
+		},
+		Lifecycle: LifecycleConfig{
+			Interval: time.Hour,
+		},
+		Log: LogConfig{
+			Format:       "text",
+			Level:        "info",
+			Bodies:       logger.LogBodies,
+			BodyMaxBytes: logger.MaxBodyBytes,
+		},
+		Metrics: MetricsConfig{
+			StorageInterval: time.Minute,
+		},
+		Tracing: TracingConfig{
+			Exporter:    tracingDefaults.Exporter,
+			File:        tracingDefaults.FilePath,
+			ServiceName: tracingDefaults.ServiceName,
+			SampleRatio: tracingDefaults.SampleRatio,
+		},
+		Health: HealthConfig{
+			CheckTimeout: 2 * time.Second,
+			MinFreeBytes: 100 << 20,
+		},
+	}
+}
+
+// Validate checks the configuration and returns all problems found
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+	oneOf := func(key, value string, allowed ...string) {
+		for _, a := range allowed {
+			if value == a {
+				return
+			}
+		}
+		errs = append(errs, fmt.Errorf("%s: %q is not one of %v", key, value, allowed))
+	}
+	nonNegative := func(key string, d time.Duration) {
+		check(d >= 0, "%s: must not be negative", key)
+	}
+
+	check(c.Server.Port > 0 && c.Server.Port <= 65535, "server.port: %d is not a valid port", c.Server.Port)
+	nonNegative("server.read_header_timeout", c.Server.ReadHeaderTimeout)
+	nonNegative("server.read_timeout", c.Server.ReadTimeout)
+	nonNegative("server.write_timeout", c.Server.WriteTimeout)
+	nonNegative("server.idle_timeout", c.Server.IdleTimeout)
+	nonNegative("server.shutdown_drain_delay", c.Server.ShutdownDrainDelay)
+	check(c.Server.ShutdownTimeout > 0, "server.shutdown_timeout: must be positive")
+	check(c.Server.MaxHeaderBytes > 0, "server.max_header_bytes: must be positive")
+
+	check((c.TLS.CertFile == "") == (c.TLS.KeyFile == ""), "tls: cert_file and key_file must be set together")
+	nonNegative("tls.reload_interval", c.TLS.ReloadInterval)
+	oneOf("tls.min_version", c.TLS.MinVersion, "1.2", "1.3")
+	oneOf("tls.client_auth", c.TLS.ClientAuth, tlsconfig.ClientAuthNone, tlsconfig.ClientAuthOptional, tlsconfig.ClientAuthRequire)
+	oneOf("tls.client_cert_username", c.TLS.ClientCertUsername, service.ClientCertFieldCN, service.ClientCertFieldEmail)
+	if c.TLS.ClientCertAuth {
+		check(c.TLS.CertFile != "" && c.TLS.ClientCAFile != "", "tls.client_cert_auth: requires tls.cert_file and tls.client_ca_file")
+	}
+
+	oneOf("database.driver", c.Database.Driver, DriverMySQL, DriverPostgres, DriverSQLite)
+	switch {
+	case c.Database.DSN != "":
+	case c.Database.Driver == DriverSQLite:
+		check(c.Database.Path != "", "database.path: must be set")
+	default:
+		check(c.Database.Host != "", "database.host: must be set")
+		check(c.Database.Port >= 0 && c.Database.Port <= 65535, "database.port: %d is not a valid port", c.Database.Port)
+		check(c.Database.User != "", "database.user: must be set")
+		check(c.Database.Name != "", "database.name: must be set")
+	}
+	check(c.Database.MigrationLockTimeout > 0, "database.migration_lock_timeout: must be positive")
+
+	check(c.JWT.Secret != "", "jwt.secret: must be set")
+	check(c.JWT.Expiration > 0, "jwt.expiration: must be positive")
+
+	oneOf("auth.registration_mode", c.Auth.RegistrationMode, service.RegistrationOpen, service.RegistrationInvite, service.RegistrationDisabled)
+	check(c.Auth.PasswordResetTTL > 0, "auth.password_reset_ttl: must be positive")
+
+	oneOf("login.attempt_store", c.Login.AttemptStore, "memory", "database")
+	check(c.Login.MaxUserFailures >= 0, "login.max_user_failures: must not be negative")
+	check(c.Login.MaxIPFailures >= 0, "login.max_ip_failures: must not be negative")
+	nonNegative("login.backoff_base", c.Login.BackoffBase)
+	nonNegative("login.backoff_max", c.Login.BackoffMax)
+	nonNegative("login.lockout_duration", c.Login.LockoutDuration)
+
+	check(c.Password.MinLength > 0, "password.min_length: must be positive")
+
+	if c.OIDC.IssuerURL != "" {
+		check(c.OIDC.ClientID != "", "oidc.client_id: must be set when oidc.issuer_url is set")
+		check(c.OIDC.RedirectURL != "", "oidc.redirect_url: must be set when oidc.issuer_url is set")
+	}
+	if c.LDAP.URL != "" {
+		check(c.LDAP.BaseDN != "", "ldap.base_dn: must be set when ldap.url is set")
+		nonNegative("ldap.sync_interval", c.LDAP.SyncInterval)
+	}
+
+	nonNegative("authz.permission_sweep_interval", c.Authz.PermissionSweepInterval)
+	check(c.Quota.WarnPercent >= 0 && c.Quota.WarnPercent <= 100, "quota.warn_percent: must be between 0 and 100")
+	check(c.Upload.MaxBytes >= 0, "upload.max_bytes: must not be negative")
+	nonNegative("lifecycle.interval", c.Lifecycle.Interval)
+
+	if _, err := util.NewLogger(io.Discard, c.Log.Format, c.Log.Level); err != nil {
+		errs = append(errs, fmt.Errorf("log: %v", err))
+	}
+	check(c.Log.BodyMaxBytes >= 0, "log.body_max_bytes: must not be negative")
+
+	check(!c.Metrics.Enabled || c.Metrics.Token != "", "metrics.token: must be set when metrics.enabled is set")
+	nonNegative("metrics.storage_interval", c.Metrics.StorageInterval)
+
+	oneOf("tracing.exporter", c.Tracing.Exporter, tracing.ExporterNone, tracing.ExporterOTLP, tracing.ExporterStdout, tracing.ExporterFile)
+	check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "tracing.sample_ratio: must be between 0 and 1")
+
+	check(c.Health.CheckTimeout > 0, "health.check_timeout: must be positive")
+	check(c.Health.MinFreeBytes >= 0, "health.min_free_bytes: must not be negative")
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,287 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// FileEnv names the environment variable holding the path of the config file
+const FileEnv = "PFSS_CONFIG"
+
+// field is a configurable leaf of Config
+type field struct {
+	key    string
+	env    string
+	secret bool
+	value  reflect.Value
+}
+
+// fields returns the configurable fields of c in declaration order
+func fields(c *Config) []field {
+	var fields []field
+	sections := reflect.ValueOf(c).Elem()
+	for i := 0; i < sections.NumField(); i++ {
+		section := sections.Field(i)
+		sectionKey := sections.Type().Field(i).Tag.Get("key")
+		for j := 0; j < section.NumField(); j++ {
+			f := section.Type().Field(j)
+			fields = append(fields, field{
+				key:    sectionKey + "." + f.Tag.Get("key"),
+				env:    f.Tag.Get("env"),
+				secret: f.Tag.Get("secret") == "true",
+				value:  section.Field(j),
+			})
+		}
+	}
+	return fields
+}
+
+// Load builds the configuration from the defaults, the config file named by
+// the -config flag or PFSS_CONFIG, the environment and the flags in args.
+// The result is not validated.
+func Load(name string, args []string) (*Config, error) {
+	c := Default()
+	fields := fields(c)
+
+	// Flags are collected first so that -config is known, and applied last
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	configFile := flags.String("config", os.Getenv(FileEnv), "path of a YAML or TOML config file (env "+FileEnv+")")
+	flagValues := make(map[string]string)
+	for _, f := range fields {
+		_, isBool := f.value.Interface().(bool)
+		flags.Var(&flagValue{def: formatValue(f.value, f.secret), key: f.key, isBool: isBool, values: flagValues},
+			f.key, fmt.Sprintf("`%s` setting, env %s", typeName(f.value), f.env))
+	}
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	if flags.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected argument %q", flags.Arg(0))
+	}
+
+	if *configFile != "" {
+		values, err := readFile(*configFile)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range fields {
+			if value, ok := values[f.key]; ok {
+				if err := setValue(f, value); err != nil {
+					return nil, fmt.Errorf("%s: %w", *configFile, err)
+				}
+				delete(values, f.key)
+			}
+		}
+		if len(values) > 0 {
+			unknown := make([]string, 0, len(values))
+			for key := range values {
+				unknown = append(unknown, key)
+			}
+			sort.Strings(unknown)
+			return nil, fmt.Errorf("%s: unknown settings %s", *configFile, strings.Join(unknown, ", "))
+		}
+	}
+
+	for _, f := range fields {
+		value, ok, err := lookupEnv(f.env)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			if err := setValue(f, value); err != nil {
+				return nil, fmt.Errorf("%s: %w", f.env, err)
+			}
+		}
+	}
+
+	for _, f := range fields {
+		if value, ok := flagValues[f.key]; ok {
+			if err := setValue(f, value); err != nil {
+				return nil, fmt.Errorf("-%s: %w", f.key, err)
+			}
+		}
+	}
+
+	return c, nil
+}
+
+// flagValue records the value of a flag so it can be applied after the file
+// and the environment
+type flagValue struct {
+	def    string
+	key    string
+	isBool bool
+	values map[string]string
+}
+
+func (v *flagValue) String() string {
+	if v == nil {
+		return ""
+	}
+	return v.def
+}
+
+func (v *flagValue) Set(s string) error {
+	v.values[v.key] = s
+	return nil
+}
+
+// IsBoolFlag lets boolean settings be enabled by the bare flag
+func (v *flagValue) IsBoolFlag() bool {
+	return v.isBool
+}
+
+// typeName describes the type of a field value in the flag usage
+func typeName(v reflect.Value) string {
+	switch v.Interface().(type) {
+	case time.Duration:
+		return "duration"
+	case []string:
+		return "list"
+	case float64:
+		return "number"
+	default:
+		return v.Type().String()
+	}
+}
+
+// lookupEnv returns the value of the environment variable key. If key_FILE is
+// set instead, the value is read from the file it names, without the trailing
+// newline, so secrets can be mounted as files. Empty variables count as unset.
+func lookupEnv(key string) (string, bool, error) {
+	if value := os.Getenv(key); value != "" {
+		return value, true, nil
+	}
+	path := os.Getenv(key + "_FILE")
+	if path == "" {
+		return "", false, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", false, fmt.Errorf("%s_FILE: %v", key, err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), true, nil
+}
+
+// readFile reads a YAML or TOML config file, chosen by its extension, into
+// values keyed by section.field
+func readFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	var doc map[string]interface{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &doc)
+	case ".toml":
+		err = toml.Unmarshal(data, &doc)
+	default:
+		return nil, fmt.Errorf("config file %s must end in .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %v", path, err)
+	}
+
+	values := make(map[string]string)
+	for sectionKey, section := range doc {
+		settings, ok := section.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s: section %s must be a table", path, sectionKey)
+		}
+		for key, value := range settings {
+			values[sectionKey+"."+key] = fileValue(value)
+		}
+	}
+	return values, nil
+}
+
+// fileValue converts a value decoded from a config file to its string form;
+// lists become comma separated
+func fileValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case []interface{}:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = fmt.Sprint(item)
+		}
+		return strings.Join(items, ",")
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// setValue parses s into the field
+func setValue(f field, s string) error {
+	v := f.value
+	switch v.Interface().(type) {
+	case string:
+		v.SetString(s)
+	case int, int64:
+		n, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+		if err != nil {
+			return fmt.Errorf("%s: invalid integer %q", f.key, s)
+		}
+		v.SetInt(n)
+	case float64:
+		n, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil {
+			return fmt.Errorf("%s: invalid number %q", f.key, s)
+		}
+		v.SetFloat(n)
+	case bool:
+		b, err := strconv.ParseBool(strings.TrimSpace(s))
+		if err != nil {
+			return fmt.Errorf("%s: invalid boolean %q", f.key, s)
+		}
+		v.SetBool(b)
+	case time.Duration:
+		d, err := time.ParseDuration(strings.TrimSpace(s))
+		if err != nil {
+			return fmt.Errorf("%s: invalid duration %q", f.key, s)
+		}
+		v.SetInt(int64(d))
+	case []string:
+		var items []string
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("%s: unsupported type %s", f.key, v.Type())
+	}
+	return nil
+}
+
+// formatValue returns the string form of a field value that setValue parses
+// back, or a placeholder for a non-empty secret if redact is set
+func formatValue(v reflect.Value, redact bool) string {
+	var s string
+	switch value := v.Interface().(type) {
+	case time.Duration:
+		s = value.String()
+	case []string:
+		s = strings.Join(value, ",")
+	default:
+		s = fmt.Sprint(value)
+	}
+	if redact && s != "" {
+		return "REDACTED"
+	}
+	return s
+}
@@ -0,0 +1,70 @@
+package config
+
+import (
+	"io"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Print writes the configuration to w as a YAML config file, with the
+// values of secrets replaced by REDACTED
+func (c *Config) Print(w io.Writer) error {
+	root := &yaml.Node{Kind: yaml.MappingNode}
+	var section *yaml.Node
+	var sectionKey string
+	for _, f := range fields(c) {
+		key, name := splitKey(f.key)
+		if section == nil || key != sectionKey {
+			section = &yaml.Node{Kind: yaml.MappingNode}
+			sectionKey = key
+			root.Content = append(root.Content, scalar("!!str", key), section)
+		}
+		section.Content = append(section.Content, scalar("!!str", name), valueNode(f))
+	}
+
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(root); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// valueNode returns the YAML node of a field value
+func valueNode(f field) *yaml.Node {
+	if f.secret {
+		return scalar("!!str", formatValue(f.value, true))
+	}
+	switch value := f.value.Interface().(type) {
+	case []string:
+		list := &yaml.Node{Kind: yaml.SequenceNode, Style: yaml.FlowStyle}
+		for _, item := range value {
+			list.Content = append(list.Content, scalar("!!str", item))
+		}
+		return list
+	case time.Duration, string:
+		return scalar("!!str", formatValue(f.value, false))
+	case bool:
+		return scalar("!!bool", formatValue(f.value, false))
+	case float64:
+		return scalar("!!float", formatValue(f.value, false))
+	default:
+		return scalar("!!int", formatValue(f.value, false))
+	}
+}
+
+// scalar returns a scalar node
+func scalar(tag, value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: value}
+}
+
+// splitKey splits a section.field key
+func splitKey(key string) (string, string) {
+	for i := 0; i < len(key); i++ {
+		if key[i] == '.' {
+			return key[:i], key[i+1:]
+		}
+	}
+	return key, ""
+}
@@ -0,0 +1,201 @@
+package handler
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/minorcell/pfss/internal/model"
+	"github.com/minorcell/pfss/internal/service"
+	"github.com/minorcell/pfss/pkg/util"
+)
+
+// AuditHandler handles audit log requests
+type AuditHandler struct {
+	auditService *service.AuditService
+}
+
+// NewAuditHandler creates a new audit handler
+func NewAuditHandler(auditService *service.AuditService) *AuditHandler {
+	return &AuditHandler{
+		auditService: auditService,
+	}
+}
+
+// newAuditEvent returns an audit event of the current request, performed by
+// the authenticated user if any
+func newAuditEvent(c *gin.Context, action, targetType string, targetID uint) *model.AuditEvent {
+	return &model.AuditEvent{
+		ActorID:    c.GetUint("user_id"),
+		ActorName:  c.GetString("username"),
+		IP:         c.ClientIP(),
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+	}
+}
+
+// ListEvents godoc
+// @Summary List audit events
+// @Description Get a filtered list of audit events with pagination, newest first
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param actor_id query int false "Actor user ID"
+// @Param action query string false "Action, e.g. auth.login"
+// @Param target_type query string false "Target type" Enums(user, group, bucket, file, invitation)
+// @Param target_id query int false "Target ID"
+// @Param result query string false "Result" Enums(success, failure, denied)
+// @Param ip query string false "Client IP"
+// @Param from query string false "Earliest time (RFC 3339)"
+// @Param to query string false "Latest time, exclusive (RFC 3339)"
+// @Param page query int false "Page number"
+// @Param page_size query int false "Page size"
+// @Success 200 {object} model.AuditEventListResponse
+// @Failure 400,401,403 {object} util.ErrorResponse
+// @Router /admin/audit-events [get]
+func (h *AuditHandler) ListEvents(c *gin.Context) {
+	var query model.AuditQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		util.SendError(c, &util.ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "10"))
+
+	// Validate pagination parameters
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 10
+	}
+
+	events, total, err := h.auditService.GetEvents(&query, page, pageSize)
+	if err != nil {
+		util.SendError(c, serviceError(err, http.StatusInternalServerError))
+		return
+	}
+
+	c.JSON(http.StatusOK, model.AuditEventListResponse{
+		Events:     events,
+		TotalCount: total,
+		Page:       page,
+		PageSize:   pageSize,
+	})
+}
+
+// ExportEvents godoc
+// @Summary Export audit events
+// @Description Stream all audit events matching the filters, oldest first, as newline-delimited JSON or CSV
+// @Tags admin
+// @Produce json
+// @Produce text/csv
+// @Security Bearer
+// @Param format query string false "Export format" Enums(ndjson, csv) default(ndjson)
+// @Param actor_id query int false "Actor user ID"
+// @Param action query string false "Action, e.g. auth.login"
+// @Param target_type query string false "Target type" Enums(user, group, bucket, file, invitation)
+// @Param target_id query int false "Target ID"
+// @Param result query string false "Result" Enums(success, failure, denied)
+// @Param ip query string false "Client IP"
+// @Param from query string false "Earliest time (RFC 3339)"
+// @Param to query string false "Latest time, exclusive (RFC 3339)"
+// @Success 200 {string} string "Audit events"
+// @Failure 400,401,403 {object} util.ErrorResponse
+// @Router /admin/audit-events/export [get]
+func (h *AuditHandler) ExportEvents(c *gin.Context) {
+	var query model.AuditQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		util.SendError(c, &util.ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	var write func(*model.AuditEvent) error
+	var flush func() error
+	filename := "audit-events-" + time.Now().UTC().Format("20060102T150405Z")
+	switch format := c.DefaultQuery("format", "ndjson"); format {
+	case "ndjson":
+		c.Header("Content-Type", "application/x-ndjson")
+		c.Header("Content-Disposition", `attachment; filename="`+filename+`.ndjson"`)
+		encoder := json.NewEncoder(c.Writer)
+		write = func(event *model.AuditEvent) error {
+			return encoder.Encode(event)
+		}
+		flush = func() error { return nil }
+	case "csv":
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		c.Header("Content-Disposition", `attachment; filename="`+filename+`.csv"`)
+		writer := csv.NewWriter(c.Writer)
+		if err := writer.Write(auditCSVHeader); err != nil {
+			return
+		}
+		write = func(event *model.AuditEvent) error {
+			return writer.Write(auditCSVRecord(event))
+		}
+		flush = func() error {
+			writer.Flush()
+			return writer.Error()
+		}
+	default:
+		util.SendError(c, &util.ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid format: " + format,
+		})
+		return
+	}
+
+	// The status line is sent with the first event, so errors after it can only end the stream
+	c.Status(http.StatusOK)
+	if err := h.auditService.ExportEvents(&query, write); err != nil {
+		c.Error(err)
+	}
+	if err := flush(); err != nil {
+		c.Error(err)
+	}
+}
+
+// auditCSVHeader names the columns of audit event CSV exports
+var auditCSVHeader = []string{
+	"id", "created_at", "actor_id", "actor_name", "ip", "action",
+	"target_type", "target_id", "before", "after", "result", "error",
+}
+
+// auditCSVRecord returns the CSV columns of event
+func auditCSVRecord(event *model.AuditEvent) []string {
+	return []string{
+		strconv.FormatUint(uint64(event.ID), 10),
+		event.CreatedAt.UTC().Format(time.RFC3339),
+		strconv.FormatUint(uint64(event.ActorID), 10),
+		csvSafe(event.ActorName),
+		csvSafe(event.IP),
+		event.Action,
+		event.TargetType,
+		strconv.FormatUint(uint64(event.TargetID), 10),
+		csvSafe(event.Before),
+		csvSafe(event.After),
+		event.Result,
+		csvSafe(event.Error),
+	}
+}
+
+// csvSafe keeps spreadsheet applications from evaluating client-controlled
+// values, such as the username of a failed login, as formulas
+func csvSafe(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
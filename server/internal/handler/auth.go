@@ -1,35 +1,42 @@
 package handler
 
 import (
+	"errors"
+	"math"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/minorcell/pfss/internal/authz"
 	"github.com/minorcell/pfss/internal/model"
 	"github.com/minorcell/pfss/internal/service"
+	"github.com/minorcell/pfss/pkg/metrics"
 	"github.com/minorcell/pfss/pkg/util"
 )
 
 // AuthHandler handles authentication related requests
 type AuthHandler struct {
-	authService *service.AuthService
+	authService  *service.AuthService
+	auditService *service.AuditService
 }
 
 // NewAuthHandler creates a new authentication handler
-func NewAuthHandler(authService *service.AuthService) *AuthHandler {
+func NewAuthHandler(authService *service.AuthService, auditService *service.AuditService) *AuthHandler {
 	return &AuthHandler{
-		authService: authService,
+		authService:  authService,
+		auditService: auditService,
 	}
 }
 
 // Register godoc
 // @Summary Register a new user
-// @Description Register a new user with username and password
+// @Description Register a new user with username and password. Depending on the registration mode an invitation token is required.
 // @Tags auth
 // @Accept json
 // @Produce json
 // @Param request body model.RegisterRequest true "Register request"
 // @Success 201 {object} model.AuthResponse
-// @Failure 400 {object} util.ErrorResponse
+// @Failure 400,403 {object} util.ErrorResponse
 // @Router /auth/register [post]
 func (h *AuthHandler) Register(c *gin.Context) {
 	var req model.RegisterRequest
@@ -41,21 +48,12 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		return
 	}
 
-	// Only root users can create other root users
-	if req.IsRoot {
-		userID, exists := c.Get("user_id")
-		isRoot, rootExists := c.Get("is_root")
-		if !exists || !rootExists || !isRoot.(bool) {
-			util.SendError(c, util.ErrForbidden)
+	resp, err := h.authService.Register(&req, false)
+	if err != nil {
+		if errors.Is(err, service.ErrRegistrationClosed) {
+			util.SendError(c, util.NewError(http.StatusForbidden, err.Error()))
 			return
 		}
-		if userID == nil {
-			req.IsRoot = false // Non-authenticated users cannot create root users
-		}
-	}
-
-	resp, err := h.authService.Register(&req)
-	if err != nil {
 		util.SendError(c, &util.ErrorResponse{
 			Code:    http.StatusBadRequest,
 			Message: err.Error(),
@@ -74,7 +72,7 @@ func (h *AuthHandler) Register(c *gin.Context) {
 // @Produce json
 // @Param request body model.LoginRequest true "Login request"
 // @Success 200 {object} model.TokenResponse
-// @Failure 400,401 {object} util.ErrorResponse
+// @Failure 400,401,429,500,503 {object} util.ErrorResponse
 // @Router /auth/login [post]
 func (h *AuthHandler) Login(c *gin.Context) {
 	var req model.LoginRequest
@@ -86,8 +84,46 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	resp, err := h.authService.Login(&req)
+	resp, err := h.authService.Login(&req, c.ClientIP())
+	event := newAuditEvent(c, model.AuditLogin, authz.KindUser, 0)
+	event.ActorName = req.Username
+	if resp != nil {
+		event.ActorID = resp.ID
+		event.TargetID = resp.ID
+	}
+	h.auditService.Record(event, nil, nil, err)
 	if err != nil {
+		var lockedErr *service.LoginLockedError
+		if errors.As(err, &lockedErr) {
+			metrics.AuthFailures.WithLabelValues("password", "locked").Inc()
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(lockedErr.RetryAfter.Seconds()))))
+			util.SendError(c, &util.ErrorResponse{
+				Code:    util.ErrorCodeTooManyRequests,
+				Message: err.Error(),
+			})
+			return
+		}
+		if errors.Is(err, service.ErrLoginUnavailable) {
+			metrics.AuthFailures.WithLabelValues("password", "unavailable").Inc()
+			util.SendError(c, util.NewError(http.StatusServiceUnavailable, err.Error()))
+			return
+		}
+		reason := "error"
+		switch {
+		case errors.Is(err, service.ErrInvalidCredentials):
+			reason = "invalid_credentials"
+		case errors.Is(err, service.ErrAccountInactive):
+			reason = "inactive"
+		case errors.Is(err, authz.ErrPermissionDenied):
+			reason = "denied"
+		}
+		metrics.AuthFailures.WithLabelValues("password", reason).Inc()
+		if reason == "error" {
+			// Logged with the request rather than shown to the client
+			c.Error(err)
+			util.SendError(c, util.ErrInternalServer)
+			return
+		}
 		util.SendError(c, &util.ErrorResponse{
 			Code:    http.StatusUnauthorized,
 			Message: err.Error(),
@@ -110,11 +146,7 @@ func (h *AuthHandler) Login(c *gin.Context) {
 // @Failure 400,401 {object} util.ErrorResponse
 // @Router /users/change-password [post]
 func (h *AuthHandler) ChangePassword(c *gin.Context) {
-	var req struct {
-		CurrentPassword string `json:"current_password" binding:"required"`
-		NewPassword    string `json:"new_password" binding:"required,min=6"`
-	}
-
+	var req model.ChangePasswordRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		util.SendError(c, &util.ErrorResponse{
 			Code:    http.StatusBadRequest,
@@ -129,7 +161,193 @@ func (h *AuthHandler) ChangePassword(c *gin.Context) {
 		return
 	}
 
-	if err := h.authService.ChangePassword(userID.(uint), req.CurrentPassword, req.NewPassword); err != nil {
+	resp, err := h.authService.ChangePassword(userID.(uint), req.CurrentPassword, req.NewPassword)
+	h.auditService.Record(newAuditEvent(c, model.AuditPasswordChange, authz.KindUser, userID.(uint)), nil, nil, err)
+	if err != nil {
+		util.SendError(c, &util.ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Password changed successfully",
+		"token":   resp.Token,
+	})
+}
+
+// Setup godoc
+// @Summary Complete first-run setup
+// @Description Set the root password using the one-time setup token printed in the server log at startup
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body model.SetupRequest true "Setup request"
+// @Success 200 {object} model.AuthResponse
+// @Failure 400 {object} util.ErrorResponse
+// @Router /auth/setup [post]
+func (h *AuthHandler) Setup(c *gin.Context) {
+	var req model.SetupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.SendError(c, &util.ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	resp, err := h.authService.CompleteSetup(&req)
+	event := newAuditEvent(c, model.AuditSetup, authz.KindUser, 0)
+	if resp != nil {
+		event.ActorID = resp.ID
+		event.ActorName = resp.Username
+		event.TargetID = resp.ID
+	}
+	h.auditService.Record(event, nil, nil, err)
+	if err != nil {
+		util.SendError(c, &util.ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// CreateUser godoc
+// @Summary Create user
+// @Description Create a user account as root, regardless of the registration mode
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param request body model.RegisterRequest true "Register request"
+// @Success 201 {object} model.AuthResponse
+// @Failure 400,401,403 {object} util.ErrorResponse
+// @Router /admin/users [post]
+func (h *AuthHandler) CreateUser(c *gin.Context) {
+	var req model.RegisterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.SendError(c, &util.ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	resp, err := h.authService.Register(&req, true)
+	event := newAuditEvent(c, model.AuditUserCreate, authz.KindUser, 0)
+	if resp != nil {
+		event.TargetID = resp.ID
+	}
+	h.auditService.Record(event, nil, gin.H{"username": req.Username}, err)
+	if err != nil {
+		util.SendError(c, &util.ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, resp)
+}
+
+// Unlock godoc
+// @Summary Clear login lockout
+// @Description Clear failed login counters and lockouts for a username and/or client IP
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param request body model.UnlockRequest true "Unlock request"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400,401,403 {object} util.ErrorResponse
+// @Router /admin/login-lockouts/unlock [post]
+func (h *AuthHandler) Unlock(c *gin.Context) {
+	var req model.UnlockRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.SendError(c, &util.ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	err := h.authService.Unlock(req.Username, req.IP)
+	h.auditService.Record(newAuditEvent(c, model.AuditLoginUnlock, authz.KindUser, 0), nil, req, err)
+	if err != nil {
+		util.SendError(c, &util.ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Login lockout cleared successfully"})
+}
+
+// IssuePasswordReset godoc
+// @Summary Issue password reset token
+// @Description Issue a single-use password reset token for a user. The token is only returned once.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "User ID"
+// @Success 201 {object} model.PasswordResetResponse
+// @Failure 400,401,403 {object} util.ErrorResponse
+// @Router /admin/users/{id}/password-reset [post]
+func (h *AuthHandler) IssuePasswordReset(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		util.SendError(c, &util.ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid user ID",
+		})
+		return
+	}
+
+	currentUserID := c.GetUint("user_id")
+	isRoot := c.GetBool("is_root")
+
+	resp, err := h.authService.IssuePasswordReset(uint(id), currentUserID, isRoot)
+	h.auditService.Record(newAuditEvent(c, model.AuditPasswordResetIssue, authz.KindUser, uint(id)), nil, nil, err)
+	if err != nil {
+		util.SendError(c, &util.ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, resp)
+}
+
+// ResetPassword godoc
+// @Summary Reset password
+// @Description Set a new password using a reset token issued by root
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body model.PasswordResetRequest true "Password reset request"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} util.ErrorResponse
+// @Router /auth/password-reset [post]
+func (h *AuthHandler) ResetPassword(c *gin.Context) {
+	var req model.PasswordResetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.SendError(c, &util.ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	err := h.authService.ResetPassword(&req)
+	h.auditService.Record(newAuditEvent(c, model.AuditPasswordReset, authz.KindUser, 0), nil, nil, err)
+	if err != nil {
 		util.SendError(c, &util.ErrorResponse{
 			Code:    http.StatusBadRequest,
 			Message: err.Error(),
@@ -137,5 +355,5 @@ func (h *AuthHandler) ChangePassword(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Password changed successfully"})
+	c.JSON(http.StatusOK, gin.H{"message": "Password reset successfully"})
 }
@@ -1,10 +1,14 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/minorcell/pfss/internal/authz"
 	"github.com/minorcell/pfss/internal/model"
 	"github.com/minorcell/pfss/internal/service"
 	"github.com/minorcell/pfss/pkg/util"
@@ -13,12 +17,14 @@ import (
 // BucketHandler handles bucket-related requests
 type BucketHandler struct {
 	bucketService *service.BucketService
+	auditService  *service.AuditService
 }
 
 // NewBucketHandler creates a new bucket handler
-func NewBucketHandler(bucketService *service.BucketService) *BucketHandler {
+func NewBucketHandler(bucketService *service.BucketService, auditService *service.AuditService) *BucketHandler {
 	return &BucketHandler{
 		bucketService: bucketService,
+		auditService:  auditService,
 	}
 }
 
@@ -44,12 +50,14 @@ func (h *BucketHandler) CreateBucket(c *gin.Context) {
 	}
 
 	userID := c.GetUint("user_id")
-	bucket, err := h.bucketService.CreateBucket(&req, userID)
+	bucket, err := h.bucketService.CreateBucket(c.Request.Context(), &req, userID, c.GetBool("is_root"))
+	event := newAuditEvent(c, model.AuditBucketCreate, authz.KindBucket, 0)
+	if bucket != nil {
+		event.TargetID = bucket.ID
+	}
+	h.auditService.Record(event, nil, gin.H{"name": req.Name, "owner_id": userID}, err)
 	if err != nil {
-		util.SendError(c, &util.ErrorResponse{
-			Code:    http.StatusBadRequest,
-			Message: err.Error(),
-		})
+		util.SendError(c, serviceError(err, http.StatusBadRequest))
 		return
 	}
 
@@ -84,12 +92,9 @@ func (h *BucketHandler) ListBuckets(c *gin.Context) {
 	userID := c.GetUint("user_id")
 	isRoot := c.GetBool("is_root")
 
-	buckets, total, err := h.bucketService.GetBuckets(userID, isRoot, page, pageSize)
+	buckets, total, err := h.bucketService.GetBuckets(c.Request.Context(), userID, isRoot, page, pageSize)
 	if err != nil {
-		util.SendError(c, &util.ErrorResponse{
-			Code:    http.StatusInternalServerError,
-			Message: "Failed to get buckets: " + err.Error(),
-		})
+		util.SendError(c, serviceError(err, http.StatusInternalServerError))
 		return
 	}
 
@@ -125,16 +130,13 @@ func (h *BucketHandler) GetBucket(c *gin.Context) {
 	userID := c.GetUint("user_id")
 	isRoot := c.GetBool("is_root")
 
-	bucket, err := h.bucketService.GetBucketByID(uint(id), userID, isRoot)
+	bucket, err := h.bucketService.GetBucketByID(c.Request.Context(), uint(id), userID, isRoot)
 	if err != nil {
-		util.SendError(c, &util.ErrorResponse{
-			Code:    http.StatusNotFound,
-			Message: err.Error(),
-		})
+		util.SendError(c, serviceError(err, http.StatusNotFound))
 		return
 	}
 
-	permissions, err := h.bucketService.GetBucketPermissions(uint(id), userID, isRoot)
+	permissions, err := h.bucketService.GetBucketPermissions(c.Request.Context(), uint(id), userID, isRoot)
 	if err != nil {
 		// Don't fail the request if permissions can't be retrieved
 		c.JSON(http.StatusOK, model.BucketResponse{
@@ -183,15 +185,105 @@ func (h *BucketHandler) UpdateBucket(c *gin.Context) {
 	userID := c.GetUint("user_id")
 	isRoot := c.GetBool("is_root")
 
-	if err := h.bucketService.UpdateBucket(uint(id), &req, userID, isRoot); err != nil {
+	before := h.auditBucket(c, uint(id))
+	err = h.bucketService.UpdateBucket(c.Request.Context(), uint(id), &req, userID, isRoot)
+	h.auditService.Record(newAuditEvent(c, model.AuditBucketUpdate, authz.KindBucket, uint(id)), before, h.auditBucket(c, uint(id)), err)
+	if err != nil {
+		util.SendError(c, serviceError(err, http.StatusBadRequest))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Bucket updated successfully"})
+}
+
+// UpdateUploadPolicy godoc
+// @Summary Update bucket upload policy
+// @Description Set the size limit of files in a bucket and the MIME types and extensions allowed or denied. A size of 0 uses the global limit; empty allow lists allow everything.
+// @Tags buckets
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Bucket ID"
+// @Param request body model.BucketUploadPolicyRequest true "Upload policy"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400,401,403,404 {object} util.ErrorResponse
+// @Router /buckets/{id}/upload-policy [put]
+func (h *BucketHandler) UpdateUploadPolicy(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		util.SendError(c, &util.ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid bucket ID",
+		})
+		return
+	}
+
+	var req model.BucketUploadPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
 		util.SendError(c, &util.ErrorResponse{
 			Code:    http.StatusBadRequest,
-			Message: err.Error(),
+			Message: "Invalid request: " + err.Error(),
 		})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Bucket updated successfully"})
+	userID := c.GetUint("user_id")
+	isRoot := c.GetBool("is_root")
+
+	before := h.auditBucket(c, uint(id))
+	err = h.bucketService.UpdateUploadPolicy(c.Request.Context(), uint(id), &req, userID, isRoot)
+	h.auditService.Record(newAuditEvent(c, model.AuditBucketUploadPolicy, authz.KindBucket, uint(id)), before, h.auditBucket(c, uint(id)), err)
+	if err != nil {
+		util.SendError(c, serviceError(err, http.StatusBadRequest))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Bucket upload policy updated successfully"})
+}
+
+// UpdateObjectLock godoc
+// @Summary Update bucket object lock
+// @Description Enable or disable object lock on a bucket and set the default retention of new files. Existing retention is not changed.
+// @Tags buckets
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Bucket ID"
+// @Param request body model.BucketObjectLockRequest true "Object lock settings"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400,401,403,404 {object} util.ErrorResponse
+// @Router /buckets/{id}/object-lock [put]
+func (h *BucketHandler) UpdateObjectLock(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		util.SendError(c, &util.ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid bucket ID",
+		})
+		return
+	}
+
+	var req model.BucketObjectLockRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.SendError(c, &util.ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	isRoot := c.GetBool("is_root")
+
+	before := h.auditBucket(c, uint(id))
+	err = h.bucketService.UpdateObjectLock(c.Request.Context(), uint(id), &req, userID, isRoot)
+	h.auditService.Record(newAuditEvent(c, model.AuditBucketObjectLock, authz.KindBucket, uint(id)), before, h.auditBucket(c, uint(id)), err)
+	if err != nil {
+		util.SendError(c, serviceError(err, http.StatusBadRequest))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Bucket object lock updated successfully"})
 }
 
 // DeleteBucket godoc
@@ -218,18 +310,75 @@ func (h *BucketHandler) DeleteBucket(c *gin.Context) {
 	userID := c.GetUint("user_id")
 	isRoot := c.GetBool("is_root")
 
-	if err := h.bucketService.DeleteBucket(uint(id), userID, isRoot); err != nil {
+	before := h.auditBucket(c, uint(id))
+	err = h.bucketService.DeleteBucket(c.Request.Context(), uint(id), userID, isRoot)
+	h.auditService.Record(newAuditEvent(c, model.AuditBucketDelete, authz.KindBucket, uint(id)), before, nil, err)
+	if err != nil {
+		util.SendError(c, serviceError(err, http.StatusBadRequest))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Bucket deleted successfully"})
+}
+
+// ListBucketPermissions godoc
+// @Summary List bucket permissions
+// @Description Get the permission set of a bucket and its version. The version is also returned in the ETag header and must be sent as If-Match when replacing the set.
+// @Tags buckets
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Bucket ID"
+// @Success 200 {object} model.BucketPermissionListResponse
+// @Failure 400,401,403,404 {object} util.ErrorResponse
+// @Router /buckets/{id}/permissions [get]
+func (h *BucketHandler) ListBucketPermissions(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
 		util.SendError(c, &util.ErrorResponse{
 			Code:    http.StatusBadRequest,
-			Message: err.Error(),
+			Message: "Invalid bucket ID",
 		})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Bucket deleted successfully"})
+	userID := c.GetUint("user_id")
+	isRoot := c.GetBool("is_root")
+
+	// Read the bucket before its permissions: a concurrent change then leaves the
+	// client with an outdated version, so its next edit fails instead of overwriting
+	bucket, err := h.bucketService.GetBucketByID(c.Request.Context(), uint(id), userID, isRoot)
+	if err != nil {
+		util.SendError(c, serviceError(err, http.StatusNotFound))
+		return
+	}
+
+	permissions, err := h.bucketService.GetBucketPermissions(c.Request.Context(), uint(id), userID, isRoot)
+	if err != nil {
+		util.SendError(c, serviceError(err, http.StatusInternalServerError))
+		return
+	}
+
+	setPermissionVersion(c, bucket.PermissionVersion)
+	c.JSON(http.StatusOK, model.BucketPermissionListResponse{
+		Permissions: permissions,
+		Version:     bucket.PermissionVersion,
+	})
 }
 
-// UpdateBucketPermissions handles updating bucket permissions
+// UpdateBucketPermissions godoc
+// @Summary Replace bucket permissions
+// @Description Replace every grant of a bucket except the owner's. Requires the current permission version in If-Match.
+// @Tags buckets
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Bucket ID"
+// @Param If-Match header string true "Permission version"
+// @Param request body []model.BucketPermissionRequest true "Bucket permissions"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400,401,403,404,409,428 {object} util.ErrorResponse
+// @Router /buckets/{id}/permissions [put]
 func (h *BucketHandler) UpdateBucketPermissions(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
@@ -240,6 +389,22 @@ func (h *BucketHandler) UpdateBucketPermissions(c *gin.Context) {
 		return
 	}
 
+	version, err := ifMatchVersion(c)
+	if err != nil {
+		util.SendError(c, &util.ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: err.Error(),
+		})
+		return
+	}
+	if version == 0 {
+		util.SendError(c, &util.ErrorResponse{
+			Code:    http.StatusPreconditionRequired,
+			Message: "If-Match header with the permission version is required",
+		})
+		return
+	}
+
 	var req []model.BucketPermissionRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		util.SendError(c, &util.ErrorResponse{
@@ -252,7 +417,43 @@ func (h *BucketHandler) UpdateBucketPermissions(c *gin.Context) {
 	userID := c.GetUint("user_id")
 	isRoot := c.GetBool("is_root")
 
-	if err := h.bucketService.UpdateBucketPermissions(uint(id), req, userID, isRoot); err != nil {
+	before := h.auditPermissions(c, uint(id))
+	newVersion, err := h.bucketService.UpdateBucketPermissions(c.Request.Context(), uint(id), req, version, userID, isRoot)
+	h.auditService.Record(newAuditEvent(c, model.AuditBucketPermissions, authz.KindBucket, uint(id)), before, h.auditPermissions(c, uint(id)), err)
+	if err != nil {
+		util.SendError(c, serviceError(err, http.StatusBadRequest))
+		return
+	}
+
+	setPermissionVersion(c, newVersion)
+	c.JSON(http.StatusOK, gin.H{"message": "Bucket permissions updated successfully", "version": newVersion})
+}
+
+// GrantBucketPermission godoc
+// @Summary Grant bucket permission
+// @Description Create or update the grant of a single user or group. If-Match is optional.
+// @Tags buckets
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Bucket ID"
+// @Param If-Match header string false "Permission version"
+// @Param request body model.BucketPermissionRequest true "Bucket permission"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400,401,403,404,409 {object} util.ErrorResponse
+// @Router /buckets/{id}/permissions [post]
+func (h *BucketHandler) GrantBucketPermission(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		util.SendError(c, &util.ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid bucket ID",
+		})
+		return
+	}
+
+	version, err := ifMatchVersion(c)
+	if err != nil {
 		util.SendError(c, &util.ErrorResponse{
 			Code:    http.StatusBadRequest,
 			Message: err.Error(),
@@ -260,11 +461,66 @@ func (h *BucketHandler) UpdateBucketPermissions(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Bucket permissions updated successfully"})
+	var req model.BucketPermissionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.SendError(c, &util.ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	isRoot := c.GetBool("is_root")
+
+	before := h.auditPermissions(c, uint(id))
+	newVersion, err := h.bucketService.GrantBucketPermission(c.Request.Context(), uint(id), &req, version, userID, isRoot)
+	h.auditService.Record(newAuditEvent(c, model.AuditBucketGrant, authz.KindBucket, uint(id)), before, h.auditPermissions(c, uint(id)), err)
+	if err != nil {
+		util.SendError(c, serviceError(err, http.StatusBadRequest))
+		return
+	}
+
+	setPermissionVersion(c, newVersion)
+	c.JSON(http.StatusOK, gin.H{"message": "Bucket permission granted successfully", "version": newVersion})
 }
 
-// GetBucketStats handles getting bucket statistics
-func (h *BucketHandler) GetBucketStats(c *gin.Context) {
+// RevokeUserBucketPermission godoc
+// @Summary Revoke user bucket permission
+// @Description Remove the grant of a single user. The owner's grant cannot be revoked. If-Match is optional.
+// @Tags buckets
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Bucket ID"
+// @Param user_id path int true "User ID"
+// @Param If-Match header string false "Permission version"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400,401,403,404,409 {object} util.ErrorResponse
+// @Router /buckets/{id}/permissions/users/{user_id} [delete]
+func (h *BucketHandler) RevokeUserBucketPermission(c *gin.Context) {
+	h.revokeBucketPermission(c, "user_id")
+}
+
+// RevokeGroupBucketPermission godoc
+// @Summary Revoke group bucket permission
+// @Description Remove the grant of a single group. If-Match is optional.
+// @Tags buckets
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Bucket ID"
+// @Param group_id path int true "Group ID"
+// @Param If-Match header string false "Permission version"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400,401,403,404,409 {object} util.ErrorResponse
+// @Router /buckets/{id}/permissions/groups/{group_id} [delete]
+func (h *BucketHandler) RevokeGroupBucketPermission(c *gin.Context) {
+	h.revokeBucketPermission(c, "group_id")
+}
+
+// revokeBucketPermission revokes the grant of the user or group named by param
+func (h *BucketHandler) revokeBucketPermission(c *gin.Context, param string) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
 		util.SendError(c, &util.ErrorResponse{
@@ -274,10 +530,68 @@ func (h *BucketHandler) GetBucketStats(c *gin.Context) {
 		return
 	}
 
+	granteeID, err := strconv.ParseUint(c.Param(param), 10, 32)
+	if err != nil || granteeID == 0 {
+		util.SendError(c, &util.ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid " + strings.TrimSuffix(param, "_id") + " ID",
+		})
+		return
+	}
+
+	version, err := ifMatchVersion(c)
+	if err != nil {
+		util.SendError(c, &util.ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: err.Error(),
+		})
+		return
+	}
+
 	userID := c.GetUint("user_id")
 	isRoot := c.GetBool("is_root")
 
-	stats, err := h.bucketService.GetBucketStats(uint(id), userID, isRoot)
+	before := h.auditPermissions(c, uint(id))
+	var newVersion uint
+	if param == "group_id" {
+		newVersion, err = h.bucketService.RevokeBucketPermission(c.Request.Context(), uint(id), 0, uint(granteeID), version, userID, isRoot)
+	} else {
+		newVersion, err = h.bucketService.RevokeBucketPermission(c.Request.Context(), uint(id), uint(granteeID), 0, version, userID, isRoot)
+	}
+	h.auditService.Record(newAuditEvent(c, model.AuditBucketRevoke, authz.KindBucket, uint(id)), before, h.auditPermissions(c, uint(id)), err)
+	if err != nil {
+		util.SendError(c, serviceError(err, http.StatusBadRequest))
+		return
+	}
+
+	setPermissionVersion(c, newVersion)
+	c.JSON(http.StatusOK, gin.H{"message": "Bucket permission revoked successfully", "version": newVersion})
+}
+
+// TransferBucketOwnership godoc
+// @Summary Transfer bucket ownership
+// @Description Make another user the owner of a bucket. If-Match is optional.
+// @Tags buckets
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Bucket ID"
+// @Param If-Match header string false "Permission version"
+// @Param request body model.BucketOwnerRequest true "New owner"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400,401,403,404,409 {object} util.ErrorResponse
+// @Router /buckets/{id}/owner [put]
+func (h *BucketHandler) TransferBucketOwnership(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		util.SendError(c, &util.ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid bucket ID",
+		})
+		return
+	}
+
+	version, err := ifMatchVersion(c)
 	if err != nil {
 		util.SendError(c, &util.ErrorResponse{
 			Code:    http.StatusBadRequest,
@@ -286,5 +600,253 @@ func (h *BucketHandler) GetBucketStats(c *gin.Context) {
 		return
 	}
 
+	var req model.BucketOwnerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.SendError(c, &util.ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	isRoot := c.GetBool("is_root")
+
+	before := h.auditBucket(c, uint(id))
+	newVersion, err := h.bucketService.TransferOwnership(c.Request.Context(), uint(id), req.OwnerID, version, userID, isRoot)
+	h.auditService.Record(newAuditEvent(c, model.AuditBucketOwner, authz.KindBucket, uint(id)), before, h.auditBucket(c, uint(id)), err)
+	if err != nil {
+		util.SendError(c, serviceError(err, http.StatusBadRequest))
+		return
+	}
+
+	setPermissionVersion(c, newVersion)
+	c.JSON(http.StatusOK, gin.H{"message": "Bucket ownership transferred successfully", "version": newVersion})
+}
+
+// ListPathRules godoc
+// @Summary List bucket path rules
+// @Description Get the rules allowing or denying access under path prefixes of a bucket
+// @Tags buckets
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Bucket ID"
+// @Success 200 {array} model.BucketPathRule
+// @Failure 400,401,403,404 {object} util.ErrorResponse
+// @Router /buckets/{id}/path-rules [get]
+func (h *BucketHandler) ListPathRules(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		util.SendError(c, &util.ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid bucket ID",
+		})
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	isRoot := c.GetBool("is_root")
+
+	rules, err := h.bucketService.GetPathRules(c.Request.Context(), uint(id), userID, isRoot)
+	if err != nil {
+		util.SendError(c, serviceError(err, http.StatusInternalServerError))
+		return
+	}
+
+	c.JSON(http.StatusOK, rules)
+}
+
+// CreatePathRule godoc
+// @Summary Create bucket path rule
+// @Description Allow or deny read or write access under a path prefix of a bucket. The rule with the longest matching prefix wins; deny wins over allow for equal prefixes. Bucket admins are not restricted by path rules.
+// @Tags buckets
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Bucket ID"
+// @Param request body model.BucketPathRuleRequest true "Path rule"
+// @Success 201 {object} model.BucketPathRule
+// @Failure 400,401,403,404 {object} util.ErrorResponse
+// @Router /buckets/{id}/path-rules [post]
+func (h *BucketHandler) CreatePathRule(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		util.SendError(c, &util.ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid bucket ID",
+		})
+		return
+	}
+
+	var req model.BucketPathRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.SendError(c, &util.ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	isRoot := c.GetBool("is_root")
+
+	rule, err := h.bucketService.CreatePathRule(c.Request.Context(), uint(id), &req, userID, isRoot)
+	h.auditService.Record(newAuditEvent(c, model.AuditBucketPathRule, authz.KindBucket, uint(id)), nil, rule, err)
+	if err != nil {
+		util.SendError(c, serviceError(err, http.StatusBadRequest))
+		return
+	}
+
+	c.JSON(http.StatusCreated, rule)
+}
+
+// DeletePathRule godoc
+// @Summary Delete bucket path rule
+// @Description Remove a path rule of a bucket
+// @Tags buckets
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Bucket ID"
+// @Param rule_id path int true "Rule ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400,401,403,404 {object} util.ErrorResponse
+// @Router /buckets/{id}/path-rules/{rule_id} [delete]
+func (h *BucketHandler) DeletePathRule(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		util.SendError(c, &util.ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid bucket ID",
+		})
+		return
+	}
+
+	ruleID, err := strconv.ParseUint(c.Param("rule_id"), 10, 32)
+	if err != nil {
+		util.SendError(c, &util.ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid rule ID",
+		})
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	isRoot := c.GetBool("is_root")
+
+	err = h.bucketService.DeletePathRule(c.Request.Context(), uint(id), uint(ruleID), userID, isRoot)
+	h.auditService.Record(newAuditEvent(c, model.AuditBucketPathRule, authz.KindBucket, uint(id)), gin.H{"rule_id": ruleID}, nil, err)
+	if err != nil {
+		util.SendError(c, serviceError(err, http.StatusBadRequest))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Path rule deleted successfully"})
+}
+
+// ifMatchVersion parses the permission version from the If-Match header.
+// It returns 0 if the header is absent.
+func ifMatchVersion(c *gin.Context) (uint, error) {
+	header := strings.TrimSpace(c.GetHeader("If-Match"))
+	if header == "" {
+		return 0, nil
+	}
+	header = strings.Trim(strings.TrimPrefix(header, "W/"), `"`)
+	version, err := strconv.ParseUint(header, 10, 32)
+	if err != nil || version == 0 {
+		return 0, errors.New("invalid If-Match header, expected the permission version")
+	}
+	return uint(version), nil
+}
+
+// setPermissionVersion returns the permission version as ETag
+func setPermissionVersion(c *gin.Context, version uint) {
+	c.Header("ETag", `"`+strconv.FormatUint(uint64(version), 10)+`"`)
+}
+
+// GetBucketStats handles getting bucket statistics
+func (h *BucketHandler) GetBucketStats(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		util.SendError(c, &util.ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid bucket ID",
+		})
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	isRoot := c.GetBool("is_root")
+
+	stats, err := h.bucketService.GetBucketStats(c.Request.Context(), uint(id), userID, isRoot)
+	if err != nil {
+		util.SendError(c, serviceError(err, http.StatusBadRequest))
+		return
+	}
+
 	c.JSON(http.StatusOK, stats)
 }
+
+// ListExpiringPermissions godoc
+// @Summary List expiring bucket permissions
+// @Description List bucket permissions that expire within the given duration, of every bucket for root and global bucket admins and of the buckets the user administers otherwise
+// @Tags buckets
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param within query string false "Duration such as 24h (default 168h)"
+// @Success 200 {array} model.BucketPermission
+// @Failure 400,401,403 {object} util.ErrorResponse
+// @Router /bucket-permissions/expiring [get]
+func (h *BucketHandler) ListExpiringPermissions(c *gin.Context) {
+	within, err := time.ParseDuration(c.DefaultQuery("within", "168h"))
+	if err != nil || within <= 0 {
+		util.SendError(c, &util.ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid duration",
+		})
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	isRoot := c.GetBool("is_root")
+
+	permissions, err := h.bucketService.GetExpiringPermissions(c.Request.Context(), within, userID, isRoot)
+	if err != nil {
+		util.SendError(c, serviceError(err, http.StatusInternalServerError))
+		return
+	}
+
+	c.JSON(http.StatusOK, permissions)
+}
+
+// auditBucket returns the audited fields of a bucket, or nil if the current user cannot see it
+func (h *BucketHandler) auditBucket(c *gin.Context, id uint) interface{} {
+	bucket, err := h.bucketService.GetBucketByID(c.Request.Context(), id, c.GetUint("user_id"), c.GetBool("is_root"))
+	if err != nil {
+		return nil
+	}
+	return gin.H{
+		"name":                   bucket.Name,
+		"description":            bucket.Description,
+		"owner_id":               bucket.OwnerID,
+		"max_file_bytes":         bucket.MaxFileBytes,
+		"allowed_types":          bucket.AllowedTypes,
+		"denied_types":           bucket.DeniedTypes,
+		"allowed_extensions":     bucket.AllowedExtensions,
+		"denied_extensions":      bucket.DeniedExtensions,
+		"object_lock_enabled":    bucket.ObjectLockEnabled,
+		"retention_mode":         bucket.RetentionMode,
+		"default_retention_days": bucket.DefaultRetentionDays,
+	}
+}
+
+// auditPermissions returns the permissions of a bucket, or nil if the current user cannot see them
+func (h *BucketHandler) auditPermissions(c *gin.Context, id uint) interface{} {
+	permissions, err := h.bucketService.GetBucketPermissions(c.Request.Context(), id, c.GetUint("user_id"), c.GetBool("is_root"))
+	if err != nil {
+		return nil
+	}
+	return permissions
+}
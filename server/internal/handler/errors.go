@@ -0,0 +1,36 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/minorcell/pfss/internal/authz"
+	"github.com/minorcell/pfss/internal/service"
+	"github.com/minorcell/pfss/pkg/util"
+)
+
+// serviceError converts a service error into an error response. Authorization
+// failures become 403 Forbidden, concurrent modifications and existing content
+// 409 Conflict, rejected uploads 413 or 415, locked files 423 Locked and
+// exceeded quotas 507 Insufficient Storage; everything else uses the given
+// status code.
+func serviceError(err error, code int) *util.ErrorResponse {
+	switch {
+	case errors.Is(err, authz.ErrPermissionDenied):
+		code = http.StatusForbidden
+	case errors.Is(err, service.ErrPermissionVersionConflict), errors.Is(err, service.ErrObjectExists):
+		code = http.StatusConflict
+	case errors.Is(err, service.ErrFileTooLarge):
+		code = http.StatusRequestEntityTooLarge
+	case errors.Is(err, service.ErrFileTypeNotAllowed):
+		code = http.StatusUnsupportedMediaType
+	case errors.Is(err, service.ErrObjectLocked):
+		code = http.StatusLocked
+	case errors.Is(err, service.ErrQuotaExceeded):
+		code = http.StatusInsufficientStorage
+	}
+	return &util.ErrorResponse{
+		Code:    code,
+		Message: err.Error(),
+	}
+}
@@ -1,46 +1,108 @@
 package handler
 
 import (
+	"errors"
+	"mime"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/minorcell/pfss/internal/authz"
 	"github.com/minorcell/pfss/internal/model"
 	"github.com/minorcell/pfss/internal/service"
 	"github.com/minorcell/pfss/pkg/util"
 )
 
+// multipartOverhead is the room left in upload requests for the multipart
+// boundaries, headers and form fields around the file content
+const multipartOverhead = 1 << 20
+
 // FileHandler handles file-related requests
 type FileHandler struct {
-	fileService *service.FileService
+	fileService  *service.FileService
+	auditService *service.AuditService
 }
 
 // NewFileHandler creates a new file handler
-func NewFileHandler(fileService *service.FileService) *FileHandler {
+func NewFileHandler(fileService *service.FileService, auditService *service.AuditService) *FileHandler {
 	return &FileHandler{
-		fileService: fileService,
+		fileService:  fileService,
+		auditService: auditService,
 	}
 }
 
 // CreateFile godoc
 // @Summary Upload file to bucket
-// @Description Upload a file to a specific bucket. The file will be stored in the 'upload/{bucket_name}' directory.
-// @Description The file name will be made unique by appending a timestamp.
+// @Description Upload a file to a directory of a bucket. The file will be stored in the 'upload/{bucket_id}/{path}' directory.
+// @Description The file name will be made unique by appending a timestamp and a random suffix.
 // @Tags files
 // @Accept multipart/form-data
 // @Produce json
 // @Security Bearer
-// @Param bucket_id formData string true "Target bucket ID to upload the file to"
+// @Param bucket_id query string false "Target bucket ID; given here the bucket size limit applies to the request body"
+// @Param bucket_id formData string false "Target bucket ID, if not given in the query string"
+// @Param path formData string false "Directory inside the bucket, e.g. /incoming/ (default /)"
 // @Param file formData file true "The file to upload (supports any file type)"
 // @Success 201 {object} model.FileResponse "File uploaded successfully"
 // @Failure 400 {object} util.ErrorResponse "Invalid request, missing file, or invalid bucket ID"
 // @Failure 401 {object} util.ErrorResponse "Unauthorized - valid JWT token required"
 // @Failure 403 {object} util.ErrorResponse "Permission denied - requires write access to bucket"
+// @Failure 413 {object} util.ErrorResponse "File exceeds the global or bucket size limit"
+// @Failure 415 {object} util.ErrorResponse "File type or extension not allowed in the bucket"
 // @Failure 500 {object} util.ErrorResponse "Internal server error"
+// @Failure 507 {object} util.ErrorResponse "User or bucket storage quota exceeded"
 // @Router /files [post]
 func (h *FileHandler) CreateFile(c *gin.Context) {
-	// Get bucket ID from form
-	bucketID, err := strconv.ParseUint(c.PostForm("bucket_id"), 10, 32)
+	// The form is only available once the body has been read, so the bucket
+	// limit can only be applied to the body if the bucket is in the query string
+	queryBucketID := c.Query("bucket_id")
+	max := h.fileService.MaxUploadBytes()
+	if queryBucketID != "" {
+		id, err := strconv.ParseUint(queryBucketID, 10, 32)
+		if err != nil {
+			util.SendError(c, &util.ErrorResponse{
+				Code:    http.StatusBadRequest,
+				Message: "Invalid bucket ID",
+			})
+			return
+		}
+		max = h.fileService.BucketMaxUploadBytes(c.Request.Context(), uint(id))
+	}
+
+	// Limit the request body to the file size limit, leaving room for the multipart framing
+	if max > 0 {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, max+multipartOverhead)
+	}
+	if _, err := c.MultipartForm(); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			util.SendError(c, &util.ErrorResponse{
+				Code:    http.StatusRequestEntityTooLarge,
+				Message: "File too large",
+			})
+			return
+		}
+		util.SendError(c, &util.ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid multipart form",
+		})
+		return
+	}
+
+	// Get bucket ID from the query string or the form
+	formBucketID := c.PostForm("bucket_id")
+	if queryBucketID != "" {
+		if formBucketID != "" && formBucketID != queryBucketID {
+			util.SendError(c, &util.ErrorResponse{
+				Code:    http.StatusBadRequest,
+				Message: "Bucket ID in query and form differ",
+			})
+			return
+		}
+		formBucketID = queryBucketID
+	}
+	bucketID, err := strconv.ParseUint(formBucketID, 10, 32)
 	if err != nil {
 		util.SendError(c, &util.ErrorResponse{
 			Code:    http.StatusBadRequest,
@@ -63,12 +125,19 @@ func (h *FileHandler) CreateFile(c *gin.Context) {
 	isRoot := c.GetBool("is_root")
 
 	// Upload file and create record
-	fileInfo, err := h.fileService.UploadFile(uint(bucketID), file, userID, isRoot)
+	fileInfo, err := h.fileService.UploadFile(c.Request.Context(), uint(bucketID), c.PostForm("path"), file, userID, isRoot)
+	event := newAuditEvent(c, model.AuditFileUpload, authz.KindFile, 0)
+	if fileInfo != nil {
+		event.TargetID = fileInfo.ID
+	}
+	h.auditService.Record(event, nil, gin.H{
+		"bucket_id": bucketID,
+		"dir":       c.PostForm("path"),
+		"name":      file.Filename,
+		"size":      file.Size,
+	}, err)
 	if err != nil {
-		util.SendError(c, &util.ErrorResponse{
-			Code:    http.StatusBadRequest,
-			Message: err.Error(),
-		})
+		util.SendError(c, serviceError(err, http.StatusBadRequest))
 		return
 	}
 
@@ -113,12 +182,9 @@ func (h *FileHandler) ListFiles(c *gin.Context) {
 	userID := c.GetUint("user_id")
 	isRoot := c.GetBool("is_root")
 
-	files, total, err := h.fileService.GetFiles(uint(bucketID), userID, isRoot, page, pageSize)
+	files, total, err := h.fileService.GetFiles(c.Request.Context(), uint(bucketID), userID, isRoot, page, pageSize)
 	if err != nil {
-		util.SendError(c, &util.ErrorResponse{
-			Code:    http.StatusInternalServerError,
-			Message: "Failed to get files: " + err.Error(),
-		})
+		util.SendError(c, serviceError(err, http.StatusInternalServerError))
 		return
 	}
 
@@ -136,6 +202,7 @@ func (h *FileHandler) ListFiles(c *gin.Context) {
 			CreatedAt:   model.JSONTime(file.CreatedAt),
 			UpdatedAt:   model.JSONTime(file.UpdatedAt),
 		}
+		fileResponses[i].SetObjectLock(&file)
 	}
 
 	c.JSON(http.StatusOK, model.FileListResponse{
@@ -170,16 +237,13 @@ func (h *FileHandler) GetFile(c *gin.Context) {
 	userID := c.GetUint("user_id")
 	isRoot := c.GetBool("is_root")
 
-	file, err := h.fileService.GetFileByID(uint(id), userID, isRoot)
+	file, err := h.fileService.GetFileByID(c.Request.Context(), uint(id), userID, isRoot)
 	if err != nil {
-		util.SendError(c, &util.ErrorResponse{
-			Code:    http.StatusNotFound,
-			Message: err.Error(),
-		})
+		util.SendError(c, serviceError(err, http.StatusNotFound))
 		return
 	}
 
-	c.JSON(http.StatusOK, model.FileResponse{
+	response := model.FileResponse{
 		ID:          file.ID,
 		BucketID:    file.BucketID,
 		Name:        file.Name,
@@ -189,7 +253,72 @@ func (h *FileHandler) GetFile(c *gin.Context) {
 		Metadata:    file.Metadata,
 		CreatedAt:   model.JSONTime(file.CreatedAt),
 		UpdatedAt:   model.JSONTime(file.UpdatedAt),
-	})
+	}
+	response.SetObjectLock(file)
+
+	c.JSON(http.StatusOK, response)
+}
+
+// DownloadFile godoc
+// @Summary Download file content
+// @Description Download the content of a file. Requires read access to the file's path. Range requests are supported; the object lock of the file is reported in the X-PFSS-Retention-Mode, X-PFSS-Retain-Until and X-PFSS-Legal-Hold headers.
+// @Tags files
+// @Produce octet-stream
+// @Security Bearer
+// @Param id path int true "File ID"
+// @Success 200 {file} file "File content"
+// @Success 206 {file} file "Requested range of the file content"
+// @Failure 400,401,403,404 {object} util.ErrorResponse
+// @Router /files/{id}/content [get]
+func (h *FileHandler) DownloadFile(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		util.SendError(c, &util.ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid file ID",
+		})
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	isRoot := c.GetBool("is_root")
+
+	file, content, err := h.fileService.OpenFile(c.Request.Context(), uint(id), userID, isRoot)
+	var after interface{}
+	if file != nil {
+		after = gin.H{"bucket_id": file.BucketID, "path": file.Path, "size": file.Size}
+	}
+	h.auditService.Record(newAuditEvent(c, model.AuditFileDownload, authz.KindFile, uint(id)), nil, after, err)
+	if err != nil {
+		util.SendError(c, serviceError(err, http.StatusNotFound))
+		return
+	}
+	defer content.Close()
+
+	info, err := content.Stat()
+	if err != nil {
+		util.SendError(c, &util.ErrorResponse{
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to read file content",
+		})
+		return
+	}
+
+	// Never let browsers render stored content as a page of this origin
+	contentType := file.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": file.Name}))
+	c.Header("X-Content-Type-Options", "nosniff")
+	if file.RetainUntil != nil {
+		c.Header("X-PFSS-Retention-Mode", file.RetentionMode)
+		c.Header("X-PFSS-Retain-Until", file.RetainUntil.UTC().Format(time.RFC3339))
+	}
+	c.Header("X-PFSS-Legal-Hold", strconv.FormatBool(file.LegalHold))
+
+	http.ServeContent(c.Writer, c.Request, file.Name, info.ModTime(), content)
 }
 
 // DeleteFile godoc
@@ -200,8 +329,9 @@ func (h *FileHandler) GetFile(c *gin.Context) {
 // @Produce json
 // @Security Bearer
 // @Param id path int true "File ID"
+// @Param X-PFSS-Bypass-Governance header bool false "Bypass governance retention (requires the bypass_governance grant)"
 // @Success 204 "No Content"
-// @Failure 400,401,403,404 {object} util.ErrorResponse
+// @Failure 400,401,403,404,423 {object} util.ErrorResponse
 // @Router /files/{id} [delete]
 func (h *FileHandler) DeleteFile(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
@@ -216,13 +346,126 @@ func (h *FileHandler) DeleteFile(c *gin.Context) {
 	userID := c.GetUint("user_id")
 	isRoot := c.GetBool("is_root")
 
-	if err := h.fileService.DeleteFile(uint(id), userID, isRoot); err != nil {
+	before := h.auditFile(c, uint(id))
+	err = h.fileService.DeleteFile(c.Request.Context(), uint(id), userID, isRoot, bypassGovernance(c))
+	h.auditService.Record(newAuditEvent(c, model.AuditFileDelete, authz.KindFile, uint(id)), before, nil, err)
+	if err != nil {
+		util.SendError(c, serviceError(err, http.StatusBadRequest))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "File deleted successfully"})
+}
+
+// SetFileRetention godoc
+// @Summary Set file retention
+// @Description Set the retention mode and retain-until date of a file in a bucket with object lock. Retention can always be extended; shortening or removing it is impossible in compliance mode and requires a governance bypass otherwise.
+// @Tags files
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "File ID"
+// @Param X-PFSS-Bypass-Governance header bool false "Bypass governance retention (requires the bypass_governance grant)"
+// @Param request body model.FileRetentionRequest true "Retention"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400,401,403,404,423 {object} util.ErrorResponse
+// @Router /files/{id}/retention [put]
+func (h *FileHandler) SetFileRetention(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		util.SendError(c, &util.ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid file ID",
+		})
+		return
+	}
+
+	var req model.FileRetentionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.SendError(c, &util.ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	isRoot := c.GetBool("is_root")
+
+	before := h.auditFile(c, uint(id))
+	err = h.fileService.SetRetention(c.Request.Context(), uint(id), &req, userID, isRoot, bypassGovernance(c))
+	h.auditService.Record(newAuditEvent(c, model.AuditFileRetention, authz.KindFile, uint(id)), before, h.auditFile(c, uint(id)), err)
+	if err != nil {
+		util.SendError(c, serviceError(err, http.StatusBadRequest))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "File retention updated successfully"})
+}
+
+// SetFileLegalHold godoc
+// @Summary Set file legal hold
+// @Description Place or release a legal hold on a file. Files under legal hold cannot be deleted or changed by anyone until the hold is released.
+// @Tags files
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "File ID"
+// @Param request body model.FileLegalHoldRequest true "Legal hold"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400,401,403,404 {object} util.ErrorResponse
+// @Router /files/{id}/legal-hold [put]
+func (h *FileHandler) SetFileLegalHold(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
 		util.SendError(c, &util.ErrorResponse{
 			Code:    http.StatusBadRequest,
-			Message: err.Error(),
+			Message: "Invalid file ID",
 		})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "File deleted successfully"})
+	var req model.FileLegalHoldRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.SendError(c, &util.ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	isRoot := c.GetBool("is_root")
+
+	before := h.auditFile(c, uint(id))
+	err = h.fileService.SetLegalHold(c.Request.Context(), uint(id), *req.LegalHold, userID, isRoot)
+	h.auditService.Record(newAuditEvent(c, model.AuditFileLegalHold, authz.KindFile, uint(id)), before, h.auditFile(c, uint(id)), err)
+	if err != nil {
+		util.SendError(c, serviceError(err, http.StatusBadRequest))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "File legal hold updated successfully"})
+}
+
+// auditFile returns the audited fields of a file, or nil if the current user cannot see it
+func (h *FileHandler) auditFile(c *gin.Context, id uint) interface{} {
+	file, err := h.fileService.GetFileByID(c.Request.Context(), id, c.GetUint("user_id"), c.GetBool("is_root"))
+	if err != nil {
+		return nil
+	}
+	return gin.H{
+		"bucket_id":      file.BucketID,
+		"path":           file.Path,
+		"size":           file.Size,
+		"retention_mode": file.RetentionMode,
+		"retain_until":   file.RetainUntil,
+		"legal_hold":     file.LegalHold,
+	}
+}
+
+// bypassGovernance reports whether the request asks to bypass governance retention
+func bypassGovernance(c *gin.Context) bool {
+	bypass, _ := strconv.ParseBool(c.GetHeader("X-PFSS-Bypass-Governance"))
+	return bypass
 }
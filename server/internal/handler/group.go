@@ -0,0 +1,312 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/minorcell/pfss/internal/authz"
+	"github.com/minorcell/pfss/internal/model"
+	"github.com/minorcell/pfss/internal/service"
+	"github.com/minorcell/pfss/pkg/util"
+)
+
+// GroupHandler handles group-related requests
+type GroupHandler struct {
+	groupService *service.GroupService
+	auditService *service.AuditService
+}
+
+// NewGroupHandler creates a new group handler
+func NewGroupHandler(groupService *service.GroupService, auditService *service.AuditService) *GroupHandler {
+	return &GroupHandler{
+		groupService: groupService,
+		auditService: auditService,
+	}
+}
+
+// CreateGroup godoc
+// @Summary Create group
+// @Description Create a new user group
+// @Tags groups
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param request body model.GroupCreateRequest true "Group creation request"
+// @Success 201 {object} model.Group
+// @Failure 400,401,403 {object} util.ErrorResponse
+// @Router /groups [post]
+func (h *GroupHandler) CreateGroup(c *gin.Context) {
+	var req model.GroupCreateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.SendError(c, &util.ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	currentUserID := c.GetUint("user_id")
+	isRoot := c.GetBool("is_root")
+
+	group, err := h.groupService.CreateGroup(c.Request.Context(), &req, currentUserID, isRoot)
+	event := newAuditEvent(c, model.AuditGroupCreate, authz.KindGroup, 0)
+	if group != nil {
+		event.TargetID = group.ID
+	}
+	h.auditService.Record(event, nil, req, err)
+	if err != nil {
+		util.SendError(c, serviceError(err, http.StatusBadRequest))
+		return
+	}
+
+	c.JSON(http.StatusCreated, group)
+}
+
+// ListGroups godoc
+// @Summary List groups
+// @Description Get a list of groups with pagination
+// @Tags groups
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param page query int false "Page number"
+// @Param page_size query int false "Page size"
+// @Success 200 {object} model.GroupListResponse
+// @Failure 400,401,403 {object} util.ErrorResponse
+// @Router /groups [get]
+func (h *GroupHandler) ListGroups(c *gin.Context) {
+	// Get pagination parameters
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "10"))
+
+	// Validate pagination parameters
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 10
+	}
+
+	currentUserID := c.GetUint("user_id")
+	isRoot := c.GetBool("is_root")
+
+	groups, total, err := h.groupService.GetGroups(c.Request.Context(), page, pageSize, currentUserID, isRoot)
+	if err != nil {
+		util.SendError(c, serviceError(err, http.StatusInternalServerError))
+		return
+	}
+
+	c.JSON(http.StatusOK, model.GroupListResponse{
+		Groups:     groups,
+		TotalCount: total,
+		Page:       page,
+		PageSize:   pageSize,
+	})
+}
+
+// GetGroup godoc
+// @Summary Get group details
+// @Description Get details of a specific group including its members
+// @Tags groups
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Group ID"
+// @Success 200 {object} model.GroupResponse
+// @Failure 400,401,403,404 {object} util.ErrorResponse
+// @Router /groups/{id} [get]
+func (h *GroupHandler) GetGroup(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		util.SendError(c, &util.ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid group ID",
+		})
+		return
+	}
+
+	currentUserID := c.GetUint("user_id")
+	isRoot := c.GetBool("is_root")
+
+	group, err := h.groupService.GetGroup(c.Request.Context(), uint(id), currentUserID, isRoot)
+	if err != nil {
+		if errors.Is(err, authz.ErrPermissionDenied) {
+			util.SendError(c, serviceError(err, http.StatusForbidden))
+			return
+		}
+		util.SendError(c, &util.ErrorResponse{
+			Code:    http.StatusNotFound,
+			Message: "Group not found",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, group)
+}
+
+// UpdateGroup godoc
+// @Summary Update group
+// @Description Update group information
+// @Tags groups
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Group ID"
+// @Param request body model.GroupUpdateRequest true "Group update request"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400,401,403,404 {object} util.ErrorResponse
+// @Router /groups/{id} [put]
+func (h *GroupHandler) UpdateGroup(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		util.SendError(c, &util.ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid group ID",
+		})
+		return
+	}
+
+	var req model.GroupUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.SendError(c, &util.ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	currentUserID := c.GetUint("user_id")
+	isRoot := c.GetBool("is_root")
+
+	if err := h.groupService.UpdateGroup(c.Request.Context(), uint(id), &req, currentUserID, isRoot); err != nil {
+		util.SendError(c, serviceError(err, http.StatusBadRequest))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Group updated successfully"})
+}
+
+// DeleteGroup godoc
+// @Summary Delete group
+// @Description Delete a group, its memberships and its bucket permissions
+// @Tags groups
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Group ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400,401,403,404 {object} util.ErrorResponse
+// @Router /groups/{id} [delete]
+func (h *GroupHandler) DeleteGroup(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		util.SendError(c, &util.ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid group ID",
+		})
+		return
+	}
+
+	currentUserID := c.GetUint("user_id")
+	isRoot := c.GetBool("is_root")
+
+	before, _ := h.groupService.GetGroupByID(c.Request.Context(), uint(id))
+	err = h.groupService.DeleteGroup(c.Request.Context(), uint(id), currentUserID, isRoot)
+	h.auditService.Record(newAuditEvent(c, model.AuditGroupDelete, authz.KindGroup, uint(id)), before, nil, err)
+	if err != nil {
+		util.SendError(c, serviceError(err, http.StatusBadRequest))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Group deleted successfully"})
+}
+
+// AddGroupMember godoc
+// @Summary Add group member
+// @Description Add a user to a group
+// @Tags groups
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Group ID"
+// @Param request body model.GroupMemberRequest true "Group member request"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400,401,403,404 {object} util.ErrorResponse
+// @Router /groups/{id}/members [post]
+func (h *GroupHandler) AddGroupMember(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		util.SendError(c, &util.ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid group ID",
+		})
+		return
+	}
+
+	var req model.GroupMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.SendError(c, &util.ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	currentUserID := c.GetUint("user_id")
+	isRoot := c.GetBool("is_root")
+
+	err = h.groupService.AddMember(c.Request.Context(), uint(id), req.UserID, currentUserID, isRoot)
+	h.auditService.Record(newAuditEvent(c, model.AuditGroupMemberAdd, authz.KindGroup, uint(id)), nil, req, err)
+	if err != nil {
+		util.SendError(c, serviceError(err, http.StatusBadRequest))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Group member added successfully"})
+}
+
+// RemoveGroupMember godoc
+// @Summary Remove group member
+// @Description Remove a user from a group
+// @Tags groups
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Group ID"
+// @Param user_id path int true "User ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400,401,403,404 {object} util.ErrorResponse
+// @Router /groups/{id}/members/{user_id} [delete]
+func (h *GroupHandler) RemoveGroupMember(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		util.SendError(c, &util.ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid group ID",
+		})
+		return
+	}
+
+	userID, err := strconv.ParseUint(c.Param("user_id"), 10, 32)
+	if err != nil {
+		util.SendError(c, &util.ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid user ID",
+		})
+		return
+	}
+
+	currentUserID := c.GetUint("user_id")
+	isRoot := c.GetBool("is_root")
+
+	err = h.groupService.RemoveMember(c.Request.Context(), uint(id), uint(userID), currentUserID, isRoot)
+	h.auditService.Record(newAuditEvent(c, model.AuditGroupMemberRemove, authz.KindGroup, uint(id)), gin.H{"user_id": userID}, nil, err)
+	if err != nil {
+		util.SendError(c, serviceError(err, http.StatusBadRequest))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Group member removed successfully"})
+}
@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/minorcell/pfss/pkg/health"
+)
+
+// HealthHandler handles liveness and readiness probes
+type HealthHandler struct {
+	checker *health.Checker
+}
+
+// NewHealthHandler creates a new health handler
+func NewHealthHandler(checker *health.Checker) *HealthHandler {
+	return &HealthHandler{
+		checker: checker,
+	}
+}
+
+// Livez godoc
+// @Summary Liveness probe
+// @Description Report that the process is running and serving HTTP. Dependencies are not checked.
+// @Tags health
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /livez [get]
+func (h *HealthHandler) Livez(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": health.StatusOK})
+}
+
+// Readyz godoc
+// @Summary Readiness probe
+// @Description Check the database, the storage directory and the schema. Returns 503 with the status of each check if any check fails or the server is shutting down. Failure details are only logged.
+// @Tags health
+// @Produce json
+// @Success 200 {object} health.Report
+// @Failure 503 {object} health.Report
+// @Router /readyz [get]
+func (h *HealthHandler) Readyz(c *gin.Context) {
+	report, ready := h.checker.Ready(c.Request.Context())
+
+	// Probes are unauthenticated, so check errors are logged with the request
+	// rather than returned
+	for name, result := range report.Checks {
+		if result.Error != "" {
+			c.Error(fmt.Errorf("readiness check %s failed: %s", name, result.Error))
+			result.Error = ""
+			report.Checks[name] = result
+		}
+	}
+
+	if !ready {
+		c.JSON(http.StatusServiceUnavailable, report)
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
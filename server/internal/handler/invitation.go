@@ -0,0 +1,144 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/minorcell/pfss/internal/model"
+	"github.com/minorcell/pfss/internal/service"
+	"github.com/minorcell/pfss/pkg/util"
+)
+
+// InvitationHandler handles invitation-related requests
+type InvitationHandler struct {
+	invitationService *service.InvitationService
+	auditService      *service.AuditService
+}
+
+// NewInvitationHandler creates a new invitation handler
+func NewInvitationHandler(invitationService *service.InvitationService, auditService *service.AuditService) *InvitationHandler {
+	return &InvitationHandler{
+		invitationService: invitationService,
+		auditService:      auditService,
+	}
+}
+
+// CreateInvitation godoc
+// @Summary Create invitation
+// @Description Create a single-use registration invitation with an optional role, bucket grants and expiry. The token is only returned once.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param request body model.InvitationCreateRequest true "Invitation create request"
+// @Success 201 {object} model.InvitationResponse
+// @Failure 400,401,403 {object} util.ErrorResponse
+// @Router /admin/invitations [post]
+func (h *InvitationHandler) CreateInvitation(c *gin.Context) {
+	var req model.InvitationCreateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.SendError(c, &util.ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	isRoot := c.GetBool("is_root")
+
+	resp, err := h.invitationService.CreateInvitation(&req, userID, isRoot)
+	event := newAuditEvent(c, model.AuditInvitationCreate, model.AuditTargetInvitation, 0)
+	var after interface{}
+	if resp != nil {
+		event.TargetID = resp.Invitation.ID
+		after = resp.Invitation
+	}
+	h.auditService.Record(event, nil, after, err)
+	if err != nil {
+		util.SendError(c, &util.ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, resp)
+}
+
+// ListInvitations godoc
+// @Summary List invitations
+// @Description Get a list of invitations with pagination
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param page query int false "Page number"
+// @Param page_size query int false "Page size"
+// @Success 200 {object} model.InvitationListResponse
+// @Failure 400,401,403 {object} util.ErrorResponse
+// @Router /admin/invitations [get]
+func (h *InvitationHandler) ListInvitations(c *gin.Context) {
+	// Get pagination parameters
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "10"))
+
+	// Validate pagination parameters
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 10
+	}
+
+	invitations, total, err := h.invitationService.GetInvitations(page, pageSize)
+	if err != nil {
+		util.SendError(c, &util.ErrorResponse{
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to get invitations: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.InvitationListResponse{
+		Invitations: invitations,
+		TotalCount:  total,
+		Page:        page,
+		PageSize:    pageSize,
+	})
+}
+
+// RevokeInvitation godoc
+// @Summary Revoke invitation
+// @Description Revoke an unused invitation
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Invitation ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400,401,403 {object} util.ErrorResponse
+// @Router /admin/invitations/{id} [delete]
+func (h *InvitationHandler) RevokeInvitation(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		util.SendError(c, &util.ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid invitation ID",
+		})
+		return
+	}
+
+	err = h.invitationService.RevokeInvitation(uint(id), c.GetUint("user_id"))
+	h.auditService.Record(newAuditEvent(c, model.AuditInvitationRevoke, model.AuditTargetInvitation, uint(id)), nil, nil, err)
+	if err != nil {
+		util.SendError(c, &util.ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Invitation revoked successfully"})
+}
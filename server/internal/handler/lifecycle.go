@@ -0,0 +1,273 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/minorcell/pfss/internal/authz"
+	"github.com/minorcell/pfss/internal/model"
+	"github.com/minorcell/pfss/internal/service"
+	"github.com/minorcell/pfss/pkg/util"
+)
+
+// LifecycleHandler handles lifecycle-rule-related requests
+type LifecycleHandler struct {
+	lifecycleService *service.LifecycleService
+	auditService     *service.AuditService
+}
+
+// NewLifecycleHandler creates a new lifecycle handler
+func NewLifecycleHandler(lifecycleService *service.LifecycleService, auditService *service.AuditService) *LifecycleHandler {
+	return &LifecycleHandler{
+		lifecycleService: lifecycleService,
+		auditService:     auditService,
+	}
+}
+
+// ListRules godoc
+// @Summary List lifecycle rules
+// @Description Get the lifecycle rules of a bucket
+// @Tags buckets
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Bucket ID"
+// @Success 200 {array} model.LifecycleRule
+// @Failure 400,401,403 {object} util.ErrorResponse
+// @Router /buckets/{id}/lifecycle-rules [get]
+func (h *LifecycleHandler) ListRules(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		util.SendError(c, &util.ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid bucket ID",
+		})
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	isRoot := c.GetBool("is_root")
+
+	rules, err := h.lifecycleService.GetRules(c.Request.Context(), uint(id), userID, isRoot)
+	if err != nil {
+		util.SendError(c, serviceError(err, http.StatusInternalServerError))
+		return
+	}
+
+	c.JSON(http.StatusOK, rules)
+}
+
+// CreateRule godoc
+// @Summary Create lifecycle rule
+// @Description Add a rule removing files of a bucket by age, keeping only the last versions of a file, or aborting incomplete uploads. Prefix and tag filters select the files.
+// @Tags buckets
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Bucket ID"
+// @Param request body model.LifecycleRuleRequest true "Lifecycle rule"
+// @Success 201 {object} model.LifecycleRule
+// @Failure 400,401,403,404 {object} util.ErrorResponse
+// @Router /buckets/{id}/lifecycle-rules [post]
+func (h *LifecycleHandler) CreateRule(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		util.SendError(c, &util.ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid bucket ID",
+		})
+		return
+	}
+
+	var req model.LifecycleRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.SendError(c, &util.ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	isRoot := c.GetBool("is_root")
+
+	rule, err := h.lifecycleService.CreateRule(c.Request.Context(), uint(id), &req, userID, isRoot)
+	h.auditService.Record(newAuditEvent(c, model.AuditBucketLifecycle, authz.KindBucket, uint(id)), nil, rule, err)
+	if err != nil {
+		util.SendError(c, serviceError(err, http.StatusBadRequest))
+		return
+	}
+
+	c.JSON(http.StatusCreated, rule)
+}
+
+// UpdateRule godoc
+// @Summary Update lifecycle rule
+// @Description Replace a lifecycle rule of a bucket
+// @Tags buckets
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Bucket ID"
+// @Param rule_id path int true "Rule ID"
+// @Param request body model.LifecycleRuleRequest true "Lifecycle rule"
+// @Success 200 {object} model.LifecycleRule
+// @Failure 400,401,403,404 {object} util.ErrorResponse
+// @Router /buckets/{id}/lifecycle-rules/{rule_id} [put]
+func (h *LifecycleHandler) UpdateRule(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		util.SendError(c, &util.ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid bucket ID",
+		})
+		return
+	}
+
+	ruleID, err := strconv.ParseUint(c.Param("rule_id"), 10, 32)
+	if err != nil {
+		util.SendError(c, &util.ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid rule ID",
+		})
+		return
+	}
+
+	var req model.LifecycleRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.SendError(c, &util.ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	isRoot := c.GetBool("is_root")
+
+	before := h.auditRule(c, uint(id), uint(ruleID))
+	rule, err := h.lifecycleService.UpdateRule(c.Request.Context(), uint(id), uint(ruleID), &req, userID, isRoot)
+	h.auditService.Record(newAuditEvent(c, model.AuditBucketLifecycle, authz.KindBucket, uint(id)), before, rule, err)
+	if err != nil {
+		util.SendError(c, serviceError(err, http.StatusBadRequest))
+		return
+	}
+
+	c.JSON(http.StatusOK, rule)
+}
+
+// DeleteRule godoc
+// @Summary Delete lifecycle rule
+// @Description Remove a lifecycle rule of a bucket
+// @Tags buckets
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Bucket ID"
+// @Param rule_id path int true "Rule ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400,401,403,404 {object} util.ErrorResponse
+// @Router /buckets/{id}/lifecycle-rules/{rule_id} [delete]
+func (h *LifecycleHandler) DeleteRule(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		util.SendError(c, &util.ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid bucket ID",
+		})
+		return
+	}
+
+	ruleID, err := strconv.ParseUint(c.Param("rule_id"), 10, 32)
+	if err != nil {
+		util.SendError(c, &util.ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid rule ID",
+		})
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	isRoot := c.GetBool("is_root")
+
+	before := h.auditRule(c, uint(id), uint(ruleID))
+	err = h.lifecycleService.DeleteRule(c.Request.Context(), uint(id), uint(ruleID), userID, isRoot)
+	h.auditService.Record(newAuditEvent(c, model.AuditBucketLifecycle, authz.KindBucket, uint(id)), before, nil, err)
+	if err != nil {
+		util.SendError(c, serviceError(err, http.StatusBadRequest))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Lifecycle rule deleted successfully"})
+}
+
+// DryRun godoc
+// @Summary Lifecycle dry run
+// @Description Report which files of a bucket the lifecycle rules would remove now, without removing them
+// @Tags buckets
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Bucket ID"
+// @Success 200 {object} model.LifecycleReport
+// @Failure 400,401,403 {object} util.ErrorResponse
+// @Router /buckets/{id}/lifecycle/dry-run [get]
+func (h *LifecycleHandler) DryRun(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		util.SendError(c, &util.ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid bucket ID",
+		})
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	isRoot := c.GetBool("is_root")
+
+	report, err := h.lifecycleService.DryRun(c.Request.Context(), uint(id), userID, isRoot)
+	if err != nil {
+		util.SendError(c, serviceError(err, http.StatusInternalServerError))
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// DryRunAll godoc
+// @Summary Lifecycle dry run for all buckets
+// @Description Report which files of every bucket the lifecycle rules would remove now, without removing them
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} model.LifecycleReport
+// @Failure 401,403 {object} util.ErrorResponse
+// @Router /admin/lifecycle/dry-run [get]
+func (h *LifecycleHandler) DryRunAll(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	isRoot := c.GetBool("is_root")
+
+	report, err := h.lifecycleService.DryRun(c.Request.Context(), 0, userID, isRoot)
+	if err != nil {
+		util.SendError(c, serviceError(err, http.StatusInternalServerError))
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// auditRule returns a lifecycle rule of a bucket, or nil if the current user cannot see it
+func (h *LifecycleHandler) auditRule(c *gin.Context, bucketID, ruleID uint) interface{} {
+	rules, err := h.lifecycleService.GetRules(c.Request.Context(), bucketID, c.GetUint("user_id"), c.GetBool("is_root"))
+	if err != nil {
+		return nil
+	}
+	for _, rule := range rules {
+		if rule.ID == ruleID {
+			return rule
+		}
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/minorcell/pfss/internal/authz"
+	"github.com/minorcell/pfss/internal/model"
+	"github.com/minorcell/pfss/internal/service"
+	"github.com/minorcell/pfss/pkg/metrics"
+	"github.com/minorcell/pfss/pkg/util"
+)
+
+// OIDCHandler handles OpenID Connect single sign-on requests
+type OIDCHandler struct {
+	oidcService  *service.OIDCService
+	auditService *service.AuditService
+}
+
+// NewOIDCHandler creates a new OIDC handler
+func NewOIDCHandler(oidcService *service.OIDCService, auditService *service.AuditService) *OIDCHandler {
+	return &OIDCHandler{
+		oidcService:  oidcService,
+		auditService: auditService,
+	}
+}
+
+// Login godoc
+// @Summary Start OIDC login
+// @Description Redirect to the OpenID Connect provider. With format=json the authorization URL is returned instead.
+// @Tags auth
+// @Produce json
+// @Param format query string false "Set to json to get the URL instead of a redirect"
+// @Success 200 {object} map[string]interface{}
+// @Success 302 "Redirect to the provider"
+// @Failure 500 {object} util.ErrorResponse
+// @Router /auth/oidc/login [get]
+func (h *OIDCHandler) Login(c *gin.Context) {
+	authURL, err := h.oidcService.LoginURL()
+	if err != nil {
+		util.SendError(c, &util.ErrorResponse{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	if c.Query("format") == "json" {
+		c.JSON(http.StatusOK, gin.H{"auth_url": authURL})
+		return
+	}
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// Callback godoc
+// @Summary Complete OIDC login
+// @Description Handle the provider redirect and issue a PFSS token
+// @Tags auth
+// @Produce json
+// @Param state query string true "Login state"
+// @Param code query string true "Authorization code"
+// @Success 200 {object} model.AuthResponse
+// @Failure 400,401 {object} util.ErrorResponse
+// @Router /auth/oidc/callback [get]
+func (h *OIDCHandler) Callback(c *gin.Context) {
+	if errCode := c.Query("error"); errCode != "" {
+		metrics.AuthFailures.WithLabelValues("oidc", "provider_error").Inc()
+		util.SendError(c, &util.ErrorResponse{
+			Code:    http.StatusUnauthorized,
+			Message: "Login failed: " + errCode + " " + c.Query("error_description"),
+		})
+		return
+	}
+
+	state := c.Query("state")
+	code := c.Query("code")
+	if state == "" || code == "" {
+		util.SendError(c, &util.ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Missing state or code",
+		})
+		return
+	}
+
+	resp, err := h.oidcService.Callback(c.Request.Context(), state, code)
+	event := newAuditEvent(c, model.AuditLogin, authz.KindUser, 0)
+	if resp != nil {
+		event.ActorID = resp.ID
+		event.ActorName = resp.Username
+		event.TargetID = resp.ID
+	}
+	h.auditService.Record(event, nil, gin.H{"provider": "oidc"}, err)
+	if err != nil {
+		metrics.AuthFailures.WithLabelValues("oidc", "rejected").Inc()
+		util.SendError(c, &util.ErrorResponse{
+			Code:    http.StatusUnauthorized,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,226 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/minorcell/pfss/internal/authz"
+	"github.com/minorcell/pfss/internal/model"
+	"github.com/minorcell/pfss/internal/service"
+	"github.com/minorcell/pfss/pkg/util"
+)
+
+// QuotaHandler handles quota-related requests
+type QuotaHandler struct {
+	quotaService *service.QuotaService
+	auditService *service.AuditService
+}
+
+// NewQuotaHandler creates a new quota handler
+func NewQuotaHandler(quotaService *service.QuotaService, auditService *service.AuditService) *QuotaHandler {
+	return &QuotaHandler{
+		quotaService: quotaService,
+		auditService: auditService,
+	}
+}
+
+// SetQuota godoc
+// @Summary Set quota
+// @Description Set the storage quota of a user or bucket. A limit of 0 means unlimited.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param scope path string true "Quota scope" Enums(users, buckets)
+// @Param id path int true "User or bucket ID"
+// @Param request body model.QuotaRequest true "Quota request"
+// @Success 200 {object} model.Quota
+// @Failure 400,401,403,404 {object} util.ErrorResponse
+// @Router /admin/quotas/{scope}/{id} [put]
+func (h *QuotaHandler) SetQuota(c *gin.Context) {
+	scope, id, ok := quotaTarget(c)
+	if !ok {
+		return
+	}
+
+	var req model.QuotaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.SendError(c, &util.ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	isRoot := c.GetBool("is_root")
+
+	before := h.auditQuota(c, scope, id)
+	quota, err := h.quotaService.SetQuota(c.Request.Context(), scope, id, &req, userID, isRoot)
+	h.auditService.Record(newQuotaAuditEvent(c, model.AuditQuotaSet, scope, id), before, h.auditQuota(c, scope, id), err)
+	if err != nil {
+		util.SendError(c, serviceError(err, http.StatusBadRequest))
+		return
+	}
+
+	c.JSON(http.StatusOK, quota)
+}
+
+// DeleteQuota godoc
+// @Summary Delete quota
+// @Description Remove the quota of a user or bucket so the default quota applies again
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param scope path string true "Quota scope" Enums(users, buckets)
+// @Param id path int true "User or bucket ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400,401,403,404 {object} util.ErrorResponse
+// @Router /admin/quotas/{scope}/{id} [delete]
+func (h *QuotaHandler) DeleteQuota(c *gin.Context) {
+	scope, id, ok := quotaTarget(c)
+	if !ok {
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	isRoot := c.GetBool("is_root")
+
+	before := h.auditQuota(c, scope, id)
+	err := h.quotaService.DeleteQuota(c.Request.Context(), scope, id, userID, isRoot)
+	h.auditService.Record(newQuotaAuditEvent(c, model.AuditQuotaDelete, scope, id), before, h.auditQuota(c, scope, id), err)
+	if err != nil {
+		util.SendError(c, serviceError(err, http.StatusBadRequest))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Quota deleted successfully"})
+}
+
+// ListQuotas godoc
+// @Summary Quota usage report
+// @Description Get the usage of every user and bucket with its own quota, with warnings for limits that are nearly or fully reached
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Success 200 {array} model.QuotaUsage
+// @Failure 401,403 {object} util.ErrorResponse
+// @Router /admin/quotas [get]
+func (h *QuotaHandler) ListQuotas(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	isRoot := c.GetBool("is_root")
+
+	report, err := h.quotaService.GetQuotaReport(c.Request.Context(), userID, isRoot)
+	if err != nil {
+		util.SendError(c, serviceError(err, http.StatusInternalServerError))
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// GetUserUsage godoc
+// @Summary Get user storage usage
+// @Description Get the storage used by a user against their quota
+// @Tags users
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "User ID"
+// @Success 200 {object} model.QuotaUsage
+// @Failure 400,401,403,404 {object} util.ErrorResponse
+// @Router /users/{id}/usage [get]
+func (h *QuotaHandler) GetUserUsage(c *gin.Context) {
+	h.getUsage(c, model.QuotaScopeUser)
+}
+
+// GetBucketUsage godoc
+// @Summary Get bucket storage usage
+// @Description Get the storage used in a bucket against its quota
+// @Tags buckets
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Bucket ID"
+// @Success 200 {object} model.QuotaUsage
+// @Failure 400,401,403,404 {object} util.ErrorResponse
+// @Router /buckets/{id}/usage [get]
+func (h *QuotaHandler) GetBucketUsage(c *gin.Context) {
+	h.getUsage(c, model.QuotaScopeBucket)
+}
+
+// getUsage reports the usage of the user or bucket given by the id parameter
+func (h *QuotaHandler) getUsage(c *gin.Context, scope string) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		util.SendError(c, &util.ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid " + scope + " ID",
+		})
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	isRoot := c.GetBool("is_root")
+
+	usage, err := h.quotaService.GetUsage(c.Request.Context(), scope, uint(id), userID, isRoot)
+	if err != nil {
+		util.SendError(c, serviceError(err, http.StatusNotFound))
+		return
+	}
+
+	c.JSON(http.StatusOK, usage)
+}
+
+// newQuotaAuditEvent returns an audit event targeting the user or bucket of a quota
+func newQuotaAuditEvent(c *gin.Context, action, scope string, id uint) *model.AuditEvent {
+	targetType := authz.KindUser
+	if scope == model.QuotaScopeBucket {
+		targetType = authz.KindBucket
+	}
+	return newAuditEvent(c, action, targetType, id)
+}
+
+// auditQuota returns the limits that apply to a user or bucket, or nil if the current user cannot see them
+func (h *QuotaHandler) auditQuota(c *gin.Context, scope string, id uint) interface{} {
+	usage, err := h.quotaService.GetUsage(c.Request.Context(), scope, id, c.GetUint("user_id"), c.GetBool("is_root"))
+	if err != nil {
+		return nil
+	}
+	return gin.H{
+		"max_bytes":    usage.MaxBytes,
+		"max_files":    usage.MaxFiles,
+		"warn_percent": usage.WarnPercent,
+	}
+}
+
+// quotaTarget parses the scope and id parameters, sending an error response if they are invalid
+func quotaTarget(c *gin.Context) (string, uint, bool) {
+	var scope string
+	switch c.Param("scope") {
+	case "users":
+		scope = model.QuotaScopeUser
+	case "buckets":
+		scope = model.QuotaScopeBucket
+	default:
+		util.SendError(c, &util.ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid quota scope, expected users or buckets",
+		})
+		return "", 0, false
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		util.SendError(c, &util.ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid " + scope + " ID",
+		})
+		return "", 0, false
+	}
+
+	return scope, uint(id), true
+}
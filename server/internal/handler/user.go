@@ -1,10 +1,12 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/minorcell/pfss/internal/authz"
 	"github.com/minorcell/pfss/internal/model"
 	"github.com/minorcell/pfss/internal/service"
 	"github.com/minorcell/pfss/pkg/util"
@@ -12,13 +14,15 @@ import (
 
 // UserHandler handles user-related requests
 type UserHandler struct {
-	userService *service.UserService
+	userService  *service.UserService
+	auditService *service.AuditService
 }
 
 // NewUserHandler creates a new user handler
-func NewUserHandler(userService *service.UserService) *UserHandler {
+func NewUserHandler(userService *service.UserService, auditService *service.AuditService) *UserHandler {
 	return &UserHandler{
-		userService: userService,
+		userService:  userService,
+		auditService: auditService,
 	}
 }
 
@@ -48,12 +52,12 @@ func (h *UserHandler) ListUsers(c *gin.Context) {
 	}
 
 	// Get users
-	users, total, err := h.userService.GetUsers(page, pageSize)
+	currentUserID := c.GetUint("user_id")
+	isRoot := c.GetBool("is_root")
+
+	users, total, err := h.userService.GetUsers(c.Request.Context(), page, pageSize, currentUserID, isRoot)
 	if err != nil {
-		util.SendError(c, &util.ErrorResponse{
-			Code:    http.StatusInternalServerError,
-			Message: "Failed to get users: " + err.Error(),
-		})
+		util.SendError(c, serviceError(err, http.StatusInternalServerError))
 		return
 	}
 
@@ -86,9 +90,16 @@ func (h *UserHandler) GetUser(c *gin.Context) {
 		return
 	}
 
+	currentUserID := c.GetUint("user_id")
+	isRoot := c.GetBool("is_root")
+
 	// Get user
-	user, err := h.userService.GetUserByID(uint(id))
+	user, err := h.userService.GetUser(c.Request.Context(), uint(id), currentUserID, isRoot)
 	if err != nil {
+		if errors.Is(err, authz.ErrPermissionDenied) {
+			util.SendError(c, serviceError(err, http.StatusForbidden))
+			return
+		}
 		util.SendError(c, &util.ErrorResponse{
 			Code:    http.StatusNotFound,
 			Message: "User not found",
@@ -97,7 +108,7 @@ func (h *UserHandler) GetUser(c *gin.Context) {
 	}
 
 	// Get user permissions
-	permissions, err := h.userService.GetUserPermissions(uint(id))
+	permissions, err := h.userService.GetUserPermissions(c.Request.Context(), uint(id))
 	if err != nil {
 		util.SendError(c, &util.ErrorResponse{
 			Code:    http.StatusInternalServerError,
@@ -159,11 +170,11 @@ func (h *UserHandler) UpdateUser(c *gin.Context) {
 		updates["is_root"] = *req.IsRoot
 	}
 
-	if err := h.userService.UpdateUser(uint(id), updates, currentUserID, isRoot); err != nil {
-		util.SendError(c, &util.ErrorResponse{
-			Code:    http.StatusBadRequest,
-			Message: err.Error(),
-		})
+	before := h.auditUser(c, uint(id))
+	err = h.userService.UpdateUser(c.Request.Context(), uint(id), updates, currentUserID, isRoot)
+	h.auditService.Record(newAuditEvent(c, model.AuditUserUpdate, authz.KindUser, uint(id)), before, h.auditUser(c, uint(id)), err)
+	if err != nil {
+		util.SendError(c, serviceError(err, http.StatusBadRequest))
 		return
 	}
 
@@ -195,11 +206,11 @@ func (h *UserHandler) DeleteUser(c *gin.Context) {
 	currentUserID := c.GetUint("user_id")
 	isRoot := c.GetBool("is_root")
 
-	if err := h.userService.DeleteUser(uint(id), currentUserID, isRoot); err != nil {
-		util.SendError(c, &util.ErrorResponse{
-			Code:    http.StatusBadRequest,
-			Message: err.Error(),
-		})
+	before := h.auditUser(c, uint(id))
+	err = h.userService.DeleteUser(c.Request.Context(), uint(id), currentUserID, isRoot)
+	h.auditService.Record(newAuditEvent(c, model.AuditUserDelete, authz.KindUser, uint(id)), before, nil, err)
+	if err != nil {
+		util.SendError(c, serviceError(err, http.StatusBadRequest))
 		return
 	}
 
@@ -232,11 +243,11 @@ func (h *UserHandler) UpdateUserStatus(c *gin.Context) {
 	currentUserID := c.GetUint("user_id")
 	isRoot := c.GetBool("is_root")
 
-	if err := h.userService.UpdateUserStatus(uint(id), req.Status, currentUserID, isRoot); err != nil {
-		util.SendError(c, &util.ErrorResponse{
-			Code:    http.StatusBadRequest,
-			Message: err.Error(),
-		})
+	before := h.auditUser(c, uint(id))
+	err = h.userService.UpdateUserStatus(c.Request.Context(), uint(id), req.Status, currentUserID, isRoot)
+	h.auditService.Record(newAuditEvent(c, model.AuditUserStatus, authz.KindUser, uint(id)), before, h.auditUser(c, uint(id)), err)
+	if err != nil {
+		util.SendError(c, serviceError(err, http.StatusBadRequest))
 		return
 	}
 
@@ -277,13 +288,35 @@ func (h *UserHandler) UpdateUserPermissions(c *gin.Context) {
 	currentUserID := c.GetUint("user_id")
 	isRoot := c.GetBool("is_root")
 
-	if err := h.userService.UpdateUserPermissions(uint(id), permissions, currentUserID, isRoot); err != nil {
-		util.SendError(c, &util.ErrorResponse{
-			Code:    http.StatusBadRequest,
-			Message: err.Error(),
-		})
+	before := h.auditPermissions(c, uint(id))
+	err = h.userService.UpdateUserPermissions(c.Request.Context(), uint(id), permissions, currentUserID, isRoot)
+	h.auditService.Record(newAuditEvent(c, model.AuditUserPermissions, authz.KindUser, uint(id)), before, h.auditPermissions(c, uint(id)), err)
+	if err != nil {
+		util.SendError(c, serviceError(err, http.StatusBadRequest))
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "User permissions updated successfully"})
 }
+
+// auditUser returns the audited fields of a user, or nil if it does not exist
+func (h *UserHandler) auditUser(c *gin.Context, id uint) interface{} {
+	user, err := h.userService.GetUserByID(c.Request.Context(), id)
+	if err != nil {
+		return nil
+	}
+	return gin.H{"username": user.Username, "status": user.Status, "is_root": user.IsRoot}
+}
+
+// auditPermissions returns the permission grants of a user as resource:action pairs
+func (h *UserHandler) auditPermissions(c *gin.Context, id uint) interface{} {
+	permissions, err := h.userService.GetUserPermissions(c.Request.Context(), id)
+	if err != nil {
+		return nil
+	}
+	grants := make([]string, len(permissions))
+	for i, p := range permissions {
+		grants[i] = p.Resource + ":" + p.Action
+	}
+	return grants
+}
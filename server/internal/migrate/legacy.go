@@ -0,0 +1,68 @@
+package migrate
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// baselineSchema lists the tables and columns that AutoMigrate created before
+// migrations were versioned. Migration 1 creates exactly this schema.
+var baselineSchema = map[string][]string{
+	"users":              {"id", "username", "password", "is_root", "status", "created_at", "updated_at", "deleted_at"},
+	"user_permissions":   {"id", "user_id", "resource", "action", "created_at", "updated_at", "deleted_at"},
+	"files":              {"id", "name", "path", "bucket_id", "size", "content_type", "hash", "created_by", "updated_by", "last_modified", "created_at", "updated_at", "deleted_at"},
+	"file_metadata":      {"id", "file_id", "key", "value", "created_at", "updated_at", "deleted_at"},
+	"buckets":            {"id", "name", "owner_id", "description", "created_at", "updated_at", "deleted_at"},
+	"bucket_permissions": {"id", "bucket_id", "user_id", "access", "expires_at", "created_at", "updated_at", "deleted_at"},
+}
+
+// isLegacy reports whether the database has tables of the baseline schema,
+// i.e. it was created by AutoMigrate before migrations were versioned
+func isLegacy(tx *gorm.DB) bool {
+	migrator := tx.Migrator()
+	for table := range baselineSchema {
+		if migrator.HasTable(table) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkLegacy returns an error unless a legacy database has exactly the
+// tables and columns of the baseline schema, so that it can be recorded at
+// version 1 and brought up to date by the later migrations
+func checkLegacy(tx *gorm.DB) error {
+	migrator := tx.Migrator()
+	var problems []string
+	for table, want := range baselineSchema {
+		if !migrator.HasTable(table) {
+			problems = append(problems, fmt.Sprintf("table %s is missing", table))
+			continue
+		}
+		columnTypes, err := migrator.ColumnTypes(table)
+		if err != nil {
+			return err
+		}
+		have := make(map[string]bool, len(columnTypes))
+		for _, columnType := range columnTypes {
+			have[columnType.Name()] = true
+		}
+		for _, column := range want {
+			if !have[column] {
+				problems = append(problems, fmt.Sprintf("column %s.%s is missing", table, column))
+			}
+			delete(have, column)
+		}
+		for column := range have {
+			problems = append(problems, fmt.Sprintf("column %s.%s is unexpected", table, column))
+		}
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("database has tables but does not match the baseline schema, so it cannot be adopted: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package migrate
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// lockName identifies the migration lock on the database server
+const lockName = "pfss_schema_migrations"
+
+var errLockTimeout = errors.New("timed out waiting for migrations run by another process")
+
+// dialect holds how migrations are serialized on a database
+type dialect struct {
+	// lock waits at most timeout for the migration lock of the database
+	lock func(tx *gorm.DB, timeout time.Duration) error
+	// unlock releases the lock; commit is false if the run failed
+	unlock func(tx *gorm.DB, commit bool) error
+	// transactional runs each migration in its own transaction
+	transactional bool
+	// lockIsTransaction is set if the lock is a transaction spanning the whole
+	// run, so a failure reverts every migration of the run
+	lockIsTransaction bool
+}
+
+// dialects maps GORM dialector names to their dialect. MySQL commits DDL
+// statements implicitly, so a failed migration may leave its earlier
+// statements applied; PostgreSQL runs each migration atomically.
+var dialects = map[string]dialect{
+	"mysql": {
+		lock:   mysqlLock,
+		unlock: mysqlUnlock,
+	},
+	"postgres": {
+		lock:          postgresLock,
+		unlock:        postgresUnlock,
+		transactional: true,
+	},
+	"sqlite": {
+		lock:              sqliteLock,
+		unlock:            sqliteUnlock,
+		lockIsTransaction: true,
+	},
+}
+
+// mysqlLock takes a named lock held by the connection
+func mysqlLock(tx *gorm.DB, timeout time.Duration) error {
+	var acquired int
+	if err := tx.Raw("SELECT GET_LOCK(?, ?)", lockName, int(timeout.Seconds())).Scan(&acquired).Error; err != nil {
+		return err
+	}
+	if acquired != 1 {
+		return errLockTimeout
+	}
+	return nil
+}
+
+func mysqlUnlock(tx *gorm.DB, _ bool) error {
+	var released int
+	return tx.Raw("SELECT RELEASE_LOCK(?)", lockName).Scan(&released).Error
+}
+
+// postgresLockKey is the advisory lock key derived from lockName
+func postgresLockKey() int64 {
+	h := fnv.New64a()
+	h.Write([]byte(lockName))
+	return int64(h.Sum64())
+}
+
+// postgresLock takes an advisory lock held by the connection, polling so
+// that the wait is bounded
+func postgresLock(tx *gorm.DB, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		var acquired bool
+		if err := tx.Raw("SELECT pg_try_advisory_lock(?)", postgresLockKey()).Scan(&acquired).Error; err != nil {
+			return err
+		}
+		if acquired {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return errLockTimeout
+		}
+		select {
+		case <-tx.Statement.Context.Done():
+			return tx.Statement.Context.Err()
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+func postgresUnlock(tx *gorm.DB, _ bool) error {
+	var released bool
+	return tx.Raw("SELECT pg_advisory_unlock(?)", postgresLockKey()).Scan(&released).Error
+}
+
+// sqliteLock begins an immediate transaction, which takes the write lock of
+// the database file, waiting up to timeout for other writers
+func sqliteLock(tx *gorm.DB, timeout time.Duration) error {
+	var busyTimeout int64
+	if err := tx.Raw("PRAGMA busy_timeout").Scan(&busyTimeout).Error; err != nil {
+		return err
+	}
+	if err := tx.Exec(fmt.Sprintf("PRAGMA busy_timeout = %d", timeout.Milliseconds())).Error; err != nil {
+		return err
+	}
+	err := tx.Exec("BEGIN IMMEDIATE").Error
+	if restoreErr := tx.Exec(fmt.Sprintf("PRAGMA busy_timeout = %d", busyTimeout)).Error; err == nil && restoreErr != nil {
+		tx.Exec("ROLLBACK")
+		err = restoreErr
+	}
+	return err
+}
+
+func sqliteUnlock(tx *gorm.DB, commit bool) error {
+	if commit {
+		return tx.Exec("COMMIT").Error
+	}
+	return tx.Exec("ROLLBACK").Error
+}
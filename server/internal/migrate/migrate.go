@@ -0,0 +1,374 @@
+// Package migrate applies the versioned schema migrations embedded in the
+// binary and records them in the schema_migrations table
+package migrate
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Migrations live in migrations/<dialect>/<version>_<name>.up.sql with a
+// matching .down.sql that reverts them. Versions start at 1 and increase by
+// one; statements end with a semicolon at the end of a line. A down file with
+// comments only marks a migration that cannot be reverted.
+//
+//go:embed migrations
+var files embed.FS
+
+var fileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+var (
+	// ErrNewerSchema is returned when the database has migrations applied that
+	// this build does not know, i.e. it was migrated by a newer release
+	ErrNewerSchema = errors.New("database schema is newer than this build")
+	// ErrPending is returned when the database has migrations left to apply
+	ErrPending = errors.New("database schema has pending migrations")
+	// ErrIrreversible is returned when reverting a migration that cannot be
+	// reverted. It stays applied; after undoing its changes by hand, delete
+	// its row from schema_migrations.
+	ErrIrreversible = errors.New("migration cannot be reverted")
+)
+
+// Migration is a versioned schema change
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// State is the state of a migration in the database
+type State struct {
+	Version int
+	Name    string
+	// AppliedAt is zero if the migration is pending
+	AppliedAt time.Time
+	// Unknown is set for migrations applied by a newer build
+	Unknown bool
+}
+
+// appliedMigration is a row of the schema_migrations table
+type appliedMigration struct {
+	Version   int       `gorm:"primaryKey;autoIncrement:false"`
+	Name      string    `gorm:"size:255;not null"`
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+// TableName specifies the table name for appliedMigration
+func (appliedMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// Migrator applies the migrations of the dialect of a database
+type Migrator struct {
+	db          *gorm.DB
+	dialect     dialect
+	migrations  []Migration
+	lockTimeout time.Duration
+}
+
+// New creates a migrator for db. Migrations run by another process are
+// waited for at most lockTimeout.
+func New(db *gorm.DB, lockTimeout time.Duration) (*Migrator, error) {
+	name := db.Dialector.Name()
+	d, ok := dialects[name]
+	if !ok {
+		return nil, fmt.Errorf("migrations are not supported on %s", name)
+	}
+	migrations, err := load(name)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, dialect: d, migrations: migrations, lockTimeout: lockTimeout}, nil
+}
+
+// load reads the migrations of a dialect in version order
+func load(dialect string) ([]Migration, error) {
+	dir := path.Join("migrations", dialect)
+	entries, err := fs.ReadDir(files, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		match := fileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name %s", path.Join(dir, entry.Name()))
+		}
+		version, _ := strconv.Atoi(match[1])
+		data, err := files.ReadFile(path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d of %s has two names, %s and %s", version, dialect, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.Up = string(data)
+		} else {
+			m.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("migrations of %s are not numbered consecutively from 1: found %d at position %d", dialect, m.Version, i+1)
+		}
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d of %s needs both an up and a down file", m.Version, dialect)
+		}
+	}
+	return migrations, nil
+}
+
+// Latest returns the version of the newest migration known to this build
+func (m *Migrator) Latest() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Status returns the state of the known migrations and of those applied by a
+// newer build, in version order
+func (m *Migrator) Status(ctx context.Context) ([]State, error) {
+	applied, err := m.applied(m.db.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	states := make([]State, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		state := State{Version: migration.Version, Name: migration.Name}
+		if row, ok := applied[migration.Version]; ok {
+			state.AppliedAt = row.AppliedAt
+			delete(applied, migration.Version)
+		}
+		states = append(states, state)
+	}
+	for _, row := range applied {
+		states = append(states, State{Version: row.Version, Name: row.Name, AppliedAt: row.AppliedAt, Unknown: true})
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Version < states[j].Version })
+	return states, nil
+}
+
+// Check returns ErrNewerSchema if the database was migrated by a newer build
+// and ErrPending if migrations are left to apply
+func (m *Migrator) Check(ctx context.Context) error {
+	states, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+	pending := 0
+	for _, state := range states {
+		if state.Unknown {
+			return fmt.Errorf("%w: migration %d %s is applied, this build knows up to %d", ErrNewerSchema, state.Version, state.Name, m.Latest())
+		}
+		if state.AppliedAt.IsZero() {
+			pending++
+		}
+	}
+	if pending > 0 {
+		return fmt.Errorf("%w: %d of %d migrations are not applied", ErrPending, pending, len(m.migrations))
+	}
+	return nil
+}
+
+// Up applies the pending migrations and returns them. It fails with
+// ErrNewerSchema if the database was migrated by a newer build.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var done []Migration
+	err := m.withLock(ctx, func(tx *gorm.DB) error {
+		if err := m.createTable(tx); err != nil {
+			return err
+		}
+		applied, err := m.applied(tx)
+		if err != nil {
+			return err
+		}
+		for version, row := range applied {
+			if version > m.Latest() {
+				return fmt.Errorf("%w: migration %d %s is applied, this build knows up to %d", ErrNewerSchema, version, row.Name, m.Latest())
+			}
+		}
+
+		for _, migration := range m.migrations {
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+			record := appliedMigration{Version: migration.Version, Name: migration.Name, AppliedAt: time.Now()}
+			err := m.run(tx, migration.Up, func(tx *gorm.DB) error {
+				return tx.Create(&record).Error
+			})
+			if err != nil {
+				return fmt.Errorf("migration %d %s failed: %w", migration.Version, migration.Name, err)
+			}
+			done = append(done, migration)
+		}
+		return nil
+	})
+	if err != nil && m.dialect.lockIsTransaction {
+		done = nil
+	}
+	return done, err
+}
+
+// Down reverts the newest applied migration and returns it, or nil if no
+// migration is applied. It fails with ErrIrreversible if the migration cannot
+// be reverted.
+func (m *Migrator) Down(ctx context.Context) (*Migration, error) {
+	var reverted *Migration
+	err := m.withLock(ctx, func(tx *gorm.DB) error {
+		applied, err := m.applied(tx)
+		if err != nil || len(applied) == 0 {
+			return err
+		}
+		version := 0
+		for v := range applied {
+			if v > version {
+				version = v
+			}
+		}
+		if version > m.Latest() {
+			return fmt.Errorf("%w: cannot revert migration %d %s", ErrNewerSchema, version, applied[version].Name)
+		}
+
+		migration := m.migrations[version-1]
+		if len(statements(migration.Down)) == 0 {
+			return fmt.Errorf("%w: migration %d %s", ErrIrreversible, migration.Version, migration.Name)
+		}
+		err = m.run(tx, migration.Down, func(tx *gorm.DB) error {
+			return tx.Delete(&appliedMigration{}, version).Error
+		})
+		if err != nil {
+			return fmt.Errorf("reverting migration %d %s failed: %w", migration.Version, migration.Name, err)
+		}
+		reverted = &migration
+		return nil
+	})
+	return reverted, err
+}
+
+// applied returns the applied migrations by version; none if the
+// schema_migrations table does not exist yet
+func (m *Migrator) applied(tx *gorm.DB) (map[int]appliedMigration, error) {
+	applied := make(map[int]appliedMigration)
+	if !tx.Migrator().HasTable(&appliedMigration{}) {
+		return applied, nil
+	}
+	var rows []appliedMigration
+	if err := tx.Order("version").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+	return applied, nil
+}
+
+// createTable creates the schema_migrations table if it does not exist. A
+// database created by AutoMigrate before migrations were versioned is
+// adopted: once its schema is verified to be the baseline, migration 1 is
+// recorded instead of being run.
+func (m *Migrator) createTable(tx *gorm.DB) error {
+	migrator := tx.Migrator()
+	if migrator.HasTable(&appliedMigration{}) {
+		return nil
+	}
+	legacy := isLegacy(tx)
+	if legacy {
+		if err := checkLegacy(tx); err != nil {
+			return err
+		}
+	}
+	if err := migrator.CreateTable(&appliedMigration{}); err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+	if legacy {
+		first := m.migrations[0]
+		return tx.Create(&appliedMigration{Version: first.Version, Name: first.Name, AppliedAt: time.Now()}).Error
+	}
+	return nil
+}
+
+// run executes the statements of a migration file and then record, in one
+// transaction where the dialect supports it
+func (m *Migrator) run(tx *gorm.DB, sql string, record func(tx *gorm.DB) error) error {
+	apply := func(tx *gorm.DB) error {
+		for _, stmt := range statements(sql) {
+			if err := tx.Exec(stmt).Error; err != nil {
+				return err
+			}
+		}
+		return record(tx)
+	}
+	if m.dialect.transactional {
+		return tx.Transaction(apply)
+	}
+	return apply(tx)
+}
+
+// withLock runs fn on a single connection while holding the migration lock
+func (m *Migrator) withLock(ctx context.Context, fn func(tx *gorm.DB) error) error {
+	// Statements run on the locked connection only, so GORM must not open
+	// transactions of its own
+	db := m.db.Session(&gorm.Session{SkipDefaultTransaction: true, Context: ctx})
+	return db.Connection(func(tx *gorm.DB) error {
+		// A new session lets tx be reused for every statement
+		tx = tx.Session(&gorm.Session{})
+		if err := m.dialect.lock(tx, m.lockTimeout); err != nil {
+			return fmt.Errorf("failed to acquire the migration lock: %w", err)
+		}
+		err := fn(tx)
+		// Release the lock even if ctx is done, as the connection returns to the pool
+		if unlockErr := m.dialect.unlock(tx.WithContext(context.Background()), err == nil); err == nil && unlockErr != nil {
+			err = fmt.Errorf("failed to release the migration lock: %w", unlockErr)
+		}
+		return err
+	})
+}
+
+// statements splits a migration file into its statements, skipping comments
+func statements(sql string) []string {
+	var stmts []string
+	var stmt strings.Builder
+	for _, line := range strings.Split(sql, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		stmt.WriteString(line)
+		stmt.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			stmts = append(stmts, strings.TrimSuffix(strings.TrimSpace(stmt.String()), ";"))
+			stmt.Reset()
+		}
+	}
+	if rest := strings.TrimSpace(stmt.String()); rest != "" {
+		stmts = append(stmts, rest)
+	}
+	return stmts
+}
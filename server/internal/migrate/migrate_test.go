@@ -0,0 +1,479 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/minorcell/pfss/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// Baseline models, as AutoMigrate created them before migrations were versioned
+
+type legacyUser struct {
+	ID        uint   `gorm:"primarykey"`
+	Username  string `gorm:"size:50;unique;not null"`
+	Password  string `gorm:"size:255;not null"`
+	IsRoot    bool   `gorm:"default:false"`
+	Status    string `gorm:"size:20;default:'active'"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+}
+
+func (legacyUser) TableName() string { return "users" }
+
+type legacyUserPermission struct {
+	ID        uint   `gorm:"primarykey"`
+	UserID    uint   `gorm:"not null"`
+	Resource  string `gorm:"size:50;not null"`
+	Action    string `gorm:"size:20;not null"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+}
+
+func (legacyUserPermission) TableName() string { return "user_permissions" }
+
+type legacyFile struct {
+	ID           uint   `gorm:"primarykey"`
+	Name         string `gorm:"size:255;not null"`
+	Path         string `gorm:"size:1024;not null"`
+	BucketID     uint   `gorm:"not null"`
+	Size         int64  `gorm:"not null"`
+	ContentType  string `gorm:"size:100;not null"`
+	Hash         string `gorm:"size:64"`
+	CreatedBy    uint   `gorm:"not null"`
+	UpdatedBy    uint   `gorm:"not null"`
+	LastModified time.Time
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	DeletedAt    gorm.DeletedAt `gorm:"index"`
+}
+
+func (legacyFile) TableName() string { return "files" }
+
+type legacyFileMetadata struct {
+	ID        uint   `gorm:"primarykey"`
+	FileID    uint   `gorm:"not null"`
+	Key       string `gorm:"size:50;not null"`
+	Value     string `gorm:"size:255"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+}
+
+func (legacyFileMetadata) TableName() string { return "file_metadata" }
+
+type legacyBucket struct {
+	ID          uint   `gorm:"primarykey"`
+	Name        string `gorm:"size:63;unique;not null"`
+	OwnerID     uint   `gorm:"not null"`
+	Description string `gorm:"size:255"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	DeletedAt   gorm.DeletedAt `gorm:"index"`
+}
+
+func (legacyBucket) TableName() string { return "buckets" }
+
+type legacyBucketPermission struct {
+	ID        uint   `gorm:"primarykey"`
+	BucketID  uint   `gorm:"not null"`
+	UserID    uint   `gorm:"not null"`
+	Access    string `gorm:"size:20;not null"`
+	ExpiresAt *time.Time
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+}
+
+func (legacyBucketPermission) TableName() string { return "bucket_permissions" }
+
+func legacyModels() []interface{} {
+	return []interface{}{
+		&legacyUser{}, &legacyUserPermission{}, &legacyFile{},
+		&legacyFileMetadata{}, &legacyBucket{}, &legacyBucketPermission{},
+	}
+}
+
+// currentModels lists every model with a database table
+func currentModels() []interface{} {
+	return []interface{}{
+		&model.User{}, &model.UserPermission{}, &model.File{}, &model.FileMetadata{},
+		&model.Bucket{}, &model.BucketPermission{}, &model.BucketPathRule{}, &model.LoginAttempt{},
+		&model.Invitation{}, &model.InvitationGrant{}, &model.PasswordResetToken{}, &model.UserIdentity{},
+		&model.Group{}, &model.GroupMember{}, &model.Quota{}, &model.LifecycleRule{}, &model.AuditEvent{},
+	}
+}
+
+func openSQLite(t *testing.T, name string) *gorm.DB {
+	t.Helper()
+	dsn := "file:" + filepath.Join(t.TempDir(), name) + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("open %s: %v", name, err)
+	}
+	return db
+}
+
+func newMigrator(t *testing.T, db *gorm.DB) *Migrator {
+	t.Helper()
+	m, err := New(db, time.Minute)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return m
+}
+
+// describe returns the columns, indexes and foreign keys of the tables of db,
+// ignoring schema_migrations, in a form that does not depend on how the
+// tables were created
+func describe(t *testing.T, db *gorm.DB) []string {
+	t.Helper()
+	var tables []string
+	db.Raw("SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT IN ('sqlite_sequence', 'schema_migrations')").Scan(&tables)
+
+	var lines []string
+	for _, table := range tables {
+		var columns []struct {
+			Name      string
+			Type      string
+			NotNull   bool
+			DfltValue *string
+			Pk        int
+		}
+		db.Raw(fmt.Sprintf("SELECT name, type, \"notnull\" AS not_null, dflt_value, pk FROM pragma_table_info('%s')", table)).Scan(&columns)
+		for _, c := range columns {
+			dflt := "NULL"
+			if c.DfltValue != nil {
+				dflt = strings.ReplaceAll(*c.DfltValue, `"`, "'")
+			}
+			lines = append(lines, fmt.Sprintf("column %s.%s %s notnull=%t default=%s pk=%d", table, c.Name, strings.ToLower(c.Type), c.NotNull, dflt, c.Pk))
+		}
+
+		var indexes []struct {
+			Name   string
+			Unique bool
+		}
+		db.Raw(fmt.Sprintf("SELECT name, \"unique\" FROM pragma_index_list('%s')", table)).Scan(&indexes)
+		for _, index := range indexes {
+			var indexColumns []string
+			db.Raw(fmt.Sprintf("SELECT name FROM pragma_index_info('%s') ORDER BY seqno", index.Name)).Scan(&indexColumns)
+			name := index.Name
+			if strings.HasPrefix(name, "sqlite_autoindex_") {
+				name = "(constraint)"
+			}
+			lines = append(lines, fmt.Sprintf("index %s %s unique=%t (%s)", table, name, index.Unique, strings.Join(indexColumns, ",")))
+		}
+
+		var foreignKeys []struct {
+			Table string
+			From  string
+			To    string
+		}
+		db.Raw(fmt.Sprintf("SELECT \"table\", \"from\", \"to\" FROM pragma_foreign_key_list('%s')", table)).Scan(&foreignKeys)
+		for _, fk := range foreignKeys {
+			lines = append(lines, fmt.Sprintf("foreign key %s.%s -> %s.%s", table, fk.From, fk.Table, fk.To))
+		}
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+func diff(want, got []string) string {
+	wantSet := make(map[string]bool)
+	for _, line := range want {
+		wantSet[line] = true
+	}
+	var b strings.Builder
+	for _, line := range got {
+		if !wantSet[line] {
+			fmt.Fprintf(&b, "+ %s\n", line)
+		}
+		delete(wantSet, line)
+	}
+	for _, line := range want {
+		if wantSet[line] {
+			fmt.Fprintf(&b, "- %s\n", line)
+		}
+	}
+	return b.String()
+}
+
+func TestLoadAllDialects(t *testing.T) {
+	for name := range dialects {
+		migrations, err := load(name)
+		if err != nil {
+			t.Fatalf("load %s: %v", name, err)
+		}
+		if len(migrations) < 2 {
+			t.Fatalf("load %s: got %d migrations, want at least 2", name, len(migrations))
+		}
+		for _, m := range migrations {
+			// Down files of data migrations may consist of a comment only
+			if len(statements(m.Up)) == 0 || strings.TrimSpace(m.Down) == "" {
+				t.Errorf("%s migration %d %s has an empty up or down file", name, m.Version, m.Name)
+			}
+		}
+	}
+}
+
+func TestStatements(t *testing.T) {
+	sql := "-- comment\nCREATE TABLE a (\n    id integer\n);\n\nINSERT INTO a VALUES (1);\nDROP TABLE b"
+	got := statements(sql)
+	want := []string{"CREATE TABLE a (\n    id integer\n)", "INSERT INTO a VALUES (1)", "DROP TABLE b"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Fatalf("statements = %q, want %q", got, want)
+	}
+}
+
+func TestUpCreatesTheSchemaOfTheModels(t *testing.T) {
+	ctx := context.Background()
+	migrated := openSQLite(t, "migrated.db")
+	m := newMigrator(t, migrated)
+
+	if err := m.Check(ctx); !errors.Is(err, ErrPending) {
+		t.Fatalf("Check before Up = %v, want ErrPending", err)
+	}
+	applied, err := m.Up(ctx)
+	if err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+	if len(applied) != m.Latest() {
+		t.Fatalf("Up applied %d migrations, want %d", len(applied), m.Latest())
+	}
+	if err := m.Check(ctx); err != nil {
+		t.Fatalf("Check after Up: %v", err)
+	}
+
+	automigrated := openSQLite(t, "automigrated.db")
+	if err := automigrated.AutoMigrate(currentModels()...); err != nil {
+		t.Fatalf("AutoMigrate: %v", err)
+	}
+	if d := diff(describe(t, automigrated), describe(t, migrated)); d != "" {
+		t.Fatalf("migrated schema differs from the models:\n%s", d)
+	}
+}
+
+func TestUpAdoptsBaselineDatabase(t *testing.T) {
+	ctx := context.Background()
+	db := openSQLite(t, "legacy.db")
+	if err := db.AutoMigrate(legacyModels()...); err != nil {
+		t.Fatalf("AutoMigrate: %v", err)
+	}
+	if err := db.Create(&legacyBucketPermission{BucketID: 1, UserID: 7, Access: "read"}).Error; err != nil {
+		t.Fatalf("create permission: %v", err)
+	}
+	if err := db.Create(&legacyBucket{ID: 1, Name: "pfss-docs", OwnerID: 7}).Error; err != nil {
+		t.Fatalf("create bucket: %v", err)
+	}
+	legacyFiles := []legacyFile{
+		{BucketID: 1, Name: "a.txt", Path: "pfss-docs/a_20240101120000.txt", ContentType: "text/plain", CreatedBy: 7, UpdatedBy: 7},
+		{BucketID: 1, Name: "b.txt", Path: "/reports/b.txt", ContentType: "text/plain", CreatedBy: 7, UpdatedBy: 7},
+	}
+	if err := db.Create(&legacyFiles).Error; err != nil {
+		t.Fatalf("create files: %v", err)
+	}
+
+	m := newMigrator(t, db)
+	applied, err := m.Up(ctx)
+	if err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+	if len(applied) != m.Latest()-1 || applied[0].Version != 2 {
+		t.Fatalf("Up applied %v, want every migration after 1", applied)
+	}
+	if err := m.Check(ctx); err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+
+	automigrated := openSQLite(t, "automigrated.db")
+	if err := automigrated.AutoMigrate(currentModels()...); err != nil {
+		t.Fatalf("AutoMigrate: %v", err)
+	}
+	if d := diff(describe(t, automigrated), describe(t, db)); d != "" {
+		t.Fatalf("adopted schema differs from the models:\n%s", d)
+	}
+
+	var permission model.BucketPermission
+	if err := db.First(&permission).Error; err != nil {
+		t.Fatalf("read permission: %v", err)
+	}
+	if permission.UserID != 7 || permission.GroupID != 0 || permission.Access != "read" {
+		t.Fatalf("permission = %+v, want the legacy grant", permission)
+	}
+	if err := db.Create(&model.BucketPermission{BucketID: 1, GroupID: 3, Access: "write"}).Error; err != nil {
+		t.Fatalf("create group grant: %v", err)
+	}
+
+	var paths []string
+	if err := db.Model(&model.File{}).Order("id").Pluck("path", &paths).Error; err != nil {
+		t.Fatalf("read paths: %v", err)
+	}
+	if want := []string{"/a_20240101120000.txt", "/reports/b.txt"}; strings.Join(paths, ",") != strings.Join(want, ",") {
+		t.Fatalf("file paths = %v, want %v", paths, want)
+	}
+}
+
+func TestUpRejectsUnknownLegacySchema(t *testing.T) {
+	tests := map[string]func(db *gorm.DB) error{
+		"missing table": func(db *gorm.DB) error {
+			return db.AutoMigrate(&legacyUser{}, &legacyBucket{})
+		},
+		"extra column": func(db *gorm.DB) error {
+			if err := db.AutoMigrate(legacyModels()...); err != nil {
+				return err
+			}
+			return db.Exec("ALTER TABLE users ADD COLUMN must_change_password numeric DEFAULT false").Error
+		},
+	}
+	for name, setup := range tests {
+		t.Run(name, func(t *testing.T) {
+			db := openSQLite(t, "legacy.db")
+			if err := setup(db); err != nil {
+				t.Fatalf("setup: %v", err)
+			}
+			m := newMigrator(t, db)
+			if _, err := m.Up(context.Background()); err == nil {
+				t.Fatal("Up succeeded, want an error")
+			}
+			if db.Migrator().HasTable("schema_migrations") {
+				t.Fatal("schema_migrations was created for a rejected database")
+			}
+			if err := m.Check(context.Background()); !errors.Is(err, ErrPending) {
+				t.Fatalf("Check = %v, want ErrPending", err)
+			}
+		})
+	}
+}
+
+func TestDownRevertsEveryMigration(t *testing.T) {
+	ctx := context.Background()
+	db := openSQLite(t, "pfss.db")
+	m := newMigrator(t, db)
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+
+	for version := m.Latest(); version > 0; version-- {
+		reverted, err := m.Down(ctx)
+		if version == 3 {
+			// Migration 3 only rewrites data; it stays applied until its row
+			// is removed by hand
+			if !errors.Is(err, ErrIrreversible) {
+				t.Fatalf("Down of migration 3 = %v, want ErrIrreversible", err)
+			}
+			var count int64
+			if err := db.Model(&appliedMigration{}).Where("version = ?", version).Count(&count).Error; err != nil {
+				t.Fatal(err)
+			}
+			if count != 1 {
+				t.Fatalf("migration 3 is no longer recorded as applied after the refused Down")
+			}
+			if err := db.Delete(&appliedMigration{}, version).Error; err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Down: %v", err)
+		}
+		if reverted == nil || reverted.Version != version {
+			t.Fatalf("Down reverted %v, want version %d", reverted, version)
+		}
+		if version == 2 {
+			legacy := openSQLite(t, "legacy.db")
+			if err := legacy.AutoMigrate(legacyModels()...); err != nil {
+				t.Fatalf("AutoMigrate: %v", err)
+			}
+			if d := diff(describe(t, legacy), describe(t, db)); d != "" {
+				t.Fatalf("schema after reverting migration 2 differs from the baseline:\n%s", d)
+			}
+		}
+	}
+	if reverted, err := m.Down(ctx); err != nil || reverted != nil {
+		t.Fatalf("Down with nothing applied = %v, %v; want nil, nil", reverted, err)
+	}
+	if got := describe(t, db); len(got) != 0 {
+		t.Fatalf("tables left after reverting every migration:\n%s", strings.Join(got, "\n"))
+	}
+
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatalf("Up after Down: %v", err)
+	}
+	if err := m.Check(ctx); err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+}
+
+func TestNewerSchemaIsRefused(t *testing.T) {
+	ctx := context.Background()
+	db := openSQLite(t, "pfss.db")
+	m := newMigrator(t, db)
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+	future := appliedMigration{Version: m.Latest() + 1, Name: "future", AppliedAt: time.Now()}
+	if err := db.Create(&future).Error; err != nil {
+		t.Fatalf("record future migration: %v", err)
+	}
+
+	if err := m.Check(ctx); !errors.Is(err, ErrNewerSchema) {
+		t.Fatalf("Check = %v, want ErrNewerSchema", err)
+	}
+	if _, err := m.Up(ctx); !errors.Is(err, ErrNewerSchema) {
+		t.Fatalf("Up = %v, want ErrNewerSchema", err)
+	}
+	if _, err := m.Down(ctx); !errors.Is(err, ErrNewerSchema) {
+		t.Fatalf("Down = %v, want ErrNewerSchema", err)
+	}
+}
+
+func TestConcurrentUpAppliesOnce(t *testing.T) {
+	dsn := "file:" + filepath.Join(t.TempDir(), "pfss.db") + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+	results := make(chan int, 4)
+	errs := make(chan error, 4)
+	for i := 0; i < 4; i++ {
+		go func() {
+			db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Discard})
+			if err != nil {
+				errs <- err
+				return
+			}
+			m, err := New(db, time.Minute)
+			if err != nil {
+				errs <- err
+				return
+			}
+			applied, err := m.Up(context.Background())
+			if err != nil {
+				errs <- err
+				return
+			}
+			results <- len(applied)
+		}()
+	}
+
+	total := 0
+	for i := 0; i < 4; i++ {
+		select {
+		case n := <-results:
+			total += n
+		case err := <-errs:
+			t.Fatalf("Up: %v", err)
+		}
+	}
+	migrations, _ := load("sqlite")
+	if total != len(migrations) {
+		t.Fatalf("migrations applied %d times in total, want %d", total, len(migrations))
+	}
+}
@@ -0,0 +1,81 @@
+CREATE TABLE `users` (
+    `id` bigint unsigned AUTO_INCREMENT,
+    `username` varchar(50) NOT NULL,
+    `password` varchar(255) NOT NULL,
+    `is_root` boolean DEFAULT false,
+    `status` varchar(20) DEFAULT 'active',
+    `created_at` datetime(3) NULL,
+    `updated_at` datetime(3) NULL,
+    `deleted_at` datetime(3) NULL,
+    PRIMARY KEY (`id`),
+    INDEX `idx_users_deleted_at` (`deleted_at`),
+    CONSTRAINT `uni_users_username` UNIQUE (`username`)
+);
+
+CREATE TABLE `user_permissions` (
+    `id` bigint unsigned AUTO_INCREMENT,
+    `user_id` bigint unsigned NOT NULL,
+    `resource` varchar(50) NOT NULL,
+    `action` varchar(20) NOT NULL,
+    `created_at` datetime(3) NULL,
+    `updated_at` datetime(3) NULL,
+    `deleted_at` datetime(3) NULL,
+    PRIMARY KEY (`id`),
+    INDEX `idx_user_permissions_deleted_at` (`deleted_at`)
+);
+
+CREATE TABLE `files` (
+    `id` bigint unsigned AUTO_INCREMENT,
+    `name` varchar(255) NOT NULL,
+    `path` varchar(1024) NOT NULL,
+    `bucket_id` bigint unsigned NOT NULL,
+    `size` bigint NOT NULL,
+    `content_type` varchar(100) NOT NULL,
+    `hash` varchar(64),
+    `created_by` bigint unsigned NOT NULL,
+    `updated_by` bigint unsigned NOT NULL,
+    `last_modified` datetime(3) NULL,
+    `created_at` datetime(3) NULL,
+    `updated_at` datetime(3) NULL,
+    `deleted_at` datetime(3) NULL,
+    PRIMARY KEY (`id`),
+    INDEX `idx_files_deleted_at` (`deleted_at`)
+);
+
+CREATE TABLE `file_metadata` (
+    `id` bigint unsigned AUTO_INCREMENT,
+    `file_id` bigint unsigned NOT NULL,
+    `key` varchar(50) NOT NULL,
+    `value` varchar(255),
+    `created_at` datetime(3) NULL,
+    `updated_at` datetime(3) NULL,
+    `deleted_at` datetime(3) NULL,
+    PRIMARY KEY (`id`),
+    INDEX `idx_file_metadata_deleted_at` (`deleted_at`)
+);
+
+CREATE TABLE `buckets` (
+    `id` bigint unsigned AUTO_INCREMENT,
+    `name` varchar(63) NOT NULL,
+    `owner_id` bigint unsigned NOT NULL,
+    `description` varchar(255),
+    `created_at` datetime(3) NULL,
+    `updated_at` datetime(3) NULL,
+    `deleted_at` datetime(3) NULL,
+    PRIMARY KEY (`id`),
+    INDEX `idx_buckets_deleted_at` (`deleted_at`),
+    CONSTRAINT `uni_buckets_name` UNIQUE (`name`)
+);
+
+CREATE TABLE `bucket_permissions` (
+    `id` bigint unsigned AUTO_INCREMENT,
+    `bucket_id` bigint unsigned NOT NULL,
+    `user_id` bigint unsigned NOT NULL,
+    `access` varchar(20) NOT NULL,
+    `expires_at` datetime(3) NULL,
+    `created_at` datetime(3) NULL,
+    `updated_at` datetime(3) NULL,
+    `deleted_at` datetime(3) NULL,
+    PRIMARY KEY (`id`),
+    INDEX `idx_bucket_permissions_deleted_at` (`deleted_at`)
+);
@@ -0,0 +1,190 @@
+ALTER TABLE `users` ADD COLUMN `must_change_password` boolean DEFAULT false;
+
+ALTER TABLE `files`
+    ADD COLUMN `retention_mode` varchar(20),
+    ADD COLUMN `retain_until` datetime(3) NULL,
+    ADD COLUMN `legal_hold` boolean NOT NULL DEFAULT false,
+    ADD INDEX `idx_files_retain_until` (`retain_until`);
+
+ALTER TABLE `buckets`
+    ADD COLUMN `permission_version` bigint unsigned NOT NULL DEFAULT 1,
+    ADD COLUMN `max_file_bytes` bigint NOT NULL DEFAULT 0,
+    ADD COLUMN `allowed_types` varchar(1024),
+    ADD COLUMN `denied_types` varchar(1024),
+    ADD COLUMN `allowed_extensions` varchar(1024),
+    ADD COLUMN `denied_extensions` varchar(1024),
+    ADD COLUMN `object_lock_enabled` boolean NOT NULL DEFAULT false,
+    ADD COLUMN `retention_mode` varchar(20),
+    ADD COLUMN `default_retention_days` bigint NOT NULL DEFAULT 0;
+
+ALTER TABLE `bucket_permissions`
+    MODIFY COLUMN `user_id` bigint unsigned NOT NULL DEFAULT 0,
+    ADD COLUMN `group_id` bigint unsigned NOT NULL DEFAULT 0,
+    ADD COLUMN `not_before` datetime(3) NULL,
+    ADD INDEX `idx_bucket_permissions_user_id` (`user_id`),
+    ADD INDEX `idx_bucket_permissions_group_id` (`group_id`),
+    ADD INDEX `idx_bucket_permissions_expires_at` (`expires_at`);
+
+CREATE TABLE `bucket_path_rules` (
+    `id` bigint unsigned AUTO_INCREMENT,
+    `bucket_id` bigint unsigned NOT NULL,
+    `user_id` bigint unsigned NOT NULL DEFAULT 0,
+    `group_id` bigint unsigned NOT NULL DEFAULT 0,
+    `prefix` varchar(1024) NOT NULL,
+    `effect` varchar(10) NOT NULL,
+    `access` varchar(20) NOT NULL,
+    `created_by` bigint unsigned NOT NULL,
+    `created_at` datetime(3) NULL,
+    `updated_at` datetime(3) NULL,
+    `deleted_at` datetime(3) NULL,
+    PRIMARY KEY (`id`),
+    INDEX `idx_bucket_path_rules_bucket_id` (`bucket_id`),
+    INDEX `idx_bucket_path_rules_user_id` (`user_id`),
+    INDEX `idx_bucket_path_rules_group_id` (`group_id`),
+    INDEX `idx_bucket_path_rules_deleted_at` (`deleted_at`)
+);
+
+CREATE TABLE `login_attempts` (
+    `id` bigint unsigned AUTO_INCREMENT,
+    `key` varchar(191) NOT NULL,
+    `failures` bigint NOT NULL DEFAULT 0,
+    `last_failure` datetime(3) NULL,
+    `locked_until` datetime(3) NULL,
+    `created_at` datetime(3) NULL,
+    `updated_at` datetime(3) NULL,
+    PRIMARY KEY (`id`),
+    UNIQUE INDEX `idx_login_attempts_key` (`key`)
+);
+
+CREATE TABLE `invitations` (
+    `id` bigint unsigned AUTO_INCREMENT,
+    `token_hash` varchar(64) NOT NULL,
+    `role` varchar(20) NOT NULL DEFAULT 'user',
+    `note` varchar(255),
+    `created_by` bigint unsigned NOT NULL,
+    `expires_at` datetime(3) NULL,
+    `used_at` datetime(3) NULL,
+    `used_by` bigint unsigned,
+    `created_at` datetime(3) NULL,
+    `updated_at` datetime(3) NULL,
+    `deleted_at` datetime(3) NULL,
+    PRIMARY KEY (`id`),
+    UNIQUE INDEX `idx_invitations_token_hash` (`token_hash`),
+    INDEX `idx_invitations_deleted_at` (`deleted_at`)
+);
+
+CREATE TABLE `invitation_grants` (
+    `id` bigint unsigned AUTO_INCREMENT,
+    `invitation_id` bigint unsigned NOT NULL,
+    `bucket_id` bigint unsigned NOT NULL,
+    `access` varchar(20) NOT NULL,
+    `created_at` datetime(3) NULL,
+    PRIMARY KEY (`id`),
+    INDEX `idx_invitation_grants_invitation_id` (`invitation_id`),
+    CONSTRAINT `fk_invitations_grants` FOREIGN KEY (`invitation_id`) REFERENCES `invitations`(`id`)
+);
+
+CREATE TABLE `password_reset_tokens` (
+    `id` bigint unsigned AUTO_INCREMENT,
+    `user_id` bigint unsigned NOT NULL,
+    `token_hash` varchar(64) NOT NULL,
+    `created_by` bigint unsigned NOT NULL,
+    `expires_at` datetime(3) NOT NULL,
+    `used_at` datetime(3) NULL,
+    `created_at` datetime(3) NULL,
+    PRIMARY KEY (`id`),
+    UNIQUE INDEX `idx_password_reset_tokens_token_hash` (`token_hash`),
+    INDEX `idx_password_reset_tokens_user_id` (`user_id`)
+);
+
+CREATE TABLE `user_identities` (
+    `id` bigint unsigned AUTO_INCREMENT,
+    `user_id` bigint unsigned NOT NULL,
+    `provider` varchar(191) NOT NULL,
+    `subject` varchar(191) NOT NULL,
+    `last_login` datetime(3) NULL,
+    `created_at` datetime(3) NULL,
+    `updated_at` datetime(3) NULL,
+    PRIMARY KEY (`id`),
+    INDEX `idx_user_identities_user_id` (`user_id`),
+    UNIQUE INDEX `idx_identity_provider_subject` (`provider`,`subject`)
+);
+
+CREATE TABLE `groups` (
+    `id` bigint unsigned AUTO_INCREMENT,
+    `name` varchar(50) NOT NULL,
+    `description` varchar(255),
+    `created_by` bigint unsigned NOT NULL,
+    `created_at` datetime(3) NULL,
+    `updated_at` datetime(3) NULL,
+    `deleted_at` datetime(3) NULL,
+    PRIMARY KEY (`id`),
+    INDEX `idx_groups_deleted_at` (`deleted_at`),
+    CONSTRAINT `uni_groups_name` UNIQUE (`name`)
+);
+
+CREATE TABLE `group_members` (
+    `id` bigint unsigned AUTO_INCREMENT,
+    `group_id` bigint unsigned NOT NULL,
+    `user_id` bigint unsigned NOT NULL,
+    `created_at` datetime(3) NULL,
+    PRIMARY KEY (`id`),
+    UNIQUE INDEX `idx_group_member` (`group_id`,`user_id`),
+    INDEX `idx_group_members_user_id` (`user_id`)
+);
+
+CREATE TABLE `quotas` (
+    `id` bigint unsigned AUTO_INCREMENT,
+    `scope` varchar(10) NOT NULL,
+    `target_id` bigint unsigned NOT NULL,
+    `max_bytes` bigint NOT NULL DEFAULT 0,
+    `max_files` bigint NOT NULL DEFAULT 0,
+    `warn_percent` bigint NOT NULL DEFAULT 0,
+    `updated_by` bigint unsigned NOT NULL,
+    `created_at` datetime(3) NULL,
+    `updated_at` datetime(3) NULL,
+    PRIMARY KEY (`id`),
+    UNIQUE INDEX `idx_quota_target` (`scope`,`target_id`)
+);
+
+CREATE TABLE `lifecycle_rules` (
+    `id` bigint unsigned AUTO_INCREMENT,
+    `bucket_id` bigint unsigned NOT NULL,
+    `name` varchar(100) NOT NULL,
+    `enabled` boolean NOT NULL DEFAULT true,
+    `prefix` varchar(1024),
+    `tag_key` varchar(50),
+    `tag_value` varchar(255),
+    `expire_after_days` bigint NOT NULL DEFAULT 0,
+    `keep_versions` bigint NOT NULL DEFAULT 0,
+    `abort_incomplete_after_days` bigint NOT NULL DEFAULT 0,
+    `created_by` bigint unsigned NOT NULL,
+    `created_at` datetime(3) NULL,
+    `updated_at` datetime(3) NULL,
+    `deleted_at` datetime(3) NULL,
+    PRIMARY KEY (`id`),
+    INDEX `idx_lifecycle_rules_bucket_id` (`bucket_id`),
+    INDEX `idx_lifecycle_rules_deleted_at` (`deleted_at`),
+    CONSTRAINT `fk_buckets_lifecycle_rules` FOREIGN KEY (`bucket_id`) REFERENCES `buckets`(`id`)
+);
+
+CREATE TABLE `audit_events` (
+    `id` bigint unsigned AUTO_INCREMENT,
+    `created_at` datetime(3) NULL,
+    `actor_id` bigint unsigned NOT NULL DEFAULT 0,
+    `actor_name` varchar(255),
+    `ip` varchar(64),
+    `action` varchar(50) NOT NULL,
+    `target_type` varchar(20),
+    `target_id` bigint unsigned,
+    `before` text,
+    `after` text,
+    `result` varchar(20) NOT NULL,
+    `error` varchar(500),
+    PRIMARY KEY (`id`),
+    INDEX `idx_audit_events_action` (`action`),
+    INDEX `idx_audit_target` (`target_type`,`target_id`),
+    INDEX `idx_audit_events_result` (`result`),
+    INDEX `idx_audit_events_created_at` (`created_at`),
+    INDEX `idx_audit_events_actor_id` (`actor_id`)
+);
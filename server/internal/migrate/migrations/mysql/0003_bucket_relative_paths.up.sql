@@ -0,0 +1,5 @@
+-- Uploads used to store the bucket name in front of the file name, as
+-- "<bucket>/<name>"; paths are now relative to the bucket root, as "/<name>"
+UPDATE `files` JOIN `buckets` ON `buckets`.`id` = `files`.`bucket_id`
+SET `files`.`path` = CONCAT('/', SUBSTRING(`files`.`path`, CHAR_LENGTH(`buckets`.`name`) + 2))
+WHERE LEFT(`files`.`path`, CHAR_LENGTH(`buckets`.`name`) + 1) = CONCAT(`buckets`.`name`, '/');
@@ -0,0 +1,6 @@
+DROP TABLE "bucket_permissions";
+DROP TABLE "buckets";
+DROP TABLE "file_metadata";
+DROP TABLE "files";
+DROP TABLE "user_permissions";
+DROP TABLE "users";
@@ -0,0 +1,81 @@
+CREATE TABLE "users" (
+    "id" bigserial,
+    "username" varchar(50) NOT NULL,
+    "password" varchar(255) NOT NULL,
+    "is_root" boolean DEFAULT false,
+    "status" varchar(20) DEFAULT 'active',
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "uni_users_username" UNIQUE ("username")
+);
+CREATE INDEX "idx_users_deleted_at" ON "users" ("deleted_at");
+
+CREATE TABLE "user_permissions" (
+    "id" bigserial,
+    "user_id" bigint NOT NULL,
+    "resource" varchar(50) NOT NULL,
+    "action" varchar(20) NOT NULL,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX "idx_user_permissions_deleted_at" ON "user_permissions" ("deleted_at");
+
+CREATE TABLE "files" (
+    "id" bigserial,
+    "name" varchar(255) NOT NULL,
+    "path" varchar(1024) NOT NULL,
+    "bucket_id" bigint NOT NULL,
+    "size" bigint NOT NULL,
+    "content_type" varchar(100) NOT NULL,
+    "hash" varchar(64),
+    "created_by" bigint NOT NULL,
+    "updated_by" bigint NOT NULL,
+    "last_modified" timestamptz,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX "idx_files_deleted_at" ON "files" ("deleted_at");
+
+CREATE TABLE "file_metadata" (
+    "id" bigserial,
+    "file_id" bigint NOT NULL,
+    "key" varchar(50) NOT NULL,
+    "value" varchar(255),
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX "idx_file_metadata_deleted_at" ON "file_metadata" ("deleted_at");
+
+CREATE TABLE "buckets" (
+    "id" bigserial,
+    "name" varchar(63) NOT NULL,
+    "owner_id" bigint NOT NULL,
+    "description" varchar(255),
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "uni_buckets_name" UNIQUE ("name")
+);
+CREATE INDEX "idx_buckets_deleted_at" ON "buckets" ("deleted_at");
+
+CREATE TABLE "bucket_permissions" (
+    "id" bigserial,
+    "bucket_id" bigint NOT NULL,
+    "user_id" bigint NOT NULL,
+    "access" varchar(20) NOT NULL,
+    "expires_at" timestamptz,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX "idx_bucket_permissions_deleted_at" ON "bucket_permissions" ("deleted_at");
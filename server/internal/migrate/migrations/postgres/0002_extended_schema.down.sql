@@ -0,0 +1,40 @@
+DROP TABLE "audit_events";
+DROP TABLE "lifecycle_rules";
+DROP TABLE "quotas";
+DROP TABLE "group_members";
+DROP TABLE "groups";
+DROP TABLE "user_identities";
+DROP TABLE "password_reset_tokens";
+DROP TABLE "invitation_grants";
+DROP TABLE "invitations";
+DROP TABLE "login_attempts";
+DROP TABLE "bucket_path_rules";
+
+-- Group grants have no place in the old table and are dropped
+DELETE FROM "bucket_permissions" WHERE "group_id" <> 0;
+DROP INDEX "idx_bucket_permissions_user_id";
+DROP INDEX "idx_bucket_permissions_group_id";
+DROP INDEX "idx_bucket_permissions_expires_at";
+ALTER TABLE "bucket_permissions"
+    DROP COLUMN "not_before",
+    DROP COLUMN "group_id",
+    ALTER COLUMN "user_id" DROP DEFAULT;
+
+ALTER TABLE "buckets"
+    DROP COLUMN "default_retention_days",
+    DROP COLUMN "retention_mode",
+    DROP COLUMN "object_lock_enabled",
+    DROP COLUMN "denied_extensions",
+    DROP COLUMN "allowed_extensions",
+    DROP COLUMN "denied_types",
+    DROP COLUMN "allowed_types",
+    DROP COLUMN "max_file_bytes",
+    DROP COLUMN "permission_version";
+
+DROP INDEX "idx_files_retain_until";
+ALTER TABLE "files"
+    DROP COLUMN "legal_hold",
+    DROP COLUMN "retain_until",
+    DROP COLUMN "retention_mode";
+
+ALTER TABLE "users" DROP COLUMN "must_change_password";
@@ -0,0 +1,190 @@
+ALTER TABLE "users" ADD COLUMN "must_change_password" boolean DEFAULT false;
+
+ALTER TABLE "files"
+    ADD COLUMN "retention_mode" varchar(20),
+    ADD COLUMN "retain_until" timestamptz,
+    ADD COLUMN "legal_hold" boolean NOT NULL DEFAULT false;
+CREATE INDEX "idx_files_retain_until" ON "files" ("retain_until");
+
+ALTER TABLE "buckets"
+    ADD COLUMN "permission_version" bigint NOT NULL DEFAULT 1,
+    ADD COLUMN "max_file_bytes" bigint NOT NULL DEFAULT 0,
+    ADD COLUMN "allowed_types" varchar(1024),
+    ADD COLUMN "denied_types" varchar(1024),
+    ADD COLUMN "allowed_extensions" varchar(1024),
+    ADD COLUMN "denied_extensions" varchar(1024),
+    ADD COLUMN "object_lock_enabled" boolean NOT NULL DEFAULT false,
+    ADD COLUMN "retention_mode" varchar(20),
+    ADD COLUMN "default_retention_days" bigint NOT NULL DEFAULT 0;
+
+ALTER TABLE "bucket_permissions"
+    ALTER COLUMN "user_id" SET DEFAULT 0,
+    ADD COLUMN "group_id" bigint NOT NULL DEFAULT 0,
+    ADD COLUMN "not_before" timestamptz;
+CREATE INDEX "idx_bucket_permissions_expires_at" ON "bucket_permissions" ("expires_at");
+CREATE INDEX "idx_bucket_permissions_group_id" ON "bucket_permissions" ("group_id");
+CREATE INDEX "idx_bucket_permissions_user_id" ON "bucket_permissions" ("user_id");
+
+CREATE TABLE "bucket_path_rules" (
+    "id" bigserial,
+    "bucket_id" bigint NOT NULL,
+    "user_id" bigint NOT NULL DEFAULT 0,
+    "group_id" bigint NOT NULL DEFAULT 0,
+    "prefix" varchar(1024) NOT NULL,
+    "effect" varchar(10) NOT NULL,
+    "access" varchar(20) NOT NULL,
+    "created_by" bigint NOT NULL,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX "idx_bucket_path_rules_deleted_at" ON "bucket_path_rules" ("deleted_at");
+CREATE INDEX "idx_bucket_path_rules_group_id" ON "bucket_path_rules" ("group_id");
+CREATE INDEX "idx_bucket_path_rules_user_id" ON "bucket_path_rules" ("user_id");
+CREATE INDEX "idx_bucket_path_rules_bucket_id" ON "bucket_path_rules" ("bucket_id");
+
+CREATE TABLE "login_attempts" (
+    "id" bigserial,
+    "key" varchar(191) NOT NULL,
+    "failures" bigint NOT NULL DEFAULT 0,
+    "last_failure" timestamptz,
+    "locked_until" timestamptz,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE UNIQUE INDEX "idx_login_attempts_key" ON "login_attempts" ("key");
+
+CREATE TABLE "invitations" (
+    "id" bigserial,
+    "token_hash" varchar(64) NOT NULL,
+    "role" varchar(20) NOT NULL DEFAULT 'user',
+    "note" varchar(255),
+    "created_by" bigint NOT NULL,
+    "expires_at" timestamptz,
+    "used_at" timestamptz,
+    "used_by" bigint,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX "idx_invitations_deleted_at" ON "invitations" ("deleted_at");
+CREATE UNIQUE INDEX "idx_invitations_token_hash" ON "invitations" ("token_hash");
+
+CREATE TABLE "invitation_grants" (
+    "id" bigserial,
+    "invitation_id" bigint NOT NULL,
+    "bucket_id" bigint NOT NULL,
+    "access" varchar(20) NOT NULL,
+    "created_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_invitations_grants" FOREIGN KEY ("invitation_id") REFERENCES "invitations"("id")
+);
+CREATE INDEX "idx_invitation_grants_invitation_id" ON "invitation_grants" ("invitation_id");
+
+CREATE TABLE "password_reset_tokens" (
+    "id" bigserial,
+    "user_id" bigint NOT NULL,
+    "token_hash" varchar(64) NOT NULL,
+    "created_by" bigint NOT NULL,
+    "expires_at" timestamptz NOT NULL,
+    "used_at" timestamptz,
+    "created_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE UNIQUE INDEX "idx_password_reset_tokens_token_hash" ON "password_reset_tokens" ("token_hash");
+CREATE INDEX "idx_password_reset_tokens_user_id" ON "password_reset_tokens" ("user_id");
+
+CREATE TABLE "user_identities" (
+    "id" bigserial,
+    "user_id" bigint NOT NULL,
+    "provider" varchar(191) NOT NULL,
+    "subject" varchar(191) NOT NULL,
+    "last_login" timestamptz,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE UNIQUE INDEX "idx_identity_provider_subject" ON "user_identities" ("provider","subject");
+CREATE INDEX "idx_user_identities_user_id" ON "user_identities" ("user_id");
+
+CREATE TABLE "groups" (
+    "id" bigserial,
+    "name" varchar(50) NOT NULL,
+    "description" varchar(255),
+    "created_by" bigint NOT NULL,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "uni_groups_name" UNIQUE ("name")
+);
+CREATE INDEX "idx_groups_deleted_at" ON "groups" ("deleted_at");
+
+CREATE TABLE "group_members" (
+    "id" bigserial,
+    "group_id" bigint NOT NULL,
+    "user_id" bigint NOT NULL,
+    "created_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX "idx_group_members_user_id" ON "group_members" ("user_id");
+CREATE UNIQUE INDEX "idx_group_member" ON "group_members" ("group_id","user_id");
+
+CREATE TABLE "quotas" (
+    "id" bigserial,
+    "scope" varchar(10) NOT NULL,
+    "target_id" bigint NOT NULL,
+    "max_bytes" bigint NOT NULL DEFAULT 0,
+    "max_files" bigint NOT NULL DEFAULT 0,
+    "warn_percent" bigint NOT NULL DEFAULT 0,
+    "updated_by" bigint NOT NULL,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE UNIQUE INDEX "idx_quota_target" ON "quotas" ("scope","target_id");
+
+CREATE TABLE "lifecycle_rules" (
+    "id" bigserial,
+    "bucket_id" bigint NOT NULL,
+    "name" varchar(100) NOT NULL,
+    "enabled" boolean NOT NULL DEFAULT true,
+    "prefix" varchar(1024),
+    "tag_key" varchar(50),
+    "tag_value" varchar(255),
+    "expire_after_days" bigint NOT NULL DEFAULT 0,
+    "keep_versions" bigint NOT NULL DEFAULT 0,
+    "abort_incomplete_after_days" bigint NOT NULL DEFAULT 0,
+    "created_by" bigint NOT NULL,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_buckets_lifecycle_rules" FOREIGN KEY ("bucket_id") REFERENCES "buckets"("id")
+);
+CREATE INDEX "idx_lifecycle_rules_deleted_at" ON "lifecycle_rules" ("deleted_at");
+CREATE INDEX "idx_lifecycle_rules_bucket_id" ON "lifecycle_rules" ("bucket_id");
+
+CREATE TABLE "audit_events" (
+    "id" bigserial,
+    "created_at" timestamptz,
+    "actor_id" bigint NOT NULL DEFAULT 0,
+    "actor_name" varchar(255),
+    "ip" varchar(64),
+    "action" varchar(50) NOT NULL,
+    "target_type" varchar(20),
+    "target_id" bigint,
+    "before" text,
+    "after" text,
+    "result" varchar(20) NOT NULL,
+    "error" varchar(500),
+    PRIMARY KEY ("id")
+);
+CREATE INDEX "idx_audit_events_actor_id" ON "audit_events" ("actor_id");
+CREATE INDEX "idx_audit_events_created_at" ON "audit_events" ("created_at");
+CREATE INDEX "idx_audit_events_result" ON "audit_events" ("result");
+CREATE INDEX "idx_audit_target" ON "audit_events" ("target_type","target_id");
+CREATE INDEX "idx_audit_events_action" ON "audit_events" ("action");
@@ -0,0 +1,3 @@
+-- Irreversible: paths of uploads cannot be told apart from paths given when
+-- files were created, so the bucket name cannot be put back in front of them.
+-- A down file without statements makes Down refuse to revert the migration.
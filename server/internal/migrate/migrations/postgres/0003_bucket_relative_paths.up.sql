@@ -0,0 +1,6 @@
+-- Uploads used to store the bucket name in front of the file name, as
+-- "<bucket>/<name>"; paths are now relative to the bucket root, as "/<name>"
+UPDATE "files" SET "path" = '/' || SUBSTR("files"."path", LENGTH("buckets"."name") + 2)
+FROM "buckets"
+WHERE "buckets"."id" = "files"."bucket_id"
+    AND SUBSTR("files"."path", 1, LENGTH("buckets"."name") + 1) = "buckets"."name" || '/';
@@ -0,0 +1,75 @@
+CREATE TABLE `users` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `username` text NOT NULL,
+    `password` text NOT NULL,
+    `is_root` numeric DEFAULT false,
+    `status` text DEFAULT 'active',
+    `created_at` datetime,
+    `updated_at` datetime,
+    `deleted_at` datetime,
+    CONSTRAINT `uni_users_username` UNIQUE (`username`)
+);
+CREATE INDEX `idx_users_deleted_at` ON `users`(`deleted_at`);
+
+CREATE TABLE `user_permissions` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `user_id` integer NOT NULL,
+    `resource` text NOT NULL,
+    `action` text NOT NULL,
+    `created_at` datetime,
+    `updated_at` datetime,
+    `deleted_at` datetime
+);
+CREATE INDEX `idx_user_permissions_deleted_at` ON `user_permissions`(`deleted_at`);
+
+CREATE TABLE `files` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `name` text NOT NULL,
+    `path` text NOT NULL,
+    `bucket_id` integer NOT NULL,
+    `size` integer NOT NULL,
+    `content_type` text NOT NULL,
+    `hash` text,
+    `created_by` integer NOT NULL,
+    `updated_by` integer NOT NULL,
+    `last_modified` datetime,
+    `created_at` datetime,
+    `updated_at` datetime,
+    `deleted_at` datetime
+);
+CREATE INDEX `idx_files_deleted_at` ON `files`(`deleted_at`);
+
+CREATE TABLE `file_metadata` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `file_id` integer NOT NULL,
+    `key` text NOT NULL,
+    `value` text,
+    `created_at` datetime,
+    `updated_at` datetime,
+    `deleted_at` datetime
+);
+CREATE INDEX `idx_file_metadata_deleted_at` ON `file_metadata`(`deleted_at`);
+
+CREATE TABLE `buckets` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `name` text NOT NULL,
+    `owner_id` integer NOT NULL,
+    `description` text,
+    `created_at` datetime,
+    `updated_at` datetime,
+    `deleted_at` datetime,
+    CONSTRAINT `uni_buckets_name` UNIQUE (`name`)
+);
+CREATE INDEX `idx_buckets_deleted_at` ON `buckets`(`deleted_at`);
+
+CREATE TABLE `bucket_permissions` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `bucket_id` integer NOT NULL,
+    `user_id` integer NOT NULL,
+    `access` text NOT NULL,
+    `expires_at` datetime,
+    `created_at` datetime,
+    `updated_at` datetime,
+    `deleted_at` datetime
+);
+CREATE INDEX `idx_bucket_permissions_deleted_at` ON `bucket_permissions`(`deleted_at`);
@@ -0,0 +1,45 @@
+DROP TABLE `audit_events`;
+DROP TABLE `lifecycle_rules`;
+DROP TABLE `quotas`;
+DROP TABLE `group_members`;
+DROP TABLE `groups`;
+DROP TABLE `user_identities`;
+DROP TABLE `password_reset_tokens`;
+DROP TABLE `invitation_grants`;
+DROP TABLE `invitations`;
+DROP TABLE `login_attempts`;
+DROP TABLE `bucket_path_rules`;
+
+-- Group grants have no place in the old table and are dropped
+CREATE TABLE `bucket_permissions_old` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `bucket_id` integer NOT NULL,
+    `user_id` integer NOT NULL,
+    `access` text NOT NULL,
+    `expires_at` datetime,
+    `created_at` datetime,
+    `updated_at` datetime,
+    `deleted_at` datetime
+);
+INSERT INTO `bucket_permissions_old` (`id`, `bucket_id`, `user_id`, `access`, `expires_at`, `created_at`, `updated_at`, `deleted_at`)
+    SELECT `id`, `bucket_id`, `user_id`, `access`, `expires_at`, `created_at`, `updated_at`, `deleted_at` FROM `bucket_permissions` WHERE `group_id` = 0;
+DROP TABLE `bucket_permissions`;
+ALTER TABLE `bucket_permissions_old` RENAME TO `bucket_permissions`;
+CREATE INDEX `idx_bucket_permissions_deleted_at` ON `bucket_permissions`(`deleted_at`);
+
+ALTER TABLE `buckets` DROP COLUMN `default_retention_days`;
+ALTER TABLE `buckets` DROP COLUMN `retention_mode`;
+ALTER TABLE `buckets` DROP COLUMN `object_lock_enabled`;
+ALTER TABLE `buckets` DROP COLUMN `denied_extensions`;
+ALTER TABLE `buckets` DROP COLUMN `allowed_extensions`;
+ALTER TABLE `buckets` DROP COLUMN `denied_types`;
+ALTER TABLE `buckets` DROP COLUMN `allowed_types`;
+ALTER TABLE `buckets` DROP COLUMN `max_file_bytes`;
+ALTER TABLE `buckets` DROP COLUMN `permission_version`;
+
+DROP INDEX `idx_files_retain_until`;
+ALTER TABLE `files` DROP COLUMN `legal_hold`;
+ALTER TABLE `files` DROP COLUMN `retain_until`;
+ALTER TABLE `files` DROP COLUMN `retention_mode`;
+
+ALTER TABLE `users` DROP COLUMN `must_change_password`;
@@ -0,0 +1,191 @@
+ALTER TABLE `users` ADD COLUMN `must_change_password` numeric DEFAULT false;
+
+ALTER TABLE `files` ADD COLUMN `retention_mode` text;
+ALTER TABLE `files` ADD COLUMN `retain_until` datetime;
+ALTER TABLE `files` ADD COLUMN `legal_hold` numeric NOT NULL DEFAULT false;
+CREATE INDEX `idx_files_retain_until` ON `files`(`retain_until`);
+
+ALTER TABLE `buckets` ADD COLUMN `permission_version` integer NOT NULL DEFAULT 1;
+ALTER TABLE `buckets` ADD COLUMN `max_file_bytes` integer NOT NULL DEFAULT 0;
+ALTER TABLE `buckets` ADD COLUMN `allowed_types` text;
+ALTER TABLE `buckets` ADD COLUMN `denied_types` text;
+ALTER TABLE `buckets` ADD COLUMN `allowed_extensions` text;
+ALTER TABLE `buckets` ADD COLUMN `denied_extensions` text;
+ALTER TABLE `buckets` ADD COLUMN `object_lock_enabled` numeric NOT NULL DEFAULT false;
+ALTER TABLE `buckets` ADD COLUMN `retention_mode` text;
+ALTER TABLE `buckets` ADD COLUMN `default_retention_days` integer NOT NULL DEFAULT 0;
+
+-- SQLite cannot change the default of user_id, so the table is rebuilt
+CREATE TABLE `bucket_permissions_new` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `bucket_id` integer NOT NULL,
+    `user_id` integer NOT NULL DEFAULT 0,
+    `group_id` integer NOT NULL DEFAULT 0,
+    `access` text NOT NULL,
+    `not_before` datetime,
+    `expires_at` datetime,
+    `created_at` datetime,
+    `updated_at` datetime,
+    `deleted_at` datetime
+);
+INSERT INTO `bucket_permissions_new` (`id`, `bucket_id`, `user_id`, `access`, `expires_at`, `created_at`, `updated_at`, `deleted_at`)
+    SELECT `id`, `bucket_id`, `user_id`, `access`, `expires_at`, `created_at`, `updated_at`, `deleted_at` FROM `bucket_permissions`;
+DROP TABLE `bucket_permissions`;
+ALTER TABLE `bucket_permissions_new` RENAME TO `bucket_permissions`;
+CREATE INDEX `idx_bucket_permissions_deleted_at` ON `bucket_permissions`(`deleted_at`);
+CREATE INDEX `idx_bucket_permissions_expires_at` ON `bucket_permissions`(`expires_at`);
+CREATE INDEX `idx_bucket_permissions_group_id` ON `bucket_permissions`(`group_id`);
+CREATE INDEX `idx_bucket_permissions_user_id` ON `bucket_permissions`(`user_id`);
+
+CREATE TABLE `bucket_path_rules` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `bucket_id` integer NOT NULL,
+    `user_id` integer NOT NULL DEFAULT 0,
+    `group_id` integer NOT NULL DEFAULT 0,
+    `prefix` text NOT NULL,
+    `effect` text NOT NULL,
+    `access` text NOT NULL,
+    `created_by` integer NOT NULL,
+    `created_at` datetime,
+    `updated_at` datetime,
+    `deleted_at` datetime
+);
+CREATE INDEX `idx_bucket_path_rules_user_id` ON `bucket_path_rules`(`user_id`);
+CREATE INDEX `idx_bucket_path_rules_bucket_id` ON `bucket_path_rules`(`bucket_id`);
+CREATE INDEX `idx_bucket_path_rules_deleted_at` ON `bucket_path_rules`(`deleted_at`);
+CREATE INDEX `idx_bucket_path_rules_group_id` ON `bucket_path_rules`(`group_id`);
+
+CREATE TABLE `login_attempts` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `key` text NOT NULL,
+    `failures` integer NOT NULL DEFAULT 0,
+    `last_failure` datetime,
+    `locked_until` datetime,
+    `created_at` datetime,
+    `updated_at` datetime
+);
+CREATE UNIQUE INDEX `idx_login_attempts_key` ON `login_attempts`(`key`);
+
+CREATE TABLE `invitations` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `token_hash` text NOT NULL,
+    `role` text NOT NULL DEFAULT 'user',
+    `note` text,
+    `created_by` integer NOT NULL,
+    `expires_at` datetime,
+    `used_at` datetime,
+    `used_by` integer,
+    `created_at` datetime,
+    `updated_at` datetime,
+    `deleted_at` datetime
+);
+CREATE INDEX `idx_invitations_deleted_at` ON `invitations`(`deleted_at`);
+CREATE UNIQUE INDEX `idx_invitations_token_hash` ON `invitations`(`token_hash`);
+
+CREATE TABLE `invitation_grants` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `invitation_id` integer NOT NULL,
+    `bucket_id` integer NOT NULL,
+    `access` text NOT NULL,
+    `created_at` datetime,
+    CONSTRAINT `fk_invitations_grants` FOREIGN KEY (`invitation_id`) REFERENCES `invitations`(`id`)
+);
+CREATE INDEX `idx_invitation_grants_invitation_id` ON `invitation_grants`(`invitation_id`);
+
+CREATE TABLE `password_reset_tokens` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `user_id` integer NOT NULL,
+    `token_hash` text NOT NULL,
+    `created_by` integer NOT NULL,
+    `expires_at` datetime NOT NULL,
+    `used_at` datetime,
+    `created_at` datetime
+);
+CREATE UNIQUE INDEX `idx_password_reset_tokens_token_hash` ON `password_reset_tokens`(`token_hash`);
+CREATE INDEX `idx_password_reset_tokens_user_id` ON `password_reset_tokens`(`user_id`);
+
+CREATE TABLE `user_identities` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `user_id` integer NOT NULL,
+    `provider` text NOT NULL,
+    `subject` text NOT NULL,
+    `last_login` datetime,
+    `created_at` datetime,
+    `updated_at` datetime
+);
+CREATE UNIQUE INDEX `idx_identity_provider_subject` ON `user_identities`(`provider`,`subject`);
+CREATE INDEX `idx_user_identities_user_id` ON `user_identities`(`user_id`);
+
+CREATE TABLE `groups` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `name` text NOT NULL,
+    `description` text,
+    `created_by` integer NOT NULL,
+    `created_at` datetime,
+    `updated_at` datetime,
+    `deleted_at` datetime,
+    CONSTRAINT `uni_groups_name` UNIQUE (`name`)
+);
+CREATE INDEX `idx_groups_deleted_at` ON `groups`(`deleted_at`);
+
+CREATE TABLE `group_members` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `group_id` integer NOT NULL,
+    `user_id` integer NOT NULL,
+    `created_at` datetime
+);
+CREATE INDEX `idx_group_members_user_id` ON `group_members`(`user_id`);
+CREATE UNIQUE INDEX `idx_group_member` ON `group_members`(`group_id`,`user_id`);
+
+CREATE TABLE `quotas` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `scope` text NOT NULL,
+    `target_id` integer NOT NULL,
+    `max_bytes` integer NOT NULL DEFAULT 0,
+    `max_files` integer NOT NULL DEFAULT 0,
+    `warn_percent` integer NOT NULL DEFAULT 0,
+    `updated_by` integer NOT NULL,
+    `created_at` datetime,
+    `updated_at` datetime
+);
+CREATE UNIQUE INDEX `idx_quota_target` ON `quotas`(`scope`,`target_id`);
+
+CREATE TABLE `lifecycle_rules` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `bucket_id` integer NOT NULL,
+    `name` text NOT NULL,
+    `enabled` numeric NOT NULL DEFAULT true,
+    `prefix` text,
+    `tag_key` text,
+    `tag_value` text,
+    `expire_after_days` integer NOT NULL DEFAULT 0,
+    `keep_versions` integer NOT NULL DEFAULT 0,
+    `abort_incomplete_after_days` integer NOT NULL DEFAULT 0,
+    `created_by` integer NOT NULL,
+    `created_at` datetime,
+    `updated_at` datetime,
+    `deleted_at` datetime,
+    CONSTRAINT `fk_buckets_lifecycle_rules` FOREIGN KEY (`bucket_id`) REFERENCES `buckets`(`id`)
+);
+CREATE INDEX `idx_lifecycle_rules_deleted_at` ON `lifecycle_rules`(`deleted_at`);
+CREATE INDEX `idx_lifecycle_rules_bucket_id` ON `lifecycle_rules`(`bucket_id`);
+
+CREATE TABLE `audit_events` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `created_at` datetime,
+    `actor_id` integer NOT NULL DEFAULT 0,
+    `actor_name` text,
+    `ip` text,
+    `action` text NOT NULL,
+    `target_type` text,
+    `target_id` integer,
+    `before` text,
+    `after` text,
+    `result` text NOT NULL,
+    `error` text
+);
+CREATE INDEX `idx_audit_events_result` ON `audit_events`(`result`);
+CREATE INDEX `idx_audit_target` ON `audit_events`(`target_type`,`target_id`);
+CREATE INDEX `idx_audit_events_action` ON `audit_events`(`action`);
+CREATE INDEX `idx_audit_events_actor_id` ON `audit_events`(`actor_id`);
+CREATE INDEX `idx_audit_events_created_at` ON `audit_events`(`created_at`);
@@ -0,0 +1,9 @@
+-- Uploads used to store the bucket name in front of the file name, as
+-- "<bucket>/<name>"; paths are now relative to the bucket root, as "/<name>"
+UPDATE `files`
+SET `path` = '/' || SUBSTR(`path`, LENGTH((SELECT `name` FROM `buckets` WHERE `buckets`.`id` = `files`.`bucket_id`)) + 2)
+WHERE EXISTS (
+    SELECT 1 FROM `buckets`
+    WHERE `buckets`.`id` = `files`.`bucket_id`
+        AND SUBSTR(`files`.`path`, 1, LENGTH(`buckets`.`name`) + 1) = `buckets`.`name` || '/'
+);
@@ -0,0 +1,4 @@
+-- Files created before their content arrives are marked as pending uploads.
+-- Existing files are not marked: whether their content was ever expected
+-- cannot be told, so lifecycle rules never abort them.
+ALTER TABLE `files` ADD COLUMN `upload_pending` numeric NOT NULL DEFAULT false;
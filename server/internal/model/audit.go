@@ -0,0 +1,82 @@
+package model
+
+import "time"
+
+// Audit event results
+const (
+	AuditSuccess = "success"
+	AuditFailure = "failure"
+	AuditDenied  = "denied"
+)
+
+// Audited actions
+const (
+	AuditLogin              = "auth.login"
+	AuditPasswordChange     = "auth.password_change"
+	AuditPasswordResetIssue = "auth.password_reset_issue"
+	AuditPasswordReset      = "auth.password_reset"
+	AuditLoginUnlock        = "auth.unlock"
+	AuditLoginLockout       = "auth.lockout"
+	AuditSetup              = "auth.setup"
+	AuditUserCreate         = "user.create"
+	AuditUserUpdate         = "user.update"
+	AuditUserDelete         = "user.delete"
+	AuditUserStatus         = "user.status"
+	AuditUserPermissions    = "user.permissions"
+	AuditUserProvision      = "user.provision"
+	AuditUserRootSync       = "user.root_sync"
+	AuditInvitationCreate   = "invitation.create"
+	AuditInvitationRevoke   = "invitation.revoke"
+	AuditGroupCreate        = "group.create"
+	AuditGroupDelete        = "group.delete"
+	AuditGroupMemberAdd     = "group.member_add"
+	AuditGroupMemberRemove  = "group.member_remove"
+	AuditBucketCreate       = "bucket.create"
+	AuditBucketUpdate       = "bucket.update"
+	AuditBucketUploadPolicy = "bucket.upload_policy"
+	AuditBucketDelete       = "bucket.delete"
+	AuditBucketPermissions  = "bucket.permissions"
+	AuditBucketGrant        = "bucket.grant"
+	AuditBucketRevoke       = "bucket.revoke"
+	AuditBucketExpire       = "bucket.permission_expire"
+	AuditBucketOwner        = "bucket.owner"
+	AuditBucketPathRule     = "bucket.path_rule"
+	AuditBucketObjectLock   = "bucket.object_lock"
+	AuditBucketLifecycle    = "bucket.lifecycle_rule"
+	AuditQuotaSet           = "quota.set"
+	AuditQuotaDelete        = "quota.delete"
+	AuditFileUpload         = "file.upload"
+	AuditFileDownload       = "file.download"
+	AuditFileDelete         = "file.delete"
+	AuditFileRetention      = "file.retention"
+	AuditRetentionBypass    = "file.retention_bypass"
+	AuditFileLegalHold      = "file.legal_hold"
+	AuditFileExpire         = "file.lifecycle_delete"
+)
+
+// AuditTargetInvitation is the target type of invitation events; other events
+// target the resource kinds of the authz package
+const AuditTargetInvitation = "invitation"
+
+// AuditEvent is an append-only record of a security-relevant action. ActorID
+// is 0 for anonymous requests and background jobs; Before and After hold JSON
+// snapshots of the target where they are known.
+type AuditEvent struct {
+	ID         uint      `gorm:"primarykey" json:"id"`
+	CreatedAt  time.Time `gorm:"index" json:"created_at"`
+	ActorID    uint      `gorm:"not null;default:0;index" json:"actor_id"`
+	ActorName  string    `gorm:"size:255" json:"actor_name,omitempty"`
+	IP         string    `gorm:"size:64" json:"ip,omitempty"`
+	Action     string    `gorm:"size:50;not null;index" json:"action"`
+	TargetType string    `gorm:"size:20;index:idx_audit_target" json:"target_type,omitempty"`
+	TargetID   uint      `gorm:"index:idx_audit_target" json:"target_id,omitempty"`
+	Before     string    `gorm:"type:text" json:"before,omitempty"`
+	After      string    `gorm:"type:text" json:"after,omitempty"`
+	Result     string    `gorm:"size:20;not null;index" json:"result"` // success, failure, denied
+	Error      string    `gorm:"size:500" json:"error,omitempty"`
+}
+
+// TableName specifies the table name for AuditEvent
+func (AuditEvent) TableName() string {
+	return "audit_events"
+}
@@ -0,0 +1,23 @@
+package model
+
+import "time"
+
+// AuditQuery filters audit events. Zero values match everything.
+type AuditQuery struct {
+	ActorID    uint      `form:"actor_id"`
+	Action     string    `form:"action"`
+	TargetType string    `form:"target_type"`
+	TargetID   uint      `form:"target_id"`
+	Result     string    `form:"result" binding:"omitempty,oneof=success failure denied"`
+	IP         string    `form:"ip"`
+	From       time.Time `form:"from" time_format:"2006-01-02T15:04:05Z07:00"`
+	To         time.Time `form:"to" time_format:"2006-01-02T15:04:05Z07:00"`
+}
+
+// AuditEventListResponse represents the paginated audit event list response
+type AuditEventListResponse struct {
+	Events     []AuditEvent `json:"events"`
+	TotalCount int64        `json:"total_count"`
+	Page       int          `json:"page"`
+	PageSize   int          `json:"page_size"`
+}
@@ -5,6 +5,8 @@ type RegisterRequest struct {
 	Username string `json:"username" binding:"required"`
 	Password string `json:"password" binding:"required"`
 	IsRoot   bool   `json:"is_root"`
+	// InviteToken is required when registration is invite-only
+	InviteToken string `json:"invite_token,omitempty"`
 }
 
 // LoginRequest represents the request body for user login
@@ -19,6 +21,20 @@ type ChangePasswordRequest struct {
 	NewPassword    string `json:"new_password" binding:"required"`
 }
 
+// PasswordResetRequest represents the request body for redeeming a password reset token
+type PasswordResetRequest struct {
+	ResetToken  string `json:"reset_token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+// PasswordResetResponse represents a newly issued password reset token.
+// The token is only returned once.
+type PasswordResetResponse struct {
+	UserID    uint     `json:"user_id"`
+	Token     string   `json:"token"`
+	ExpiresAt JSONTime `json:"expires_at"`
+}
+
 // TokenResponse represents the response body for successful login
 type TokenResponse struct {
 	Token string `json:"token"`
@@ -29,4 +45,18 @@ type AuthResponse struct {
 	ID       uint           `json:"id"`
 	Username string         `json:"username"`
 	Token    *TokenResponse `json:"token"`
+	// MustChangePassword is set when the token only allows changing the password
+	MustChangePassword bool `json:"must_change_password,omitempty"`
+}
+
+// SetupRequest represents the request body for first-run root setup
+type SetupRequest struct {
+	SetupToken string `json:"setup_token" binding:"required"`
+	Password   string `json:"password" binding:"required"`
+}
+
+// UnlockRequest represents the request body for clearing a login lockout
+type UnlockRequest struct {
+	Username string `json:"username"`
+	IP       string `json:"ip"`
 }
@@ -14,19 +14,68 @@ type Bucket struct {
 	CreatedAt   time.Time      `json:"created_at"`
 	UpdatedAt   time.Time      `json:"updated_at"`
 	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+
+	// PermissionVersion is incremented on every change to the bucket's permission
+	// set and is used for optimistic concurrency control of permission edits
+	PermissionVersion uint `gorm:"not null;default:1" json:"permission_version"`
+
+	// Upload policy. A MaxFileBytes of 0 uses the global limit. The lists are
+	// comma separated; types may use wildcards such as image/*, extensions
+	// include the dot. Denied entries win over allowed ones.
+	MaxFileBytes      int64  `gorm:"not null;default:0" json:"max_file_bytes"`
+	AllowedTypes      string `gorm:"size:1024" json:"allowed_types"`
+	DeniedTypes       string `gorm:"size:1024" json:"denied_types"`
+	AllowedExtensions string `gorm:"size:1024" json:"allowed_extensions"`
+	DeniedExtensions  string `gorm:"size:1024" json:"denied_extensions"`
+
+	LifecycleRules []LifecycleRule `gorm:"foreignKey:BucketID" json:"lifecycle_rules,omitempty"`
+
+	// Object lock. When enabled, new files are retained for DefaultRetentionDays
+	// in RetentionMode, and files can be given their own retention or legal hold.
+	ObjectLockEnabled    bool   `gorm:"not null;default:false" json:"object_lock_enabled"`
+	RetentionMode        string `gorm:"size:20" json:"retention_mode,omitempty"` // governance, compliance
+	DefaultRetentionDays int    `gorm:"not null;default:0" json:"default_retention_days"`
 }
 
 type BucketPermission struct {
 	ID        uint           `gorm:"primarykey" json:"id"`
 	BucketID  uint           `gorm:"not null" json:"bucket_id"`
-	UserID    uint           `gorm:"not null" json:"user_id"`
-	Access    string         `gorm:"size:20;not null" json:"access"` // read, write, admin
-	ExpiresAt *time.Time     `json:"expires_at"`
+	UserID    uint           `gorm:"not null;default:0;index" json:"user_id"`  // set for user grants
+	GroupID   uint           `gorm:"not null;default:0;index" json:"group_id"` // set for group grants
+	Access    string         `gorm:"size:20;not null" json:"access"`           // read, write, admin
+	NotBefore *time.Time     `json:"not_before"`
+	ExpiresAt *time.Time     `gorm:"index" json:"expires_at"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// BucketPathRule allows or denies access to files under a path prefix of a bucket.
+// A rule applies to one user, one group, or everyone with access to the bucket
+// when both UserID and GroupID are 0.
+type BucketPathRule struct {
+	ID        uint           `gorm:"primarykey" json:"id"`
+	BucketID  uint           `gorm:"not null;index" json:"bucket_id"`
+	UserID    uint           `gorm:"not null;default:0;index" json:"user_id"`
+	GroupID   uint           `gorm:"not null;default:0;index" json:"group_id"`
+	Prefix    string         `gorm:"size:1024;not null" json:"prefix"`
+	Effect    string         `gorm:"size:10;not null" json:"effect"` // allow, deny
+	Access    string         `gorm:"size:20;not null" json:"access"` // read, write
+	CreatedBy uint           `gorm:"not null" json:"created_by"`
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
 }
 
+// ActiveBucketPermissions limits a query on bucket_permissions to grants that
+// are in effect at now: already started and not yet expired
+func ActiveBucketPermissions(now time.Time) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("(bucket_permissions.not_before IS NULL OR bucket_permissions.not_before <= ?)", now).
+			Where("(bucket_permissions.expires_at IS NULL OR bucket_permissions.expires_at > ?)", now)
+	}
+}
+
 // TableName specifies the table name for Bucket
 func (Bucket) TableName() string {
 	return "buckets"
@@ -36,3 +85,8 @@ func (Bucket) TableName() string {
 func (BucketPermission) TableName() string {
 	return "bucket_permissions"
 }
+
+// TableName specifies the table name for BucketPathRule
+func (BucketPathRule) TableName() string {
+	return "bucket_path_rules"
+}
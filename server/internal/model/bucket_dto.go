@@ -14,13 +14,53 @@ type BucketUpdateRequest struct {
 	Metadata    map[string]string `json:"metadata,omitempty"`
 }
 
-// BucketPermissionRequest represents the bucket permission request
+// BucketUploadPolicyRequest represents the request to set the upload policy of a bucket
+type BucketUploadPolicyRequest struct {
+	MaxFileBytes      int64    `json:"max_file_bytes" binding:"min=0"`
+	AllowedTypes      []string `json:"allowed_types"`
+	DeniedTypes       []string `json:"denied_types"`
+	AllowedExtensions []string `json:"allowed_extensions"`
+	DeniedExtensions  []string `json:"denied_extensions"`
+}
+
+// BucketObjectLockRequest represents the request to configure object lock of a bucket
+type BucketObjectLockRequest struct {
+	Enabled              bool   `json:"enabled"`
+	Mode                 string `json:"mode" binding:"omitempty,oneof=governance compliance"`
+	DefaultRetentionDays int    `json:"default_retention_days" binding:"min=0"`
+}
+
+// BucketPermissionRequest represents the bucket permission request.
+// Exactly one of UserID and GroupID must be set.
 type BucketPermissionRequest struct {
-	UserID    uint      `json:"user_id" binding:"required"`
+	UserID    uint      `json:"user_id" binding:"required_without=GroupID,excluded_with=GroupID"`
+	GroupID   uint      `json:"group_id" binding:"required_without=UserID"`
 	Access    string    `json:"access" binding:"required,oneof=read write admin"`
+	NotBefore *JSONTime `json:"not_before,omitempty"`
 	ExpiresAt *JSONTime `json:"expires_at,omitempty"`
 }
 
+// BucketPermissionListResponse represents the permission set of a bucket and its version
+type BucketPermissionListResponse struct {
+	Permissions []BucketPermission `json:"permissions"`
+	Version     uint               `json:"version"`
+}
+
+// BucketOwnerRequest represents the bucket ownership transfer request
+type BucketOwnerRequest struct {
+	OwnerID uint `json:"owner_id" binding:"required"`
+}
+
+// BucketPathRuleRequest represents the request to create a path rule. A rule
+// without UserID and GroupID applies to everyone with access to the bucket.
+type BucketPathRuleRequest struct {
+	UserID  uint   `json:"user_id" binding:"excluded_with=GroupID"`
+	GroupID uint   `json:"group_id"`
+	Prefix  string `json:"prefix" binding:"required,max=1024"`
+	Effect  string `json:"effect" binding:"required,oneof=allow deny"`
+	Access  string `json:"access" binding:"required,oneof=read write"`
+}
+
 // BucketResponse represents the bucket response with permissions
 type BucketResponse struct {
 	Bucket      *Bucket            `json:"bucket"`
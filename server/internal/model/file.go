@@ -21,6 +21,16 @@ type File struct {
 	CreatedAt    time.Time      `json:"created_at"`
 	UpdatedAt    time.Time      `json:"updated_at"`
 	DeletedAt    gorm.DeletedAt `gorm:"index" json:"-"`
+
+	// Object lock: a file under legal hold or retained until a future time
+	// cannot be deleted, overwritten or moved
+	RetentionMode string     `gorm:"size:20" json:"retention_mode,omitempty"` // governance, compliance
+	RetainUntil   *time.Time `gorm:"index" json:"retain_until,omitempty"`
+	LegalHold     bool       `gorm:"not null;default:false" json:"legal_hold"`
+
+	// A file created before its content arrives is pending until the content
+	// is stored; lifecycle rules abort uploads that stay pending
+	UploadPending bool `gorm:"not null;default:false" json:"upload_pending"`
 }
 
 type FileMetadata struct {
@@ -29,6 +29,32 @@ type FileResponse struct {
 	Metadata    map[string]string `json:"metadata,omitempty"`
 	CreatedAt   JSONTime         `json:"created_at"`
 	UpdatedAt   JSONTime         `json:"updated_at"`
+
+	RetentionMode string    `json:"retention_mode,omitempty"`
+	RetainUntil   *JSONTime `json:"retain_until,omitempty"`
+	LegalHold     bool      `json:"legal_hold,omitempty"`
+}
+
+// SetObjectLock copies the retention and legal hold of file into the response
+func (r *FileResponse) SetObjectLock(file *File) {
+	r.RetentionMode = file.RetentionMode
+	r.LegalHold = file.LegalHold
+	if file.RetainUntil != nil {
+		retainUntil := JSONTime(*file.RetainUntil)
+		r.RetainUntil = &retainUntil
+	}
+}
+
+// FileRetentionRequest represents the request to set the retention of a file.
+// Without RetainUntil the retention is removed.
+type FileRetentionRequest struct {
+	Mode        string    `json:"mode" binding:"required,oneof=governance compliance"`
+	RetainUntil *JSONTime `json:"retain_until,omitempty"`
+}
+
+// FileLegalHoldRequest represents the request to place or release a legal hold
+type FileLegalHoldRequest struct {
+	LegalHold *bool `json:"legal_hold" binding:"required"`
 }
 
 // FileListResponse represents the paginated file list response
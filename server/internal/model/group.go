@@ -0,0 +1,34 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type Group struct {
+	ID          uint           `gorm:"primarykey" json:"id"`
+	Name        string         `gorm:"size:50;unique;not null" json:"name"`
+	Description string         `gorm:"size:255" json:"description"`
+	CreatedBy   uint           `gorm:"not null" json:"created_by"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+type GroupMember struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	GroupID   uint      `gorm:"not null;uniqueIndex:idx_group_member" json:"group_id"`
+	UserID    uint      `gorm:"not null;uniqueIndex:idx_group_member;index" json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TableName specifies the table name for Group
+func (Group) TableName() string {
+	return "groups"
+}
+
+// TableName specifies the table name for GroupMember
+func (GroupMember) TableName() string {
+	return "group_members"
+}
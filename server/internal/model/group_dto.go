@@ -0,0 +1,32 @@
+package model
+
+// GroupCreateRequest represents the group creation request
+type GroupCreateRequest struct {
+	Name        string `json:"name" binding:"required,min=2,max=50"`
+	Description string `json:"description" binding:"max=255"`
+}
+
+// GroupUpdateRequest represents the group update request
+type GroupUpdateRequest struct {
+	Name        string `json:"name,omitempty" binding:"omitempty,min=2,max=50"`
+	Description string `json:"description,omitempty" binding:"max=255"`
+}
+
+// GroupMemberRequest represents the request to add a member to a group
+type GroupMemberRequest struct {
+	UserID uint `json:"user_id" binding:"required"`
+}
+
+// GroupResponse represents the group response with members
+type GroupResponse struct {
+	Group   *Group `json:"group"`
+	Members []User `json:"members"`
+}
+
+// GroupListResponse represents the paginated group list response
+type GroupListResponse struct {
+	Groups     []Group `json:"groups"`
+	TotalCount int64   `json:"total_count"`
+	Page       int     `json:"page"`
+	PageSize   int     `json:"page_size"`
+}
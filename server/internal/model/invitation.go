@@ -0,0 +1,41 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type Invitation struct {
+	ID        uint              `gorm:"primarykey" json:"id"`
+	TokenHash string            `gorm:"size:64;uniqueIndex;not null" json:"-"`
+	Role      string            `gorm:"size:20;not null;default:'user'" json:"role"` // user, root
+	Note      string            `gorm:"size:255" json:"note"`
+	CreatedBy uint              `gorm:"not null" json:"created_by"`
+	ExpiresAt *time.Time        `json:"expires_at"`
+	UsedAt    *time.Time        `json:"used_at"`
+	UsedBy    *uint             `json:"used_by"`
+	Grants    []InvitationGrant `gorm:"foreignKey:InvitationID" json:"grants,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+	DeletedAt gorm.DeletedAt    `gorm:"index" json:"-"`
+}
+
+// InvitationGrant is a bucket permission given to the user redeeming an invitation
+type InvitationGrant struct {
+	ID           uint      `gorm:"primarykey" json:"id"`
+	InvitationID uint      `gorm:"not null;index" json:"invitation_id"`
+	BucketID     uint      `gorm:"not null" json:"bucket_id"`
+	Access       string    `gorm:"size:20;not null" json:"access"` // read, write, admin
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// TableName specifies the table name for Invitation
+func (Invitation) TableName() string {
+	return "invitations"
+}
+
+// TableName specifies the table name for InvitationGrant
+func (InvitationGrant) TableName() string {
+	return "invitation_grants"
+}
@@ -0,0 +1,30 @@
+package model
+
+// InvitationCreateRequest represents the invitation creation request
+type InvitationCreateRequest struct {
+	Role      string                   `json:"role" binding:"omitempty,oneof=user root"`
+	Note      string                   `json:"note" binding:"max=255"`
+	ExpiresAt *JSONTime                `json:"expires_at,omitempty"`
+	Grants    []InvitationGrantRequest `json:"grants,omitempty" binding:"dive"`
+}
+
+// InvitationGrantRequest represents a bucket grant attached to an invitation
+type InvitationGrantRequest struct {
+	BucketID uint   `json:"bucket_id" binding:"required"`
+	Access   string `json:"access" binding:"required,oneof=read write admin"`
+}
+
+// InvitationResponse represents a newly created invitation.
+// The token is only returned once and cannot be recovered later.
+type InvitationResponse struct {
+	Invitation *Invitation `json:"invitation"`
+	Token      string      `json:"token"`
+}
+
+// InvitationListResponse represents the paginated invitation list response
+type InvitationListResponse struct {
+	Invitations []Invitation `json:"invitations"`
+	TotalCount  int64        `json:"total_count"`
+	Page        int          `json:"page"`
+	PageSize    int          `json:"page_size"`
+}
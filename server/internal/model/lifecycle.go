@@ -0,0 +1,34 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// LifecycleRule automatically removes files of a bucket. The optional Prefix
+// and TagKey/TagValue filters select the files a rule applies to; each
+// non-zero action is applied to them.
+type LifecycleRule struct {
+	ID       uint   `gorm:"primarykey" json:"id"`
+	BucketID uint   `gorm:"not null;index" json:"bucket_id"`
+	Name     string `gorm:"size:100;not null" json:"name"`
+	Enabled  bool   `gorm:"not null;default:true" json:"enabled"`
+	// Filters
+	Prefix   string `gorm:"size:1024" json:"prefix"`
+	TagKey   string `gorm:"size:50" json:"tag_key"`
+	TagValue string `gorm:"size:255" json:"tag_value"`
+	// Actions
+	ExpireAfterDays          int            `gorm:"not null;default:0" json:"expire_after_days"`
+	KeepVersions             int            `gorm:"not null;default:0" json:"keep_versions"`
+	AbortIncompleteAfterDays int            `gorm:"not null;default:0" json:"abort_incomplete_after_days"`
+	CreatedBy                uint           `gorm:"not null" json:"created_by"`
+	CreatedAt                time.Time      `json:"created_at"`
+	UpdatedAt                time.Time      `json:"updated_at"`
+	DeletedAt                gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// TableName specifies the table name for LifecycleRule
+func (LifecycleRule) TableName() string {
+	return "lifecycle_rules"
+}
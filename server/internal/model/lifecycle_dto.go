@@ -0,0 +1,34 @@
+package model
+
+// LifecycleRuleRequest represents the request to create or replace a lifecycle rule
+type LifecycleRuleRequest struct {
+	Name                     string `json:"name" binding:"required,max=100"`
+	Enabled                  *bool  `json:"enabled,omitempty"`
+	Prefix                   string `json:"prefix" binding:"max=1024"`
+	TagKey                   string `json:"tag_key" binding:"max=50,required_with=TagValue"`
+	TagValue                 string `json:"tag_value" binding:"max=255"`
+	ExpireAfterDays          int    `json:"expire_after_days" binding:"min=0"`
+	KeepVersions             int    `json:"keep_versions" binding:"min=0"`
+	AbortIncompleteAfterDays int    `json:"abort_incomplete_after_days" binding:"min=0"`
+}
+
+// LifecycleAction is a file removed, or to be removed in a dry run, by a lifecycle rule
+type LifecycleAction struct {
+	RuleID   uint   `json:"rule_id"`
+	BucketID uint   `json:"bucket_id"`
+	FileID   uint   `json:"file_id"`
+	Path     string `json:"path"`
+	Size     int64  `json:"size"`
+	Reason   string `json:"reason"` // expired, noncurrent_version, incomplete_upload
+}
+
+// LifecycleReport represents the outcome of applying lifecycle rules
+type LifecycleReport struct {
+	DryRun     bool              `json:"dry_run"`
+	RunAt      JSONTime          `json:"run_at"`
+	Actions    []LifecycleAction `json:"actions"`
+	FreedBytes int64             `json:"freed_bytes"`
+
+	// SkippedLocked counts matching files kept because of object lock
+	SkippedLocked int `json:"skipped_locked,omitempty"`
+}
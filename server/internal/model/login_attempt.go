@@ -0,0 +1,22 @@
+package model
+
+import (
+	"time"
+)
+
+// LoginAttempt tracks failed login attempts for a single key.
+// Keys are namespaced, e.g. "user:alice" or "ip:10.0.0.1".
+type LoginAttempt struct {
+	ID          uint       `gorm:"primarykey" json:"id"`
+	Key         string     `gorm:"size:191;uniqueIndex;not null" json:"key"`
+	Failures    int        `gorm:"not null;default:0" json:"failures"`
+	LastFailure time.Time  `json:"last_failure"`
+	LockedUntil *time.Time `json:"locked_until"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// TableName specifies the table name for LoginAttempt
+func (LoginAttempt) TableName() string {
+	return "login_attempts"
+}
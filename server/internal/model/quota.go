@@ -0,0 +1,28 @@
+package model
+
+import "time"
+
+// Quota scopes
+const (
+	QuotaScopeUser   = "user"
+	QuotaScopeBucket = "bucket"
+)
+
+// Quota limits the storage used by a user or stored in a bucket.
+// A limit of 0 means unlimited.
+type Quota struct {
+	ID          uint      `gorm:"primarykey" json:"id"`
+	Scope       string    `gorm:"size:10;not null;uniqueIndex:idx_quota_target" json:"scope"` // user, bucket
+	TargetID    uint      `gorm:"not null;uniqueIndex:idx_quota_target" json:"target_id"`
+	MaxBytes    int64     `gorm:"not null;default:0" json:"max_bytes"`
+	MaxFiles    int64     `gorm:"not null;default:0" json:"max_files"`
+	WarnPercent int       `gorm:"not null;default:0" json:"warn_percent"` // 0 uses the configured default
+	UpdatedBy   uint      `gorm:"not null" json:"updated_by"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// TableName specifies the table name for Quota
+func (Quota) TableName() string {
+	return "quotas"
+}
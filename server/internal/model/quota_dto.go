@@ -0,0 +1,20 @@
+package model
+
+// QuotaRequest represents the request to set a quota. A limit of 0 means unlimited.
+type QuotaRequest struct {
+	MaxBytes    int64 `json:"max_bytes" binding:"min=0"`
+	MaxFiles    int64 `json:"max_files" binding:"min=0"`
+	WarnPercent int   `json:"warn_percent" binding:"omitempty,min=1,max=100"`
+}
+
+// QuotaUsage represents the storage usage of a user or bucket against its quota
+type QuotaUsage struct {
+	Scope       string   `json:"scope"`
+	TargetID    uint     `json:"target_id"`
+	UsedBytes   int64    `json:"used_bytes"`
+	UsedFiles   int64    `json:"used_files"`
+	MaxBytes    int64    `json:"max_bytes"`
+	MaxFiles    int64    `json:"max_files"`
+	WarnPercent int      `json:"warn_percent"`
+	Warnings    []string `json:"warnings,omitempty"`
+}
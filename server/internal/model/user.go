@@ -12,6 +12,8 @@ type User struct {
 	Password  string         `gorm:"size:255;not null" json:"-"`
 	IsRoot    bool          `gorm:"default:false" json:"is_root"`
 	Status    string         `gorm:"size:20;default:'active'" json:"status"`
+	// MustChangePassword forces a password change on the next login
+	MustChangePassword bool `gorm:"default:false" json:"must_change_password"`
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
@@ -7,10 +7,12 @@ type UserUpdateRequest struct {
 	IsRoot   *bool  `json:"is_root,omitempty"`
 }
 
-// UserPermissionRequest represents the permission update request
+// UserPermissionRequest represents the permission update request.
+// A grant applies to every resource of its kind, e.g. bucket:create or user:read;
+// admin implies every action on the kind.
 type UserPermissionRequest struct {
-	Resource string `json:"resource" binding:"required"`
-	Action   string `json:"action" binding:"required,oneof=read write admin"`
+	Resource string `json:"resource" binding:"required,oneof=bucket file user group"`
+	Action   string `json:"action" binding:"required,oneof=read write create delete admin bypass_governance"`
 }
 
 // UserListResponse represents the paginated user list response
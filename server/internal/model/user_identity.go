@@ -0,0 +1,21 @@
+package model
+
+import (
+	"time"
+)
+
+// UserIdentity links a user to an account at an external identity provider
+type UserIdentity struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	UserID    uint      `gorm:"not null;index" json:"user_id"`
+	Provider  string    `gorm:"size:191;not null;uniqueIndex:idx_identity_provider_subject" json:"provider"` // oidc:<issuer>, ldap
+	Subject   string    `gorm:"size:191;not null;uniqueIndex:idx_identity_provider_subject" json:"subject"`
+	LastLogin time.Time `json:"last_login"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TableName specifies the table name for UserIdentity
+func (UserIdentity) TableName() string {
+	return "user_identities"
+}
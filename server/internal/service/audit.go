@@ -0,0 +1,124 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+
+	"github.com/minorcell/pfss/internal/authz"
+	"github.com/minorcell/pfss/internal/model"
+	"gorm.io/gorm"
+)
+
+// auditExportBatchSize is the number of events read at once while exporting
+const auditExportBatchSize = 500
+
+// AuditService records and queries the audit log
+type AuditService struct {
+	db *gorm.DB
+}
+
+// NewAuditService creates a new audit service
+func NewAuditService(db *gorm.DB) *AuditService {
+	return &AuditService{db: db}
+}
+
+// Record appends event to the audit log with the outcome of err. before and
+// after are stored as JSON and may be nil. Failures to write the event are
+// logged rather than returned so that auditing never changes the outcome of
+// the audited action.
+func (s *AuditService) Record(event *model.AuditEvent, before, after interface{}, err error) {
+	event.Before = auditJSON(before)
+	event.After = auditJSON(after)
+
+	switch {
+	case err == nil:
+		event.Result = model.AuditSuccess
+	case errors.Is(err, authz.ErrPermissionDenied):
+		event.Result = model.AuditDenied
+	default:
+		event.Result = model.AuditFailure
+	}
+	if err != nil {
+		event.Error = err.Error()
+		if len(event.Error) > 500 {
+			event.Error = event.Error[:500]
+		}
+	}
+
+	if err := s.db.Create(event).Error; err != nil {
+		log.Printf("Failed to record audit event %s: %v", event.Action, err)
+	}
+}
+
+// GetEvents returns audit events matching query with pagination, newest first
+func (s *AuditService) GetEvents(query *model.AuditQuery, page, pageSize int) ([]model.AuditEvent, int64, error) {
+	var total int64
+	if err := s.filter(query).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var events []model.AuditEvent
+	offset := (page - 1) * pageSize
+	if err := s.filter(query).Order("id DESC").Offset(offset).Limit(pageSize).Find(&events).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return events, total, nil
+}
+
+// ExportEvents calls fn for every audit event matching query, oldest first.
+// Events are read in batches so that exports of any size use bounded memory.
+func (s *AuditService) ExportEvents(query *model.AuditQuery, fn func(*model.AuditEvent) error) error {
+	var events []model.AuditEvent
+	return s.filter(query).Order("id").FindInBatches(&events, auditExportBatchSize, func(tx *gorm.DB, batch int) error {
+		for i := range events {
+			if err := fn(&events[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}).Error
+}
+
+// filter returns a query on the audit events matching query
+func (s *AuditService) filter(query *model.AuditQuery) *gorm.DB {
+	db := s.db.Model(&model.AuditEvent{})
+	if query.ActorID != 0 {
+		db = db.Where("actor_id = ?", query.ActorID)
+	}
+	if query.Action != "" {
+		db = db.Where("action = ?", query.Action)
+	}
+	if query.TargetType != "" {
+		db = db.Where("target_type = ?", query.TargetType)
+	}
+	if query.TargetID != 0 {
+		db = db.Where("target_id = ?", query.TargetID)
+	}
+	if query.Result != "" {
+		db = db.Where("result = ?", query.Result)
+	}
+	if query.IP != "" {
+		db = db.Where("ip = ?", query.IP)
+	}
+	if !query.From.IsZero() {
+		db = db.Where("created_at >= ?", query.From)
+	}
+	if !query.To.IsZero() {
+		db = db.Where("created_at < ?", query.To)
+	}
+	return db
+}
+
+// auditJSON encodes a snapshot of an audited target, or returns "" for nil
+func auditJSON(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	data, err := json.Marshal(v)
+	if err != nil || string(data) == "null" {
+		return ""
+	}
+	return string(data)
+}
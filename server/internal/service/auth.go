@@ -2,56 +2,196 @@ package service
 
 import (
 	"errors"
+	"log"
+	"sync"
+	"time"
 
 	"github.com/minorcell/pfss/internal/model"
 	"github.com/minorcell/pfss/pkg/util"
 	"gorm.io/gorm"
 )
 
+// Registration modes
+const (
+	// RegistrationOpen lets anyone register through /auth/register
+	RegistrationOpen = "open"
+	// RegistrationInvite requires an invitation token issued by root
+	RegistrationInvite = "invite"
+	// RegistrationDisabled only lets root create accounts
+	RegistrationDisabled = "disabled"
+)
+
+// ErrRegistrationClosed is returned when self-registration is not allowed
+var ErrRegistrationClosed = errors.New("registration is disabled")
+
+// ErrInvalidCredentials is returned when the username or password is wrong
+var ErrInvalidCredentials = errors.New("invalid username or password")
+
+// ErrAccountInactive is returned when a deactivated user tries to log in
+var ErrAccountInactive = errors.New("account is inactive")
+
+// ErrLoginUnavailable is returned when the directory cannot be reached and the
+// user cannot log in with a local account instead
+var ErrLoginUnavailable = errors.New("login is temporarily unavailable, please try again later")
+
+// AuthConfig configures the authentication service
+type AuthConfig struct {
+	// RegistrationMode is one of RegistrationOpen, RegistrationInvite or RegistrationDisabled
+	RegistrationMode string
+	// PasswordPolicy is applied whenever a password is set
+	PasswordPolicy *util.PasswordPolicy
+	// PasswordResetTTL is how long a root-issued reset token stays valid
+	PasswordResetTTL time.Duration
+	// Directory, when set, is tried before local passwords. Users unknown to
+	// the directory fall back to their local password. While the directory is
+	// unavailable only users without a directory identity can log in locally.
+	Directory Directory
+	// DirectoryProvision creates PFSS users for directory users on first login
+	DirectoryProvision bool
+	// ClientCertField is the field of a TLS client certificate that holds the
+	// username, ClientCertFieldCN (default) or ClientCertFieldEmail
+	ClientCertField string
+}
+
 // AuthService handles authentication related operations
 type AuthService struct {
-	db *gorm.DB
+	db     *gorm.DB
+	guard  *LoginGuard
+	audit  *AuditService
+	config AuthConfig
+
+	// setupTokenHash is the hash of the pending root setup token, if any,
+	// and setupRootID the account it claims
+	setupMu        sync.Mutex
+	setupTokenHash string
+	setupRootID    uint
 }
 
 // NewAuthService creates a new authentication service
-func NewAuthService(db *gorm.DB) *AuthService {
-	return &AuthService{db: db}
+func NewAuthService(db *gorm.DB, guard *LoginGuard, auditService *AuditService, config AuthConfig) *AuthService {
+	if config.RegistrationMode == "" {
+		config.RegistrationMode = RegistrationInvite
+	}
+	if config.PasswordPolicy == nil {
+		config.PasswordPolicy = util.DefaultPasswordPolicy()
+	}
+	if config.PasswordResetTTL <= 0 {
+		config.PasswordResetTTL = 24 * time.Hour
+	}
+	return &AuthService{db: db, guard: guard, audit: auditService, config: config}
 }
 
 // Login authenticates a user and returns a token
-func (s *AuthService) Login(req *model.LoginRequest) (*model.AuthResponse, error) {
+func (s *AuthService) Login(req *model.LoginRequest, clientIP string) (*model.AuthResponse, error) {
+	// Reject early while the username or IP is backing off or locked
+	if err := s.guard.Check(req.Username, clientIP); err != nil {
+		return nil, err
+	}
+
+	// directoryDown is set when the directory could not be asked, so that
+	// local accounts such as a break-glass root still work
+	directoryDown := false
+	if s.config.Directory != nil {
+		resp, err := s.loginDirectory(req.Username, req.Password)
+		switch {
+		case err == nil:
+			if err := s.guard.RecordSuccess(req.Username); err != nil {
+				return nil, err
+			}
+			return resp, nil
+		case errors.Is(err, ErrDirectoryInvalidCredentials):
+			if err := s.guard.RecordFailure(req.Username, clientIP); err != nil {
+				return nil, err
+			}
+			return nil, ErrInvalidCredentials
+		case errors.Is(err, ErrDirectoryUnavailable):
+			log.Printf("Directory login for %q failed, trying local accounts: %v", req.Username, err)
+			directoryDown = true
+		case !errors.Is(err, ErrDirectoryUserNotFound):
+			return nil, err
+		}
+	}
+
 	var user model.User
 	if err := s.db.Where("username = ?", req.Username).First(&user).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, errors.New("invalid username or password")
+			// The user may exist in the directory, so this is not counted as a failure
+			if directoryDown {
+				return nil, ErrLoginUnavailable
+			}
+			if err := s.guard.RecordFailure(req.Username, clientIP); err != nil {
+				return nil, err
+			}
+			return nil, ErrInvalidCredentials
 		}
 		return nil, err
 	}
 
+	if directoryDown {
+		var identities int64
+		if err := s.db.Model(&model.UserIdentity{}).
+			Where("user_id = ? AND provider = ?", user.ID, ldapProvider).
+			Count(&identities).Error; err != nil {
+			return nil, err
+		}
+		if identities > 0 {
+			return nil, ErrLoginUnavailable
+		}
+	}
+
 	// Validate password
 	if !util.ValidatePassword(req.Password, user.Password) {
-		return nil, errors.New("invalid username or password")
+		if err := s.guard.RecordFailure(req.Username, clientIP); err != nil {
+			return nil, err
+		}
+		// Answer like for unknown users so that local accounts cannot be told apart
+		if directoryDown {
+			return nil, ErrLoginUnavailable
+		}
+		return nil, ErrInvalidCredentials
 	}
 
-	// Generate token
-	token, err := util.GenerateToken(user.ID, user.Username, user.IsRoot)
-	if err != nil {
+	if user.Status != "active" {
+		return nil, ErrAccountInactive
+	}
+
+	if err := s.guard.RecordSuccess(req.Username); err != nil {
 		return nil, err
 	}
 
-	// Create response
-	tokenResp := &model.TokenResponse{
-		Token: token,
+	// Upgrade hashes created with an outdated bcrypt cost while the plaintext is at hand
+	if util.PasswordNeedsRehash(user.Password) {
+		if hashedPassword, err := util.HashPassword(req.Password); err == nil {
+			if err := s.db.Model(&user).Update("password", hashedPassword).Error; err != nil {
+				log.Printf("Failed to rehash password for user %d: %v", user.ID, err)
+			}
+		}
 	}
-	return &model.AuthResponse{
-		ID:       user.ID,
-		Username: user.Username,
-		Token:    tokenResp,
-	}, nil
+
+	return s.newAuthResponse(&user)
 }
 
-// Register creates a new user account
-func (s *AuthService) Register(req *model.RegisterRequest) (*model.AuthResponse, error) {
+// Register creates a new user account.
+// byRoot is set when an authenticated root user creates the account; only then
+// is req.IsRoot honoured and the registration mode bypassed. Otherwise the mode
+// decides whether an invitation token is required, and an invitation may
+// preset the role and bucket grants of the new user.
+func (s *AuthService) Register(req *model.RegisterRequest, byRoot bool) (*model.AuthResponse, error) {
+	if !byRoot {
+		if req.IsRoot {
+			return nil, errors.New("permission denied: only root can create root users")
+		}
+		switch s.config.RegistrationMode {
+		case RegistrationOpen:
+		case RegistrationInvite:
+			if req.InviteToken == "" {
+				return nil, errors.New("an invitation token is required")
+			}
+		default:
+			return nil, ErrRegistrationClosed
+		}
+	}
+
 	// Check if username already exists
 	var count int64
 	if err := s.db.Model(&model.User{}).Where("username = ?", req.Username).Count(&count).Error; err != nil {
@@ -61,6 +201,10 @@ func (s *AuthService) Register(req *model.RegisterRequest) (*model.AuthResponse,
 		return nil, errors.New("username already exists")
 	}
 
+	if err := s.config.PasswordPolicy.Validate(req.Password, req.Username); err != nil {
+		return nil, err
+	}
+
 	// Hash password
 	hashedPassword, err := util.HashPassword(req.Password)
 	if err != nil {
@@ -75,45 +219,91 @@ func (s *AuthService) Register(req *model.RegisterRequest) (*model.AuthResponse,
 		Status:   "active",
 	}
 
-	if err := s.db.Create(user).Error; err != nil {
-		return nil, err
-	}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+		if byRoot || req.InviteToken == "" {
+			return nil
+		}
 
-	// Generate token
-	token, err := util.GenerateToken(user.ID, user.Username, user.IsRoot)
+		invitation, err := redeemInvitation(tx, req.InviteToken, user.ID)
+		if err != nil {
+			return err
+		}
+		if invitation.Role == "root" {
+			user.IsRoot = true
+			return tx.Model(user).Update("is_root", true).Error
+		}
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	// Create response
-	tokenResp := &model.TokenResponse{
-		Token: token,
-	}
-	return &model.AuthResponse{
-		ID:       user.ID,
-		Username: user.Username,
-		Token:    tokenResp,
-	}, nil
+	return s.newAuthResponse(user)
 }
 
-// ChangePassword changes a user's password
-func (s *AuthService) ChangePassword(userID uint, currentPassword, newPassword string) error {
+// ChangePassword changes a user's password and returns a fresh token
+func (s *AuthService) ChangePassword(userID uint, currentPassword, newPassword string) (*model.AuthResponse, error) {
 	var user model.User
 	if err := s.db.First(&user, userID).Error; err != nil {
-		return err
+		return nil, err
 	}
 
 	// Validate current password
 	if !util.ValidatePassword(currentPassword, user.Password) {
-		return errors.New("current password is incorrect")
+		return nil, errors.New("current password is incorrect")
+	}
+
+	if newPassword == currentPassword {
+		return nil, errors.New("new password must differ from the current password")
+	}
+	if err := s.config.PasswordPolicy.Validate(newPassword, user.Username); err != nil {
+		return nil, err
 	}
 
 	// Hash new password
 	hashedPassword, err := util.HashPassword(newPassword)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	// Update password and lift any forced password change
+	if err := s.db.Model(&user).Updates(map[string]interface{}{
+		"password":             hashedPassword,
+		"must_change_password": false,
+	}).Error; err != nil {
+		return nil, err
+	}
+	user.MustChangePassword = false
+
+	return s.newAuthResponse(&user)
+}
+
+// newAuthResponse issues a token for the user. Users that must change their
+// password only get a token that allows doing so.
+func (s *AuthService) newAuthResponse(user *model.User) (*model.AuthResponse, error) {
+	var token string
+	var err error
+	if user.MustChangePassword {
+		token, err = util.GeneratePasswordChangeToken(user.ID, user.Username, user.IsRoot)
+	} else {
+		token, err = util.GenerateToken(user.ID, user.Username, user.IsRoot)
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	// Update password
-	return s.db.Model(&user).Update("password", hashedPassword).Error
+	return &model.AuthResponse{
+		ID:                 user.ID,
+		Username:           user.Username,
+		Token:              &model.TokenResponse{Token: token},
+		MustChangePassword: user.MustChangePassword,
+	}, nil
+}
+
+// Unlock clears a login lockout for a username and/or client IP
+func (s *AuthService) Unlock(username, ip string) error {
+	return s.guard.Unlock(username, ip)
 }
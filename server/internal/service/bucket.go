@@ -1,22 +1,37 @@
 package service
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"log"
 	"strings"
 	"time"
 
+	"github.com/minorcell/pfss/internal/authz"
 	"github.com/minorcell/pfss/internal/model"
+	"github.com/minorcell/pfss/pkg/metrics"
 	"gorm.io/gorm"
 )
 
+// Bucket permission errors
+var (
+	// ErrOwnerPermission is returned when a request would change the owner's grant
+	ErrOwnerPermission = errors.New("the owner's permission cannot be changed; transfer ownership instead")
+	// ErrPermissionVersionConflict is returned when the permission set was changed since it was read
+	ErrPermissionVersionConflict = errors.New("bucket permissions have been modified; reload and retry")
+)
+
 // BucketService handles bucket-related operations
 type BucketService struct {
-	db *gorm.DB
+	db           *gorm.DB
+	authz        *authz.Authorizer
+	auditService *AuditService
 }
 
 // NewBucketService creates a new bucket service
-func NewBucketService(db *gorm.DB) *BucketService {
-	return &BucketService{db: db}
+func NewBucketService(db *gorm.DB, authorizer *authz.Authorizer, auditService *AuditService) *BucketService {
+	return &BucketService{db: db, authz: authorizer, auditService: auditService}
 }
 
 // validateBucketName validates bucket name format
@@ -32,7 +47,15 @@ func validateBucketName(name string) error {
 }
 
 // CreateBucket creates a new bucket
-func (s *BucketService) CreateBucket(req *model.BucketCreateRequest, ownerID uint) (*model.Bucket, error) {
+func (s *BucketService) CreateBucket(ctx context.Context, req *model.BucketCreateRequest, ownerID uint, isRoot bool) (*model.Bucket, error) {
+	ctx, span := tracer.Start(ctx, "BucketService.CreateBucket")
+	defer span.End()
+
+	// Check permissions
+	if err := s.authz.Require(ctx, authz.Subject{UserID: ownerID, IsRoot: isRoot}, authz.ActionCreate, authz.Buckets()); err != nil {
+		return nil, err
+	}
+
 	// Validate bucket name
 	if err := validateBucketName(req.Name); err != nil {
 		return nil, err
@@ -40,7 +63,7 @@ func (s *BucketService) CreateBucket(req *model.BucketCreateRequest, ownerID uin
 
 	// Check if bucket name already exists
 	var count int64
-	if err := s.db.Model(&model.Bucket{}).Where("name = ?", req.Name).Count(&count).Error; err != nil {
+	if err := s.db.WithContext(ctx).Model(&model.Bucket{}).Where("name = ?", req.Name).Count(&count).Error; err != nil {
 		return nil, err
 	}
 	if count > 0 {
@@ -55,7 +78,7 @@ func (s *BucketService) CreateBucket(req *model.BucketCreateRequest, ownerID uin
 	}
 
 	// Start transaction
-	err := s.db.Transaction(func(tx *gorm.DB) error {
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		// Create bucket
 		if err := tx.Create(bucket).Error; err != nil {
 			return err
@@ -82,15 +105,21 @@ func (s *BucketService) CreateBucket(req *model.BucketCreateRequest, ownerID uin
 }
 
 // GetBuckets returns a list of buckets with pagination
-func (s *BucketService) GetBuckets(userID uint, isRoot bool, page, pageSize int) ([]model.Bucket, int64, error) {
+func (s *BucketService) GetBuckets(ctx context.Context, userID uint, isRoot bool, page, pageSize int) ([]model.Bucket, int64, error) {
+	ctx, span := tracer.Start(ctx, "BucketService.GetBuckets")
+	defer span.End()
+
 	var buckets []model.Bucket
 	var total int64
-	query := s.db.Model(&model.Bucket{})
+	query := s.db.WithContext(ctx).Model(&model.Bucket{})
 
-	// If not root user, only show buckets they have access to
-	if !isRoot {
-		query = query.Joins("JOIN bucket_permissions ON buckets.id = bucket_permissions.bucket_id").
-			Where("bucket_permissions.user_id = ?", userID)
+	// Unless allowed to read every bucket, only show buckets the user has access to
+	readAll, err := s.authz.HasGlobalGrant(ctx, authz.Subject{UserID: userID, IsRoot: isRoot}, authz.ActionRead, authz.KindBucket)
+	if err != nil {
+		return nil, 0, err
+	}
+	if !readAll {
+		query = query.Where("buckets.id IN (?)", s.authz.AccessibleBuckets(ctx, userID))
 	}
 
 	// Get total count
@@ -100,7 +129,7 @@ func (s *BucketService) GetBuckets(userID uint, isRoot bool, page, pageSize int)
 
 	// Get buckets with pagination
 	offset := (page - 1) * pageSize
-	if err := query.Offset(offset).Limit(pageSize).Find(&buckets).Error; err != nil {
+	if err := query.Order("buckets.id").Offset(offset).Limit(pageSize).Find(&buckets).Error; err != nil {
 		return nil, 0, err
 	}
 
@@ -108,17 +137,22 @@ func (s *BucketService) GetBuckets(userID uint, isRoot bool, page, pageSize int)
 }
 
 // GetBucketByID returns a bucket by ID
-func (s *BucketService) GetBucketByID(id uint, userID uint, isRoot bool) (*model.Bucket, error) {
+func (s *BucketService) GetBucketByID(ctx context.Context, id uint, userID uint, isRoot bool) (*model.Bucket, error) {
+	ctx, span := tracer.Start(ctx, "BucketService.GetBucketByID")
+	defer span.End()
+
 	var bucket model.Bucket
 
-	query := s.db.Model(&model.Bucket{})
-	if !isRoot {
-		// Check if user has access to the bucket
-		query = query.Joins("JOIN bucket_permissions ON buckets.id = bucket_permissions.bucket_id").
-			Where("bucket_permissions.user_id = ?", userID)
+	// Check if user has access to the bucket
+	ok, err := s.authz.Can(ctx, authz.Subject{UserID: userID, IsRoot: isRoot}, authz.ActionRead, authz.Bucket(id))
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errors.New("bucket not found or access denied")
 	}
 
-	if err := query.First(&bucket, id).Error; err != nil {
+	if err := s.db.WithContext(ctx).First(&bucket, id).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, errors.New("bucket not found or access denied")
 		}
@@ -129,19 +163,19 @@ func (s *BucketService) GetBucketByID(id uint, userID uint, isRoot bool) (*model
 }
 
 // UpdateBucket updates bucket information
-func (s *BucketService) UpdateBucket(id uint, req *model.BucketUpdateRequest, userID uint, isRoot bool) error {
+func (s *BucketService) UpdateBucket(ctx context.Context, id uint, req *model.BucketUpdateRequest, userID uint, isRoot bool) error {
+	ctx, span := tracer.Start(ctx, "BucketService.UpdateBucket")
+	defer span.End()
+
 	// Get bucket
-	bucket, err := s.GetBucketByID(id, userID, isRoot)
+	bucket, err := s.GetBucketByID(ctx, id, userID, isRoot)
 	if err != nil {
 		return err
 	}
 
 	// Check permissions
-	if !isRoot {
-		perm, err := s.GetUserBucketPermission(id, userID)
-		if err != nil || perm.Access != "admin" {
-			return errors.New("permission denied: requires admin access")
-		}
+	if err := s.authz.Require(ctx, authz.Subject{UserID: userID, IsRoot: isRoot}, authz.ActionAdmin, authz.Bucket(id)); err != nil {
+		return err
 	}
 
 	// Validate new bucket name if provided
@@ -151,7 +185,7 @@ func (s *BucketService) UpdateBucket(id uint, req *model.BucketUpdateRequest, us
 		}
 		// Check if new name already exists
 		var count int64
-		if err := s.db.Model(&model.Bucket{}).Where("name = ? AND id != ?", req.Name, id).Count(&count).Error; err != nil {
+		if err := s.db.WithContext(ctx).Model(&model.Bucket{}).Where("name = ? AND id != ?", req.Name, id).Count(&count).Error; err != nil {
 			return err
 		}
 		if count > 0 {
@@ -168,49 +202,105 @@ func (s *BucketService) UpdateBucket(id uint, req *model.BucketUpdateRequest, us
 		updates["description"] = req.Description
 	}
 
-	return s.db.Model(bucket).Updates(updates).Error
+	return s.db.WithContext(ctx).Model(bucket).Updates(updates).Error
+}
+
+// UpdateUploadPolicy sets the size limit and the MIME type and extension lists of a bucket
+func (s *BucketService) UpdateUploadPolicy(ctx context.Context, id uint, req *model.BucketUploadPolicyRequest, userID uint, isRoot bool) error {
+	ctx, span := tracer.Start(ctx, "BucketService.UpdateUploadPolicy")
+	defer span.End()
+
+	// Check permissions
+	if err := s.authz.Require(ctx, authz.Subject{UserID: userID, IsRoot: isRoot}, authz.ActionAdmin, authz.Bucket(id)); err != nil {
+		return err
+	}
+
+	bucket, err := s.getBucket(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	updates := map[string]interface{}{"max_file_bytes": req.MaxFileBytes}
+	lists := map[string][]string{
+		"allowed_types":      req.AllowedTypes,
+		"denied_types":       req.DeniedTypes,
+		"allowed_extensions": req.AllowedExtensions,
+		"denied_extensions":  req.DeniedExtensions,
+	}
+	for column, items := range lists {
+		list, err := joinList(items)
+		if err != nil {
+			return fmt.Errorf("%s: %w", column, err)
+		}
+		updates[column] = list
+	}
+
+	if err := s.db.WithContext(ctx).Model(bucket).Updates(updates).Error; err != nil {
+		return err
+	}
+
+	return nil
 }
 
 // DeleteBucket deletes a bucket
-func (s *BucketService) DeleteBucket(id uint, userID uint, isRoot bool) error {
+func (s *BucketService) DeleteBucket(ctx context.Context, id uint, userID uint, isRoot bool) error {
+	ctx, span := tracer.Start(ctx, "BucketService.DeleteBucket")
+	defer span.End()
+
 	// Get bucket
-	bucket, err := s.GetBucketByID(id, userID, isRoot)
+	bucket, err := s.GetBucketByID(ctx, id, userID, isRoot)
 	if err != nil {
 		return err
 	}
 
 	// Check permissions
-	if !isRoot {
-		perm, err := s.GetUserBucketPermission(id, userID)
-		if err != nil || perm.Access != "admin" {
-			return errors.New("permission denied: requires admin access")
-		}
+	if err := s.authz.Require(ctx, authz.Subject{UserID: userID, IsRoot: isRoot}, authz.ActionDelete, authz.Bucket(id)); err != nil {
+		return err
+	}
+
+	// Buckets still holding locked files cannot be deleted
+	var locked int64
+	if err := lockedFiles(s.db, id, time.Now()).Count(&locked).Error; err != nil {
+		return err
+	}
+	if locked > 0 {
+		return fmt.Errorf("%w: bucket contains %d locked files", ErrObjectLocked, locked)
 	}
 
 	// Start transaction
-	return s.db.Transaction(func(tx *gorm.DB) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		// Delete bucket permissions
 		if err := tx.Where("bucket_id = ?", id).Delete(&model.BucketPermission{}).Error; err != nil {
 			return err
 		}
 
+		// Delete path rules
+		if err := tx.Where("bucket_id = ?", id).Delete(&model.BucketPathRule{}).Error; err != nil {
+			return err
+		}
+
+		// Delete lifecycle rules
+		if err := tx.Where("bucket_id = ?", id).Delete(&model.LifecycleRule{}).Error; err != nil {
+			return err
+		}
+
 		// Delete bucket
 		return tx.Delete(bucket).Error
 	})
 }
 
 // GetBucketPermissions returns a list of permissions for a bucket
-func (s *BucketService) GetBucketPermissions(bucketID uint, userID uint, isRoot bool) ([]model.BucketPermission, error) {
+func (s *BucketService) GetBucketPermissions(ctx context.Context, bucketID uint, userID uint, isRoot bool) ([]model.BucketPermission, error) {
+	ctx, span := tracer.Start(ctx, "BucketService.GetBucketPermissions")
+	defer span.End()
+
 	// Check if user has access to view permissions
-	if !isRoot {
-		perm, err := s.GetUserBucketPermission(bucketID, userID)
-		if err != nil || perm.Access != "admin" {
-			return nil, errors.New("permission denied: requires admin access")
-		}
+	if err := s.authz.Require(ctx, authz.Subject{UserID: userID, IsRoot: isRoot}, authz.ActionAdmin, authz.Bucket(bucketID)); err != nil {
+		return nil, err
 	}
 
 	var permissions []model.BucketPermission
-	if err := s.db.Where("bucket_id = ?", bucketID).Find(&permissions).Error; err != nil {
+	if err := s.db.WithContext(ctx).Where("bucket_id = ?", bucketID).Find(&permissions).Error; err != nil {
 		return nil, err
 	}
 
@@ -218,84 +308,530 @@ func (s *BucketService) GetBucketPermissions(bucketID uint, userID uint, isRoot
 }
 
 // GetUserBucketPermission gets a user's permission for a bucket
-func (s *BucketService) GetUserBucketPermission(bucketID, userID uint) (*model.BucketPermission, error) {
-	var perm model.BucketPermission
-	err := s.db.Where("bucket_id = ? AND user_id = ?", bucketID, userID).First(&perm).Error
-	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, errors.New("permission not found")
-		}
-		return nil, err
-	}
-	return &perm, nil
+func (s *BucketService) GetUserBucketPermission(ctx context.Context, bucketID, userID uint) (*model.BucketPermission, error) {
+	ctx, span := tracer.Start(ctx, "BucketService.GetUserBucketPermission")
+	defer span.End()
+
+	return s.authz.BucketPermission(ctx, bucketID, userID)
 }
 
-// UpdateBucketPermissions updates bucket permissions
-func (s *BucketService) UpdateBucketPermissions(bucketID uint, permissions []model.BucketPermissionRequest, userID uint, isRoot bool) error {
+// UpdateBucketPermissions replaces every grant of a bucket except the owner's.
+// version must match the bucket's current permission version; the new version is returned.
+func (s *BucketService) UpdateBucketPermissions(ctx context.Context, bucketID uint, permissions []model.BucketPermissionRequest, version uint, userID uint, isRoot bool) (uint, error) {
+	ctx, span := tracer.Start(ctx, "BucketService.UpdateBucketPermissions")
+	defer span.End()
+
 	// Check if user has admin access
-	if !isRoot {
-		perm, err := s.GetUserBucketPermission(bucketID, userID)
-		if err != nil || perm.Access != "admin" {
-			return errors.New("permission denied: requires admin access")
-		}
+	if err := s.authz.Require(ctx, authz.Subject{UserID: userID, IsRoot: isRoot}, authz.ActionAdmin, authz.Bucket(bucketID)); err != nil {
+		return 0, err
 	}
 
-	// Start transaction
-	return s.db.Transaction(func(tx *gorm.DB) error {
-		// Delete existing permissions except owner's
-		if err := tx.Where("bucket_id = ? AND user_id != ?", bucketID, userID).Delete(&model.BucketPermission{}).Error; err != nil {
+	bucket, err := s.getBucket(ctx, bucketID)
+	if err != nil {
+		return 0, err
+	}
+
+	var newVersion uint
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if newVersion, err = bumpPermissionVersion(tx, bucketID, version); err != nil {
+			return err
+		}
+
+		// Delete existing permissions except the owner's
+		if err := tx.Where("bucket_id = ? AND (user_id != ? OR group_id != 0)", bucketID, bucket.OwnerID).Delete(&model.BucketPermission{}).Error; err != nil {
 			return err
 		}
 
 		// Add new permissions
 		for _, p := range permissions {
-			// Skip if trying to modify owner's permission
-			if p.UserID == userID {
+			// The owner always keeps admin access
+			if p.GroupID == 0 && p.UserID == bucket.OwnerID {
 				continue
 			}
 
-			var expiresAt *time.Time
-			if p.ExpiresAt != nil {
-				t := time.Time(*p.ExpiresAt)
-				expiresAt = &t
-			}
-			perm := model.BucketPermission{
-				BucketID:  bucketID,
-				UserID:    p.UserID,
-				Access:    p.Access,
-				ExpiresAt: expiresAt,
+			perm, err := newBucketPermission(bucketID, &p)
+			if err != nil {
+				return err
 			}
-			if err := tx.Create(&perm).Error; err != nil {
+			if err := tx.Create(perm).Error; err != nil {
 				return err
 			}
 		}
 
 		return nil
 	})
+	if err != nil {
+		return 0, err
+	}
+
+	return newVersion, nil
+}
+
+// GrantBucketPermission creates or updates the grant of a single user or group.
+// If version is not 0 it must match the bucket's current permission version.
+func (s *BucketService) GrantBucketPermission(ctx context.Context, bucketID uint, req *model.BucketPermissionRequest, version uint, userID uint, isRoot bool) (uint, error) {
+	ctx, span := tracer.Start(ctx, "BucketService.GrantBucketPermission")
+	defer span.End()
+
+	// Check if user has admin access
+	if err := s.authz.Require(ctx, authz.Subject{UserID: userID, IsRoot: isRoot}, authz.ActionAdmin, authz.Bucket(bucketID)); err != nil {
+		return 0, err
+	}
+
+	bucket, err := s.getBucket(ctx, bucketID)
+	if err != nil {
+		return 0, err
+	}
+	if req.GroupID == 0 && req.UserID == bucket.OwnerID {
+		return 0, ErrOwnerPermission
+	}
+
+	perm, err := newBucketPermission(bucketID, req)
+	if err != nil {
+		return 0, err
+	}
+
+	// Check the grantee exists
+	var count int64
+	if req.GroupID != 0 {
+		err = s.db.WithContext(ctx).Model(&model.Group{}).Where("id = ?", req.GroupID).Count(&count).Error
+	} else {
+		err = s.db.WithContext(ctx).Model(&model.User{}).Where("id = ?", req.UserID).Count(&count).Error
+	}
+	if err != nil {
+		return 0, err
+	}
+	if count == 0 {
+		if req.GroupID != 0 {
+			return 0, errors.New("group not found")
+		}
+		return 0, errors.New("user not found")
+	}
+
+	var newVersion uint
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if newVersion, err = bumpPermissionVersion(tx, bucketID, version); err != nil {
+			return err
+		}
+
+		var existing model.BucketPermission
+		err := tx.Where("bucket_id = ? AND user_id = ? AND group_id = ?", bucketID, perm.UserID, perm.GroupID).First(&existing).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return tx.Create(perm).Error
+		}
+		if err != nil {
+			return err
+		}
+
+		return tx.Model(&existing).Select("access", "not_before", "expires_at").Updates(perm).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return newVersion, nil
+}
+
+// RevokeBucketPermission removes the grant of a single user (groupID 0) or group (granteeID 0).
+// If version is not 0 it must match the bucket's current permission version.
+func (s *BucketService) RevokeBucketPermission(ctx context.Context, bucketID, granteeID, groupID uint, version uint, userID uint, isRoot bool) (uint, error) {
+	ctx, span := tracer.Start(ctx, "BucketService.RevokeBucketPermission")
+	defer span.End()
+
+	// Check if user has admin access
+	if err := s.authz.Require(ctx, authz.Subject{UserID: userID, IsRoot: isRoot}, authz.ActionAdmin, authz.Bucket(bucketID)); err != nil {
+		return 0, err
+	}
+
+	bucket, err := s.getBucket(ctx, bucketID)
+	if err != nil {
+		return 0, err
+	}
+	if groupID == 0 && granteeID == bucket.OwnerID {
+		return 0, ErrOwnerPermission
+	}
+
+	var newVersion uint
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if newVersion, err = bumpPermissionVersion(tx, bucketID, version); err != nil {
+			return err
+		}
+
+		result := tx.Where("bucket_id = ? AND user_id = ? AND group_id = ?", bucketID, granteeID, groupID).Delete(&model.BucketPermission{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("permission not found")
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return newVersion, nil
+}
+
+// TransferOwnership makes newOwnerID the owner of a bucket. Only the current owner,
+// root or a user with a global bucket admin grant may transfer ownership. The new
+// owner gets a permanent admin grant; the previous owner keeps theirs as a regular
+// grant that can then be revoked.
+func (s *BucketService) TransferOwnership(ctx context.Context, bucketID, newOwnerID uint, version uint, userID uint, isRoot bool) (uint, error) {
+	ctx, span := tracer.Start(ctx, "BucketService.TransferOwnership")
+	defer span.End()
+
+	bucket, err := s.getBucket(ctx, bucketID)
+	if err != nil {
+		return 0, err
+	}
+
+	// Check permissions
+	if bucket.OwnerID != userID {
+		ok, err := s.authz.HasGlobalGrant(ctx, authz.Subject{UserID: userID, IsRoot: isRoot}, authz.ActionAdmin, authz.KindBucket)
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			return 0, fmt.Errorf("%w: only the owner can transfer a bucket", authz.ErrPermissionDenied)
+		}
+	}
+
+	if newOwnerID == bucket.OwnerID {
+		return 0, errors.New("user already owns this bucket")
+	}
+
+	var newOwner model.User
+	if err := s.db.WithContext(ctx).First(&newOwner, newOwnerID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, errors.New("user not found")
+		}
+		return 0, err
+	}
+	if newOwner.Status != "active" {
+		return 0, errors.New("new owner is not active")
+	}
+
+	var newVersion uint
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if newVersion, err = bumpPermissionVersion(tx, bucketID, version); err != nil {
+			return err
+		}
+
+		if err := tx.Model(&model.Bucket{}).Where("id = ?", bucketID).Update("owner_id", newOwnerID).Error; err != nil {
+			return err
+		}
+
+		// Replace any existing grant of the new owner with a permanent admin grant
+		if err := tx.Where("bucket_id = ? AND user_id = ? AND group_id = 0", bucketID, newOwnerID).Delete(&model.BucketPermission{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&model.BucketPermission{
+			BucketID: bucketID,
+			UserID:   newOwnerID,
+			Access:   authz.AccessAdmin,
+		}).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return newVersion, nil
+}
+
+// GetPathRules returns the path rules of a bucket
+func (s *BucketService) GetPathRules(ctx context.Context, bucketID uint, userID uint, isRoot bool) ([]model.BucketPathRule, error) {
+	ctx, span := tracer.Start(ctx, "BucketService.GetPathRules")
+	defer span.End()
+
+	// Check if user has admin access
+	if err := s.authz.Require(ctx, authz.Subject{UserID: userID, IsRoot: isRoot}, authz.ActionAdmin, authz.Bucket(bucketID)); err != nil {
+		return nil, err
+	}
+
+	var rules []model.BucketPathRule
+	if err := s.db.WithContext(ctx).Where("bucket_id = ?", bucketID).Order("prefix").Find(&rules).Error; err != nil {
+		return nil, err
+	}
+
+	return rules, nil
+}
+
+// CreatePathRule adds a rule allowing or denying access under a path prefix of a bucket
+func (s *BucketService) CreatePathRule(ctx context.Context, bucketID uint, req *model.BucketPathRuleRequest, userID uint, isRoot bool) (*model.BucketPathRule, error) {
+	ctx, span := tracer.Start(ctx, "BucketService.CreatePathRule")
+	defer span.End()
+
+	// Check if user has admin access
+	if err := s.authz.Require(ctx, authz.Subject{UserID: userID, IsRoot: isRoot}, authz.ActionAdmin, authz.Bucket(bucketID)); err != nil {
+		return nil, err
+	}
+
+	if _, err := s.getBucket(ctx, bucketID); err != nil {
+		return nil, err
+	}
+	if err := validatePathPrefix(req.Prefix); err != nil {
+		return nil, err
+	}
+
+	rule := &model.BucketPathRule{
+		BucketID:  bucketID,
+		UserID:    req.UserID,
+		GroupID:   req.GroupID,
+		Prefix:    req.Prefix,
+		Effect:    req.Effect,
+		Access:    req.Access,
+		CreatedBy: userID,
+	}
+	if err := s.db.WithContext(ctx).Create(rule).Error; err != nil {
+		return nil, err
+	}
+
+	return rule, nil
+}
+
+// DeletePathRule removes a path rule of a bucket
+func (s *BucketService) DeletePathRule(ctx context.Context, bucketID, ruleID uint, userID uint, isRoot bool) error {
+	ctx, span := tracer.Start(ctx, "BucketService.DeletePathRule")
+	defer span.End()
+
+	// Check if user has admin access
+	if err := s.authz.Require(ctx, authz.Subject{UserID: userID, IsRoot: isRoot}, authz.ActionAdmin, authz.Bucket(bucketID)); err != nil {
+		return err
+	}
+
+	result := s.db.WithContext(ctx).Where("id = ? AND bucket_id = ?", ruleID, bucketID).Delete(&model.BucketPathRule{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("path rule not found")
+	}
+
+	return nil
+}
+
+// getBucket returns a bucket by ID without checking access
+func (s *BucketService) getBucket(ctx context.Context, id uint) (*model.Bucket, error) {
+	var bucket model.Bucket
+	if err := s.db.WithContext(ctx).First(&bucket, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("bucket not found")
+		}
+		return nil, err
+	}
+	return &bucket, nil
+}
+
+// newBucketPermission validates a permission request and converts it into a grant
+func newBucketPermission(bucketID uint, p *model.BucketPermissionRequest) (*model.BucketPermission, error) {
+	var notBefore, expiresAt *time.Time
+	if p.NotBefore != nil {
+		t := time.Time(*p.NotBefore)
+		notBefore = &t
+	}
+	if p.ExpiresAt != nil {
+		t := time.Time(*p.ExpiresAt)
+		expiresAt = &t
+	}
+	if notBefore != nil && expiresAt != nil && !notBefore.Before(*expiresAt) {
+		return nil, errors.New("not_before must be before expires_at")
+	}
+
+	userID := p.UserID
+	if p.GroupID != 0 {
+		userID = 0
+	}
+	return &model.BucketPermission{
+		BucketID:  bucketID,
+		UserID:    userID,
+		GroupID:   p.GroupID,
+		Access:    p.Access,
+		NotBefore: notBefore,
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+// bumpPermissionVersion increments the permission version of a bucket and returns
+// the new version. If expected is not 0 and does not match the current version,
+// ErrPermissionVersionConflict is returned.
+func bumpPermissionVersion(tx *gorm.DB, bucketID, expected uint) (uint, error) {
+	query := tx.Model(&model.Bucket{}).Where("id = ?", bucketID)
+	if expected != 0 {
+		query = query.Where("permission_version = ?", expected)
+	}
+
+	result := query.Update("permission_version", gorm.Expr("permission_version + 1"))
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return 0, ErrPermissionVersionConflict
+	}
+
+	var bucket model.Bucket
+	if err := tx.Select("permission_version").First(&bucket, bucketID).Error; err != nil {
+		return 0, err
+	}
+	return bucket.PermissionVersion, nil
 }
 
 // GetBucketStats returns statistics for a bucket
-func (s *BucketService) GetBucketStats(bucketID uint, userID uint, isRoot bool) (*model.BucketStats, error) {
+func (s *BucketService) GetBucketStats(ctx context.Context, bucketID uint, userID uint, isRoot bool) (*model.BucketStats, error) {
+	ctx, span := tracer.Start(ctx, "BucketService.GetBucketStats")
+	defer span.End()
+
 	// Check if user has access to the bucket
-	if !isRoot {
-		if _, err := s.GetUserBucketPermission(bucketID, userID); err != nil {
-			return nil, errors.New("permission denied")
-		}
+	if err := s.authz.Require(ctx, authz.Subject{UserID: userID, IsRoot: isRoot}, authz.ActionRead, authz.Bucket(bucketID)); err != nil {
+		return nil, err
 	}
 
 	var stats model.BucketStats
 	var totalSize int64
 
 	// Get file count
-	if err := s.db.Model(&model.File{}).Where("bucket_id = ?", bucketID).Count(&stats.FileCount).Error; err != nil {
+	if err := s.db.WithContext(ctx).Model(&model.File{}).Where("bucket_id = ?", bucketID).Count(&stats.FileCount).Error; err != nil {
 		return nil, err
 	}
 
 	// Get total size
-	if err := s.db.Model(&model.File{}).Where("bucket_id = ?", bucketID).Select("COALESCE(SUM(size), 0)").Scan(&totalSize).Error; err != nil {
+	if err := s.db.WithContext(ctx).Model(&model.File{}).Where("bucket_id = ?", bucketID).Select("COALESCE(SUM(size), 0)").Scan(&totalSize).Error; err != nil {
 		return nil, err
 	}
 	stats.TotalSize = totalSize
 
 	return &stats, nil
 }
+
+// GetExpiringPermissions returns active bucket permissions that expire within
+// the given duration, of every bucket with a global bucket admin grant and of
+// the buckets the user administers otherwise
+func (s *BucketService) GetExpiringPermissions(ctx context.Context, within time.Duration, userID uint, isRoot bool) ([]model.BucketPermission, error) {
+	ctx, span := tracer.Start(ctx, "BucketService.GetExpiringPermissions")
+	defer span.End()
+
+	now := time.Now()
+	query := s.db.WithContext(ctx).Where("expires_at > ? AND expires_at <= ?", now, now.Add(within))
+
+	// Check permissions
+	global, err := s.authz.HasGlobalGrant(ctx, authz.Subject{UserID: userID, IsRoot: isRoot}, authz.ActionAdmin, authz.KindBucket)
+	if err != nil {
+		return nil, err
+	}
+	if !global {
+		query = query.Where("bucket_id IN (?)", s.authz.AdministeredBuckets(ctx, userID))
+	}
+
+	var permissions []model.BucketPermission
+	if err := query.Order("expires_at").Find(&permissions).Error; err != nil {
+		return nil, err
+	}
+
+	return permissions, nil
+}
+
+// SweepExpiredPermissions removes bucket permissions whose expiry has passed.
+// The expired grants of a bucket are deleted at once and its permission
+// version is bumped, so that clients holding the old version see the change.
+func (s *BucketService) SweepExpiredPermissions(ctx context.Context) error {
+	ctx, span := tracer.Start(ctx, "BucketService.SweepExpiredPermissions")
+	defer span.End()
+
+	now := time.Now()
+	var bucketIDs []uint
+	if err := s.db.WithContext(ctx).Model(&model.BucketPermission{}).
+		Where("expires_at <= ?", now).
+		Distinct().Pluck("bucket_id", &bucketIDs).Error; err != nil {
+		return err
+	}
+
+	for _, bucketID := range bucketIDs {
+		var expired []model.BucketPermission
+		err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := tx.Where("bucket_id = ? AND expires_at <= ?", bucketID, now).Find(&expired).Error; err != nil || len(expired) == 0 {
+				return err
+			}
+			if err := tx.Where("bucket_id = ? AND expires_at <= ?", bucketID, now).Delete(&model.BucketPermission{}).Error; err != nil {
+				return err
+			}
+			_, err := bumpPermissionVersion(tx, bucketID, 0)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		if len(expired) > 0 {
+			s.auditService.Record(&model.AuditEvent{
+				Action:     model.AuditBucketExpire,
+				TargetType: authz.KindBucket,
+				TargetID:   bucketID,
+			}, expired, nil, nil)
+		}
+	}
+
+	return nil
+}
+
+// RunPermissionSweeper calls SweepExpiredPermissions every interval until ctx is done
+func (s *BucketService) RunPermissionSweeper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.SweepExpiredPermissions(ctx); err != nil {
+				log.Printf("Bucket permission sweep failed: %v", err)
+			}
+		}
+	}
+}
+
+// SampleStorageMetrics updates the per-bucket storage gauges with the number
+// and total size of the files in every bucket
+func (s *BucketService) SampleStorageMetrics(ctx context.Context) error {
+	ctx, span := tracer.Start(ctx, "BucketService.SampleStorageMetrics")
+	defer span.End()
+
+	var usage []struct {
+		Name      string
+		FileCount int64
+		TotalSize int64
+	}
+	err := s.db.WithContext(ctx).Model(&model.Bucket{}).
+		Select("buckets.name, COUNT(files.id) AS file_count, COALESCE(SUM(files.size), 0) AS total_size").
+		Joins("LEFT JOIN files ON files.bucket_id = buckets.id AND files.deleted_at IS NULL").
+		Group("buckets.id, buckets.name").
+		Scan(&usage).Error
+	if err != nil {
+		return err
+	}
+
+	// Start over so that deleted buckets disappear from the metrics
+	metrics.BucketBytes.Reset()
+	metrics.BucketFiles.Reset()
+	for _, u := range usage {
+		metrics.BucketBytes.WithLabelValues(u.Name).Set(float64(u.TotalSize))
+		metrics.BucketFiles.WithLabelValues(u.Name).Set(float64(u.FileCount))
+	}
+	return nil
+}
+
+// RunStorageSampler calls SampleStorageMetrics now and then every interval until ctx is done
+func (s *BucketService) RunStorageSampler(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.SampleStorageMetrics(ctx); err != nil {
+			log.Printf("Storage metrics sampling failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/minorcell/pfss/internal/authz"
+	"github.com/minorcell/pfss/internal/model"
+	"gorm.io/gorm"
+)
+
+func newTestBucketService(t *testing.T) (*BucketService, *gorm.DB) {
+	t.Helper()
+	db := openTestDB(t)
+	authorizer, err := authz.New(db, authz.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewBucketService(db, authorizer, NewAuditService(db)), db
+}
+
+// createTestBucket creates a bucket owned by ownerID
+func createTestBucket(t *testing.T, db *gorm.DB, name string, ownerID uint) *model.Bucket {
+	t.Helper()
+	bucket := &model.Bucket{Name: name, OwnerID: ownerID}
+	if err := db.Create(bucket).Error; err != nil {
+		t.Fatal(err)
+	}
+	return bucket
+}
+
+// createTestGrant grants access to a bucket to a user or, if groupID is set, a group
+func createTestGrant(t *testing.T, db *gorm.DB, bucketID, userID, groupID uint, access string, expiresAt *time.Time) *model.BucketPermission {
+	t.Helper()
+	perm := &model.BucketPermission{BucketID: bucketID, UserID: userID, GroupID: groupID, Access: access, ExpiresAt: expiresAt}
+	if err := db.Create(perm).Error; err != nil {
+		t.Fatal(err)
+	}
+	return perm
+}
+
+func TestSweepExpiredPermissions(t *testing.T) {
+	buckets, db := newTestBucketService(t)
+	owner := createTestUser(t, db, "owner", "owner-secret", false)
+	alice := createTestUser(t, db, "alice", "alice-secret", false)
+	docs := createTestBucket(t, db, "pfss-docs", owner.ID)
+	logs := createTestBucket(t, db, "pfss-logs", owner.ID)
+
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+	createTestGrant(t, db, docs.ID, alice.ID, 0, authz.AccessRead, &past)
+	createTestGrant(t, db, docs.ID, 0, 7, authz.AccessWrite, &past)
+	kept := createTestGrant(t, db, docs.ID, owner.ID, 0, authz.AccessAdmin, &future)
+	createTestGrant(t, db, logs.ID, owner.ID, 0, authz.AccessAdmin, nil)
+
+	if err := buckets.SweepExpiredPermissions(context.Background()); err != nil {
+		t.Fatalf("SweepExpiredPermissions: %v", err)
+	}
+
+	var remaining []model.BucketPermission
+	if err := db.Where("bucket_id = ?", docs.ID).Find(&remaining).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(remaining) != 1 || remaining[0].ID != kept.ID {
+		t.Errorf("remaining grants of docs: %+v, want only %d", remaining, kept.ID)
+	}
+
+	// Only the bucket that lost grants gets a new permission version
+	for bucket, want := range map[*model.Bucket]uint{docs: 2, logs: 1} {
+		var got model.Bucket
+		if err := db.First(&got, bucket.ID).Error; err != nil {
+			t.Fatal(err)
+		}
+		if got.PermissionVersion != want {
+			t.Errorf("%s has permission version %d, want %d", bucket.Name, got.PermissionVersion, want)
+		}
+	}
+
+	var events []model.AuditEvent
+	if err := db.Where("action = ?", model.AuditBucketExpire).Find(&events).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].TargetID != docs.ID {
+		t.Fatalf("got audit events %+v, want one for bucket %d", events, docs.ID)
+	}
+	for _, want := range []string{fmt.Sprintf(`"user_id":%d`, alice.ID), `"group_id":7`} {
+		if !strings.Contains(events[0].Before, want) {
+			t.Errorf("audit event %s does not contain %s", events[0].Before, want)
+		}
+	}
+}
+
+func TestGetExpiringPermissionsIsScopedToAdministeredBuckets(t *testing.T) {
+	buckets, db := newTestBucketService(t)
+	owner := createTestUser(t, db, "owner", "owner-secret", false)
+	alice := createTestUser(t, db, "alice", "alice-secret", false)
+	docs := createTestBucket(t, db, "pfss-docs", owner.ID)
+	logs := createTestBucket(t, db, "pfss-logs", owner.ID)
+
+	// alice administers docs through a group and may only read logs
+	group := &model.Group{Name: "docs-admins", CreatedBy: owner.ID}
+	if err := db.Create(group).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&model.GroupMember{GroupID: group.ID, UserID: alice.ID}).Error; err != nil {
+		t.Fatal(err)
+	}
+	createTestGrant(t, db, docs.ID, 0, group.ID, authz.AccessAdmin, nil)
+	createTestGrant(t, db, logs.ID, alice.ID, 0, authz.AccessRead, nil)
+
+	soon := time.Now().Add(time.Hour)
+	docsGrant := createTestGrant(t, db, docs.ID, owner.ID, 0, authz.AccessRead, &soon)
+	createTestGrant(t, db, logs.ID, owner.ID, 0, authz.AccessRead, &soon)
+
+	expiring, err := buckets.GetExpiringPermissions(context.Background(), 24*time.Hour, alice.ID, false)
+	if err != nil {
+		t.Fatalf("GetExpiringPermissions: %v", err)
+	}
+	if len(expiring) != 1 || expiring[0].ID != docsGrant.ID {
+		t.Errorf("alice sees %+v, want only grant %d", expiring, docsGrant.ID)
+	}
+
+	expiring, err = buckets.GetExpiringPermissions(context.Background(), 24*time.Hour, owner.ID, true)
+	if err != nil {
+		t.Fatalf("GetExpiringPermissions as root: %v", err)
+	}
+	if len(expiring) != 2 {
+		t.Errorf("root sees %d expiring grants, want 2", len(expiring))
+	}
+}
+
+func TestGetBuckets(t *testing.T) {
+	buckets, db := newTestBucketService(t)
+	root := createTestUser(t, db, "root", "root-secret", true)
+	alice := createTestUser(t, db, "alice", "alice-secret", false)
+
+	group := &model.Group{Name: "staff", CreatedBy: root.ID}
+	if err := db.Create(group).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&model.GroupMember{GroupID: group.ID, UserID: alice.ID}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	past := time.Now().Add(-time.Hour)
+	direct := createTestBucket(t, db, "pfss-direct", root.ID)
+	viaGroup := createTestBucket(t, db, "pfss-group", root.ID)
+	expired := createTestBucket(t, db, "pfss-expired", root.ID)
+	createTestBucket(t, db, "pfss-other", root.ID)
+	createTestGrant(t, db, direct.ID, alice.ID, 0, authz.AccessRead, nil)
+	createTestGrant(t, db, viaGroup.ID, 0, group.ID, authz.AccessWrite, nil)
+	createTestGrant(t, db, expired.ID, alice.ID, 0, authz.AccessRead, &past)
+
+	ctx := context.Background()
+	all, total, err := buckets.GetBuckets(ctx, root.ID, true, 1, 10)
+	if err != nil {
+		t.Fatalf("GetBuckets as root: %v", err)
+	}
+	if total != 4 || len(all) != 4 {
+		t.Errorf("root sees %d of %d buckets, want 4", len(all), total)
+	}
+
+	page, total, err := buckets.GetBuckets(ctx, alice.ID, false, 1, 1)
+	if err != nil {
+		t.Fatalf("GetBuckets: %v", err)
+	}
+	if total != 2 || len(page) != 1 || page[0].ID != direct.ID {
+		t.Errorf("alice's first page: %d buckets of %d, want bucket %d of 2", len(page), total, direct.ID)
+	}
+	page, _, err = buckets.GetBuckets(ctx, alice.ID, false, 2, 1)
+	if err != nil {
+		t.Fatalf("GetBuckets: %v", err)
+	}
+	if len(page) != 1 || page[0].ID != viaGroup.ID {
+		t.Errorf("alice's second page: %+v, want bucket %d", page, viaGroup.ID)
+	}
+}
+
+func TestGetBucketStats(t *testing.T) {
+	files, db := newTestFileService(t, DefaultQuotaConfig())
+	root := createTestUser(t, db, "root", "root-secret", true)
+	docs := createTestBucket(t, db, "pfss-docs", root.ID)
+	empty := createTestBucket(t, db, "pfss-empty", root.ID)
+	createTestFile(t, files, docs, "/a.txt", []byte("hello"))
+	createTestFile(t, files, docs, "/b.txt", []byte("world!"))
+
+	ctx := context.Background()
+	for bucket, want := range map[*model.Bucket]model.BucketStats{
+		docs:  {FileCount: 2, TotalSize: 11},
+		empty: {FileCount: 0, TotalSize: 0},
+	} {
+		stats, err := files.bucketService.GetBucketStats(ctx, bucket.ID, root.ID, true)
+		if err != nil {
+			t.Fatalf("GetBucketStats of %s: %v", bucket.Name, err)
+		}
+		if *stats != want {
+			t.Errorf("stats of %s: %+v, want %+v", bucket.Name, *stats, want)
+		}
+	}
+}
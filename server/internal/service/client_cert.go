@@ -0,0 +1,56 @@
+package service
+
+import (
+	"crypto/x509"
+	"errors"
+
+	"github.com/minorcell/pfss/internal/model"
+	"github.com/minorcell/pfss/pkg/util"
+	"gorm.io/gorm"
+)
+
+// Client certificate username fields
+const (
+	// ClientCertFieldCN takes the username from the subject common name
+	ClientCertFieldCN = "cn"
+	// ClientCertFieldEmail takes the username from the first email address
+	// subject alternative name
+	ClientCertFieldEmail = "email"
+)
+
+// ErrCertificateRejected is returned when a client certificate does not map to an active user
+var ErrCertificateRejected = errors.New("client certificate does not belong to an active user")
+
+// AuthenticateCertificate maps a client certificate, already verified against
+// the client CAs during the TLS handshake, to the active user it names
+func (s *AuthService) AuthenticateCertificate(cert *x509.Certificate) (*util.Claims, error) {
+	username := cert.Subject.CommonName
+	if s.config.ClientCertField == ClientCertFieldEmail {
+		username = ""
+		if len(cert.EmailAddresses) > 0 {
+			username = cert.EmailAddresses[0]
+		}
+	}
+	if username == "" {
+		return nil, ErrCertificateRejected
+	}
+
+	var user model.User
+	if err := s.db.Where("username = ?", username).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCertificateRejected
+		}
+		return nil, err
+	}
+	if user.Status != "active" {
+		return nil, ErrCertificateRejected
+	}
+
+	return &util.Claims{
+		UserID:   user.ID,
+		Username: user.Username,
+		IsRoot:   user.IsRoot,
+		// Like a password login, a forced password change limits the session
+		PasswordChange: user.MustChangePassword,
+	}, nil
+}
@@ -1,37 +1,86 @@
 package service
 
 import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
+	"log"
 	"mime/multipart"
+	"net/http"
 	"os"
 	"path"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/minorcell/pfss/internal/authz"
 	"github.com/minorcell/pfss/internal/model"
+	"github.com/minorcell/pfss/pkg/metrics"
 	"gorm.io/gorm"
 )
 
+// FileConfig configures file uploads
+type FileConfig struct {
+	// MaxUploadBytes is the global size limit of a single file; 0 means unlimited
+	MaxUploadBytes int64
+}
+
+// DefaultFileConfig returns the default upload settings: files of up to 100MB
+func DefaultFileConfig() FileConfig {
+	return FileConfig{MaxUploadBytes: 100 << 20}
+}
+
 // FileService handles file-related operations
 type FileService struct {
 	db            *gorm.DB
 	bucketService *BucketService
+	quotaService  *QuotaService
+	authz         *authz.Authorizer
+	auditService  *AuditService
+	config        FileConfig
 	storagePath   string
 }
 
 // NewFileService creates a new file service
-func NewFileService(db *gorm.DB, bucketService *BucketService) *FileService {
+func NewFileService(db *gorm.DB, bucketService *BucketService, quotaService *QuotaService, authorizer *authz.Authorizer, auditService *AuditService, config FileConfig) *FileService {
 	return &FileService{
 		db:            db,
 		bucketService: bucketService,
+		quotaService:  quotaService,
+		authz:         authorizer,
+		auditService:  auditService,
+		config:        config,
 		storagePath:   "upload",
 	}
 }
 
-// validateFilePath validates file path format
+// MaxUploadBytes returns the global size limit of a single file, 0 if unlimited
+func (s *FileService) MaxUploadBytes() int64 {
+	return s.config.MaxUploadBytes
+}
+
+// BucketMaxUploadBytes returns the size limit of a single file in a bucket, 0
+// if unlimited. Buckets that cannot be found get the global limit.
+func (s *FileService) BucketMaxUploadBytes(ctx context.Context, bucketID uint) int64 {
+	bucket, err := s.bucketService.getBucket(ctx, bucketID)
+	if err != nil {
+		return s.config.MaxUploadBytes
+	}
+	return s.maxFileBytes(bucket)
+}
+
+// StoragePath returns the directory file content is stored in
+func (s *FileService) StoragePath() string {
+	return s.storagePath
+}
+
+// validateFilePath validates file path format. Paths must be canonical, as
+// path rules compare them by prefix and the content is stored at the cleaned
+// path: "//a" or "/./a" would otherwise evade a rule for "/a".
 func validateFilePath(filePath string) error {
 	if !strings.HasPrefix(filePath, "/") {
 		return errors.New("file path must start with '/'")
@@ -39,24 +88,46 @@ func validateFilePath(filePath string) error {
 	if strings.Contains(filePath, "..") {
 		return errors.New("file path cannot contain '..'")
 	}
+	if path.Clean(filePath) != filePath {
+		return errors.New("file path must not contain '//', '/./' or a trailing '/'")
+	}
 	return nil
 }
 
-// CreateFile creates a new file record
-func (s *FileService) CreateFile(req *model.FileCreateRequest, userID uint, isRoot bool) (*model.File, error) {
-	// Check bucket access
-	if _, err := s.bucketService.GetUserBucketPermission(req.BucketID, userID); err != nil {
-		return nil, errors.New("permission denied: no access to bucket")
+// validatePathPrefix validates a directory or path prefix, which unlike a
+// file path may end with '/'
+func validatePathPrefix(prefix string) error {
+	if prefix == "/" {
+		return nil
 	}
+	if strings.HasSuffix(prefix, "/") {
+		// "//" would leave "/" to validate
+		if err := validateFilePath(strings.TrimSuffix(prefix, "/")); err != nil || prefix == "//" {
+			return errors.New("path prefix must not contain '..', '//' or '/./'")
+		}
+		return nil
+	}
+	return validateFilePath(prefix)
+}
+
+// CreateFile creates a new file record
+func (s *FileService) CreateFile(ctx context.Context, req *model.FileCreateRequest, userID uint, isRoot bool) (*model.File, error) {
+	ctx, span := tracer.Start(ctx, "FileService.CreateFile")
+	defer span.End()
 
 	// Validate file path
 	if err := validateFilePath(req.Path); err != nil {
 		return nil, err
 	}
 
+	// Check bucket access
+	if err := s.authz.Require(ctx, authz.Subject{UserID: userID, IsRoot: isRoot}, authz.ActionCreate, authz.FileAt(req.BucketID, 0, req.Path)); err != nil {
+		return nil, err
+	}
+
 	// Check if file already exists in the bucket
 	var count int64
-	if err := s.db.Model(&model.File{}).
+	if err := s.db.WithContext(ctx).Model(&model.File{}).
 		Where("bucket_id = ? AND path = ?", req.BucketID, req.Path).
 		Count(&count).Error; err != nil {
 		return nil, err
@@ -65,19 +136,51 @@ func (s *FileService) CreateFile(req *model.FileCreateRequest, userID uint, isRo
 		return nil, errors.New("file already exists in this path")
 	}
 
-	// Create file record
+	// Check the bucket upload policy; without content the declared type is all we have
+	bucket, err := s.bucketService.getBucket(ctx, req.BucketID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkFileSize(bucket, req.Size); err != nil {
+		return nil, err
+	}
+	if err := checkExtension(bucket, req.Name); err != nil {
+		return nil, err
+	}
+	if err := checkContentType(bucket, req.ContentType); err != nil {
+		return nil, err
+	}
+
+	// Check user and bucket quotas
+	if _, err := s.quotaService.CheckUpload(ctx, req.BucketID, userID, req.Size); err != nil {
+		return nil, err
+	}
+
+	// Create file record; it stays pending until its content is uploaded
 	file := &model.File{
-		BucketID:    req.BucketID,
-		Name:        req.Name,
-		Path:        req.Path,
-		ContentType: req.ContentType,
-		Size:        req.Size,
-		Metadata:    req.Metadata,
-		CreatedBy:   userID,
-		UpdatedBy:   userID,
+		BucketID:      req.BucketID,
+		Name:          req.Name,
+		Path:          req.Path,
+		ContentType:   req.ContentType,
+		Size:          req.Size,
+		Metadata:      req.Metadata,
+		CreatedBy:     userID,
+		UpdatedBy:     userID,
+		UploadPending: true,
 	}
+	applyDefaultRetention(bucket, file)
 
-	if err := s.db.Create(file).Error; err != nil {
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Check the quotas again, counting concurrent uploads
+		if _, err := s.quotaService.ReserveUpload(tx, req.BucketID, userID, req.Size); err != nil {
+			return err
+		}
+		if err := tx.Create(file).Error; err != nil {
+			return err
+		}
+		return saveFileMetadata(tx, file.ID, req.Metadata)
+	})
+	if err != nil {
 		return nil, err
 	}
 
@@ -85,15 +188,25 @@ func (s *FileService) CreateFile(req *model.FileCreateRequest, userID uint, isRo
 }
 
 // GetFiles returns a list of files with pagination
-func (s *FileService) GetFiles(bucketID uint, userID uint, isRoot bool, page, pageSize int) ([]model.File, int64, error) {
+func (s *FileService) GetFiles(ctx context.Context, bucketID uint, userID uint, isRoot bool, page, pageSize int) ([]model.File, int64, error) {
+	ctx, span := tracer.Start(ctx, "FileService.GetFiles")
+	defer span.End()
+
 	// Check bucket access
-	if _, err := s.bucketService.GetUserBucketPermission(bucketID, userID); err != nil {
-		return nil, 0, errors.New("permission denied: no access to bucket")
+	sub := authz.Subject{UserID: userID, IsRoot: isRoot}
+	if err := s.authz.Require(ctx, sub, authz.ActionRead, authz.File(bucketID, 0)); err != nil {
+		return nil, 0, err
+	}
+
+	// Hide files under paths the user may not read
+	readable, err := s.authz.ReadableFiles(ctx, sub, bucketID)
+	if err != nil {
+		return nil, 0, err
 	}
 
 	var files []model.File
 	var total int64
-	query := s.db.Model(&model.File{}).Where("bucket_id = ?", bucketID)
+	query := s.db.WithContext(ctx).Model(&model.File{}).Where("bucket_id = ?", bucketID).Scopes(readable)
 
 	// Get total count
 	if err := query.Count(&total).Error; err != nil {
@@ -102,7 +215,7 @@ func (s *FileService) GetFiles(bucketID uint, userID uint, isRoot bool, page, pa
 
 	// Get files with pagination
 	offset := (page - 1) * pageSize
-	if err := query.Offset(offset).Limit(pageSize).Find(&files).Error; err != nil {
+	if err := query.Order("files.id").Offset(offset).Limit(pageSize).Find(&files).Error; err != nil {
 		return nil, 0, err
 	}
 
@@ -110,9 +223,12 @@ func (s *FileService) GetFiles(bucketID uint, userID uint, isRoot bool, page, pa
 }
 
 // GetFileByID returns a file by ID
-func (s *FileService) GetFileByID(id uint, userID uint, isRoot bool) (*model.File, error) {
+func (s *FileService) GetFileByID(ctx context.Context, id uint, userID uint, isRoot bool) (*model.File, error) {
+	ctx, span := tracer.Start(ctx, "FileService.GetFileByID")
+	defer span.End()
+
 	var file model.File
-	if err := s.db.First(&file, id).Error; err != nil {
+	if err := s.db.WithContext(ctx).First(&file, id).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, errors.New("file not found")
 		}
@@ -120,25 +236,34 @@ func (s *FileService) GetFileByID(id uint, userID uint, isRoot bool) (*model.Fil
 	}
 
 	// Check bucket access
-	if _, err := s.bucketService.GetUserBucketPermission(file.BucketID, userID); err != nil {
-		return nil, errors.New("permission denied: no access to bucket")
+	if err := s.authz.Require(ctx, authz.Subject{UserID: userID, IsRoot: isRoot}, authz.ActionRead, authz.FileAt(file.BucketID, file.ID, file.Path)); err != nil {
+		return nil, err
 	}
 
 	return &file, nil
 }
 
-// UpdateFile updates file information
-func (s *FileService) UpdateFile(id uint, req *model.FileUpdateRequest, userID uint, isRoot bool) error {
+// UpdateFile updates file information. Locked files cannot be changed or moved;
+// bypass lifts governance retention for users allowed to bypass it.
+func (s *FileService) UpdateFile(ctx context.Context, id uint, req *model.FileUpdateRequest, userID uint, isRoot bool, bypass bool) error {
+	ctx, span := tracer.Start(ctx, "FileService.UpdateFile")
+	defer span.End()
+
 	// Get file
-	file, err := s.GetFileByID(id, userID, isRoot)
+	file, err := s.GetFileByID(ctx, id, userID, isRoot)
 	if err != nil {
 		return err
 	}
 
 	// Check bucket write access
-	perm, err := s.bucketService.GetUserBucketPermission(file.BucketID, userID)
-	if err != nil || perm.Access == "read" {
-		return errors.New("permission denied: requires write access")
+	sub := authz.Subject{UserID: userID, IsRoot: isRoot}
+	if err := s.authz.Require(ctx, sub, authz.ActionWrite, authz.FileAt(file.BucketID, file.ID, file.Path)); err != nil {
+		return err
+	}
+
+	// Check object lock
+	if err := s.checkUnlocked(ctx, file, sub, bypass); err != nil {
+		return err
 	}
 
 	// Validate new file path if provided
@@ -146,9 +271,13 @@ func (s *FileService) UpdateFile(id uint, req *model.FileUpdateRequest, userID u
 		if err := validateFilePath(req.Path); err != nil {
 			return err
 		}
+		// Moving a file also needs write access at the destination
+		if err := s.authz.Require(ctx, authz.Subject{UserID: userID, IsRoot: isRoot}, authz.ActionCreate, authz.FileAt(file.BucketID, 0, req.Path)); err != nil {
+			return err
+		}
 		// Check if new path already exists
 		var count int64
-		if err := s.db.Model(&model.File{}).
+		if err := s.db.WithContext(ctx).Model(&model.File{}).
 			Where("bucket_id = ? AND path = ? AND id != ?", file.BucketID, req.Path, id).
 			Count(&count).Error; err != nil {
 			return err
@@ -169,44 +298,144 @@ func (s *FileService) UpdateFile(id uint, req *model.FileUpdateRequest, userID u
 	if req.ContentType != "" {
 		updates["content_type"] = req.ContentType
 	}
-	if req.Metadata != nil {
-		updates["metadata"] = req.Metadata
-	}
 	updates["updated_by"] = userID
 
-	return s.db.Model(file).Updates(updates).Error
+	// A moved file takes its content along. The content is linked to the new
+	// path together with the update, and the old path is only removed once the
+	// update is committed, so the record always points to its content.
+	var oldPath, newPath string
+	if req.Path != "" && req.Path != file.Path {
+		bucket, err := s.bucketService.getBucket(ctx, file.BucketID)
+		if err != nil {
+			return err
+		}
+		oldPath = s.objectPath(bucket, file)
+		newPath = s.objectPath(bucket, &model.File{Path: req.Path})
+	}
+	linked := false
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(file).Updates(updates).Error; err != nil {
+			return err
+		}
+		if oldPath != "" {
+			// Files created without content have nothing to move yet
+			if _, err := os.Stat(oldPath); err == nil {
+				if err := s.publishObject(ctx, oldPath, newPath); err != nil {
+					return err
+				}
+				linked = true
+			}
+		}
+		if req.Metadata == nil {
+			return nil
+		}
+		// Replace the metadata of the file
+		if err := tx.Where("file_id = ?", file.ID).Delete(&model.FileMetadata{}).Error; err != nil {
+			return err
+		}
+		return saveFileMetadata(tx, file.ID, req.Metadata)
+	})
+	if err != nil {
+		if linked {
+			s.removeObject(ctx, newPath)
+		}
+		return err
+	}
+	if linked {
+		if err := s.removeObject(ctx, oldPath); err != nil {
+			log.Printf("Failed to remove content of file %d at its old path: %v", file.ID, err)
+		}
+	}
+	return nil
 }
 
-// DeleteFile deletes a file
-func (s *FileService) DeleteFile(id uint, userID uint, isRoot bool) error {
+// saveFileMetadata stores metadata key/value pairs of a file
+func saveFileMetadata(tx *gorm.DB, fileID uint, metadata map[string]string) error {
+	for key, value := range metadata {
+		if err := tx.Create(&model.FileMetadata{FileID: fileID, Key: key, Value: value}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// uniqueObjectName returns the name an upload of name is stored under: the
+// name with the upload time and a random suffix appended, so that uploads of
+// the same name never collide
+func uniqueObjectName(name string, now time.Time) (string, error) {
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", fmt.Errorf("failed to generate file name: %v", err)
+	}
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(path.Base(name), ext)
+	return fmt.Sprintf("%s_%s_%s%s", base, now.Format("20060102150405"), hex.EncodeToString(suffix), ext), nil
+}
+
+// objectPath returns where the content of a file is stored on disk
+func (s *FileService) objectPath(bucket *model.Bucket, file *model.File) string {
+	return path.Join(s.bucketDir(bucket.ID), file.Path)
+}
+
+// DeleteFile deletes a file. Locked files cannot be deleted; bypass lifts
+// governance retention for users allowed to bypass it.
+func (s *FileService) DeleteFile(ctx context.Context, id uint, userID uint, isRoot bool, bypass bool) error {
+	ctx, span := tracer.Start(ctx, "FileService.DeleteFile")
+	defer span.End()
+
 	// Get file
-	file, err := s.GetFileByID(id, userID, isRoot)
+	file, err := s.GetFileByID(ctx, id, userID, isRoot)
 	if err != nil {
 		return err
 	}
 
 	// Check bucket write access
-	perm, err := s.bucketService.GetUserBucketPermission(file.BucketID, userID)
-	if err != nil || perm.Access == "read" {
-		return errors.New("permission denied: requires write access")
+	sub := authz.Subject{UserID: userID, IsRoot: isRoot}
+	if err := s.authz.Require(ctx, sub, authz.ActionDelete, authz.FileAt(file.BucketID, file.ID, file.Path)); err != nil {
+		return err
+	}
+
+	// Check object lock
+	if err := s.checkUnlocked(ctx, file, sub, bypass); err != nil {
+		return err
+	}
+
+	bucket, err := s.bucketService.getBucket(ctx, file.BucketID)
+	if err != nil {
+		return err
 	}
 
-	// Delete file record
-	return s.db.Delete(file).Error
+	// Delete file record, then its content, so that deleted files stop
+	// taking up storage as soon as they stop counting against quotas
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(file).Error; err != nil {
+			return err
+		}
+		return tx.Where("file_id = ?", file.ID).Delete(&model.FileMetadata{}).Error
+	})
+	if err != nil {
+		return err
+	}
+	if err := s.removeObject(ctx, s.objectPath(bucket, file)); err != nil {
+		log.Printf("Failed to remove content of file %d: %v", file.ID, err)
+	}
+	return nil
 }
 
 // GetUploadURL generates a pre-signed URL for file upload
-func (s *FileService) GetUploadURL(id uint, userID uint, isRoot bool) (string, error) {
+func (s *FileService) GetUploadURL(ctx context.Context, id uint, userID uint, isRoot bool) (string, error) {
+	ctx, span := tracer.Start(ctx, "FileService.GetUploadURL")
+	defer span.End()
+
 	// Get file
-	file, err := s.GetFileByID(id, userID, isRoot)
+	file, err := s.GetFileByID(ctx, id, userID, isRoot)
 	if err != nil {
 		return "", err
 	}
 
 	// Check bucket write access
-	perm, err := s.bucketService.GetUserBucketPermission(file.BucketID, userID)
-	if err != nil || perm.Access == "read" {
-		return "", errors.New("permission denied: requires write access")
+	if err := s.authz.Require(ctx, authz.Subject{UserID: userID, IsRoot: isRoot}, authz.ActionWrite, authz.FileAt(file.BucketID, file.ID, file.Path)); err != nil {
+		return "", err
 	}
 
 	// TODO: Implement storage service integration to generate pre-signed upload URL
@@ -216,80 +445,182 @@ func (s *FileService) GetUploadURL(id uint, userID uint, isRoot bool) (string, e
 }
 
 // GetDownloadURL generates a pre-signed URL for file download
-func (s *FileService) GetDownloadURL(id uint, userID uint, isRoot bool) (string, time.Time, error) {
+func (s *FileService) GetDownloadURL(ctx context.Context, id uint, userID uint, isRoot bool) (string, time.Time, error) {
+	ctx, span := tracer.Start(ctx, "FileService.GetDownloadURL")
+	defer span.End()
+
 	// Get file
-	file, err := s.GetFileByID(id, userID, isRoot)
+	file, err := s.GetFileByID(ctx, id, userID, isRoot)
 	if err != nil {
 		return "", time.Time{}, err
 	}
 
 	// TODO: Implement storage service integration to generate pre-signed download URL
-	downloadURL := "/api/v1/files/" + path.Join(strconv.FormatUint(uint64(file.BucketID), 10), file.Path)
+	downloadURL := "/api/v1/files/" + strconv.FormatUint(uint64(file.ID), 10) + "/content"
 	expiresAt := time.Now().Add(24 * time.Hour) // URL expires in 24 hours
 
 	return downloadURL, expiresAt, nil
 }
 
-// UploadFile handles file upload to a bucket
-func (s *FileService) UploadFile(bucketID uint, file *multipart.FileHeader, userID uint, isRoot bool) (*model.FileResponse, error) {
+// OpenFile returns a file and its content for download. The caller must close the content.
+func (s *FileService) OpenFile(ctx context.Context, id uint, userID uint, isRoot bool) (*model.File, *os.File, error) {
+	ctx, span := tracer.Start(ctx, "FileService.OpenFile")
+	defer span.End()
+
+	// Get file; this checks read access to its path
+	file, err := s.GetFileByID(ctx, id, userID, isRoot)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	bucket, err := s.bucketService.getBucket(ctx, file.BucketID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	content, err := os.Open(s.objectPath(bucket, file))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil, errors.New("file content not found")
+		}
+		return nil, nil, fmt.Errorf("failed to open file content: %v", err)
+	}
+	return file, content, nil
+}
+
+// UploadFile handles file upload to a directory of a bucket. An empty dir uploads to the bucket root.
+func (s *FileService) UploadFile(ctx context.Context, bucketID uint, dir string, file *multipart.FileHeader, userID uint, isRoot bool) (*model.FileResponse, error) {
+	ctx, span := tracer.Start(ctx, "FileService.UploadFile")
+	defer span.End()
+
+	// Validate target directory
+	if dir == "" {
+		dir = "/"
+	}
+	if err := validatePathPrefix(dir); err != nil {
+		return nil, err
+	}
+
+	// Generate unique filename
+	uniqueFileName, err := uniqueObjectName(file.Filename, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	objectPath := path.Join(dir, uniqueFileName)
+
 	// Check bucket access
-	perm, err := s.bucketService.GetUserBucketPermission(bucketID, userID)
-	if err != nil || perm.Access == "read" {
-		return nil, errors.New("permission denied: requires write access")
+	if err := s.authz.Require(ctx, authz.Subject{UserID: userID, IsRoot: isRoot}, authz.ActionCreate, authz.FileAt(bucketID, 0, objectPath)); err != nil {
+		return nil, err
 	}
 
 	// Get bucket info for path construction
-	bucket, err := s.bucketService.GetBucketByID(bucketID, userID, isRoot)
+	bucket, err := s.bucketService.GetBucketByID(ctx, bucketID, userID, isRoot)
 	if err != nil {
 		return nil, err
 	}
 
-	// Create storage directory if not exists
-	bucketPath := path.Join(s.storagePath, bucket.Name)
-	if err := os.MkdirAll(bucketPath, 0755); err != nil {
-		return nil, fmt.Errorf("failed to create storage directory: %v", err)
+	// Check the bucket upload policy against the announced size and the file name
+	maxBytes := s.maxFileBytes(bucket)
+	if err := s.checkFileSize(bucket, file.Size); err != nil {
+		return nil, err
+	}
+	if err := checkExtension(bucket, file.Filename); err != nil {
+		return nil, err
 	}
 
-	// Generate unique filename
-	ext := path.Ext(file.Filename)
-	fileName := strings.TrimSuffix(file.Filename, ext)
-	timestamp := time.Now().Format("20060102150405")
-	uniqueFileName := fmt.Sprintf("%s_%s%s", fileName, timestamp, ext)
-	filePath := path.Join(bucketPath, uniqueFileName)
+	// Check user and bucket quotas against the announced size
+	remaining, err := s.quotaService.CheckUpload(ctx, bucketID, userID, file.Size)
+	if err != nil {
+		return nil, err
+	}
 
-	// Save file to disk
+	// Open the upload and detect its type from the content rather than trusting the client
 	src, err := file.Open()
 	if err != nil {
 		return nil, fmt.Errorf("failed to open uploaded file: %v", err)
 	}
 	defer src.Close()
 
-	dst, err := os.Create(filePath)
+	head := make([]byte, 512)
+	n, err := io.ReadFull(src, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, fmt.Errorf("failed to read uploaded file: %v", err)
+	}
+	contentType := http.DetectContentType(head[:n])
+	if err := checkContentType(bucket, contentType); err != nil {
+		return nil, err
+	}
+
+	metrics.ActiveUploads.Inc()
+	defer metrics.ActiveUploads.Dec()
+
+	// Enforce the size limit and the quota while streaming too, in case the
+	// content is larger than announced
+	limit := int64(-1)
+	if maxBytes > 0 {
+		limit = maxBytes
+	}
+	if remaining >= 0 && (limit < 0 || remaining < limit) {
+		limit = remaining
+	}
+	var reader io.Reader = io.MultiReader(bytes.NewReader(head[:n]), src)
+	if limit >= 0 {
+		reader = io.LimitReader(reader, limit+1)
+	}
+
+	// Save the content to a partial file; only the partial file is ever
+	// removed here, so a failed upload cannot touch the content of another file
+	partialPath, written, err := s.stageObject(ctx, reader)
+	metrics.UploadBytes.Add(float64(written))
 	if err != nil {
-		return nil, fmt.Errorf("failed to create destination file: %v", err)
+		return nil, err
 	}
-	defer dst.Close()
+	defer os.Remove(partialPath)
 
-	if _, err = io.Copy(dst, src); err != nil {
-		return nil, fmt.Errorf("failed to save file: %v", err)
+	// Check the actual size before the content becomes visible
+	if maxBytes > 0 && written > maxBytes {
+		return nil, fmt.Errorf("%w: limit is %d bytes", ErrFileTooLarge, maxBytes)
+	}
+	if remaining >= 0 && written > remaining {
+		return nil, fmt.Errorf("%w: upload is larger than the remaining quota", ErrQuotaExceeded)
 	}
 
 	// Create file record
 	fileRecord := &model.File{
-		BucketID:      bucketID,
-		Name:          file.Filename,
-		Path:          path.Join(bucket.Name, uniqueFileName),
-		Size:          file.Size,
-		ContentType:   file.Header.Get("Content-Type"),
-		CreatedBy:     userID,
-		UpdatedBy:     userID,
-		LastModified:  time.Now(),
-	}
-
-	if err := s.db.Create(fileRecord).Error; err != nil {
-		// Cleanup file if database insert fails
-		os.Remove(filePath)
-		return nil, fmt.Errorf("failed to create file record: %v", err)
+		BucketID:     bucketID,
+		Name:         file.Filename,
+		Path:         objectPath,
+		Size:         written,
+		ContentType:  contentType,
+		CreatedBy:    userID,
+		UpdatedBy:    userID,
+		LastModified: time.Now(),
+	}
+	applyDefaultRetention(bucket, fileRecord)
+
+	// Publish the content together with the record, so that neither exists without the other
+	filePath := s.objectPath(bucket, fileRecord)
+	published := false
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Check the quotas again with the actual size, counting concurrent uploads
+		if _, err := s.quotaService.ReserveUpload(tx, bucketID, userID, written); err != nil {
+			return err
+		}
+		if err := tx.Create(fileRecord).Error; err != nil {
+			return fmt.Errorf("failed to create file record: %v", err)
+		}
+		if err := s.publishObject(ctx, partialPath, filePath); err != nil {
+			return err
+		}
+		published = true
+		return nil
+	})
+	if err != nil {
+		// The content was published by this upload, so removing it cannot affect another file
+		if published {
+			s.removeObject(ctx, filePath)
+		}
+		return nil, err
 	}
 
 	// Generate response
@@ -303,6 +634,7 @@ func (s *FileService) UploadFile(bucketID uint, file *multipart.FileHeader, user
 		CreatedAt:   model.JSONTime(fileRecord.CreatedAt),
 		UpdatedAt:   model.JSONTime(fileRecord.UpdatedAt),
 	}
+	response.SetObjectLock(fileRecord)
 
 	return response, nil
 }
@@ -0,0 +1,232 @@
+package service
+
+import (
+	"context"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/minorcell/pfss/internal/authz"
+	"github.com/minorcell/pfss/internal/model"
+	"gorm.io/gorm"
+)
+
+func newTestFileService(t *testing.T, quota QuotaConfig) (*FileService, *gorm.DB) {
+	t.Helper()
+	buckets, db := newTestBucketService(t)
+	quotas := NewQuotaService(db, buckets.authz, quota)
+	files := NewFileService(db, buckets, quotas, buckets.authz, buckets.auditService, DefaultFileConfig())
+	files.storagePath = t.TempDir()
+	return files, db
+}
+
+// createTestFile creates a file record and, unless content is nil, its content on disk
+func createTestFile(t *testing.T, files *FileService, bucket *model.Bucket, filePath string, content []byte) *model.File {
+	t.Helper()
+	file := &model.File{
+		BucketID:    bucket.ID,
+		Name:        path.Base(filePath),
+		Path:        filePath,
+		Size:        int64(len(content)),
+		ContentType: "text/plain",
+		CreatedBy:   bucket.OwnerID,
+		UpdatedBy:   bucket.OwnerID,
+	}
+	if err := files.db.Create(file).Error; err != nil {
+		t.Fatal(err)
+	}
+	if content != nil {
+		objectPath := files.objectPath(bucket, file)
+		if err := os.MkdirAll(path.Dir(objectPath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(objectPath, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return file
+}
+
+func TestUpdateFileMovesContent(t *testing.T) {
+	files, db := newTestFileService(t, DefaultQuotaConfig())
+	root := createTestUser(t, db, "root", "root-secret", true)
+	bucket := createTestBucket(t, db, "pfss-docs", root.ID)
+	file := createTestFile(t, files, bucket, "/drafts/report.txt", []byte("report"))
+	empty := createTestFile(t, files, bucket, "/drafts/empty.txt", nil)
+
+	ctx := context.Background()
+	if err := files.UpdateFile(ctx, file.ID, &model.FileUpdateRequest{Path: "/final/report.txt"}, root.ID, true, false); err != nil {
+		t.Fatalf("UpdateFile: %v", err)
+	}
+
+	content, err := os.ReadFile(files.objectPath(bucket, &model.File{Path: "/final/report.txt"}))
+	if err != nil || string(content) != "report" {
+		t.Errorf("content at the new path: %q, %v", content, err)
+	}
+	if _, err := os.Stat(files.objectPath(bucket, &model.File{Path: "/drafts/report.txt"})); !os.IsNotExist(err) {
+		t.Errorf("content is still at the old path: %v", err)
+	}
+
+	// A file without content can be moved as well
+	if err := files.UpdateFile(ctx, empty.ID, &model.FileUpdateRequest{Path: "/final/empty.txt"}, root.ID, true, false); err != nil {
+		t.Fatalf("UpdateFile without content: %v", err)
+	}
+}
+
+func TestGetFilesAppliesPathRules(t *testing.T) {
+	files, db := newTestFileService(t, DefaultQuotaConfig())
+	root := createTestUser(t, db, "root", "root-secret", true)
+	alice := createTestUser(t, db, "alice", "alice-secret", false)
+	bucket := createTestBucket(t, db, "pfss-docs", root.ID)
+	createTestGrant(t, db, bucket.ID, alice.ID, 0, authz.AccessRead, nil)
+
+	for _, rule := range []model.BucketPathRule{
+		{Prefix: "/private/", Effect: authz.EffectDeny, Access: authz.AccessRead},
+		{Prefix: "/private/shared/", Effect: authz.EffectAllow, Access: authz.AccessRead},
+		// Multi-byte prefixes are compared by character
+		{Prefix: "/机密/", Effect: authz.EffectDeny, Access: authz.AccessRead},
+		// Rules of other users do not apply
+		{Prefix: "/public/", UserID: root.ID, Effect: authz.EffectDeny, Access: authz.AccessRead},
+	} {
+		rule.BucketID = bucket.ID
+		rule.CreatedBy = root.ID
+		if err := db.Create(&rule).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, filePath := range []string{"/public/a.txt", "/private/b.txt", "/private/shared/c.txt", "/机密/d.txt", "/机密.txt"} {
+		createTestFile(t, files, bucket, filePath, nil)
+	}
+
+	list, total, err := files.GetFiles(context.Background(), bucket.ID, alice.ID, false, 1, 10)
+	if err != nil {
+		t.Fatalf("GetFiles: %v", err)
+	}
+	got := make(map[string]bool)
+	for _, file := range list {
+		got[file.Path] = true
+	}
+	want := []string{"/public/a.txt", "/private/shared/c.txt", "/机密.txt"}
+	if total != int64(len(want)) || len(got) != len(want) {
+		t.Errorf("alice sees %v (total %d), want %v", got, total, want)
+	}
+	for _, filePath := range want {
+		if !got[filePath] {
+			t.Errorf("alice does not see %s", filePath)
+		}
+	}
+}
+
+func TestFileContentSurvivesBucketRename(t *testing.T) {
+	files, db := newTestFileService(t, DefaultQuotaConfig())
+	root := createTestUser(t, db, "root", "root-secret", true)
+	bucket := createTestBucket(t, db, "pfss-docs", root.ID)
+	file := createTestFile(t, files, bucket, "/report.txt", []byte("report"))
+
+	ctx := context.Background()
+	if err := files.bucketService.UpdateBucket(ctx, bucket.ID, &model.BucketUpdateRequest{Name: "pfss-renamed"}, root.ID, true); err != nil {
+		t.Fatalf("UpdateBucket: %v", err)
+	}
+
+	_, content, err := files.OpenFile(ctx, file.ID, root.ID, true)
+	if err != nil {
+		t.Fatalf("OpenFile after rename: %v", err)
+	}
+	content.Close()
+}
+
+func TestMoveLegacyBucketDirs(t *testing.T) {
+	files, db := newTestFileService(t, DefaultQuotaConfig())
+	root := createTestUser(t, db, "root", "root-secret", true)
+	bucket := createTestBucket(t, db, "pfss-docs", root.ID)
+
+	// Earlier releases stored content below the bucket name
+	legacy := path.Join(files.storagePath, bucket.Name, "report.txt")
+	if err := os.MkdirAll(path.Dir(legacy), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(legacy, []byte("report"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	moved, err := files.MoveLegacyBucketDirs(context.Background())
+	if err != nil || moved != 1 {
+		t.Fatalf("MoveLegacyBucketDirs = %d, %v; want 1 bucket moved", moved, err)
+	}
+	content, err := os.ReadFile(files.objectPath(bucket, &model.File{Path: "/report.txt"}))
+	if err != nil || string(content) != "report" {
+		t.Errorf("content after the move: %q, %v", content, err)
+	}
+
+	// Running again finds nothing left to move
+	if moved, err := files.MoveLegacyBucketDirs(context.Background()); err != nil || moved != 0 {
+		t.Errorf("second run = %d, %v; want nothing moved", moved, err)
+	}
+}
+
+func TestValidatePaths(t *testing.T) {
+	tests := []struct {
+		path         string
+		file, prefix bool
+	}{
+		{"/", true, true},
+		{"/a.txt", true, true},
+		{"/dir/a.txt", true, true},
+		{"/dir/", false, true},
+		{"a.txt", false, false},
+		{"//a.txt", false, false},
+		{"/dir//a.txt", false, false},
+		{"/./a.txt", false, false},
+		{"/dir/./", false, false},
+		{"/dir/../a.txt", false, false},
+		{"//", false, false},
+		{"/dir//", false, false},
+	}
+	for _, tt := range tests {
+		if err := validateFilePath(tt.path); (err == nil) != tt.file {
+			t.Errorf("validateFilePath(%q) = %v, want valid %t", tt.path, err, tt.file)
+		}
+		if err := validatePathPrefix(tt.path); (err == nil) != tt.prefix {
+			t.Errorf("validatePathPrefix(%q) = %v, want valid %t", tt.path, err, tt.prefix)
+		}
+	}
+}
+
+func TestPathAliasesCannotEvadePathRules(t *testing.T) {
+	files, db := newTestFileService(t, DefaultQuotaConfig())
+	root := createTestUser(t, db, "root", "root-secret", true)
+	alice := createTestUser(t, db, "alice", "alice-secret", false)
+	bucket := createTestBucket(t, db, "pfss-docs", root.ID)
+	createTestGrant(t, db, bucket.ID, alice.ID, 0, authz.AccessWrite, nil)
+	rule := &model.BucketPathRule{BucketID: bucket.ID, Prefix: "/secret/", Effect: authz.EffectDeny, Access: authz.AccessWrite, CreatedBy: root.ID}
+	if err := db.Create(rule).Error; err != nil {
+		t.Fatal(err)
+	}
+	createTestFile(t, files, bucket, "/secret/doc.txt", []byte("secret"))
+
+	ctx := context.Background()
+	for _, alias := range []string{"//secret/doc.txt", "/./secret/doc.txt", "/public/../secret/doc.txt"} {
+		_, err := files.CreateFile(ctx, &model.FileCreateRequest{
+			BucketID:    bucket.ID,
+			Name:        "doc.txt",
+			Path:        alias,
+			ContentType: "text/plain",
+			Size:        1,
+		}, alice.ID, false)
+		if err == nil {
+			t.Errorf("alice created a file at %s", alias)
+		}
+	}
+
+	public := createTestFile(t, files, bucket, "/public/doc.txt", []byte("public"))
+	if err := files.UpdateFile(ctx, public.ID, &model.FileUpdateRequest{Path: "//secret/moved.txt"}, alice.ID, false, false); err == nil {
+		t.Error("alice moved a file to //secret/moved.txt")
+	}
+
+	if _, err := files.bucketService.CreatePathRule(ctx, bucket.ID, &model.BucketPathRuleRequest{
+		Prefix: "//secret/", Effect: authz.EffectAllow, Access: authz.AccessRead, UserID: alice.ID,
+	}, root.ID, true); err == nil {
+		t.Error("a path rule with a non-canonical prefix was created")
+	}
+}
@@ -0,0 +1,231 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/minorcell/pfss/internal/authz"
+	"github.com/minorcell/pfss/internal/model"
+	"gorm.io/gorm"
+)
+
+// GroupService handles group-related operations
+type GroupService struct {
+	db    *gorm.DB
+	authz *authz.Authorizer
+}
+
+// NewGroupService creates a new group service
+func NewGroupService(db *gorm.DB, authorizer *authz.Authorizer) *GroupService {
+	return &GroupService{db: db, authz: authorizer}
+}
+
+// CreateGroup creates a new group
+func (s *GroupService) CreateGroup(ctx context.Context, req *model.GroupCreateRequest, userID uint, isRoot bool) (*model.Group, error) {
+	// Check permissions
+	if err := s.authz.Require(ctx, authz.Subject{UserID: userID, IsRoot: isRoot}, authz.ActionCreate, authz.Groups()); err != nil {
+		return nil, err
+	}
+
+	// Check if group name already exists
+	var count int64
+	if err := s.db.WithContext(ctx).Model(&model.Group{}).Where("name = ?", req.Name).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, errors.New("group name already exists")
+	}
+
+	group := &model.Group{
+		Name:        req.Name,
+		Description: req.Description,
+		CreatedBy:   userID,
+	}
+	if err := s.db.WithContext(ctx).Create(group).Error; err != nil {
+		return nil, err
+	}
+
+	return group, nil
+}
+
+// GetGroups returns a list of groups with pagination
+func (s *GroupService) GetGroups(ctx context.Context, page, pageSize int, userID uint, isRoot bool) ([]model.Group, int64, error) {
+	// Check permissions
+	if err := s.authz.Require(ctx, authz.Subject{UserID: userID, IsRoot: isRoot}, authz.ActionRead, authz.Groups()); err != nil {
+		return nil, 0, err
+	}
+
+	var groups []model.Group
+	var total int64
+
+	// Get total count
+	if err := s.db.WithContext(ctx).Model(&model.Group{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	// Get groups with pagination
+	offset := (page - 1) * pageSize
+	if err := s.db.WithContext(ctx).Order("id").Offset(offset).Limit(pageSize).Find(&groups).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return groups, total, nil
+}
+
+// GetGroupByID returns a group by ID
+func (s *GroupService) GetGroupByID(ctx context.Context, id uint) (*model.Group, error) {
+	var group model.Group
+	if err := s.db.WithContext(ctx).First(&group, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("group not found")
+		}
+		return nil, err
+	}
+	return &group, nil
+}
+
+// GetGroup returns a group and its members
+func (s *GroupService) GetGroup(ctx context.Context, id uint, userID uint, isRoot bool) (*model.GroupResponse, error) {
+	// Check permissions
+	if err := s.authz.Require(ctx, authz.Subject{UserID: userID, IsRoot: isRoot}, authz.ActionRead, authz.Group(id)); err != nil {
+		return nil, err
+	}
+
+	group, err := s.GetGroupByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var members []model.User
+	if err := s.db.WithContext(ctx).Where("id IN (?)", s.db.WithContext(ctx).Model(&model.GroupMember{}).Select("user_id").Where("group_id = ?", id)).
+		Find(&members).Error; err != nil {
+		return nil, err
+	}
+
+	return &model.GroupResponse{
+		Group:   group,
+		Members: members,
+	}, nil
+}
+
+// UpdateGroup updates group information
+func (s *GroupService) UpdateGroup(ctx context.Context, id uint, req *model.GroupUpdateRequest, userID uint, isRoot bool) error {
+	// Check permissions
+	if err := s.authz.Require(ctx, authz.Subject{UserID: userID, IsRoot: isRoot}, authz.ActionWrite, authz.Group(id)); err != nil {
+		return err
+	}
+
+	group, err := s.GetGroupByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if req.Name != "" {
+		// Check if new name already exists
+		var count int64
+		if err := s.db.WithContext(ctx).Model(&model.Group{}).Where("name = ? AND id != ?", req.Name, id).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return errors.New("group name already exists")
+		}
+	}
+
+	updates := make(map[string]interface{})
+	if req.Name != "" {
+		updates["name"] = req.Name
+	}
+	if req.Description != "" {
+		updates["description"] = req.Description
+	}
+
+	return s.db.WithContext(ctx).Model(group).Updates(updates).Error
+}
+
+// DeleteGroup deletes a group together with its memberships, bucket grants and path rules
+func (s *GroupService) DeleteGroup(ctx context.Context, id uint, userID uint, isRoot bool) error {
+	// Check permissions
+	if err := s.authz.Require(ctx, authz.Subject{UserID: userID, IsRoot: isRoot}, authz.ActionDelete, authz.Group(id)); err != nil {
+		return err
+	}
+
+	group, err := s.GetGroupByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("group_id = ?", id).Delete(&model.GroupMember{}).Error; err != nil {
+			return err
+		}
+		// Removing the group's grants changes the permission set of those buckets
+		if err := tx.Model(&model.Bucket{}).
+			Where("id IN (?)", tx.Model(&model.BucketPermission{}).Select("bucket_id").Where("group_id = ?", id)).
+			Update("permission_version", gorm.Expr("permission_version + 1")).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("group_id = ?", id).Delete(&model.BucketPermission{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("group_id = ?", id).Delete(&model.BucketPathRule{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(group).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// AddMember adds a user to a group
+func (s *GroupService) AddMember(ctx context.Context, groupID, memberID uint, userID uint, isRoot bool) error {
+	// Check permissions
+	if err := s.authz.Require(ctx, authz.Subject{UserID: userID, IsRoot: isRoot}, authz.ActionWrite, authz.Group(groupID)); err != nil {
+		return err
+	}
+
+	if _, err := s.GetGroupByID(ctx, groupID); err != nil {
+		return err
+	}
+
+	var count int64
+	if err := s.db.WithContext(ctx).Model(&model.User{}).Where("id = ?", memberID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return errors.New("user not found")
+	}
+
+	if err := s.db.WithContext(ctx).Model(&model.GroupMember{}).Where("group_id = ? AND user_id = ?", groupID, memberID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return errors.New("user is already a member of this group")
+	}
+
+	if err := s.db.WithContext(ctx).Create(&model.GroupMember{GroupID: groupID, UserID: memberID}).Error; err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// RemoveMember removes a user from a group
+func (s *GroupService) RemoveMember(ctx context.Context, groupID, memberID uint, userID uint, isRoot bool) error {
+	// Check permissions
+	if err := s.authz.Require(ctx, authz.Subject{UserID: userID, IsRoot: isRoot}, authz.ActionWrite, authz.Group(groupID)); err != nil {
+		return err
+	}
+
+	result := s.db.WithContext(ctx).Where("group_id = ? AND user_id = ?", groupID, memberID).Delete(&model.GroupMember{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("user is not a member of this group")
+	}
+
+	return nil
+}
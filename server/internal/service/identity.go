@@ -0,0 +1,136 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/minorcell/pfss/internal/authz"
+	"github.com/minorcell/pfss/internal/model"
+	"gorm.io/gorm"
+)
+
+// externalLogin describes a user authenticated by an external identity provider
+type externalLogin struct {
+	// Provider names the identity provider, e.g. "oidc" or "ldap"
+	Provider string
+	// Subject is the stable identifier of the user at the provider
+	Subject string
+	// Username is the preferred PFSS username for newly provisioned users
+	Username string
+	// IsRoot overrides the root flag of the user when set
+	IsRoot *bool
+	// Provision allows creating a PFSS user on first login
+	Provision bool
+}
+
+// loginExternal maps an external identity onto a PFSS user, provisioning the
+// user just in time when allowed, and issues a PFSS token for it
+func (s *AuthService) loginExternal(login *externalLogin) (*model.AuthResponse, error) {
+	var user model.User
+	var provisioned, rootSynced bool
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var identity model.UserIdentity
+		err := tx.Where("provider = ? AND subject = ?", login.Provider, login.Subject).First(&identity).Error
+		switch {
+		case err == nil:
+			if err := tx.First(&user, identity.UserID).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return errors.New("linked user no longer exists")
+				}
+				return err
+			}
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			if !login.Provision {
+				return errors.New("no account is linked to this identity")
+			}
+			username, err := uniqueUsername(tx, login.Username)
+			if err != nil {
+				return err
+			}
+			// External users have no local password and cannot use password login
+			user = model.User{
+				Username: username,
+				Status:   "active",
+			}
+			if login.IsRoot != nil {
+				user.IsRoot = *login.IsRoot
+			}
+			if err := tx.Create(&user).Error; err != nil {
+				return err
+			}
+			identity = model.UserIdentity{
+				UserID:   user.ID,
+				Provider: login.Provider,
+				Subject:  login.Subject,
+			}
+			provisioned = true
+		default:
+			return err
+		}
+
+		if user.Status != "active" {
+			return ErrAccountInactive
+		}
+
+		if login.IsRoot != nil && user.IsRoot != *login.IsRoot {
+			if err := tx.Model(&user).Update("is_root", *login.IsRoot).Error; err != nil {
+				return err
+			}
+			rootSynced = true
+		}
+
+		identity.LastLogin = time.Now()
+		return tx.Save(&identity).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Recorded once committed, so that rolled back changes leave no events
+	if provisioned {
+		s.audit.Record(&model.AuditEvent{
+			Action:     model.AuditUserProvision,
+			TargetType: authz.KindUser,
+			TargetID:   user.ID,
+		}, nil, map[string]interface{}{"username": user.Username, "provider": login.Provider, "subject": login.Subject, "is_root": user.IsRoot}, nil)
+	}
+	if rootSynced {
+		s.audit.Record(&model.AuditEvent{
+			Action:     model.AuditUserRootSync,
+			TargetType: authz.KindUser,
+			TargetID:   user.ID,
+		}, map[string]bool{"is_root": !*login.IsRoot}, map[string]interface{}{"is_root": *login.IsRoot, "provider": login.Provider}, nil)
+	}
+
+	return s.newAuthResponse(&user)
+}
+
+// uniqueUsername returns base, or base with a numeric suffix if it is taken.
+// Existing accounts are never linked by name, so an identity provider cannot
+// claim a local account such as root.
+func uniqueUsername(tx *gorm.DB, base string) (string, error) {
+	base = strings.TrimSpace(base)
+	// Truncate by characters so that multi-byte names stay valid UTF-8
+	if runes := []rune(base); len(runes) > 40 {
+		base = string(runes[:40])
+	}
+	if base == "" {
+		base = "user"
+	}
+
+	name := base
+	for i := 2; i < 1000; i++ {
+		var count int64
+		if err := tx.Unscoped().Model(&model.User{}).Where("username = ?", name).Count(&count).Error; err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return name, nil
+		}
+		name = fmt.Sprintf("%s-%d", base, i)
+	}
+	return "", errors.New("could not find a free username")
+}
@@ -0,0 +1,42 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/minorcell/pfss/internal/model"
+)
+
+func TestLoginExternalRecordsAuditEvents(t *testing.T) {
+	auth := newTestAuthService(t, nil)
+	isRoot, notRoot := true, false
+
+	resp, err := auth.loginExternal(&externalLogin{Provider: "oidc", Subject: "alice-1", Username: "alice", IsRoot: &isRoot, Provision: true})
+	if err != nil {
+		t.Fatalf("first login: %v", err)
+	}
+	// A login that changes nothing records nothing
+	if _, err := auth.loginExternal(&externalLogin{Provider: "oidc", Subject: "alice-1", IsRoot: &isRoot}); err != nil {
+		t.Fatalf("second login: %v", err)
+	}
+	if _, err := auth.loginExternal(&externalLogin{Provider: "oidc", Subject: "alice-1", IsRoot: &notRoot}); err != nil {
+		t.Fatalf("third login: %v", err)
+	}
+
+	var events []model.AuditEvent
+	if err := auth.db.Order("id").Find(&events).Error; err != nil {
+		t.Fatal(err)
+	}
+	want := []string{model.AuditUserProvision, model.AuditUserRootSync}
+	if len(events) != len(want) {
+		t.Fatalf("got %d audit events %+v, want %v", len(events), events, want)
+	}
+	for i, event := range events {
+		if event.Action != want[i] || event.TargetID != resp.ID || event.Result != model.AuditSuccess {
+			t.Errorf("event %d: %+v, want a successful %s of user %d", i, event, want[i], resp.ID)
+		}
+	}
+	if events[1].After != `{"is_root":false,"provider":"oidc"}` {
+		t.Errorf("root sync recorded %s", events[1].After)
+	}
+
+}
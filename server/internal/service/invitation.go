@@ -0,0 +1,171 @@
+package service
+
+import (
+	"errors"
+	"time"
+
+	"github.com/minorcell/pfss/internal/model"
+	"github.com/minorcell/pfss/pkg/util"
+	"gorm.io/gorm"
+)
+
+// InvitationService handles registration invitations
+type InvitationService struct {
+	db *gorm.DB
+}
+
+// NewInvitationService creates a new invitation service
+func NewInvitationService(db *gorm.DB) *InvitationService {
+	return &InvitationService{db: db}
+}
+
+// CreateInvitation creates an invitation and returns it with its one-time token
+func (s *InvitationService) CreateInvitation(req *model.InvitationCreateRequest, userID uint, isRoot bool) (*model.InvitationResponse, error) {
+	// Only root users can invite
+	if !isRoot {
+		return nil, errors.New("permission denied")
+	}
+
+	var expiresAt *time.Time
+	if req.ExpiresAt != nil {
+		t := time.Time(*req.ExpiresAt)
+		if !t.After(time.Now()) {
+			return nil, errors.New("expiry must be in the future")
+		}
+		expiresAt = &t
+	}
+
+	role := req.Role
+	if role == "" {
+		role = "user"
+	}
+
+	token, err := util.GenerateOneTimeToken()
+	if err != nil {
+		return nil, err
+	}
+
+	invitation := &model.Invitation{
+		TokenHash: util.HashOneTimeToken(token),
+		Role:      role,
+		Note:      req.Note,
+		CreatedBy: userID,
+		ExpiresAt: expiresAt,
+	}
+	for _, g := range req.Grants {
+		invitation.Grants = append(invitation.Grants, model.InvitationGrant{
+			BucketID: g.BucketID,
+			Access:   g.Access,
+		})
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		// Make sure every granted bucket exists
+		for _, g := range invitation.Grants {
+			var count int64
+			if err := tx.Model(&model.Bucket{}).Where("id = ?", g.BucketID).Count(&count).Error; err != nil {
+				return err
+			}
+			if count == 0 {
+				return errors.New("bucket not found")
+			}
+		}
+		return tx.Create(invitation).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.InvitationResponse{
+		Invitation: invitation,
+		Token:      token,
+	}, nil
+}
+
+// GetInvitations returns a list of invitations with pagination
+func (s *InvitationService) GetInvitations(page, pageSize int) ([]model.Invitation, int64, error) {
+	var invitations []model.Invitation
+	var total int64
+
+	// Get total count
+	if err := s.db.Model(&model.Invitation{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	// Get invitations with pagination
+	offset := (page - 1) * pageSize
+	if err := s.db.Preload("Grants").Order("id DESC").Offset(offset).Limit(pageSize).Find(&invitations).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return invitations, total, nil
+}
+
+// RevokeInvitation deletes an unused invitation
+func (s *InvitationService) RevokeInvitation(id uint, userID uint) error {
+	var invitation model.Invitation
+	if err := s.db.First(&invitation, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errors.New("invitation not found")
+		}
+		return err
+	}
+	if invitation.UsedAt != nil {
+		return errors.New("invitation has already been used")
+	}
+
+	if err := s.db.Delete(&invitation).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+// redeemInvitation marks the invitation matching token as used by userID inside tx
+// and applies its bucket grants. It fails if the token is unknown, used or expired.
+func redeemInvitation(tx *gorm.DB, token string, userID uint) (*model.Invitation, error) {
+	var invitation model.Invitation
+	err := tx.Preload("Grants").
+		Where("token_hash = ?", util.HashOneTimeToken(token)).
+		First(&invitation).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("invalid invitation token")
+		}
+		return nil, err
+	}
+
+	now := time.Now()
+	if invitation.UsedAt != nil {
+		return nil, errors.New("invitation has already been used")
+	}
+	if invitation.ExpiresAt != nil && !now.Before(*invitation.ExpiresAt) {
+		return nil, errors.New("invitation has expired")
+	}
+
+	// Claim the invitation; a concurrent redemption leaves no row to update
+	result := tx.Model(&model.Invitation{}).
+		Where("id = ? AND used_at IS NULL", invitation.ID).
+		Updates(map[string]interface{}{
+			"used_at": now,
+			"used_by": userID,
+		})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, errors.New("invitation has already been used")
+	}
+
+	for _, g := range invitation.Grants {
+		perm := model.BucketPermission{
+			BucketID: g.BucketID,
+			UserID:   userID,
+			Access:   g.Access,
+		}
+		if err := tx.Create(&perm).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	return &invitation, nil
+}
@@ -0,0 +1,392 @@
+package service
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/minorcell/pfss/internal/authz"
+	"github.com/minorcell/pfss/internal/model"
+)
+
+// ldapProvider is the identity provider name of directory users
+const ldapProvider = "ldap"
+
+// Directory errors
+var (
+	// ErrDirectoryUserNotFound is returned when the directory has no such user
+	ErrDirectoryUserNotFound = errors.New("user not found in directory")
+	// ErrDirectoryInvalidCredentials is returned when the directory rejects the password
+	ErrDirectoryInvalidCredentials = errors.New("invalid directory credentials")
+	// ErrDirectoryUnavailable is wrapped by errors returned when the directory
+	// cannot be reached or fails to answer
+	ErrDirectoryUnavailable = errors.New("directory unavailable")
+)
+
+// DirectoryUser is a user entry found in an external directory
+type DirectoryUser struct {
+	DN       string
+	Username string
+	Groups   []string
+	Disabled bool
+}
+
+// Directory authenticates users against an external directory
+type Directory interface {
+	// Authenticate verifies the password and returns the directory entry
+	Authenticate(username, password string) (*DirectoryUser, error)
+	// Open connects to the directory for a series of lookups
+	Open() (DirectorySession, error)
+	// IsRoot reports whether the user's groups map to root. ok is false
+	// when no root groups are configured and the root flag should be left alone.
+	IsRoot(user *DirectoryUser) (isRoot bool, ok bool)
+	// Allowed reports whether the user's groups allow logging in
+	Allowed(user *DirectoryUser) bool
+}
+
+// DirectorySession looks up users over one connection to a directory
+type DirectorySession interface {
+	// Lookup returns the directory entry without verifying a password
+	Lookup(username string) (*DirectoryUser, error)
+	// Close closes the connection
+	Close() error
+}
+
+// LDAPConfig configures LDAP bind/search authentication
+type LDAPConfig struct {
+	// URL of the server, e.g. ldaps://ldap.example.com:636
+	URL                string
+	StartTLS           bool
+	InsecureSkipVerify bool
+	// BindDN and BindPassword of the service account used for searches
+	BindDN       string
+	BindPassword string
+	// BaseDN is where users are searched
+	BaseDN string
+	// UserFilter finds a user; %s is replaced by the escaped username
+	UserFilter string
+	// UsernameAttribute holds the PFSS username
+	UsernameAttribute string
+	// GroupAttribute lists the groups of a user entry, e.g. memberOf
+	GroupAttribute string
+	// DisabledFilter matches disabled user entries when set
+	DisabledFilter string
+	// AllowedGroups restricts login to members of these groups when not empty
+	AllowedGroups []string
+	// RootGroups grants root to members of these groups when not empty
+	RootGroups []string
+	// Timeout for connecting and each request
+	Timeout time.Duration
+}
+
+// LDAPDirectory is a Directory backed by an LDAP server
+type LDAPDirectory struct {
+	config LDAPConfig
+}
+
+// NewLDAPDirectory creates a new LDAP directory
+func NewLDAPDirectory(config LDAPConfig) (*LDAPDirectory, error) {
+	if config.URL == "" || config.BaseDN == "" {
+		return nil, errors.New("ldap url and base dn are required")
+	}
+	if config.UserFilter == "" {
+		config.UserFilter = "(uid=%s)"
+	}
+	if !strings.Contains(config.UserFilter, "%s") {
+		return nil, errors.New("ldap user filter must contain %s")
+	}
+	if config.UsernameAttribute == "" {
+		config.UsernameAttribute = "uid"
+	}
+	if config.GroupAttribute == "" {
+		config.GroupAttribute = "memberOf"
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 10 * time.Second
+	}
+	return &LDAPDirectory{config: config}, nil
+}
+
+// connect dials the server and binds the service account
+func (d *LDAPDirectory) connect() (*ldap.Conn, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: d.config.InsecureSkipVerify}
+
+	conn, err := ldap.DialURL(d.config.URL,
+		ldap.DialWithTLSConfig(tlsConfig),
+		ldap.DialWithDialer(&net.Dialer{Timeout: d.config.Timeout}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to connect to ldap: %v", ErrDirectoryUnavailable, err)
+	}
+	conn.SetTimeout(d.config.Timeout)
+
+	if d.config.StartTLS {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("%w: failed to start tls: %v", ErrDirectoryUnavailable, err)
+		}
+	}
+
+	if d.config.BindDN != "" {
+		err = conn.Bind(d.config.BindDN, d.config.BindPassword)
+	} else {
+		err = conn.UnauthenticatedBind("")
+	}
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("%w: failed to bind service account: %v", ErrDirectoryUnavailable, err)
+	}
+
+	return conn, nil
+}
+
+// search finds the entry of username using an already bound connection
+func (d *LDAPDirectory) search(conn *ldap.Conn, username string) (*DirectoryUser, error) {
+	filter := strings.ReplaceAll(d.config.UserFilter, "%s", ldap.EscapeFilter(username))
+
+	result, err := conn.Search(ldap.NewSearchRequest(
+		d.config.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		2, int(d.config.Timeout.Seconds()), false,
+		filter,
+		[]string{d.config.UsernameAttribute, d.config.GroupAttribute},
+		nil,
+	))
+	if err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchObject) {
+			return nil, ErrDirectoryUserNotFound
+		}
+		return nil, searchError(err)
+	}
+	switch len(result.Entries) {
+	case 0:
+		return nil, ErrDirectoryUserNotFound
+	case 1:
+	default:
+		return nil, errors.New("ldap user filter matched more than one entry")
+	}
+
+	entry := result.Entries[0]
+	user := &DirectoryUser{
+		DN:       entry.DN,
+		Username: entry.GetAttributeValue(d.config.UsernameAttribute),
+		Groups:   entry.GetAttributeValues(d.config.GroupAttribute),
+	}
+	if user.Username == "" {
+		user.Username = username
+	}
+
+	if d.config.DisabledFilter != "" {
+		disabled, err := conn.Search(ldap.NewSearchRequest(
+			entry.DN, ldap.ScopeBaseObject, ldap.NeverDerefAliases,
+			1, int(d.config.Timeout.Seconds()), false,
+			d.config.DisabledFilter,
+			[]string{"dn"},
+			nil,
+		))
+		if err != nil {
+			return nil, searchError(err)
+		}
+		user.Disabled = len(disabled.Entries) > 0
+	}
+
+	return user, nil
+}
+
+// Authenticate searches the user with the service account and binds as the user
+func (d *LDAPDirectory) Authenticate(username, password string) (*DirectoryUser, error) {
+	// An empty password would be an unauthenticated bind, which always succeeds
+	if password == "" {
+		return nil, ErrDirectoryInvalidCredentials
+	}
+
+	conn, err := d.connect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	user, err := d.search(conn, username)
+	if errors.Is(err, ErrDirectoryUserNotFound) || errors.Is(err, ErrDirectoryUnavailable) {
+		return nil, err
+	}
+	if err != nil {
+		// The search is misconfigured, which users cannot fix by logging in again
+		return nil, fmt.Errorf("%w: %v", ErrDirectoryUnavailable, err)
+	}
+
+	if err := conn.Bind(user.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrDirectoryInvalidCredentials
+		}
+		return nil, fmt.Errorf("%w: ldap bind failed: %v", ErrDirectoryUnavailable, err)
+	}
+
+	return user, nil
+}
+
+// searchError converts a failed search into an error, wrapping
+// ErrDirectoryUnavailable if the connection failed
+func searchError(err error) error {
+	if ldap.IsErrorWithCode(err, ldap.ErrorNetwork) {
+		return fmt.Errorf("%w: ldap search failed: %v", ErrDirectoryUnavailable, err)
+	}
+	return fmt.Errorf("ldap search failed: %w", err)
+}
+
+// Open connects and binds the service account for a series of lookups
+func (d *LDAPDirectory) Open() (DirectorySession, error) {
+	conn, err := d.connect()
+	if err != nil {
+		return nil, err
+	}
+	return &ldapSession{directory: d, conn: conn}, nil
+}
+
+// ldapSession is a DirectorySession on a connection bound as the service account
+type ldapSession struct {
+	directory *LDAPDirectory
+	conn      *ldap.Conn
+}
+
+// Lookup returns the directory entry of username
+func (s *ldapSession) Lookup(username string) (*DirectoryUser, error) {
+	return s.directory.search(s.conn, username)
+}
+
+// Close unbinds and closes the connection
+func (s *ldapSession) Close() error {
+	return s.conn.Close()
+}
+
+// IsRoot reports whether the user is a member of a root group
+func (d *LDAPDirectory) IsRoot(user *DirectoryUser) (bool, bool) {
+	if len(d.config.RootGroups) == 0 {
+		return false, false
+	}
+	return memberOfAny(user.Groups, d.config.RootGroups), true
+}
+
+// Allowed reports whether the user is a member of an allowed group
+func (d *LDAPDirectory) Allowed(user *DirectoryUser) bool {
+	return len(d.config.AllowedGroups) == 0 || memberOfAny(user.Groups, d.config.AllowedGroups)
+}
+
+// memberOfAny reports whether groups contains any of wanted. Groups match by
+// full DN or by the value of their first RDN (e.g. the CN), case-insensitively.
+func memberOfAny(groups, wanted []string) bool {
+	for _, group := range groups {
+		name := group
+		if dn, err := ldap.ParseDN(group); err == nil && len(dn.RDNs) > 0 && len(dn.RDNs[0].Attributes) > 0 {
+			name = dn.RDNs[0].Attributes[0].Value
+		}
+		for _, w := range wanted {
+			if strings.EqualFold(w, group) || strings.EqualFold(w, name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// loginDirectory authenticates against the directory and maps the entry onto a
+// PFSS user. ErrDirectoryUserNotFound means the local password should be tried.
+func (s *AuthService) loginDirectory(username, password string) (*model.AuthResponse, error) {
+	dirUser, err := s.config.Directory.Authenticate(username, password)
+	if err != nil {
+		return nil, err
+	}
+	if dirUser.Disabled {
+		return nil, ErrAccountInactive
+	}
+	if !s.config.Directory.Allowed(dirUser) {
+		return nil, fmt.Errorf("%w: not a member of an allowed group", authz.ErrPermissionDenied)
+	}
+
+	login := &externalLogin{
+		Provider:  ldapProvider,
+		Subject:   strings.ToLower(dirUser.Username),
+		Username:  dirUser.Username,
+		Provision: s.config.DirectoryProvision,
+	}
+	if isRoot, ok := s.config.Directory.IsRoot(dirUser); ok {
+		login.IsRoot = &isRoot
+	}
+
+	return s.loginExternal(login)
+}
+
+// SyncDirectory marks users as inactive whose directory entry was removed or
+// disabled. Users whose entry cannot be read are skipped; the sync stops when
+// the directory becomes unavailable.
+func (s *AuthService) SyncDirectory() error {
+	if s.config.Directory == nil {
+		return nil
+	}
+
+	var identities []model.UserIdentity
+	if err := s.db.Where("provider = ?", ldapProvider).Find(&identities).Error; err != nil {
+		return err
+	}
+	if len(identities) == 0 {
+		return nil
+	}
+
+	session, err := s.config.Directory.Open()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	for _, identity := range identities {
+		dirUser, err := session.Lookup(identity.Subject)
+		if errors.Is(err, ErrDirectoryUnavailable) {
+			return err
+		}
+		if err != nil && !errors.Is(err, ErrDirectoryUserNotFound) {
+			log.Printf("Directory sync skipped user %d (%s): %v", identity.UserID, identity.Subject, err)
+			continue
+		}
+		if err == nil && !dirUser.Disabled {
+			continue
+		}
+
+		result := s.db.Model(&model.User{}).
+			Where("id = ? AND status = ?", identity.UserID, "active").
+			Update("status", "inactive")
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected > 0 {
+			s.audit.Record(&model.AuditEvent{
+				Action:     model.AuditUserStatus,
+				TargetType: authz.KindUser,
+				TargetID:   identity.UserID,
+			}, map[string]string{"status": "active"}, map[string]string{"status": "inactive", "subject": identity.Subject}, nil)
+		}
+	}
+
+	return nil
+}
+
+// RunDirectorySync calls SyncDirectory every interval until ctx is done
+func (s *AuthService) RunDirectorySync(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.SyncDirectory(); err != nil {
+				log.Printf("Directory sync failed: %v", err)
+			}
+		}
+	}
+}
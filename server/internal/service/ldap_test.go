@@ -0,0 +1,312 @@
+package service
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+	"github.com/minorcell/pfss/internal/model"
+	"github.com/minorcell/pfss/pkg/util"
+)
+
+const (
+	testBaseDN       = "ou=people,dc=example,dc=org"
+	testBindDN       = "cn=pfss,dc=example,dc=org"
+	testBindPassword = "service-secret"
+)
+
+// testEntry is a user of testLDAPServer
+type testEntry struct {
+	password string
+	groups   []string
+	// broken makes searches for the user fail
+	broken bool
+}
+
+// testLDAPServer is a minimal LDAP server answering simple binds and
+// (uid=...) searches below testBaseDN
+type testLDAPServer struct {
+	listener    net.Listener
+	users       map[string]testEntry
+	connections atomic.Int32
+	wg          sync.WaitGroup
+}
+
+func newTestLDAPServer(t *testing.T, users map[string]testEntry) *testLDAPServer {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &testLDAPServer{listener: listener, users: users}
+	s.wg.Add(1)
+	go s.serve()
+	t.Cleanup(func() {
+		listener.Close()
+		s.wg.Wait()
+	})
+	return s
+}
+
+func (s *testLDAPServer) url() string {
+	return "ldap://" + s.listener.Addr().String()
+}
+
+func (s *testLDAPServer) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.connections.Add(1)
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer conn.Close()
+			s.handle(conn)
+		}()
+	}
+}
+
+func (s *testLDAPServer) handle(conn net.Conn) {
+	for {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		id := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			dn := op.Children[1].Value.(string)
+			password := op.Children[2].Data.String()
+			code := ldap.LDAPResultInvalidCredentials
+			if dn == testBindDN && password == testBindPassword {
+				code = ldap.LDAPResultSuccess
+			}
+			for uid, entry := range s.users {
+				if dn == testUserDN(uid) && password == entry.password {
+					code = ldap.LDAPResultSuccess
+				}
+			}
+			writeLDAPResult(conn, id, ldap.ApplicationBindResponse, code)
+		case ldap.ApplicationSearchRequest:
+			filter, err := ldap.DecompileFilter(op.Children[6])
+			if err != nil {
+				writeLDAPResult(conn, id, ldap.ApplicationSearchResultDone, ldap.LDAPResultProtocolError)
+				continue
+			}
+			uid := strings.TrimSuffix(strings.TrimPrefix(filter, "(uid="), ")")
+			entry, ok := s.users[uid]
+			if ok && entry.broken {
+				writeLDAPResult(conn, id, ldap.ApplicationSearchResultDone, ldap.LDAPResultOther)
+				continue
+			}
+			if ok {
+				writeLDAPEntry(conn, id, uid, entry.groups)
+			}
+			writeLDAPResult(conn, id, ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess)
+		case ldap.ApplicationUnbindRequest:
+			return
+		default:
+			return
+		}
+	}
+}
+
+func testUserDN(uid string) string {
+	return "uid=" + uid + "," + testBaseDN
+}
+
+func ldapMessage(id int64, op *ber.Packet) []byte {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "MessageID"))
+	packet.AppendChild(op)
+	return packet.Bytes()
+}
+
+func writeLDAPResult(conn net.Conn, id int64, tag ber.Tag, code int) {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Result")
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), "resultCode"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "matchedDN"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "diagnosticMessage"))
+	conn.Write(ldapMessage(id, op))
+}
+
+func writeLDAPEntry(conn net.Conn, id int64, uid string, groups []string) {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Entry")
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, testUserDN(uid), "objectName"))
+	attributes := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "attributes")
+	for name, values := range map[string][]string{"uid": {uid}, "memberOf": groups} {
+		attribute := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "attribute")
+		attribute.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "type"))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "vals")
+		for _, value := range values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, "value"))
+		}
+		attribute.AppendChild(set)
+		attributes.AppendChild(attribute)
+	}
+	op.AppendChild(attributes)
+	conn.Write(ldapMessage(id, op))
+}
+
+func newTestDirectory(t *testing.T, url string) *LDAPDirectory {
+	t.Helper()
+	directory, err := NewLDAPDirectory(LDAPConfig{
+		URL:          url,
+		BindDN:       testBindDN,
+		BindPassword: testBindPassword,
+		BaseDN:       testBaseDN,
+		Timeout:      2 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return directory
+}
+
+func newTestAuthService(t *testing.T, directory Directory) *AuthService {
+	t.Helper()
+	util.ConfigureJWT("test-secret", time.Hour)
+	db := openTestDB(t)
+	guard := NewLoginGuard(NewMemoryAttemptStore(time.Minute), NewAuditService(db), LoginGuardConfig{
+		MaxUserFailures: 100,
+		MaxIPFailures:   100,
+		LockoutDuration: time.Minute,
+	})
+	return NewAuthService(db, guard, NewAuditService(db), AuthConfig{Directory: directory})
+}
+
+func TestLDAPAuthenticate(t *testing.T) {
+	server := newTestLDAPServer(t, map[string]testEntry{
+		"alice": {password: "alice-secret", groups: []string{"cn=staff,ou=groups,dc=example,dc=org"}},
+	})
+	directory := newTestDirectory(t, server.url())
+
+	user, err := directory.Authenticate("alice", "alice-secret")
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if user.DN != testUserDN("alice") || user.Username != "alice" || len(user.Groups) != 1 {
+		t.Errorf("unexpected directory user %+v", user)
+	}
+
+	if _, err := directory.Authenticate("alice", "wrong"); !errors.Is(err, ErrDirectoryInvalidCredentials) {
+		t.Errorf("wrong password: got %v, want ErrDirectoryInvalidCredentials", err)
+	}
+	if _, err := directory.Authenticate("bob", "bob-secret"); !errors.Is(err, ErrDirectoryUserNotFound) {
+		t.Errorf("unknown user: got %v, want ErrDirectoryUserNotFound", err)
+	}
+}
+
+func TestLoginFallsBackToLocalAccountsWhileDirectoryIsDown(t *testing.T) {
+	// A listener that was closed again leaves a port nobody answers on
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := "ldap://" + listener.Addr().String()
+	listener.Close()
+
+	auth := newTestAuthService(t, newTestDirectory(t, url))
+	createTestUser(t, auth.db, "root", "root-secret", true)
+	alice := createTestUser(t, auth.db, "alice", "alice-secret", false)
+	if err := auth.db.Create(&model.UserIdentity{UserID: alice.ID, Provider: ldapProvider, Subject: "alice"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := auth.Login(&model.LoginRequest{Username: "root", Password: "root-secret"}, "127.0.0.1")
+	if err != nil {
+		t.Fatalf("local root login: %v", err)
+	}
+	if resp.Username != "root" {
+		t.Errorf("logged in as %q, want root", resp.Username)
+	}
+
+	for _, req := range []model.LoginRequest{
+		{Username: "alice", Password: "alice-secret"},
+		{Username: "root", Password: "wrong"},
+		{Username: "nobody", Password: "secret"},
+	} {
+		_, err := auth.Login(&req, "127.0.0.1")
+		if !errors.Is(err, ErrLoginUnavailable) {
+			t.Errorf("login as %s: got %v, want ErrLoginUnavailable", req.Username, err)
+		}
+		if err != nil && strings.Contains(strings.ToLower(err.Error()), "ldap") {
+			t.Errorf("login as %s: error %q reveals directory details", req.Username, err)
+		}
+	}
+}
+
+func TestLoginWithDirectory(t *testing.T) {
+	server := newTestLDAPServer(t, map[string]testEntry{
+		"alice": {password: "alice-secret"},
+	})
+	auth := newTestAuthService(t, newTestDirectory(t, server.url()))
+	auth.config.DirectoryProvision = true
+
+	resp, err := auth.Login(&model.LoginRequest{Username: "alice", Password: "alice-secret"}, "127.0.0.1")
+	if err != nil {
+		t.Fatalf("directory login: %v", err)
+	}
+	if resp.Token == nil || resp.Token.Token == "" {
+		t.Error("directory login returned no token")
+	}
+
+	if _, err := auth.Login(&model.LoginRequest{Username: "alice", Password: "wrong"}, "127.0.0.1"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("wrong directory password: got %v, want ErrInvalidCredentials", err)
+	}
+}
+
+func TestSyncDirectory(t *testing.T) {
+	server := newTestLDAPServer(t, map[string]testEntry{
+		"alice": {password: "alice-secret"},
+		"carol": {password: "carol-secret", broken: true},
+	})
+	auth := newTestAuthService(t, newTestDirectory(t, server.url()))
+
+	users := make(map[string]*model.User)
+	for _, name := range []string{"alice", "carol", "dave", "erin"} {
+		users[name] = createTestUser(t, auth.db, name, name+"-secret", false)
+		if err := auth.db.Create(&model.UserIdentity{UserID: users[name].ID, Provider: ldapProvider, Subject: name}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := auth.SyncDirectory(); err != nil {
+		t.Fatalf("SyncDirectory: %v", err)
+	}
+
+	want := map[string]string{
+		// Present in the directory
+		"alice": "active",
+		// The lookup failed, so the user is skipped rather than deactivated
+		"carol": "active",
+		// Removed from the directory
+		"dave": "inactive",
+		"erin": "inactive",
+	}
+	for name, status := range want {
+		var user model.User
+		if err := auth.db.First(&user, users[name].ID).Error; err != nil {
+			t.Fatal(err)
+		}
+		if user.Status != status {
+			t.Errorf("%s is %s, want %s", name, user.Status, status)
+		}
+	}
+
+	if n := server.connections.Load(); n != 1 {
+		t.Errorf("sync opened %d connections, want 1", n)
+	}
+}
@@ -0,0 +1,360 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"path"
+	"time"
+	"unicode/utf8"
+
+	"github.com/minorcell/pfss/internal/authz"
+	"github.com/minorcell/pfss/internal/model"
+	"gorm.io/gorm"
+)
+
+// Lifecycle action reasons
+const (
+	LifecycleExpired           = "expired"
+	LifecycleNoncurrentVersion = "noncurrent_version"
+	LifecycleIncompleteUpload  = "incomplete_upload"
+)
+
+// LifecycleService manages and applies bucket lifecycle rules
+type LifecycleService struct {
+	db           *gorm.DB
+	authz        *authz.Authorizer
+	fileService  *FileService
+	auditService *AuditService
+}
+
+// NewLifecycleService creates a new lifecycle service
+func NewLifecycleService(db *gorm.DB, authorizer *authz.Authorizer, fileService *FileService, auditService *AuditService) *LifecycleService {
+	return &LifecycleService{db: db, authz: authorizer, fileService: fileService, auditService: auditService}
+}
+
+// GetRules returns the lifecycle rules of a bucket
+func (s *LifecycleService) GetRules(ctx context.Context, bucketID uint, userID uint, isRoot bool) ([]model.LifecycleRule, error) {
+	// Check permissions
+	if err := s.authz.Require(ctx, authz.Subject{UserID: userID, IsRoot: isRoot}, authz.ActionAdmin, authz.Bucket(bucketID)); err != nil {
+		return nil, err
+	}
+
+	var rules []model.LifecycleRule
+	if err := s.db.WithContext(ctx).Where("bucket_id = ?", bucketID).Order("id").Find(&rules).Error; err != nil {
+		return nil, err
+	}
+
+	return rules, nil
+}
+
+// CreateRule adds a lifecycle rule to a bucket
+func (s *LifecycleService) CreateRule(ctx context.Context, bucketID uint, req *model.LifecycleRuleRequest, userID uint, isRoot bool) (*model.LifecycleRule, error) {
+	// Check permissions
+	if err := s.authz.Require(ctx, authz.Subject{UserID: userID, IsRoot: isRoot}, authz.ActionAdmin, authz.Bucket(bucketID)); err != nil {
+		return nil, err
+	}
+
+	if _, err := s.fileService.bucketService.getBucket(ctx, bucketID); err != nil {
+		return nil, err
+	}
+
+	rule := &model.LifecycleRule{BucketID: bucketID, CreatedBy: userID}
+	if err := applyLifecycleRequest(rule, req); err != nil {
+		return nil, err
+	}
+	// Select all fields so a disabled rule is not replaced by the column default
+	if err := s.db.WithContext(ctx).Select("*").Omit("id", "deleted_at").Create(rule).Error; err != nil {
+		return nil, err
+	}
+
+	return rule, nil
+}
+
+// UpdateRule replaces a lifecycle rule of a bucket
+func (s *LifecycleService) UpdateRule(ctx context.Context, bucketID, ruleID uint, req *model.LifecycleRuleRequest, userID uint, isRoot bool) (*model.LifecycleRule, error) {
+	// Check permissions
+	if err := s.authz.Require(ctx, authz.Subject{UserID: userID, IsRoot: isRoot}, authz.ActionAdmin, authz.Bucket(bucketID)); err != nil {
+		return nil, err
+	}
+
+	var rule model.LifecycleRule
+	if err := s.db.WithContext(ctx).Where("id = ? AND bucket_id = ?", ruleID, bucketID).First(&rule).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("lifecycle rule not found")
+		}
+		return nil, err
+	}
+
+	if err := applyLifecycleRequest(&rule, req); err != nil {
+		return nil, err
+	}
+	if err := s.db.WithContext(ctx).Save(&rule).Error; err != nil {
+		return nil, err
+	}
+
+	return &rule, nil
+}
+
+// DeleteRule removes a lifecycle rule of a bucket
+func (s *LifecycleService) DeleteRule(ctx context.Context, bucketID, ruleID uint, userID uint, isRoot bool) error {
+	// Check permissions
+	if err := s.authz.Require(ctx, authz.Subject{UserID: userID, IsRoot: isRoot}, authz.ActionAdmin, authz.Bucket(bucketID)); err != nil {
+		return err
+	}
+
+	result := s.db.WithContext(ctx).Where("id = ? AND bucket_id = ?", ruleID, bucketID).Delete(&model.LifecycleRule{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("lifecycle rule not found")
+	}
+
+	return nil
+}
+
+// DryRun reports which files the lifecycle rules would remove, without removing
+// them. A bucketID of 0 covers every bucket and requires a global bucket admin grant.
+func (s *LifecycleService) DryRun(ctx context.Context, bucketID uint, userID uint, isRoot bool) (*model.LifecycleReport, error) {
+	// Check permissions
+	res := authz.Buckets()
+	if bucketID != 0 {
+		res = authz.Bucket(bucketID)
+	}
+	if err := s.authz.Require(ctx, authz.Subject{UserID: userID, IsRoot: isRoot}, authz.ActionAdmin, res); err != nil {
+		return nil, err
+	}
+
+	return s.Apply(ctx, bucketID, true)
+}
+
+// Apply evaluates the enabled lifecycle rules of a bucket, or of every bucket
+// if bucketID is 0, and removes the matching files unless dryRun is set
+func (s *LifecycleService) Apply(ctx context.Context, bucketID uint, dryRun bool) (*model.LifecycleReport, error) {
+	now := time.Now()
+	report := &model.LifecycleReport{
+		DryRun:  dryRun,
+		RunAt:   model.JSONTime(now),
+		Actions: []model.LifecycleAction{},
+	}
+
+	query := s.db.WithContext(ctx).Where("enabled = ?", true)
+	if bucketID != 0 {
+		query = query.Where("bucket_id = ?", bucketID)
+	}
+	var rules []model.LifecycleRule
+	if err := query.Order("bucket_id, id").Find(&rules).Error; err != nil {
+		return nil, err
+	}
+
+	buckets := make(map[uint]*model.Bucket)
+	handled := make(map[uint]bool)
+	locked := make(map[uint]bool)
+	for i := range rules {
+		rule := &rules[i]
+
+		bucket, ok := buckets[rule.BucketID]
+		if !ok {
+			var err error
+			if bucket, err = s.fileService.bucketService.getBucket(ctx, rule.BucketID); err != nil {
+				// Rules of deleted buckets have nothing left to clean up
+				buckets[rule.BucketID] = nil
+				continue
+			}
+			buckets[rule.BucketID] = bucket
+		}
+		if bucket == nil {
+			continue
+		}
+
+		actions, err := s.evaluate(ctx, bucket, rule, now, locked)
+		if err != nil {
+			return report, err
+		}
+		for _, action := range actions {
+			// A file matched by several rules is only removed once
+			if handled[action.FileID] {
+				continue
+			}
+			handled[action.FileID] = true
+
+			if !dryRun {
+				removed, err := s.remove(ctx, bucket, &action, locked)
+				if err != nil {
+					return report, err
+				}
+				if !removed {
+					continue
+				}
+			}
+			report.Actions = append(report.Actions, action)
+			report.FreedBytes += action.Size
+		}
+	}
+	report.SkippedLocked = len(locked)
+
+	return report, nil
+}
+
+// RunScheduler applies the lifecycle rules of every bucket every interval until ctx is done
+func (s *LifecycleService) RunScheduler(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			report, err := s.Apply(ctx, 0, false)
+			if err != nil {
+				log.Printf("Lifecycle run failed: %v", err)
+			}
+			if report != nil && len(report.Actions) > 0 {
+				log.Printf("Lifecycle run removed %d files (%d bytes)", len(report.Actions), report.FreedBytes)
+			}
+		}
+	}
+}
+
+// evaluate returns the files of bucket that rule removes at now. Matching files
+// under object lock are never removed and are recorded in locked instead.
+func (s *LifecycleService) evaluate(ctx context.Context, bucket *model.Bucket, rule *model.LifecycleRule, now time.Time, locked map[uint]bool) ([]model.LifecycleAction, error) {
+	var actions []model.LifecycleAction
+	add := func(file *model.File, reason string) {
+		if fileLocked(file, now) {
+			locked[file.ID] = true
+			return
+		}
+		actions = append(actions, model.LifecycleAction{
+			RuleID:   rule.ID,
+			BucketID: bucket.ID,
+			FileID:   file.ID,
+			Path:     file.Path,
+			Size:     file.Size,
+			Reason:   reason,
+		})
+	}
+
+	if rule.ExpireAfterDays > 0 {
+		var files []model.File
+		if err := s.ruleFiles(ctx, rule).Where("created_at < ?", now.AddDate(0, 0, -rule.ExpireAfterDays)).
+			Find(&files).Error; err != nil {
+			return nil, err
+		}
+		for i := range files {
+			add(&files[i], LifecycleExpired)
+		}
+	}
+
+	// Uploads of the same file name into the same directory are versions of one file
+	if rule.KeepVersions > 0 {
+		var files []model.File
+		if err := s.ruleFiles(ctx, rule).Order("name, created_at DESC, id DESC").Find(&files).Error; err != nil {
+			return nil, err
+		}
+		versions := make(map[string]int)
+		for i := range files {
+			key := path.Dir(files[i].Path) + "\x00" + files[i].Name
+			versions[key]++
+			if versions[key] > rule.KeepVersions {
+				add(&files[i], LifecycleNoncurrentVersion)
+			}
+		}
+	}
+
+	// Files created without content stay pending; those pending too long are incomplete uploads
+	if rule.AbortIncompleteAfterDays > 0 {
+		var files []model.File
+		if err := s.ruleFiles(ctx, rule).Where("upload_pending = ?", true).
+			Where("created_at < ?", now.AddDate(0, 0, -rule.AbortIncompleteAfterDays)).
+			Find(&files).Error; err != nil {
+			return nil, err
+		}
+		for i := range files {
+			add(&files[i], LifecycleIncompleteUpload)
+		}
+	}
+
+	return actions, nil
+}
+
+// ruleFiles returns a query on the files of the rule's bucket matching its filters
+func (s *LifecycleService) ruleFiles(ctx context.Context, rule *model.LifecycleRule) *gorm.DB {
+	query := s.db.WithContext(ctx).Model(&model.File{}).Where("bucket_id = ?", rule.BucketID)
+	if rule.Prefix != "" {
+		query = query.Where("SUBSTR(path, 1, ?) = ?", utf8.RuneCountInString(rule.Prefix), rule.Prefix)
+	}
+	if rule.TagKey != "" {
+		query = query.Where("id IN (?)", s.db.WithContext(ctx).Model(&model.FileMetadata{}).Select("file_id").
+			Where(&model.FileMetadata{Key: rule.TagKey, Value: rule.TagValue}))
+	}
+	return query
+}
+
+// remove deletes the file of action and its content and reports whether it
+// did. The object lock is checked again when deleting, as a hold or retention
+// may have been set since the rules were evaluated; a file kept for that
+// reason is recorded in locked. A file that is gone already is skipped.
+func (s *LifecycleService) remove(ctx context.Context, bucket *model.Bucket, action *model.LifecycleAction, locked map[uint]bool) (bool, error) {
+	var file model.File
+	removed := false
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Read the path again, the file may have been moved since
+		if err := tx.First(&file, action.FileID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil
+			}
+			return err
+		}
+		result := tx.Where("legal_hold = ? AND (retain_until IS NULL OR retain_until <= ?)", false, time.Now()).
+			Delete(&model.File{}, file.ID)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			locked[file.ID] = true
+			return nil
+		}
+		removed = true
+		return tx.Where("file_id = ?", file.ID).Delete(&model.FileMetadata{}).Error
+	})
+	if err != nil || !removed {
+		return false, err
+	}
+
+	if err := s.fileService.removeObject(ctx, s.fileService.objectPath(bucket, &file)); err != nil {
+		log.Printf("Failed to remove content of file %d: %v", file.ID, err)
+	}
+
+	action.Path = file.Path
+	s.auditService.Record(&model.AuditEvent{
+		Action:     model.AuditFileExpire,
+		TargetType: authz.KindFile,
+		TargetID:   action.FileID,
+	}, action, nil, nil)
+	return true, nil
+}
+
+// applyLifecycleRequest validates a rule request and copies it onto rule
+func applyLifecycleRequest(rule *model.LifecycleRule, req *model.LifecycleRuleRequest) error {
+	if req.ExpireAfterDays == 0 && req.KeepVersions == 0 && req.AbortIncompleteAfterDays == 0 {
+		return errors.New("lifecycle rule needs at least one action")
+	}
+	if req.Prefix != "" {
+		if err := validatePathPrefix(req.Prefix); err != nil {
+			return err
+		}
+	}
+
+	rule.Name = req.Name
+	rule.Enabled = req.Enabled == nil || *req.Enabled
+	rule.Prefix = req.Prefix
+	rule.TagKey = req.TagKey
+	rule.TagValue = req.TagValue
+	rule.ExpireAfterDays = req.ExpireAfterDays
+	rule.KeepVersions = req.KeepVersions
+	rule.AbortIncompleteAfterDays = req.AbortIncompleteAfterDays
+	return nil
+}
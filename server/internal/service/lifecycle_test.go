@@ -0,0 +1,82 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/minorcell/pfss/internal/model"
+)
+
+func TestLifecycleKeepsFilesLockedAfterEvaluation(t *testing.T) {
+	files, db := newTestFileService(t, DefaultQuotaConfig())
+	lifecycle := NewLifecycleService(db, files.authz, files, files.auditService)
+	root := createTestUser(t, db, "root", "root-secret", true)
+	bucket := createTestBucket(t, db, "pfss-docs", root.ID)
+	file := createTestFile(t, files, bucket, "/old.txt", []byte("old"))
+
+	// A legal hold is placed between evaluating the rules and removing the file
+	action := model.LifecycleAction{BucketID: bucket.ID, FileID: file.ID, Path: file.Path, Reason: LifecycleExpired}
+	if err := db.Model(file).Update("legal_hold", true).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	locked := make(map[uint]bool)
+	removed, err := lifecycle.remove(context.Background(), bucket, &action, locked)
+	if err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if removed || !locked[file.ID] {
+		t.Errorf("removed = %t, locked = %t; want the file kept as locked", removed, locked[file.ID])
+	}
+	if err := db.First(&model.File{}, file.ID).Error; err != nil {
+		t.Errorf("file under legal hold was deleted: %v", err)
+	}
+}
+
+func TestLifecycleIncompleteUploads(t *testing.T) {
+	files, db := newTestFileService(t, DefaultQuotaConfig())
+	lifecycle := NewLifecycleService(db, files.authz, files, files.auditService)
+	root := createTestUser(t, db, "root", "root-secret", true)
+	bucket := createTestBucket(t, db, "pfss-docs", root.ID)
+	moved := createTestFile(t, files, bucket, "/inbox/report.txt", []byte("report"))
+	// A completed upload whose content cannot be found is not an incomplete upload
+	unreachable := createTestFile(t, files, bucket, "/inbox/lost.txt", nil)
+
+	ctx := context.Background()
+	incomplete, err := files.CreateFile(ctx, &model.FileCreateRequest{
+		BucketID: bucket.ID, Name: "upload.txt", Path: "/inbox/upload.txt", ContentType: "text/plain", Size: 6,
+	}, root.ID, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := files.UpdateFile(ctx, moved.ID, &model.FileUpdateRequest{Path: "/archive/report.txt"}, root.ID, true, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Model(&model.File{}).Where("1 = 1").Update("created_at", time.Now().AddDate(0, 0, -2)).Error; err != nil {
+		t.Fatal(err)
+	}
+	// A pending upload younger than the rule allows is kept
+	recent, err := files.CreateFile(ctx, &model.FileCreateRequest{
+		BucketID: bucket.ID, Name: "recent.txt", Path: "/inbox/recent.txt", ContentType: "text/plain", Size: 6,
+	}, root.ID, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&model.LifecycleRule{BucketID: bucket.ID, Name: "abort", Enabled: true, AbortIncompleteAfterDays: 1, CreatedBy: root.ID}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := lifecycle.Apply(ctx, bucket.ID, false)
+	if err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	if len(report.Actions) != 1 || report.Actions[0].FileID != incomplete.ID {
+		t.Errorf("got actions %+v, want only the incomplete upload %d", report.Actions, incomplete.ID)
+	}
+	for _, kept := range []*model.File{moved, unreachable, recent} {
+		if err := db.First(&model.File{}, kept.ID).Error; err != nil {
+			t.Errorf("file %s was removed: %v", kept.Path, err)
+		}
+	}
+}
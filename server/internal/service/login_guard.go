@@ -0,0 +1,382 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/minorcell/pfss/internal/authz"
+	"github.com/minorcell/pfss/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// LoginAttemptStore persists failed login attempt counters. Increment and
+// Lock must be atomic so that concurrent failures are all counted.
+type LoginAttemptStore interface {
+	// Get returns the attempt record for key, or nil if there is none
+	Get(key string) (*model.LoginAttempt, error)
+	// Increment counts a failure for key at now and returns the updated
+	// record. A lockout that ended before now starts a fresh series.
+	Increment(key string, now time.Time) (*model.LoginAttempt, error)
+	// Lock locks key until the given time and reports whether it did so;
+	// it does nothing if key is locked already
+	Lock(key string, until time.Time) (bool, error)
+	// Delete removes the attempt record for key
+	Delete(key string) error
+}
+
+// LoginGuardConfig configures brute-force protection for logins
+type LoginGuardConfig struct {
+	// MaxUserFailures is the number of failures before a username is locked
+	MaxUserFailures int
+	// MaxIPFailures is the number of failures before a client IP is locked
+	MaxIPFailures int
+	// BaseDelay is the backoff after the first failure, doubled on each further failure
+	BaseDelay time.Duration
+	// MaxDelay caps the backoff between attempts
+	MaxDelay time.Duration
+	// LockoutDuration is how long a key stays locked once the limit is reached
+	LockoutDuration time.Duration
+}
+
+// DefaultLoginGuardConfig returns the default brute-force protection settings
+func DefaultLoginGuardConfig() LoginGuardConfig {
+	return LoginGuardConfig{
+		MaxUserFailures: 5,
+		MaxIPFailures:   20,
+		BaseDelay:       time.Second,
+		MaxDelay:        30 * time.Second,
+		LockoutDuration: 15 * time.Minute,
+	}
+}
+
+// LoginLockedError is returned when a login is rejected by the guard
+type LoginLockedError struct {
+	RetryAfter time.Duration
+	Locked     bool
+}
+
+func (e *LoginLockedError) Error() string {
+	if e.Locked {
+		return fmt.Sprintf("too many failed login attempts, account temporarily locked; retry in %s", e.RetryAfter.Round(time.Second))
+	}
+	return fmt.Sprintf("too many failed login attempts; retry in %s", e.RetryAfter.Round(time.Second))
+}
+
+// LoginGuard tracks failed logins per username and per client IP and
+// applies exponential backoff and temporary lockouts
+type LoginGuard struct {
+	store        LoginAttemptStore
+	auditService *AuditService
+	config       LoginGuardConfig
+	now          func() time.Time
+}
+
+// NewLoginGuard creates a new login guard
+func NewLoginGuard(store LoginAttemptStore, auditService *AuditService, config LoginGuardConfig) *LoginGuard {
+	return &LoginGuard{
+		store:        store,
+		auditService: auditService,
+		config:       config,
+		now:          time.Now,
+	}
+}
+
+func userAttemptKey(username string) string {
+	return "user:" + username
+}
+
+func ipAttemptKey(ip string) string {
+	return "ip:" + ip
+}
+
+// Check returns a *LoginLockedError if the username or IP may not attempt a login right now
+func (g *LoginGuard) Check(username, ip string) error {
+	now := g.now()
+	var wait time.Duration
+	locked := false
+
+	for _, key := range g.keys(username, ip) {
+		attempt, err := g.store.Get(key)
+		if err != nil {
+			return err
+		}
+		if attempt == nil {
+			continue
+		}
+
+		if attempt.LockedUntil != nil && now.Before(*attempt.LockedUntil) {
+			locked = true
+			if d := attempt.LockedUntil.Sub(now); d > wait {
+				wait = d
+			}
+			continue
+		}
+
+		next := attempt.LastFailure.Add(g.backoff(attempt.Failures))
+		if now.Before(next) {
+			if d := next.Sub(now); d > wait {
+				wait = d
+			}
+		}
+	}
+
+	if wait > 0 {
+		return &LoginLockedError{RetryAfter: wait, Locked: locked}
+	}
+	return nil
+}
+
+// RecordFailure counts a failed login for the username and IP
+func (g *LoginGuard) RecordFailure(username, ip string) error {
+	now := g.now()
+
+	for _, key := range g.keys(username, ip) {
+		attempt, err := g.store.Increment(key, now)
+		if err != nil {
+			return err
+		}
+
+		limit := g.config.MaxUserFailures
+		if key == ipAttemptKey(ip) {
+			limit = g.config.MaxIPFailures
+		}
+		if limit <= 0 || attempt.Failures < limit || attempt.LockedUntil != nil {
+			continue
+		}
+
+		// Of concurrent failures reaching the limit only one locks the key
+		lockedUntil := now.Add(g.config.LockoutDuration)
+		locked, err := g.store.Lock(key, lockedUntil)
+		if err != nil {
+			return err
+		}
+		if locked {
+			g.auditService.Record(&model.AuditEvent{
+				ActorName:  username,
+				IP:         ip,
+				Action:     model.AuditLoginLockout,
+				TargetType: authz.KindUser,
+			}, nil, map[string]interface{}{
+				"key":          key,
+				"failures":     attempt.Failures,
+				"locked_until": lockedUntil,
+			}, nil)
+		}
+	}
+
+	return nil
+}
+
+// RecordSuccess clears the failure counter of the username.
+// The IP counter is kept so one valid account cannot reset it.
+func (g *LoginGuard) RecordSuccess(username string) error {
+	if username == "" {
+		return nil
+	}
+	return g.store.Delete(userAttemptKey(username))
+}
+
+// Unlock clears any lockout and failure counter for the username and/or IP
+func (g *LoginGuard) Unlock(username, ip string) error {
+	if username == "" && ip == "" {
+		return errors.New("username or ip is required")
+	}
+
+	for _, key := range g.keys(username, ip) {
+		if err := g.store.Delete(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// keys returns the attempt keys for the non-empty username and IP
+func (g *LoginGuard) keys(username, ip string) []string {
+	keys := make([]string, 0, 2)
+	if username != "" {
+		keys = append(keys, userAttemptKey(username))
+	}
+	if ip != "" {
+		keys = append(keys, ipAttemptKey(ip))
+	}
+	return keys
+}
+
+// backoff returns the delay required after the given number of failures
+func (g *LoginGuard) backoff(failures int) time.Duration {
+	if failures <= 0 || g.config.BaseDelay <= 0 {
+		return 0
+	}
+	delay := g.config.BaseDelay
+	for i := 1; i < failures; i++ {
+		delay *= 2
+		if g.config.MaxDelay > 0 && delay >= g.config.MaxDelay {
+			return g.config.MaxDelay
+		}
+	}
+	return delay
+}
+
+// memorySweepInterval is how often MemoryAttemptStore evicts expired records
+const memorySweepInterval = time.Minute
+
+// MemoryAttemptStore keeps login attempts in process memory. Records whose
+// lockout has run out, or that saw no failure for maxAge, are evicted.
+type MemoryAttemptStore struct {
+	mu        sync.Mutex
+	attempts  map[string]model.LoginAttempt
+	maxAge    time.Duration
+	lastSweep time.Time
+}
+
+// NewMemoryAttemptStore creates a new in-memory attempt store that forgets
+// failures after maxAge without further failures
+func NewMemoryAttemptStore(maxAge time.Duration) *MemoryAttemptStore {
+	return &MemoryAttemptStore{attempts: make(map[string]model.LoginAttempt), maxAge: maxAge}
+}
+
+// Get returns the attempt record for key
+func (s *MemoryAttemptStore) Get(key string) (*model.LoginAttempt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attempt, ok := s.attempts[key]
+	if !ok {
+		return nil, nil
+	}
+	return &attempt, nil
+}
+
+// Increment counts a failure for key
+func (s *MemoryAttemptStore) Increment(key string, now time.Time) (*model.LoginAttempt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep(now)
+
+	attempt, ok := s.attempts[key]
+	if !ok {
+		attempt = model.LoginAttempt{Key: key, CreatedAt: now}
+	}
+	// A lockout that has run out starts a fresh series
+	if attempt.LockedUntil != nil && !now.Before(*attempt.LockedUntil) {
+		attempt.Failures = 0
+		attempt.LockedUntil = nil
+	}
+	attempt.Failures++
+	attempt.LastFailure = now
+	attempt.UpdatedAt = now
+
+	s.attempts[key] = attempt
+	return &attempt, nil
+}
+
+// Lock locks key until the given time unless it is locked already
+func (s *MemoryAttemptStore) Lock(key string, until time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attempt, ok := s.attempts[key]
+	if !ok || attempt.LockedUntil != nil {
+		return false, nil
+	}
+	attempt.LockedUntil = &until
+	s.attempts[key] = attempt
+	return true, nil
+}
+
+// sweep evicts expired records at most once per memorySweepInterval.
+// s.mu must be held.
+func (s *MemoryAttemptStore) sweep(now time.Time) {
+	if s.maxAge <= 0 || now.Sub(s.lastSweep) < memorySweepInterval {
+		return
+	}
+	s.lastSweep = now
+
+	for key, attempt := range s.attempts {
+		// The next failure would reset a record whose lockout has run out
+		expired := !now.Before(attempt.LastFailure.Add(s.maxAge))
+		if attempt.LockedUntil != nil {
+			expired = !now.Before(*attempt.LockedUntil)
+		}
+		if expired {
+			delete(s.attempts, key)
+		}
+	}
+}
+
+// Delete removes the attempt record for key
+func (s *MemoryAttemptStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.attempts, key)
+	return nil
+}
+
+// DBAttemptStore keeps login attempts in the database so that
+// counters are shared between replicas and survive restarts
+type DBAttemptStore struct {
+	db *gorm.DB
+}
+
+// NewDBAttemptStore creates a new database-backed attempt store
+func NewDBAttemptStore(db *gorm.DB) *DBAttemptStore {
+	return &DBAttemptStore{db: db}
+}
+
+// Get returns the attempt record for key
+func (s *DBAttemptStore) Get(key string) (*model.LoginAttempt, error) {
+	var attempt model.LoginAttempt
+	if err := s.db.Where(&model.LoginAttempt{Key: key}).First(&attempt).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &attempt, nil
+}
+
+// Increment counts a failure for key with an upsert, so that failures on
+// other replicas are not overwritten
+func (s *DBAttemptStore) Increment(key string, now time.Time) (*model.LoginAttempt, error) {
+	// A lockout that has run out starts a fresh series
+	if err := s.db.Model(&model.LoginAttempt{}).
+		Where(&model.LoginAttempt{Key: key}).
+		Where("locked_until IS NOT NULL AND locked_until <= ?", now).
+		Updates(map[string]interface{}{"failures": 0, "locked_until": nil}).Error; err != nil {
+		return nil, err
+	}
+
+	attempt := &model.LoginAttempt{Key: key, Failures: 1, LastFailure: now, CreatedAt: now, UpdatedAt: now}
+	if err := s.db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "key"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"failures":     gorm.Expr("login_attempts.failures + 1"),
+			"last_failure": now,
+			"updated_at":   now,
+		}),
+	}).Create(attempt).Error; err != nil {
+		return nil, err
+	}
+
+	// Read the counter back, as the upsert does not return it on every database
+	return s.Get(key)
+}
+
+// Lock locks key until the given time unless it is locked already
+func (s *DBAttemptStore) Lock(key string, until time.Time) (bool, error) {
+	result := s.db.Model(&model.LoginAttempt{}).
+		Where(&model.LoginAttempt{Key: key}).
+		Where("locked_until IS NULL").
+		Update("locked_until", until)
+	return result.RowsAffected > 0, result.Error
+}
+
+// Delete removes the attempt record for key
+func (s *DBAttemptStore) Delete(key string) error {
+	return s.db.Where(&model.LoginAttempt{Key: key}).Delete(&model.LoginAttempt{}).Error
+}
@@ -0,0 +1,133 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/minorcell/pfss/internal/model"
+	"gorm.io/gorm"
+)
+
+func TestLoginGuardCountsConcurrentFailures(t *testing.T) {
+	stores := map[string]func(db *gorm.DB) LoginAttemptStore{
+		"memory":   func(*gorm.DB) LoginAttemptStore { return NewMemoryAttemptStore(time.Hour) },
+		"database": func(db *gorm.DB) LoginAttemptStore { return NewDBAttemptStore(db) },
+	}
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			db := openTestDB(t)
+			store := newStore(db)
+			guard := NewLoginGuard(store, NewAuditService(db), LoginGuardConfig{
+				MaxUserFailures: 5,
+				MaxIPFailures:   100,
+				LockoutDuration: time.Minute,
+			})
+
+			const failures = 20
+			var wg sync.WaitGroup
+			errs := make(chan error, failures)
+			for i := 0; i < failures; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					errs <- guard.RecordFailure("alice", fmt.Sprintf("10.0.0.%d", i))
+				}(i)
+			}
+			wg.Wait()
+			close(errs)
+			for err := range errs {
+				if err != nil {
+					t.Fatalf("RecordFailure: %v", err)
+				}
+			}
+
+			attempt, err := store.Get(userAttemptKey("alice"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if attempt == nil || attempt.Failures != failures {
+				t.Fatalf("got %+v, want %d failures", attempt, failures)
+			}
+			if attempt.LockedUntil == nil {
+				t.Error("alice is not locked")
+			}
+
+			var locked *LoginLockedError
+			if err := guard.Check("alice", "10.0.1.1"); !errors.As(err, &locked) || !locked.Locked {
+				t.Errorf("Check: got %v, want a lockout", err)
+			}
+
+			// Of the concurrent failures reaching the limit only one locked the user
+			var lockouts int64
+			if err := db.Model(&model.AuditEvent{}).Where("action = ?", model.AuditLoginLockout).Count(&lockouts).Error; err != nil {
+				t.Fatal(err)
+			}
+			if lockouts != 1 {
+				t.Errorf("recorded %d lockouts, want 1", lockouts)
+			}
+		})
+	}
+}
+
+func TestLoginGuardLockoutRunsOut(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	db := openTestDB(t)
+	store := NewDBAttemptStore(db)
+	guard := NewLoginGuard(store, NewAuditService(db), LoginGuardConfig{
+		MaxUserFailures: 2,
+		LockoutDuration: time.Minute,
+	})
+	guard.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if err := guard.RecordFailure("alice", ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := guard.Check("alice", ""); err == nil {
+		t.Fatal("alice is not locked after 2 failures")
+	}
+
+	now = now.Add(2 * time.Minute)
+	if err := guard.Check("alice", ""); err != nil {
+		t.Fatalf("alice is still locked: %v", err)
+	}
+	if err := guard.RecordFailure("alice", ""); err != nil {
+		t.Fatal(err)
+	}
+	attempt, err := store.Get(userAttemptKey("alice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attempt.Failures != 1 || attempt.LockedUntil != nil {
+		t.Errorf("got %d failures, locked until %v; want a fresh series", attempt.Failures, attempt.LockedUntil)
+	}
+}
+
+func TestMemoryAttemptStoreEvictsExpiredRecords(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	store := NewMemoryAttemptStore(10 * time.Minute)
+
+	store.Increment("user:alice", now)
+	store.Increment("user:bob", now)
+	store.Lock("user:bob", now.Add(time.Hour))
+
+	store.Increment("user:carol", now.Add(15*time.Minute))
+	if attempt, _ := store.Get("user:alice"); attempt != nil {
+		t.Error("alice was not evicted")
+	}
+	if attempt, _ := store.Get("user:bob"); attempt == nil {
+		t.Error("bob was evicted while locked")
+	}
+
+	store.Increment("user:carol", now.Add(2*time.Hour))
+	if attempt, _ := store.Get("user:bob"); attempt != nil {
+		t.Error("bob was not evicted after the lockout ran out")
+	}
+	if n := len(store.attempts); n != 1 {
+		t.Errorf("store holds %d records, want 1", n)
+	}
+}
@@ -0,0 +1,205 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/minorcell/pfss/internal/authz"
+	"github.com/minorcell/pfss/internal/model"
+	"gorm.io/gorm"
+)
+
+// Retention modes
+const (
+	// RetentionGovernance can be shortened or removed by users with the bypass_governance grant
+	RetentionGovernance = "governance"
+	// RetentionCompliance cannot be shortened or removed by anyone, including root
+	RetentionCompliance = "compliance"
+)
+
+// ErrObjectLocked is wrapped by every error returned when a file is protected by object lock
+var ErrObjectLocked = errors.New("file is locked")
+
+// fileLocked reports whether file is under legal hold or retention at now
+func fileLocked(file *model.File, now time.Time) bool {
+	return file.LegalHold || (file.RetainUntil != nil && now.Before(*file.RetainUntil))
+}
+
+// checkUnlocked returns an error wrapping ErrObjectLocked if file may not be
+// deleted, overwritten or moved by sub. Governance retention is lifted when
+// bypass is requested by a user with the bypass_governance grant; legal holds
+// and compliance retention are never lifted.
+func (s *FileService) checkUnlocked(ctx context.Context, file *model.File, sub authz.Subject, bypass bool) error {
+	if file.LegalHold {
+		return fmt.Errorf("%w: file is under legal hold", ErrObjectLocked)
+	}
+	return s.checkRetention(ctx, file, sub, bypass)
+}
+
+// checkRetention returns an error wrapping ErrObjectLocked if the retention of
+// file is active and cannot be bypassed by sub
+func (s *FileService) checkRetention(ctx context.Context, file *model.File, sub authz.Subject, bypass bool) error {
+	if file.RetainUntil == nil || !time.Now().Before(*file.RetainUntil) {
+		return nil
+	}
+
+	if file.RetentionMode == RetentionGovernance && bypass {
+		ok, err := s.authz.HasGlobalGrant(ctx, sub, authz.ActionBypassGovernance, authz.KindFile)
+		if err != nil {
+			return err
+		}
+		if ok {
+			s.auditService.Record(&model.AuditEvent{
+				ActorID:    sub.UserID,
+				Action:     model.AuditRetentionBypass,
+				TargetType: authz.KindFile,
+				TargetID:   file.ID,
+			}, map[string]interface{}{
+				"retention_mode": file.RetentionMode,
+				"retain_until":   file.RetainUntil,
+			}, nil, nil)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: file is retained in %s mode until %s",
+		ErrObjectLocked, file.RetentionMode, file.RetainUntil.Format(time.RFC3339))
+}
+
+// applyDefaultRetention retains a new file according to the object lock settings of bucket
+func applyDefaultRetention(bucket *model.Bucket, file *model.File) {
+	if !bucket.ObjectLockEnabled || bucket.DefaultRetentionDays <= 0 {
+		return
+	}
+	retainUntil := time.Now().AddDate(0, 0, bucket.DefaultRetentionDays)
+	file.RetentionMode = bucket.RetentionMode
+	file.RetainUntil = &retainUntil
+}
+
+// SetRetention sets the retention of a file. Retention can always be extended;
+// shortening or removing it needs a governance bypass and is impossible in compliance mode.
+func (s *FileService) SetRetention(ctx context.Context, id uint, req *model.FileRetentionRequest, userID uint, isRoot bool, bypass bool) error {
+	ctx, span := tracer.Start(ctx, "FileService.SetRetention")
+	defer span.End()
+
+	file, err := s.GetFileByID(ctx, id, userID, isRoot)
+	if err != nil {
+		return err
+	}
+
+	// Check bucket write access
+	sub := authz.Subject{UserID: userID, IsRoot: isRoot}
+	if err := s.authz.Require(ctx, sub, authz.ActionWrite, authz.FileAt(file.BucketID, file.ID, file.Path)); err != nil {
+		return err
+	}
+
+	bucket, err := s.bucketService.getBucket(ctx, file.BucketID)
+	if err != nil {
+		return err
+	}
+	if !bucket.ObjectLockEnabled {
+		return errors.New("object lock is not enabled for this bucket")
+	}
+
+	var retainUntil *time.Time
+	if req.RetainUntil != nil {
+		t := time.Time(*req.RetainUntil)
+		if !t.After(time.Now()) {
+			return errors.New("retain_until must be in the future")
+		}
+		retainUntil = &t
+	}
+
+	// Weakening an active retention is subject to the lock itself
+	if file.RetainUntil != nil && time.Now().Before(*file.RetainUntil) {
+		weakens := retainUntil == nil || retainUntil.Before(*file.RetainUntil) ||
+			(file.RetentionMode == RetentionCompliance && req.Mode != RetentionCompliance)
+		if weakens {
+			if err := s.checkRetention(ctx, file, sub, bypass); err != nil {
+				return err
+			}
+		}
+	}
+
+	mode := req.Mode
+	if retainUntil == nil {
+		mode = ""
+	}
+	if err := s.db.WithContext(ctx).Model(file).Select("retention_mode", "retain_until").
+		Updates(&model.File{RetentionMode: mode, RetainUntil: retainUntil}).Error; err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// SetLegalHold places or releases a legal hold on a file. It requires admin access to the bucket.
+func (s *FileService) SetLegalHold(ctx context.Context, id uint, hold bool, userID uint, isRoot bool) error {
+	ctx, span := tracer.Start(ctx, "FileService.SetLegalHold")
+	defer span.End()
+
+	file, err := s.GetFileByID(ctx, id, userID, isRoot)
+	if err != nil {
+		return err
+	}
+
+	// Check bucket admin access
+	if err := s.authz.Require(ctx, authz.Subject{UserID: userID, IsRoot: isRoot}, authz.ActionAdmin, authz.Bucket(file.BucketID)); err != nil {
+		return err
+	}
+
+	bucket, err := s.bucketService.getBucket(ctx, file.BucketID)
+	if err != nil {
+		return err
+	}
+	if hold && !bucket.ObjectLockEnabled {
+		return errors.New("object lock is not enabled for this bucket")
+	}
+
+	if err := s.db.WithContext(ctx).Model(file).Update("legal_hold", hold).Error; err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// UpdateObjectLock configures the object lock of a bucket. Changes only affect
+// files created afterwards; existing retention is kept.
+func (s *BucketService) UpdateObjectLock(ctx context.Context, id uint, req *model.BucketObjectLockRequest, userID uint, isRoot bool) error {
+	ctx, span := tracer.Start(ctx, "BucketService.UpdateObjectLock")
+	defer span.End()
+
+	// Check permissions
+	if err := s.authz.Require(ctx, authz.Subject{UserID: userID, IsRoot: isRoot}, authz.ActionAdmin, authz.Bucket(id)); err != nil {
+		return err
+	}
+
+	bucket, err := s.getBucket(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	mode := req.Mode
+	if mode == "" && req.DefaultRetentionDays > 0 {
+		mode = RetentionGovernance
+	}
+
+	if err := s.db.WithContext(ctx).Model(bucket).Select("object_lock_enabled", "retention_mode", "default_retention_days").
+		Updates(&model.Bucket{
+			ObjectLockEnabled:    req.Enabled,
+			RetentionMode:        mode,
+			DefaultRetentionDays: req.DefaultRetentionDays,
+		}).Error; err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// lockedFiles returns a query on the files of a bucket that are locked at now
+func lockedFiles(db *gorm.DB, bucketID uint, now time.Time) *gorm.DB {
+	return db.Model(&model.File{}).Where("bucket_id = ?", bucketID).
+		Where("legal_hold = ? OR retain_until > ?", true, now)
+}
@@ -0,0 +1,158 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/minorcell/pfss/internal/authz"
+	"github.com/minorcell/pfss/internal/model"
+)
+
+func TestSetRetention(t *testing.T) {
+	files, db := newTestFileService(t, DefaultQuotaConfig())
+	root := createTestUser(t, db, "root", "root-secret", true)
+	alice := createTestUser(t, db, "alice", "alice-secret", false)
+	bypasser := createTestUser(t, db, "bypasser", "bypasser-secret", false)
+	bucket := createTestBucket(t, db, "pfss-locked", root.ID)
+	if err := db.Model(bucket).Update("object_lock_enabled", true).Error; err != nil {
+		t.Fatal(err)
+	}
+	createTestGrant(t, db, bucket.ID, alice.ID, 0, authz.AccessWrite, nil)
+	createTestGrant(t, db, bucket.ID, bypasser.ID, 0, authz.AccessWrite, nil)
+	if err := db.Create(&model.UserPermission{UserID: bypasser.ID, Resource: authz.KindFile, Action: authz.ActionBypassGovernance}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	days := func(n int) *time.Time {
+		t := time.Now().AddDate(0, 0, n)
+		return &t
+	}
+	tests := []struct {
+		name        string
+		mode        string // current retention
+		retainUntil *time.Time
+		user        *model.User
+		bypass      bool
+		reqMode     string
+		reqUntil    *time.Time
+		locked      bool
+		fails       bool
+	}{
+		{"set", "", nil, alice, false, RetentionGovernance, days(1), false, false},
+		{"extend governance", RetentionGovernance, days(2), alice, false, RetentionGovernance, days(3), false, false},
+		{"shorten governance without the grant", RetentionGovernance, days(2), alice, true, RetentionGovernance, days(1), true, false},
+		{"shorten governance without bypass", RetentionGovernance, days(2), bypasser, false, RetentionGovernance, days(1), true, false},
+		{"shorten governance with bypass", RetentionGovernance, days(2), bypasser, true, RetentionGovernance, days(1), false, false},
+		{"remove governance with bypass", RetentionGovernance, days(2), bypasser, true, RetentionGovernance, nil, false, false},
+		{"replace expired retention", RetentionCompliance, days(-1), alice, false, RetentionGovernance, days(1), false, false},
+		{"extend compliance", RetentionCompliance, days(2), alice, false, RetentionCompliance, days(3), false, false},
+		{"shorten compliance as root", RetentionCompliance, days(2), root, true, RetentionCompliance, days(1), true, false},
+		{"remove compliance as root", RetentionCompliance, days(2), root, true, RetentionCompliance, nil, true, false},
+		{"downgrade compliance to governance", RetentionCompliance, days(2), root, true, RetentionGovernance, days(3), true, false},
+		{"retain until the past", "", nil, alice, false, RetentionGovernance, days(-1), false, true},
+	}
+	ctx := context.Background()
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := createTestFile(t, files, bucket, "/"+string(rune('a'+i))+".txt", []byte("content"))
+			if err := db.Model(file).Select("retention_mode", "retain_until").
+				Updates(&model.File{RetentionMode: tt.mode, RetainUntil: tt.retainUntil}).Error; err != nil {
+				t.Fatal(err)
+			}
+
+			req := &model.FileRetentionRequest{Mode: tt.reqMode}
+			if tt.reqUntil != nil {
+				until := model.JSONTime(*tt.reqUntil)
+				req.RetainUntil = &until
+			}
+			err := files.SetRetention(ctx, file.ID, req, tt.user.ID, tt.user.IsRoot, tt.bypass)
+			switch {
+			case tt.locked:
+				if !errors.Is(err, ErrObjectLocked) {
+					t.Fatalf("SetRetention = %v, want %v", err, ErrObjectLocked)
+				}
+			case tt.fails:
+				if err == nil || errors.Is(err, ErrObjectLocked) {
+					t.Fatalf("SetRetention = %v, want a validation error", err)
+				}
+			case err != nil:
+				t.Fatalf("SetRetention: %v", err)
+			}
+
+			var got model.File
+			if err := db.First(&got, file.ID).Error; err != nil {
+				t.Fatal(err)
+			}
+			wantUntil := tt.reqUntil
+			if tt.locked || tt.fails {
+				wantUntil = tt.retainUntil
+			}
+			if (got.RetainUntil == nil) != (wantUntil == nil) ||
+				(wantUntil != nil && got.RetainUntil.Sub(*wantUntil).Abs() > time.Second) {
+				t.Errorf("retained until %v, want %v", got.RetainUntil, wantUntil)
+			}
+		})
+	}
+
+	var bypasses int64
+	if err := db.Model(&model.AuditEvent{}).Where("action = ? AND actor_id = ?", model.AuditRetentionBypass, bypasser.ID).Count(&bypasses).Error; err != nil {
+		t.Fatal(err)
+	}
+	if bypasses != 2 {
+		t.Errorf("recorded %d governance bypasses, want 2", bypasses)
+	}
+
+	// Retention can only be set once object lock is enabled
+	plain := createTestBucket(t, db, "pfss-plain", root.ID)
+	file := createTestFile(t, files, plain, "/a.txt", []byte("content"))
+	until := model.JSONTime(*days(1))
+	if err := files.SetRetention(ctx, file.ID, &model.FileRetentionRequest{Mode: RetentionGovernance, RetainUntil: &until}, root.ID, true, false); err == nil {
+		t.Error("retention was set in a bucket without object lock")
+	}
+}
+
+func TestLegalHold(t *testing.T) {
+	files, db := newTestFileService(t, DefaultQuotaConfig())
+	root := createTestUser(t, db, "root", "root-secret", true)
+	admin := createTestUser(t, db, "admin", "admin-secret", false)
+	alice := createTestUser(t, db, "alice", "alice-secret", false)
+	bucket := createTestBucket(t, db, "pfss-locked", root.ID)
+	if err := db.Model(bucket).Update("object_lock_enabled", true).Error; err != nil {
+		t.Fatal(err)
+	}
+	createTestGrant(t, db, bucket.ID, admin.ID, 0, authz.AccessAdmin, nil)
+	createTestGrant(t, db, bucket.ID, alice.ID, 0, authz.AccessWrite, nil)
+	file := createTestFile(t, files, bucket, "/evidence.txt", []byte("evidence"))
+
+	ctx := context.Background()
+	if err := files.SetLegalHold(ctx, file.ID, true, alice.ID, false); !errors.Is(err, authz.ErrPermissionDenied) {
+		t.Fatalf("holding without bucket admin access = %v, want %v", err, authz.ErrPermissionDenied)
+	}
+	if err := files.SetLegalHold(ctx, file.ID, true, admin.ID, false); err != nil {
+		t.Fatalf("SetLegalHold: %v", err)
+	}
+
+	// Nobody, not even root with a bypass, changes a held file
+	if err := files.DeleteFile(ctx, file.ID, root.ID, true, true); !errors.Is(err, ErrObjectLocked) {
+		t.Errorf("deleting a held file = %v, want %v", err, ErrObjectLocked)
+	}
+	if err := files.UpdateFile(ctx, file.ID, &model.FileUpdateRequest{Path: "/moved.txt"}, root.ID, true, true); !errors.Is(err, ErrObjectLocked) {
+		t.Errorf("moving a held file = %v, want %v", err, ErrObjectLocked)
+	}
+
+	// Releasing the hold is allowed even once object lock is disabled
+	if err := db.Model(bucket).Update("object_lock_enabled", false).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := files.SetLegalHold(ctx, file.ID, true, admin.ID, false); err == nil {
+		t.Error("a hold was placed in a bucket without object lock")
+	}
+	if err := files.SetLegalHold(ctx, file.ID, false, admin.ID, false); err != nil {
+		t.Fatalf("releasing the hold: %v", err)
+	}
+	if err := files.DeleteFile(ctx, file.ID, alice.ID, false, false); err != nil {
+		t.Errorf("deleting a released file: %v", err)
+	}
+}
@@ -0,0 +1,238 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/minorcell/pfss/internal/model"
+	"github.com/minorcell/pfss/pkg/util"
+	"golang.org/x/oauth2"
+)
+
+// oidcStateTTL is how long a started login may take to come back to the callback
+const oidcStateTTL = 10 * time.Minute
+
+// oidcMaxPending caps the logins awaiting their callback, so that requests
+// to the unauthenticated login endpoint cannot exhaust memory. The oldest
+// logins are dropped first.
+const oidcMaxPending = 10000
+
+// OIDCConfig configures OpenID Connect single sign-on
+type OIDCConfig struct {
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	// Scopes requested in addition to "openid"
+	Scopes []string
+	// UsernameClaim names the claim used as username for provisioned users
+	UsernameClaim string
+	// GroupsClaim names the claim listing the user's groups
+	GroupsClaim string
+	// AllowedGroups restricts login to members of these groups when not empty
+	AllowedGroups []string
+	// RootGroups grants root to members of these groups when not empty.
+	// The root flag is then kept in sync with group membership on every login.
+	RootGroups []string
+	// Provision creates PFSS users on their first login
+	Provision bool
+	// HTTPClient is used to talk to the provider, e.g. a local mock IdP in tests
+	HTTPClient *http.Client
+}
+
+// oidcPendingLogin is a login started by LoginURL awaiting its callback
+type oidcPendingLogin struct {
+	verifier  string
+	nonce     string
+	expiresAt time.Time
+}
+
+// oidcPendingState is an entry of the queue of started logins
+type oidcPendingState struct {
+	state     string
+	expiresAt time.Time
+}
+
+// OIDCService handles OpenID Connect authorization-code logins with PKCE
+type OIDCService struct {
+	authService *AuthService
+	config      OIDCConfig
+	oauth2      *oauth2.Config
+	verifier    *oidc.IDTokenVerifier
+
+	mu      sync.Mutex
+	pending map[string]oidcPendingLogin
+	// order holds the states of pending in the order they were started,
+	// which is also the order they expire in. States that completed are
+	// removed from pending only and skipped once they reach the front.
+	order      []oidcPendingState
+	maxPending int
+}
+
+// NewOIDCService discovers the provider and creates a new OIDC service
+func NewOIDCService(ctx context.Context, authService *AuthService, config OIDCConfig) (*OIDCService, error) {
+	if config.IssuerURL == "" || config.ClientID == "" || config.RedirectURL == "" {
+		return nil, errors.New("oidc issuer url, client id and redirect url are required")
+	}
+	if config.UsernameClaim == "" {
+		config.UsernameClaim = "preferred_username"
+	}
+	if config.GroupsClaim == "" {
+		config.GroupsClaim = "groups"
+	}
+	if config.HTTPClient != nil {
+		ctx = oidc.ClientContext(ctx, config.HTTPClient)
+	}
+
+	provider, err := oidc.NewProvider(ctx, config.IssuerURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover oidc provider: %w", err)
+	}
+
+	return &OIDCService{
+		authService: authService,
+		config:      config,
+		oauth2: &oauth2.Config{
+			ClientID:     config.ClientID,
+			ClientSecret: config.ClientSecret,
+			RedirectURL:  config.RedirectURL,
+			Endpoint:     provider.Endpoint(),
+			Scopes:       append([]string{oidc.ScopeOpenID}, config.Scopes...),
+		},
+		verifier:   provider.Verifier(&oidc.Config{ClientID: config.ClientID}),
+		pending:    make(map[string]oidcPendingLogin),
+		maxPending: oidcMaxPending,
+	}, nil
+}
+
+// LoginURL starts a login and returns the provider authorization URL
+func (s *OIDCService) LoginURL() (string, error) {
+	state, err := util.GenerateOneTimeToken()
+	if err != nil {
+		return "", err
+	}
+	nonce, err := util.GenerateOneTimeToken()
+	if err != nil {
+		return "", err
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	s.mu.Lock()
+	now := time.Now()
+	// Drop expired logins, and the oldest ones while the queue is full
+	for len(s.order) > 0 && (now.After(s.order[0].expiresAt) || len(s.order) >= s.maxPending) {
+		delete(s.pending, s.order[0].state)
+		s.order = s.order[1:]
+	}
+	s.pending[state] = oidcPendingLogin{
+		verifier:  verifier,
+		nonce:     nonce,
+		expiresAt: now.Add(oidcStateTTL),
+	}
+	s.order = append(s.order, oidcPendingState{state: state, expiresAt: now.Add(oidcStateTTL)})
+	s.mu.Unlock()
+
+	return s.oauth2.AuthCodeURL(state,
+		oidc.Nonce(nonce),
+		oauth2.S256ChallengeOption(verifier),
+	), nil
+}
+
+// Callback completes a login: it exchanges the code, verifies the ID token,
+// maps the identity onto a PFSS user and issues a PFSS token
+func (s *OIDCService) Callback(ctx context.Context, state, code string) (*model.AuthResponse, error) {
+	s.mu.Lock()
+	pending, ok := s.pending[state]
+	delete(s.pending, state)
+	s.mu.Unlock()
+
+	if !ok || time.Now().After(pending.expiresAt) {
+		return nil, errors.New("invalid or expired login state")
+	}
+
+	if s.config.HTTPClient != nil {
+		ctx = oidc.ClientContext(ctx, s.config.HTTPClient)
+	}
+
+	token, err := s.oauth2.Exchange(ctx, code, oauth2.VerifierOption(pending.verifier))
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange authorization code: %w", err)
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, errors.New("provider did not return an id token")
+	}
+	idToken, err := s.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("invalid id token: %w", err)
+	}
+	if idToken.Nonce != pending.nonce {
+		return nil, errors.New("invalid id token nonce")
+	}
+
+	var claims map[string]interface{}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, err
+	}
+
+	groups := claimStrings(claims[s.config.GroupsClaim])
+	if len(s.config.AllowedGroups) > 0 && !anyIn(groups, s.config.AllowedGroups) {
+		return nil, errors.New("permission denied: not a member of an allowed group")
+	}
+
+	username, _ := claims[s.config.UsernameClaim].(string)
+	if username == "" {
+		username, _ = claims["email"].(string)
+	}
+	if username == "" {
+		username = idToken.Subject
+	}
+
+	login := &externalLogin{
+		Provider:  "oidc:" + idToken.Issuer,
+		Subject:   idToken.Subject,
+		Username:  username,
+		Provision: s.config.Provision,
+	}
+	if len(s.config.RootGroups) > 0 {
+		isRoot := anyIn(groups, s.config.RootGroups)
+		login.IsRoot = &isRoot
+	}
+
+	return s.authService.loginExternal(login)
+}
+
+// claimStrings converts a string or list claim into a string slice
+func claimStrings(v interface{}) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		out := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// anyIn reports whether any of values is contained in set
+func anyIn(values, set []string) bool {
+	for _, v := range values {
+		for _, s := range set {
+			if v == s {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,259 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/minorcell/pfss/internal/model"
+)
+
+const testClientID = "pfss"
+
+// testIdP is a minimal OpenID Connect provider. Authorization codes are
+// issued by authorize instead of a login page.
+type testIdP struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]testAuthorization
+}
+
+// testAuthorization is an authorization code awaiting its exchange
+type testAuthorization struct {
+	challenge string
+	nonce     string
+	claims    jwt.MapClaims
+}
+
+func newTestIdP(t *testing.T) *testIdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &testIdP{key: key, codes: make(map[string]testAuthorization)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeTestJSON(w, map[string]interface{}{
+			"issuer":                                idp.server.URL,
+			"authorization_endpoint":                idp.server.URL + "/authorize",
+			"token_endpoint":                        idp.server.URL + "/token",
+			"jwks_uri":                              idp.server.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeTestJSON(w, map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"alg": "RS256",
+				"use": "sig",
+				"kid": "test",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", idp.token)
+
+	// TLS makes the client use the HTTPClient hook, as the default client
+	// does not trust the test certificate
+	idp.server = httptest.NewTLSServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+func writeTestJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// authorize completes the provider side of a login started with authURL
+// and returns the authorization code
+func (idp *testIdP) authorize(t *testing.T, authURL string, claims jwt.MapClaims) (state, code string) {
+	t.Helper()
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := u.Query()
+	if query.Get("client_id") != testClientID || query.Get("code_challenge_method") != "S256" {
+		t.Fatalf("unexpected authorization request %s", authURL)
+	}
+
+	code = "code-" + query.Get("state")
+	idp.mu.Lock()
+	idp.codes[code] = testAuthorization{
+		challenge: query.Get("code_challenge"),
+		nonce:     query.Get("nonce"),
+		claims:    claims,
+	}
+	idp.mu.Unlock()
+	return query.Get("state"), code
+}
+
+func (idp *testIdP) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	idp.mu.Lock()
+	auth, ok := idp.codes[r.PostForm.Get("code")]
+	delete(idp.codes, r.PostForm.Get("code"))
+	idp.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != auth.challenge {
+		w.WriteHeader(http.StatusBadRequest)
+		writeTestJSON(w, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	claims := jwt.MapClaims{
+		"iss":   idp.server.URL,
+		"aud":   testClientID,
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"nonce": auth.nonce,
+	}
+	for k, v := range auth.claims {
+		claims[k] = v
+	}
+	idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	idToken.Header["kid"] = "test"
+	signed, err := idToken.SignedString(idp.key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeTestJSON(w, map[string]interface{}{
+		"access_token": "access",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     signed,
+	})
+}
+
+func newTestOIDCService(t *testing.T, idp *testIdP, auth *AuthService) *OIDCService {
+	t.Helper()
+	oidcService, err := NewOIDCService(context.Background(), auth, OIDCConfig{
+		IssuerURL:   idp.server.URL,
+		ClientID:    testClientID,
+		RedirectURL: "https://pfss.example.org/auth/oidc/callback",
+		RootGroups:  []string{"admins"},
+		Provision:   true,
+		HTTPClient:  idp.server.Client(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return oidcService
+}
+
+func TestOIDCLogin(t *testing.T) {
+	idp := newTestIdP(t)
+	auth := newTestAuthService(t, nil)
+	oidcService := newTestOIDCService(t, idp, auth)
+
+	authURL, err := oidcService.LoginURL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, code := idp.authorize(t, authURL, jwt.MapClaims{
+		"sub":                "user-1",
+		"preferred_username": "alice",
+		"groups":             []string{"admins"},
+	})
+
+	resp, err := oidcService.Callback(context.Background(), state, code)
+	if err != nil {
+		t.Fatalf("Callback: %v", err)
+	}
+	if resp.Username != "alice" || resp.Token == nil {
+		t.Errorf("unexpected response %+v", resp)
+	}
+
+	var user model.User
+	if err := auth.db.First(&user, resp.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if !user.IsRoot {
+		t.Error("member of a root group was not made root")
+	}
+
+	// A state can be used once only
+	if _, err := oidcService.Callback(context.Background(), state, code); err == nil {
+		t.Error("replayed login state was accepted")
+	}
+}
+
+func TestOIDCLoginRejectsForeignState(t *testing.T) {
+	idp := newTestIdP(t)
+	oidcService := newTestOIDCService(t, idp, newTestAuthService(t, nil))
+
+	authURL, err := oidcService.LoginURL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, code := idp.authorize(t, authURL, jwt.MapClaims{"sub": "user-1"})
+
+	if _, err := oidcService.Callback(context.Background(), "forged", code); err == nil {
+		t.Error("unknown login state was accepted")
+	}
+}
+
+func TestOIDCPendingLoginsAreCapped(t *testing.T) {
+	idp := newTestIdP(t)
+	oidcService := newTestOIDCService(t, idp, newTestAuthService(t, nil))
+	oidcService.maxPending = 3
+
+	var states []string
+	for i := 0; i < 5; i++ {
+		authURL, err := oidcService.LoginURL()
+		if err != nil {
+			t.Fatal(err)
+		}
+		u, _ := url.Parse(authURL)
+		states = append(states, u.Query().Get("state"))
+	}
+
+	if n := len(oidcService.pending); n != 3 {
+		t.Fatalf("%d logins are pending, want 3", n)
+	}
+	for i, state := range states {
+		_, ok := oidcService.pending[state]
+		if want := i >= 2; ok != want {
+			t.Errorf("login %d pending = %t, want %t", i, ok, want)
+		}
+	}
+}
+
+func TestUniqueUsernameTruncatesByCharacter(t *testing.T) {
+	db := openTestDB(t)
+
+	base := strings.Repeat("名", 45)
+	name, err := uniqueUsername(db, base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !utf8.ValidString(name) || utf8.RuneCountInString(name) != 40 {
+		t.Errorf("got %q (%d characters), want 40 valid characters", name, utf8.RuneCountInString(name))
+	}
+}
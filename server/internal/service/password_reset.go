@@ -0,0 +1,115 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/minorcell/pfss/internal/model"
+	"github.com/minorcell/pfss/pkg/util"
+	"gorm.io/gorm"
+)
+
+// IssuePasswordReset creates a single-use password reset token for a user.
+// Any earlier unused token of the user is invalidated.
+func (s *AuthService) IssuePasswordReset(userID uint, currentUserID uint, isRoot bool) (*model.PasswordResetResponse, error) {
+	// Only root users can issue reset tokens
+	if !isRoot {
+		return nil, errors.New("permission denied")
+	}
+
+	var user model.User
+	if err := s.db.First(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("user not found")
+		}
+		return nil, err
+	}
+
+	token, err := util.GenerateOneTimeToken()
+	if err != nil {
+		return nil, err
+	}
+
+	reset := &model.PasswordResetToken{
+		UserID:    user.ID,
+		TokenHash: util.HashOneTimeToken(token),
+		CreatedBy: currentUserID,
+		ExpiresAt: time.Now().Add(s.config.PasswordResetTTL),
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND used_at IS NULL", user.ID).Delete(&model.PasswordResetToken{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(reset).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.PasswordResetResponse{
+		UserID:    user.ID,
+		Token:     token,
+		ExpiresAt: model.JSONTime(reset.ExpiresAt),
+	}, nil
+}
+
+// ResetPassword redeems a password reset token and sets the new password
+func (s *AuthService) ResetPassword(req *model.PasswordResetRequest) error {
+	var reset model.PasswordResetToken
+	err := s.db.Where("token_hash = ?", util.HashOneTimeToken(req.ResetToken)).First(&reset).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errors.New("invalid reset token")
+		}
+		return err
+	}
+
+	now := time.Now()
+	if reset.UsedAt != nil || !now.Before(reset.ExpiresAt) {
+		return errors.New("reset token has expired or was already used")
+	}
+
+	var user model.User
+	if err := s.db.First(&user, reset.UserID).Error; err != nil {
+		return err
+	}
+
+	if err := s.config.PasswordPolicy.Validate(req.NewPassword, user.Username); err != nil {
+		return err
+	}
+
+	hashedPassword, err := util.HashPassword(req.NewPassword)
+	if err != nil {
+		return err
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		// Claim the token; a concurrent redemption leaves no row to update
+		result := tx.Model(&model.PasswordResetToken{}).
+			Where("id = ? AND used_at IS NULL", reset.ID).
+			Update("used_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("reset token has expired or was already used")
+		}
+
+		return tx.Model(&user).Updates(map[string]interface{}{
+			"password":             hashedPassword,
+			"must_change_password": false,
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	// A successful reset also lifts any lockout on the account
+	if err := s.guard.Unlock(user.Username, ""); err != nil {
+		log.Printf("Failed to clear login lockout for user %d: %v", user.ID, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,325 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/minorcell/pfss/internal/authz"
+	"github.com/minorcell/pfss/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrQuotaExceeded is wrapped by every error returned when an upload would exceed a quota
+var ErrQuotaExceeded = errors.New("storage quota exceeded")
+
+// QuotaConfig configures the default quotas of users and buckets without
+// their own quota. A limit of 0 means unlimited.
+type QuotaConfig struct {
+	UserMaxBytes   int64
+	UserMaxFiles   int64
+	BucketMaxBytes int64
+	BucketMaxFiles int64
+	// WarnPercent is the share of a limit at which usage reports warn
+	WarnPercent int
+}
+
+// DefaultQuotaConfig returns the default quota settings: unlimited, warning at 80%
+func DefaultQuotaConfig() QuotaConfig {
+	return QuotaConfig{WarnPercent: 80}
+}
+
+// QuotaService handles storage quotas of users and buckets
+type QuotaService struct {
+	db     *gorm.DB
+	authz  *authz.Authorizer
+	config QuotaConfig
+}
+
+// NewQuotaService creates a new quota service
+func NewQuotaService(db *gorm.DB, authorizer *authz.Authorizer, config QuotaConfig) *QuotaService {
+	return &QuotaService{db: db, authz: authorizer, config: config}
+}
+
+// SetQuota creates or replaces the quota of a user or bucket
+func (s *QuotaService) SetQuota(ctx context.Context, scope string, targetID uint, req *model.QuotaRequest, userID uint, isRoot bool) (*model.Quota, error) {
+	// Check permissions
+	if err := s.requireManage(ctx, scope, userID, isRoot); err != nil {
+		return nil, err
+	}
+	if err := s.targetExists(ctx, scope, targetID); err != nil {
+		return nil, err
+	}
+
+	quota := &model.Quota{
+		Scope:       scope,
+		TargetID:    targetID,
+		MaxBytes:    req.MaxBytes,
+		MaxFiles:    req.MaxFiles,
+		WarnPercent: req.WarnPercent,
+		UpdatedBy:   userID,
+	}
+	err := s.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "scope"}, {Name: "target_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"max_bytes", "max_files", "warn_percent", "updated_by", "updated_at"}),
+	}).Create(quota).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return quota, nil
+}
+
+// DeleteQuota removes the quota of a user or bucket, which then falls back to the default quota
+func (s *QuotaService) DeleteQuota(ctx context.Context, scope string, targetID uint, userID uint, isRoot bool) error {
+	// Check permissions
+	if err := s.requireManage(ctx, scope, userID, isRoot); err != nil {
+		return err
+	}
+
+	result := s.db.WithContext(ctx).Where("scope = ? AND target_id = ?", scope, targetID).Delete(&model.Quota{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("quota not found")
+	}
+
+	return nil
+}
+
+// GetUsage returns the usage of a user or bucket against its quota
+func (s *QuotaService) GetUsage(ctx context.Context, scope string, targetID uint, userID uint, isRoot bool) (*model.QuotaUsage, error) {
+	// Check permissions
+	res := authz.User(targetID)
+	if scope == model.QuotaScopeBucket {
+		res = authz.Bucket(targetID)
+	}
+	if err := s.authz.Require(ctx, authz.Subject{UserID: userID, IsRoot: isRoot}, authz.ActionRead, res); err != nil {
+		return nil, err
+	}
+	if err := s.targetExists(ctx, scope, targetID); err != nil {
+		return nil, err
+	}
+
+	quota, err := s.quota(s.db.WithContext(ctx), scope, targetID)
+	if err != nil {
+		return nil, err
+	}
+	return s.usage(ctx, quota)
+}
+
+// GetQuotaReport returns the usage of every user and bucket with its own quota
+func (s *QuotaService) GetQuotaReport(ctx context.Context, userID uint, isRoot bool) ([]model.QuotaUsage, error) {
+	// Check permissions
+	sub := authz.Subject{UserID: userID, IsRoot: isRoot}
+	if err := s.authz.Require(ctx, sub, authz.ActionAdmin, authz.Users()); err != nil {
+		return nil, err
+	}
+	if err := s.authz.Require(ctx, sub, authz.ActionAdmin, authz.Buckets()); err != nil {
+		return nil, err
+	}
+
+	var quotas []model.Quota
+	if err := s.db.WithContext(ctx).Order("scope, target_id").Find(&quotas).Error; err != nil {
+		return nil, err
+	}
+
+	report := make([]model.QuotaUsage, 0, len(quotas))
+	for i := range quotas {
+		usage, err := s.usage(ctx, &quotas[i])
+		if err != nil {
+			return nil, err
+		}
+		report = append(report, *usage)
+	}
+	return report, nil
+}
+
+// CheckUpload returns an error wrapping ErrQuotaExceeded if storing size more
+// bytes in one more file would exceed the quota of the user or the bucket.
+// Otherwise it returns the number of bytes that may still be written, or -1
+// if neither quota limits bytes.
+func (s *QuotaService) CheckUpload(ctx context.Context, bucketID, userID uint, size int64) (int64, error) {
+	return s.checkUpload(s.db.WithContext(ctx), bucketID, userID, size, false)
+}
+
+// ReserveUpload checks the quotas like CheckUpload, within tx, the transaction
+// that stores the file. The user or bucket of a limited quota is locked first,
+// so concurrent uploads against the same quota are checked one after another
+// and each sees the files the others stored.
+func (s *QuotaService) ReserveUpload(tx *gorm.DB, bucketID, userID uint, size int64) (int64, error) {
+	return s.checkUpload(tx, bucketID, userID, size, true)
+}
+
+// checkUpload implements CheckUpload and ReserveUpload on db
+func (s *QuotaService) checkUpload(db *gorm.DB, bucketID, userID uint, size int64, lock bool) (int64, error) {
+	remaining := int64(-1)
+
+	targets := []struct {
+		scope string
+		id    uint
+	}{
+		{model.QuotaScopeUser, userID},
+		{model.QuotaScopeBucket, bucketID},
+	}
+	for _, target := range targets {
+		quota, err := s.quota(db, target.scope, target.id)
+		if err != nil {
+			return 0, err
+		}
+		if quota.MaxBytes == 0 && quota.MaxFiles == 0 {
+			continue
+		}
+		if lock {
+			if err := lockQuotaTarget(db, target.scope, target.id); err != nil {
+				return 0, err
+			}
+		}
+
+		usedBytes, usedFiles, err := s.used(db, target.scope, target.id)
+		if err != nil {
+			return 0, err
+		}
+		if quota.MaxFiles > 0 && usedFiles+1 > quota.MaxFiles {
+			return 0, fmt.Errorf("%w: %s file limit of %d reached", ErrQuotaExceeded, target.scope, quota.MaxFiles)
+		}
+		if quota.MaxBytes > 0 {
+			left := quota.MaxBytes - usedBytes
+			if size > left {
+				return 0, fmt.Errorf("%w: %s storage limit of %d bytes reached", ErrQuotaExceeded, target.scope, quota.MaxBytes)
+			}
+			if remaining < 0 || left < remaining {
+				remaining = left
+			}
+		}
+	}
+
+	return remaining, nil
+}
+
+// lockQuotaTarget locks the row of the user or bucket a quota refers to until
+// the end of the transaction tx. SQLite has no row locks, but serializes
+// writing transactions anyway.
+func lockQuotaTarget(tx *gorm.DB, scope string, targetID uint) error {
+	var target interface{} = &model.User{}
+	if scope == model.QuotaScopeBucket {
+		target = &model.Bucket{}
+	}
+	var id uint
+	return tx.Model(target).Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ?", targetID).Select("id").Scan(&id).Error
+}
+
+// quota returns the quota of a user or bucket, or the default quota if it has none
+func (s *QuotaService) quota(db *gorm.DB, scope string, targetID uint) (*model.Quota, error) {
+	var quota model.Quota
+	err := db.Where("scope = ? AND target_id = ?", scope, targetID).First(&quota).Error
+	if err == nil {
+		return &quota, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	quota = model.Quota{Scope: scope, TargetID: targetID}
+	if scope == model.QuotaScopeUser {
+		quota.MaxBytes, quota.MaxFiles = s.config.UserMaxBytes, s.config.UserMaxFiles
+	} else {
+		quota.MaxBytes, quota.MaxFiles = s.config.BucketMaxBytes, s.config.BucketMaxFiles
+	}
+	return &quota, nil
+}
+
+// used returns the bytes and number of files stored by a user or in a bucket
+func (s *QuotaService) used(db *gorm.DB, scope string, targetID uint) (int64, int64, error) {
+	query := db.Model(&model.File{})
+	if scope == model.QuotaScopeUser {
+		query = query.Where("created_by = ?", targetID)
+	} else {
+		query = query.Where("bucket_id = ?", targetID)
+	}
+
+	var result struct {
+		Bytes int64
+		Files int64
+	}
+	if err := query.Select("COALESCE(SUM(size), 0) AS bytes, COUNT(*) AS files").Scan(&result).Error; err != nil {
+		return 0, 0, err
+	}
+	return result.Bytes, result.Files, nil
+}
+
+// usage reports the usage against quota, warning about limits that are nearly reached
+func (s *QuotaService) usage(ctx context.Context, quota *model.Quota) (*model.QuotaUsage, error) {
+	usedBytes, usedFiles, err := s.used(s.db.WithContext(ctx), quota.Scope, quota.TargetID)
+	if err != nil {
+		return nil, err
+	}
+
+	warnPercent := quota.WarnPercent
+	if warnPercent == 0 {
+		warnPercent = s.config.WarnPercent
+	}
+
+	usage := &model.QuotaUsage{
+		Scope:       quota.Scope,
+		TargetID:    quota.TargetID,
+		UsedBytes:   usedBytes,
+		UsedFiles:   usedFiles,
+		MaxBytes:    quota.MaxBytes,
+		MaxFiles:    quota.MaxFiles,
+		WarnPercent: warnPercent,
+	}
+	if warning := quotaWarning("storage", usedBytes, quota.MaxBytes, warnPercent); warning != "" {
+		usage.Warnings = append(usage.Warnings, warning)
+	}
+	if warning := quotaWarning("file count", usedFiles, quota.MaxFiles, warnPercent); warning != "" {
+		usage.Warnings = append(usage.Warnings, warning)
+	}
+	return usage, nil
+}
+
+// quotaWarning describes used against limit once it reaches warnPercent of it
+func quotaWarning(what string, used, limit int64, warnPercent int) string {
+	if limit <= 0 {
+		return ""
+	}
+	percent := used * 100 / limit
+	switch {
+	case used >= limit:
+		return fmt.Sprintf("%s quota reached (%d of %d)", what, used, limit)
+	case warnPercent > 0 && percent >= int64(warnPercent):
+		return fmt.Sprintf("%s at %d%% of quota (%d of %d)", what, percent, used, limit)
+	}
+	return ""
+}
+
+// requireManage checks that the user may manage quotas of the scope. Bucket
+// admins may not change the quota of their own bucket, so a global grant is required.
+func (s *QuotaService) requireManage(ctx context.Context, scope string, userID uint, isRoot bool) error {
+	res := authz.Users()
+	if scope == model.QuotaScopeBucket {
+		res = authz.Buckets()
+	}
+	return s.authz.Require(ctx, authz.Subject{UserID: userID, IsRoot: isRoot}, authz.ActionAdmin, res)
+}
+
+// targetExists checks that the user or bucket a quota refers to exists
+func (s *QuotaService) targetExists(ctx context.Context, scope string, targetID uint) error {
+	var count int64
+	var err error
+	if scope == model.QuotaScopeUser {
+		err = s.db.WithContext(ctx).Model(&model.User{}).Where("id = ?", targetID).Count(&count).Error
+	} else {
+		err = s.db.WithContext(ctx).Model(&model.Bucket{}).Where("id = ?", targetID).Count(&count).Error
+	}
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return fmt.Errorf("%s not found", scope)
+	}
+	return nil
+}
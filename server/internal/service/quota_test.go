@@ -0,0 +1,82 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/minorcell/pfss/internal/model"
+	"gorm.io/gorm"
+)
+
+func TestReserveUploadCountsFilesStoredSinceTheCheck(t *testing.T) {
+	files, db := newTestFileService(t, QuotaConfig{BucketMaxBytes: 10})
+	root := createTestUser(t, db, "root", "root-secret", true)
+	bucket := createTestBucket(t, db, "pfss-docs", root.ID)
+
+	ctx := context.Background()
+	if _, err := files.quotaService.CheckUpload(ctx, bucket.ID, root.ID, 8); err != nil {
+		t.Fatalf("CheckUpload: %v", err)
+	}
+	// Another upload is stored between the check and the write
+	createTestFile(t, files, bucket, "/other.txt", []byte("other"))
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		_, err := files.quotaService.ReserveUpload(tx, bucket.ID, root.ID, 8)
+		return err
+	})
+	if !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("ReserveUpload: got %v, want ErrQuotaExceeded", err)
+	}
+}
+
+func TestDeleteFileFreesStorage(t *testing.T) {
+	files, db := newTestFileService(t, DefaultQuotaConfig())
+	root := createTestUser(t, db, "root", "root-secret", true)
+	bucket := createTestBucket(t, db, "pfss-docs", root.ID)
+	file := createTestFile(t, files, bucket, "/report.txt", []byte("report"))
+
+	ctx := context.Background()
+	if err := files.DeleteFile(ctx, file.ID, root.ID, true, false); err != nil {
+		t.Fatalf("DeleteFile: %v", err)
+	}
+
+	if _, err := os.Stat(files.objectPath(bucket, file)); !os.IsNotExist(err) {
+		t.Errorf("content of the deleted file is still stored: %v", err)
+	}
+	usage, err := files.quotaService.GetUsage(ctx, model.QuotaScopeBucket, bucket.ID, root.ID, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.UsedBytes != 0 || usage.UsedFiles != 0 {
+		t.Errorf("bucket still uses %d bytes in %d files", usage.UsedBytes, usage.UsedFiles)
+	}
+}
+
+func TestSetQuotaReplacesExistingQuota(t *testing.T) {
+	files, db := newTestFileService(t, DefaultQuotaConfig())
+	root := createTestUser(t, db, "root", "root-secret", true)
+	bucket := createTestBucket(t, db, "pfss-docs", root.ID)
+
+	ctx := context.Background()
+	for _, req := range []model.QuotaRequest{
+		{MaxBytes: 100, MaxFiles: 10},
+		{MaxBytes: 200, WarnPercent: 90},
+	} {
+		if _, err := files.quotaService.SetQuota(ctx, model.QuotaScopeBucket, bucket.ID, &req, root.ID, true); err != nil {
+			t.Fatalf("SetQuota: %v", err)
+		}
+	}
+
+	var quotas []model.Quota
+	if err := db.Where("scope = ? AND target_id = ?", model.QuotaScopeBucket, bucket.ID).Find(&quotas).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(quotas) != 1 {
+		t.Fatalf("got %d quotas, want 1", len(quotas))
+	}
+	if q := quotas[0]; q.MaxBytes != 200 || q.MaxFiles != 0 || q.WarnPercent != 90 {
+		t.Errorf("got quota %+v, want the second request", q)
+	}
+}
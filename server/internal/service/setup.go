@@ -0,0 +1,124 @@
+package service
+
+import (
+	"errors"
+	"log"
+
+	"github.com/minorcell/pfss/internal/model"
+	"github.com/minorcell/pfss/pkg/util"
+	"gorm.io/gorm"
+)
+
+// rootUsername is the username of the bootstrapped root account
+const rootUsername = "root"
+
+// BootstrapRoot makes sure a usable root account exists.
+// If passwordHash is set it becomes the root password and a change is forced on
+// first login. Otherwise a one-time setup token is generated and logged, to be
+// redeemed through CompleteSetup.
+func (s *AuthService) BootstrapRoot(passwordHash string) error {
+	var root model.User
+	err := s.db.Where("is_root = ?", true).Order("id").First(&root).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	exists := err == nil
+
+	// Nothing to do once root has a real password
+	if exists && util.IsPasswordHash(root.Password) {
+		return nil
+	}
+
+	if passwordHash != "" {
+		if !util.IsPasswordHash(passwordHash) {
+			return errors.New("root password hash is not a valid bcrypt hash")
+		}
+		if err := s.saveRootPassword(&root, exists, passwordHash, true); err != nil {
+			return err
+		}
+		log.Printf("Root account initialized from the configured password hash; a password change is required on first login")
+		return nil
+	}
+
+	// Accounts from older versions may hold a plaintext password; clear it
+	if err := s.saveRootPassword(&root, exists, "", false); err != nil {
+		return err
+	}
+
+	token, err := util.GenerateOneTimeToken()
+	if err != nil {
+		return err
+	}
+
+	s.setupMu.Lock()
+	s.setupTokenHash = util.HashOneTimeToken(token)
+	s.setupRootID = root.ID
+	s.setupMu.Unlock()
+
+	log.Printf("Root account is not configured. Complete setup with POST /api/v1/auth/setup using setup token: %s", token)
+	return nil
+}
+
+// saveRootPassword creates the root account or overwrites its password
+func (s *AuthService) saveRootPassword(root *model.User, exists bool, password string, mustChange bool) error {
+	if !exists {
+		*root = model.User{
+			Username:           rootUsername,
+			Password:           password,
+			IsRoot:             true,
+			Status:             "active",
+			MustChangePassword: mustChange,
+		}
+		return s.db.Create(root).Error
+	}
+
+	return s.db.Model(root).Updates(map[string]interface{}{
+		"password":             password,
+		"must_change_password": mustChange,
+	}).Error
+}
+
+// CompleteSetup redeems the setup token and sets the root password
+func (s *AuthService) CompleteSetup(req *model.SetupRequest) (*model.AuthResponse, error) {
+	s.setupMu.Lock()
+	defer s.setupMu.Unlock()
+
+	if s.setupTokenHash == "" {
+		return nil, errors.New("setup is not pending")
+	}
+	if !util.CompareOneTimeToken(req.SetupToken, s.setupTokenHash) {
+		return nil, errors.New("invalid setup token")
+	}
+	if err := s.config.PasswordPolicy.Validate(req.Password, rootUsername); err != nil {
+		return nil, err
+	}
+
+	hashedPassword, err := util.HashPassword(req.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only the bootstrapped root may be claimed, and only while unconfigured
+	result := s.db.Model(&model.User{}).
+		Where("id = ? AND is_root = ? AND password = ?", s.setupRootID, true, "").
+		Updates(map[string]interface{}{
+			"password":             hashedPassword,
+			"must_change_password": false,
+		})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	rootID := s.setupRootID
+	s.setupTokenHash = ""
+	s.setupRootID = 0
+	if result.RowsAffected == 0 {
+		return nil, errors.New("setup is not pending")
+	}
+
+	var root model.User
+	if err := s.db.First(&root, rootID).Error; err != nil {
+		return nil, err
+	}
+
+	return s.newAuthResponse(&root)
+}
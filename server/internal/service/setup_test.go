@@ -0,0 +1,48 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/minorcell/pfss/internal/model"
+	"github.com/minorcell/pfss/pkg/util"
+)
+
+func TestCompleteSetupClaimsOnlyTheBootstrappedRoot(t *testing.T) {
+	auth := newTestAuthService(t, nil)
+	if err := auth.BootstrapRoot(""); err != nil {
+		t.Fatalf("BootstrapRoot: %v", err)
+	}
+
+	// A root provisioned through single sign-on has no local password either
+	sso := &model.User{Username: "sso-admin", IsRoot: true, Status: "active"}
+	if err := auth.db.Create(sso).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// The token itself is only logged, so replace it with a known one
+	token, err := util.GenerateOneTimeToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth.setupTokenHash = util.HashOneTimeToken(token)
+
+	resp, err := auth.CompleteSetup(&model.SetupRequest{SetupToken: token, Password: "Correct-Horse-42"})
+	if err != nil {
+		t.Fatalf("CompleteSetup: %v", err)
+	}
+	if resp.Username != rootUsername {
+		t.Errorf("setup logged in as %q, want %q", resp.Username, rootUsername)
+	}
+
+	var got model.User
+	if err := auth.db.First(&got, sso.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got.Password != "" {
+		t.Error("setup also set the password of another root account")
+	}
+
+	if _, err := auth.CompleteSetup(&model.SetupRequest{SetupToken: token, Password: "Correct-Horse-42"}); err == nil {
+		t.Error("setup token was accepted twice")
+	}
+}
@@ -0,0 +1,181 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/minorcell/pfss/internal/model"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// partialDir is the directory below the storage path that content is written
+// to until it is complete. Bucket directories are named by bucket ID, so it
+// never collides with a bucket.
+const partialDir = ".partial"
+
+// partialUploadGrace is how long a partial upload may go unmodified before it
+// is considered abandoned, so uploads still in progress on another instance
+// sharing the storage directory are not removed
+const partialUploadGrace = time.Minute
+
+// ErrObjectExists is returned when content would replace the content of another file
+var ErrObjectExists = errors.New("file content already exists")
+
+// bucketDir returns the directory below the storage path holding the content
+// of a bucket. It is named by the bucket ID rather than its name, so renaming
+// a bucket leaves its content in place.
+func (s *FileService) bucketDir(bucketID uint) string {
+	return path.Join(s.storagePath, strconv.FormatUint(uint64(bucketID), 10))
+}
+
+// MoveLegacyBucketDirs moves bucket content that earlier releases stored in
+// directories named by bucket name to directories named by bucket ID, and
+// returns how many buckets were moved
+func (s *FileService) MoveLegacyBucketDirs(ctx context.Context) (int, error) {
+	var buckets []model.Bucket
+	if err := s.db.WithContext(ctx).Find(&buckets).Error; err != nil {
+		return 0, err
+	}
+
+	moved := 0
+	for _, bucket := range buckets {
+		// Names that are not a single path element never were a directory of their own
+		if bucket.Name != path.Base(bucket.Name) || bucket.Name == "." || bucket.Name == ".." {
+			continue
+		}
+		legacy := path.Join(s.storagePath, bucket.Name)
+		if info, err := os.Stat(legacy); err != nil || !info.IsDir() {
+			continue
+		}
+		dir := s.bucketDir(bucket.ID)
+		if _, err := os.Stat(dir); err == nil {
+			log.Printf("Not moving content of bucket %d from %s: %s exists already", bucket.ID, legacy, dir)
+			continue
+		}
+		if err := os.Rename(legacy, dir); err != nil {
+			return moved, fmt.Errorf("failed to move content of bucket %d: %v", bucket.ID, err)
+		}
+		moved++
+	}
+	return moved, nil
+}
+
+// stageObject writes the content read from r to a partial file below the
+// storage path and returns its path and the number of bytes written. The
+// write stops when ctx is done. The caller publishes the partial file with
+// publishObject and removes it afterwards in any case.
+func (s *FileService) stageObject(ctx context.Context, r io.Reader) (string, int64, error) {
+	ctx, span := tracer.Start(ctx, "storage.Write")
+	defer span.End()
+
+	staging := path.Join(s.storagePath, partialDir)
+	if err := os.MkdirAll(staging, 0755); err != nil {
+		return "", 0, spanError(span, fmt.Errorf("failed to create storage directory: %v", err))
+	}
+	dst, err := os.CreateTemp(staging, "upload-*")
+	if err != nil {
+		return "", 0, spanError(span, fmt.Errorf("failed to create destination file: %v", err))
+	}
+
+	written, err := io.Copy(dst, &contextReader{ctx: ctx, r: r})
+	span.SetAttributes(attribute.Int64("pfss.storage.bytes", written))
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(dst.Name())
+		return "", written, spanError(span, fmt.Errorf("failed to save file: %v", err))
+	}
+	return dst.Name(), written, nil
+}
+
+// publishObject makes the staged content at partialPath available at
+// filePath. Content already stored at filePath is never replaced; publishing
+// fails with ErrObjectExists instead.
+func (s *FileService) publishObject(ctx context.Context, partialPath, filePath string) error {
+	_, span := tracer.Start(ctx, "storage.Publish",
+		trace.WithAttributes(attribute.String("pfss.storage.path", filePath)))
+	defer span.End()
+
+	if err := os.MkdirAll(path.Dir(filePath), 0755); err != nil {
+		return spanError(span, fmt.Errorf("failed to create storage directory: %v", err))
+	}
+	// Unlike a rename, a link fails if the target exists
+	if err := os.Link(partialPath, filePath); err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return spanError(span, ErrObjectExists)
+		}
+		return spanError(span, fmt.Errorf("failed to save file: %v", err))
+	}
+	return nil
+}
+
+// removeObject deletes the content stored at filePath on disk. Content that
+// is already gone is not an error.
+func (s *FileService) removeObject(ctx context.Context, filePath string) error {
+	_, span := tracer.Start(ctx, "storage.Remove",
+		trace.WithAttributes(attribute.String("pfss.storage.path", filePath)))
+	defer span.End()
+
+	if err := os.Remove(filePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return spanError(span, err)
+	}
+	return nil
+}
+
+// RemovePartialUploads deletes partial files left behind by uploads that were
+// interrupted, e.g. by a crash or a shutdown that hit its deadline, and
+// returns how many were removed
+func (s *FileService) RemovePartialUploads() (int, error) {
+	entries, err := os.ReadDir(path.Join(s.storagePath, partialDir))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	removed := 0
+	cutoff := time.Now().Add(-partialUploadGrace)
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || entry.IsDir() || info.ModTime().After(cutoff) {
+			continue
+		}
+		if err := os.Remove(path.Join(s.storagePath, partialDir, entry.Name())); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Printf("Failed to remove partial upload %s: %v", entry.Name(), err)
+			continue
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// contextReader reads from r until ctx is done
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+// spanError records err on span and returns it
+func spanError(span trace.Span, err error) error {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+	return err
+}
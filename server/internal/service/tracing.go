@@ -0,0 +1,8 @@
+package service
+
+import (
+	"go.opentelemetry.io/otel"
+)
+
+// tracer creates the spans of service methods and storage calls
+var tracer = otel.Tracer("github.com/minorcell/pfss/internal/service")
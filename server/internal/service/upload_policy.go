@@ -0,0 +1,128 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"path"
+	"strings"
+
+	"github.com/minorcell/pfss/internal/model"
+)
+
+// Upload policy errors
+var (
+	// ErrFileTooLarge is wrapped by every error returned when a file exceeds the size limit
+	ErrFileTooLarge = errors.New("file too large")
+	// ErrFileTypeNotAllowed is wrapped by every error returned when a file type or extension is rejected
+	ErrFileTypeNotAllowed = errors.New("file type not allowed")
+)
+
+// maxFileBytes returns the size limit of files in bucket: the bucket limit
+// when it is set and lower than the global limit, otherwise the global limit
+func (s *FileService) maxFileBytes(bucket *model.Bucket) int64 {
+	max := s.config.MaxUploadBytes
+	if bucket.MaxFileBytes > 0 && (max <= 0 || bucket.MaxFileBytes < max) {
+		max = bucket.MaxFileBytes
+	}
+	return max
+}
+
+// checkFileSize returns an error wrapping ErrFileTooLarge if size exceeds the limit of bucket
+func (s *FileService) checkFileSize(bucket *model.Bucket, size int64) error {
+	if max := s.maxFileBytes(bucket); max > 0 && size > max {
+		return fmt.Errorf("%w: limit is %d bytes", ErrFileTooLarge, max)
+	}
+	return nil
+}
+
+// checkExtension checks the extension of name against the lists of bucket
+func checkExtension(bucket *model.Bucket, name string) error {
+	ext := strings.ToLower(path.Ext(name))
+
+	if matchesExtension(splitList(bucket.DeniedExtensions), ext) {
+		return fmt.Errorf("%w: extension %q is denied in this bucket", ErrFileTypeNotAllowed, ext)
+	}
+	allowed := splitList(bucket.AllowedExtensions)
+	if len(allowed) > 0 && !matchesExtension(allowed, ext) {
+		return fmt.Errorf("%w: extension %q is not allowed in this bucket", ErrFileTypeNotAllowed, ext)
+	}
+	return nil
+}
+
+// checkContentType checks a MIME type against the lists of bucket
+func checkContentType(bucket *model.Bucket, contentType string) error {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = strings.ToLower(strings.TrimSpace(contentType))
+	}
+
+	if matchesType(splitList(bucket.DeniedTypes), mediaType) {
+		return fmt.Errorf("%w: type %q is denied in this bucket", ErrFileTypeNotAllowed, mediaType)
+	}
+	allowed := splitList(bucket.AllowedTypes)
+	if len(allowed) > 0 && !matchesType(allowed, mediaType) {
+		return fmt.Errorf("%w: type %q is not allowed in this bucket", ErrFileTypeNotAllowed, mediaType)
+	}
+	return nil
+}
+
+// matchesType reports whether mediaType matches any of patterns, which may
+// be exact types, wildcards such as image/* or */*
+func matchesType(patterns []string, mediaType string) bool {
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(pattern)
+		if pattern == "*/*" || pattern == mediaType {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(pattern, "/*"); ok && strings.HasPrefix(mediaType, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesExtension reports whether ext, e.g. ".png", is one of extensions.
+// Extensions may be given with or without the leading dot.
+func matchesExtension(extensions []string, ext string) bool {
+	for _, e := range extensions {
+		if !strings.HasPrefix(e, ".") {
+			e = "." + e
+		}
+		if strings.EqualFold(e, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitList splits a comma separated list, dropping empty entries
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// joinList normalizes and joins items into a comma separated list
+func joinList(items []string) (string, error) {
+	var out []string
+	for _, item := range items {
+		item = strings.ToLower(strings.TrimSpace(item))
+		if item == "" {
+			continue
+		}
+		if strings.Contains(item, ",") {
+			return "", fmt.Errorf("invalid list entry %q", item)
+		}
+		out = append(out, item)
+	}
+	list := strings.Join(out, ",")
+	if len(list) > 1024 {
+		return "", errors.New("list is too long")
+	}
+	return list, nil
+}
@@ -0,0 +1,142 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/minorcell/pfss/internal/model"
+)
+
+func TestCheckFileSize(t *testing.T) {
+	tests := []struct {
+		name         string
+		globalLimit  int64
+		bucketLimit  int64
+		size         int64
+		wantTooLarge bool
+	}{
+		{"unlimited", 0, 0, 1 << 40, false},
+		{"global limit", 100, 0, 101, true},
+		{"at the global limit", 100, 0, 100, false},
+		{"bucket limit below the global limit", 100, 10, 11, true},
+		{"bucket limit above the global limit", 100, 1000, 101, true},
+		{"bucket limit without a global limit", 0, 10, 11, true},
+		{"at the bucket limit", 0, 10, 10, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := &FileService{config: FileConfig{MaxUploadBytes: tt.globalLimit}}
+			err := files.checkFileSize(&model.Bucket{MaxFileBytes: tt.bucketLimit}, tt.size)
+			if errors.Is(err, ErrFileTooLarge) != tt.wantTooLarge {
+				t.Errorf("checkFileSize(%d) = %v, want too large %t", tt.size, err, tt.wantTooLarge)
+			}
+		})
+	}
+}
+
+func TestCheckExtension(t *testing.T) {
+	tests := []struct {
+		allowed, denied string
+		name            string
+		wantAllowed     bool
+	}{
+		{"", "", "a.exe", true},
+		{"", "", "README", true},
+		{".png,.jpg", "", "a.png", true},
+		{".png,.jpg", "", "a.PNG", true},
+		{"png, jpg", "", "a.jpg", true},
+		{".png,.jpg", "", "a.gif", false},
+		{".png", "", "README", false},
+		{"", ".exe", "a.exe", false},
+		{"", ".exe", "a.EXE", false},
+		{"", ".exe", "a.exe.txt", true},
+		{".exe", ".exe", "a.exe", false},
+	}
+	for _, tt := range tests {
+		bucket := &model.Bucket{AllowedExtensions: tt.allowed, DeniedExtensions: tt.denied}
+		err := checkExtension(bucket, tt.name)
+		if err != nil && !errors.Is(err, ErrFileTypeNotAllowed) {
+			t.Errorf("checkExtension(%q) = %v, want %v", tt.name, err, ErrFileTypeNotAllowed)
+		}
+		if (err == nil) != tt.wantAllowed {
+			t.Errorf("checkExtension(%q) with allowed %q and denied %q = %v, want allowed %t",
+				tt.name, tt.allowed, tt.denied, err, tt.wantAllowed)
+		}
+	}
+}
+
+func TestCheckContentType(t *testing.T) {
+	tests := []struct {
+		allowed, denied string
+		contentType     string
+		wantAllowed     bool
+	}{
+		{"", "", "application/octet-stream", true},
+		{"image/png", "", "image/png", true},
+		{"image/png", "", "image/jpeg", false},
+		{"image/*", "", "image/jpeg", true},
+		{"image/*", "", "imagex/jpeg", false},
+		{"*/*", "image/svg+xml", "text/plain", true},
+		{"*/*", "image/svg+xml", "image/svg+xml", false},
+		{"image/*", "image/svg+xml", "image/svg+xml", false},
+		{"text/plain", "", "text/plain; charset=utf-8", true},
+		{"text/plain", "", " Text/Plain ", true},
+		{"", "text/html", "TEXT/HTML; charset=utf-8", false},
+		{"IMAGE/*", "", "image/png", true},
+	}
+	for _, tt := range tests {
+		bucket := &model.Bucket{AllowedTypes: tt.allowed, DeniedTypes: tt.denied}
+		err := checkContentType(bucket, tt.contentType)
+		if err != nil && !errors.Is(err, ErrFileTypeNotAllowed) {
+			t.Errorf("checkContentType(%q) = %v, want %v", tt.contentType, err, ErrFileTypeNotAllowed)
+		}
+		if (err == nil) != tt.wantAllowed {
+			t.Errorf("checkContentType(%q) with allowed %q and denied %q = %v, want allowed %t",
+				tt.contentType, tt.allowed, tt.denied, err, tt.wantAllowed)
+		}
+	}
+}
+
+func TestCreateFileAppliesUploadPolicy(t *testing.T) {
+	files, db := newTestFileService(t, DefaultQuotaConfig())
+	root := createTestUser(t, db, "root", "root-secret", true)
+	bucket := createTestBucket(t, db, "pfss-images", root.ID)
+
+	ctx := context.Background()
+	if err := files.bucketService.UpdateUploadPolicy(ctx, bucket.ID, &model.BucketUploadPolicyRequest{
+		MaxFileBytes:      1000,
+		AllowedTypes:      []string{" Image/* "},
+		DeniedTypes:       []string{"image/svg+xml"},
+		AllowedExtensions: []string{".PNG", ".svg"},
+	}, root.ID, true); err != nil {
+		t.Fatalf("UpdateUploadPolicy: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		contentType string
+		size        int64
+		want        error
+	}{
+		{"a.png", "image/png", 1000, nil},
+		{"b.png", "image/png", 1001, ErrFileTooLarge},
+		{"c.gif", "image/gif", 10, ErrFileTypeNotAllowed},
+		{"d.png", "text/plain", 10, ErrFileTypeNotAllowed},
+		{"e.svg", "image/svg+xml", 10, ErrFileTypeNotAllowed},
+	}
+	for _, tt := range tests {
+		_, err := files.CreateFile(ctx, &model.FileCreateRequest{
+			BucketID: bucket.ID, Name: tt.name, Path: "/" + tt.name, ContentType: tt.contentType, Size: tt.size,
+		}, root.ID, true)
+		if tt.want == nil && err != nil || tt.want != nil && !errors.Is(err, tt.want) {
+			t.Errorf("CreateFile(%s, %s, %d) = %v, want %v", tt.name, tt.contentType, tt.size, err, tt.want)
+		}
+	}
+
+	if err := files.bucketService.UpdateUploadPolicy(ctx, bucket.ID, &model.BucketUploadPolicyRequest{
+		AllowedTypes: []string{"image/png,image/gif"},
+	}, root.ID, true); err == nil {
+		t.Error("an upload policy entry containing a comma was accepted")
+	}
+}
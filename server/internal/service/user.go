@@ -1,35 +1,44 @@
 package service
 
 import (
+	"context"
 	"errors"
+	"fmt"
 
+	"github.com/minorcell/pfss/internal/authz"
 	"github.com/minorcell/pfss/internal/model"
 	"gorm.io/gorm"
 )
 
 // UserService handles user-related operations
 type UserService struct {
-	db *gorm.DB
+	db    *gorm.DB
+	authz *authz.Authorizer
 }
 
 // NewUserService creates a new user service
-func NewUserService(db *gorm.DB) *UserService {
-	return &UserService{db: db}
+func NewUserService(db *gorm.DB, authorizer *authz.Authorizer) *UserService {
+	return &UserService{db: db, authz: authorizer}
 }
 
 // GetUsers returns a list of users with pagination
-func (s *UserService) GetUsers(page, pageSize int) ([]model.User, int64, error) {
+func (s *UserService) GetUsers(ctx context.Context, page, pageSize int, currentUserID uint, isRoot bool) ([]model.User, int64, error) {
+	// Check permissions
+	if err := s.authz.Require(ctx, authz.Subject{UserID: currentUserID, IsRoot: isRoot}, authz.ActionRead, authz.Users()); err != nil {
+		return nil, 0, err
+	}
+
 	var users []model.User
 	var total int64
 
 	// Get total count
-	if err := s.db.Model(&model.User{}).Count(&total).Error; err != nil {
+	if err := s.db.WithContext(ctx).Model(&model.User{}).Count(&total).Error; err != nil {
 		return nil, 0, err
 	}
 
 	// Get users with pagination
 	offset := (page - 1) * pageSize
-	if err := s.db.Offset(offset).Limit(pageSize).Find(&users).Error; err != nil {
+	if err := s.db.WithContext(ctx).Order("id").Offset(offset).Limit(pageSize).Find(&users).Error; err != nil {
 		return nil, 0, err
 	}
 
@@ -37,51 +46,72 @@ func (s *UserService) GetUsers(page, pageSize int) ([]model.User, int64, error)
 }
 
 // GetUserByID returns a user by ID
-func (s *UserService) GetUserByID(id uint) (*model.User, error) {
+func (s *UserService) GetUserByID(ctx context.Context, id uint) (*model.User, error) {
 	var user model.User
-	if err := s.db.First(&user, id).Error; err != nil {
+	if err := s.db.WithContext(ctx).First(&user, id).Error; err != nil {
 		return nil, err
 	}
 	return &user, nil
 }
 
+// GetUser returns a user by ID if the current user may view it
+func (s *UserService) GetUser(ctx context.Context, id uint, currentUserID uint, isRoot bool) (*model.User, error) {
+	// Check permissions
+	if err := s.authz.Require(ctx, authz.Subject{UserID: currentUserID, IsRoot: isRoot}, authz.ActionRead, authz.User(id)); err != nil {
+		return nil, err
+	}
+
+	return s.GetUserByID(ctx, id)
+}
+
 // UpdateUser updates user information
-func (s *UserService) UpdateUser(id uint, updates map[string]interface{}, currentUserID uint, isRoot bool) error {
+func (s *UserService) UpdateUser(ctx context.Context, id uint, updates map[string]interface{}, currentUserID uint, isRoot bool) error {
 	// Get the user to update
-	user, err := s.GetUserByID(id)
+	user, err := s.GetUserByID(ctx, id)
 	if err != nil {
 		return err
 	}
 
 	// Check permissions
-	if !isRoot && currentUserID != id {
-		return errors.New("permission denied")
+	sub := authz.Subject{UserID: currentUserID, IsRoot: isRoot}
+	if err := s.authz.Require(ctx, sub, authz.ActionWrite, authz.User(id)); err != nil {
+		return err
 	}
 
-	// Prevent non-root users from modifying root status
+	// Prevent non-root users from modifying root status or other root users
 	if !isRoot {
 		delete(updates, "is_root")
+		if user.IsRoot && currentUserID != id {
+			return errors.New("permission denied: cannot modify a root user")
+		}
+	}
+
+	// Changing the status of an account is administrative
+	if _, ok := updates["status"]; ok {
+		if err := s.authz.Require(ctx, sub, authz.ActionAdmin, authz.User(id)); err != nil {
+			return err
+		}
 	}
 
 	// Prevent modification of sensitive fields
 	delete(updates, "password")
 	delete(updates, "id")
 
-	return s.db.Model(user).Updates(updates).Error
+	return s.db.WithContext(ctx).Model(user).Updates(updates).Error
 }
 
 // DeleteUser deletes a user
-func (s *UserService) DeleteUser(id uint, currentUserID uint, isRoot bool) error {
+func (s *UserService) DeleteUser(ctx context.Context, id uint, currentUserID uint, isRoot bool) error {
 	// Get the user to delete
-	user, err := s.GetUserByID(id)
+	user, err := s.GetUserByID(ctx, id)
 	if err != nil {
 		return err
 	}
 
 	// Check permissions
 	if !isRoot {
-		if currentUserID != id {
-			return errors.New("permission denied")
+		if err := s.authz.Require(ctx, authz.Subject{UserID: currentUserID, IsRoot: isRoot}, authz.ActionDelete, authz.User(id)); err != nil {
+			return err
 		}
 		if user.IsRoot {
 			return errors.New("cannot delete root user")
@@ -93,19 +123,30 @@ func (s *UserService) DeleteUser(id uint, currentUserID uint, isRoot bool) error
 		}
 	}
 
-	return s.db.Delete(user).Error
+	return s.db.WithContext(ctx).Delete(user).Error
 }
 
 // UpdateUserStatus updates a user's status (active/inactive)
-func (s *UserService) UpdateUserStatus(id uint, status string, currentUserID uint, isRoot bool) error {
-	// Only root users can change user status
-	if !isRoot {
-		return errors.New("permission denied")
+func (s *UserService) UpdateUserStatus(ctx context.Context, id uint, status string, currentUserID uint, isRoot bool) error {
+	// Check permissions
+	if err := s.authz.Require(ctx, authz.Subject{UserID: currentUserID, IsRoot: isRoot}, authz.ActionAdmin, authz.User(id)); err != nil {
+		return err
 	}
 
-	// Root users cannot deactivate themselves
+	// Users cannot deactivate themselves
 	if currentUserID == id {
-		return errors.New("root user cannot change their own status")
+		return errors.New("users cannot change their own status")
+	}
+
+	// Only root can change the status of a root user
+	if !isRoot {
+		target, err := s.GetUserByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		if target.IsRoot {
+			return errors.New("permission denied: cannot change the status of a root user")
+		}
 	}
 
 	// Validate status
@@ -113,27 +154,59 @@ func (s *UserService) UpdateUserStatus(id uint, status string, currentUserID uin
 		return errors.New("invalid status")
 	}
 
-	return s.db.Model(&model.User{}).Where("id = ?", id).Update("status", status).Error
+	return s.db.WithContext(ctx).Model(&model.User{}).Where("id = ?", id).Update("status", status).Error
 }
 
 // GetUserPermissions returns a list of permissions for a user
-func (s *UserService) GetUserPermissions(userID uint) ([]model.UserPermission, error) {
+func (s *UserService) GetUserPermissions(ctx context.Context, userID uint) ([]model.UserPermission, error) {
 	var permissions []model.UserPermission
-	if err := s.db.Where("user_id = ?", userID).Find(&permissions).Error; err != nil {
+	if err := s.db.WithContext(ctx).Where("user_id = ?", userID).Find(&permissions).Error; err != nil {
 		return nil, err
 	}
 	return permissions, nil
 }
 
-// UpdateUserPermissions updates a user's permissions
-func (s *UserService) UpdateUserPermissions(userID uint, permissions []model.UserPermission, currentUserID uint, isRoot bool) error {
-	// Only root users can modify permissions
-	if !isRoot {
-		return errors.New("permission denied")
+// UpdateUserPermissions replaces a user's permissions. Callers can only grant
+// or revoke permissions they hold themselves, and only root can change the
+// permissions of a root user.
+func (s *UserService) UpdateUserPermissions(ctx context.Context, userID uint, permissions []model.UserPermission, currentUserID uint, isRoot bool) error {
+	// Check permissions
+	sub := authz.Subject{UserID: currentUserID, IsRoot: isRoot}
+	if err := s.authz.Require(ctx, sub, authz.ActionAdmin, authz.Users()); err != nil {
+		return err
+	}
+
+	user, err := s.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !isRoot && user.IsRoot {
+		return fmt.Errorf("%w: cannot modify the permissions of a root user", authz.ErrPermissionDenied)
+	}
+
+	for _, perm := range permissions {
+		if !authz.ValidGrant(perm.Resource, perm.Action) {
+			return fmt.Errorf("invalid permission %s:%s", perm.Resource, perm.Action)
+		}
+	}
+
+	// Permissions that are added or revoked must be held by the caller
+	current, err := s.GetUserPermissions(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for _, perm := range changedPermissions(current, permissions) {
+		held, err := s.authz.HasGlobalGrant(ctx, sub, perm.Action, perm.Resource)
+		if err != nil {
+			return err
+		}
+		if !held {
+			return fmt.Errorf("%w: cannot grant or revoke %s:%s without holding it", authz.ErrPermissionDenied, perm.Resource, perm.Action)
+		}
 	}
 
 	// Start transaction
-	return s.db.Transaction(func(tx *gorm.DB) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		// Delete existing permissions
 		if err := tx.Where("user_id = ?", userID).Delete(&model.UserPermission{}).Error; err != nil {
 			return err
@@ -150,3 +223,22 @@ func (s *UserService) UpdateUserPermissions(userID uint, permissions []model.Use
 		return nil
 	})
 }
+
+// changedPermissions returns the permissions that are in only one of before and after
+func changedPermissions(before, after []model.UserPermission) []model.UserPermission {
+	key := func(perm model.UserPermission) string { return perm.Resource + ":" + perm.Action }
+	seen := make(map[string]int)
+	for _, perm := range before {
+		seen[key(perm)] |= 1
+	}
+	for _, perm := range after {
+		seen[key(perm)] |= 2
+	}
+	var changed []model.UserPermission
+	for _, perm := range append(before, after...) {
+		if seen[key(perm)] != 3 {
+			changed = append(changed, perm)
+		}
+	}
+	return changed
+}
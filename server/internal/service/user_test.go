@@ -0,0 +1,89 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/minorcell/pfss/internal/authz"
+	"github.com/minorcell/pfss/internal/model"
+)
+
+func TestUpdateUserPermissions(t *testing.T) {
+	db := openTestDB(t)
+	authorizer, err := authz.New(db, authz.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := NewUserService(db, authorizer)
+	root := createTestUser(t, db, "root", "root-secret", true)
+	carol := createTestUser(t, db, "carol", "carol-secret", false)
+	bob := createTestUser(t, db, "bob", "bob-secret", false)
+
+	ctx := context.Background()
+	grant := func(resource, action string) model.UserPermission {
+		return model.UserPermission{Resource: resource, Action: action}
+	}
+	// carol administers users and may read buckets; bob starts out reading files
+	if err := users.UpdateUserPermissions(ctx, carol.ID, []model.UserPermission{grant("user", "admin"), grant("bucket", "read")}, root.ID, true); err != nil {
+		t.Fatalf("root grants carol: %v", err)
+	}
+	if err := users.UpdateUserPermissions(ctx, bob.ID, []model.UserPermission{grant("file", "read")}, root.ID, true); err != nil {
+		t.Fatalf("root grants bob: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		target      uint
+		permissions []model.UserPermission
+		denied      bool
+		invalid     bool
+	}{
+		{"revoking a grant the caller does not hold", bob.ID, []model.UserPermission{grant("user", "read")}, true, false},
+		{"granting a held grant next to an unchanged one", bob.ID, []model.UserPermission{grant("file", "read"), grant("bucket", "read")}, false, false},
+		{"admin implies granting every action", bob.ID, []model.UserPermission{grant("file", "read"), grant("user", "delete")}, false, false},
+		{"granting an action not held", bob.ID, []model.UserPermission{grant("file", "read"), grant("bucket", "create")}, true, false},
+		{"granting oneself more", carol.ID, []model.UserPermission{grant("user", "admin"), grant("bucket", "admin")}, true, false},
+		{"changing root", root.ID, nil, true, false},
+		{"unknown resource", bob.ID, []model.UserPermission{grant("file", "read"), grant("server", "read")}, false, true},
+		{"unknown action", bob.ID, []model.UserPermission{grant("file", "read"), grant("user", "fly")}, false, true},
+		{"bypass outside files", bob.ID, []model.UserPermission{grant("file", "read"), grant("bucket", "bypass_governance")}, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before, err := users.GetUserPermissions(ctx, tt.target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = users.UpdateUserPermissions(ctx, tt.target, tt.permissions, carol.ID, false)
+			switch {
+			case tt.denied:
+				if !errors.Is(err, authz.ErrPermissionDenied) {
+					t.Fatalf("UpdateUserPermissions = %v, want %v", err, authz.ErrPermissionDenied)
+				}
+			case tt.invalid:
+				if err == nil || errors.Is(err, authz.ErrPermissionDenied) {
+					t.Fatalf("UpdateUserPermissions = %v, want an invalid permission error", err)
+				}
+			default:
+				if err != nil {
+					t.Fatalf("UpdateUserPermissions: %v", err)
+				}
+				return
+			}
+
+			after, err := users.GetUserPermissions(ctx, tt.target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(after) != len(before) {
+				t.Errorf("rejected update changed the permissions from %+v to %+v", before, after)
+			}
+		})
+	}
+
+	// Root holds every grant
+	if err := users.UpdateUserPermissions(ctx, bob.ID, []model.UserPermission{grant("file", "bypass_governance")}, root.ID, true); err != nil {
+		t.Errorf("root grants bypass_governance: %v", err)
+	}
+}
@@ -0,0 +1,56 @@
+package health
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// DatabaseCheck pings the database
+func DatabaseCheck(db *sql.DB) CheckFunc {
+	return func(ctx context.Context) error {
+		return db.PingContext(ctx)
+	}
+}
+
+// WritableCheck verifies that files can be created in dir
+func WritableCheck(dir string) CheckFunc {
+	return func(ctx context.Context) error {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		file, err := os.CreateTemp(dir, ".readyz-*")
+		if err != nil {
+			return err
+		}
+		name := file.Name()
+		_, err = file.Write([]byte("ok"))
+		if cerr := file.Close(); err == nil {
+			err = cerr
+		}
+		if rerr := os.Remove(name); err == nil {
+			err = rerr
+		}
+		return err
+	}
+}
+
+// FreeSpaceCheck verifies that the file system holding dir has at least minBytes available
+func FreeSpaceCheck(dir string, minBytes uint64) CheckFunc {
+	return func(ctx context.Context) error {
+		// The checks run concurrently, so the directory may not have been created yet
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		free, err := freeSpace(filepath.Clean(dir))
+		if err != nil {
+			return err
+		}
+		if free < minBytes {
+			return fmt.Errorf("%d bytes free, at least %d required", free, minBytes)
+		}
+		return nil
+	}
+}
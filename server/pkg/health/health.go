@@ -0,0 +1,126 @@
+// Package health implements liveness and readiness checks
+package health
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Check statuses
+const (
+	StatusOK       = "ok"
+	StatusFail     = "fail"
+	StatusDraining = "draining"
+)
+
+// CheckFunc checks a dependency and returns an error if it is not usable
+type CheckFunc func(ctx context.Context) error
+
+// CheckResult is the outcome of a single check
+type CheckResult struct {
+	Status    string `json:"status"`
+	LatencyMS int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Report is the outcome of a readiness check
+type Report struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks"`
+}
+
+// Checker runs the readiness checks of the server
+type Checker struct {
+	timeout  time.Duration
+	mu       sync.RWMutex
+	names    []string
+	checks   map[string]CheckFunc
+	draining atomic.Bool
+}
+
+// NewChecker creates a checker that gives each check at most timeout to complete
+func NewChecker(timeout time.Duration) *Checker {
+	return &Checker{timeout: timeout, checks: make(map[string]CheckFunc)}
+}
+
+// Add registers a readiness check under name
+func (h *Checker) Add(name string, check CheckFunc) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.checks[name]; !ok {
+		h.names = append(h.names, name)
+	}
+	h.checks[name] = check
+}
+
+// Drain marks the server as shutting down. From then on it reports not ready
+// so that load balancers stop sending new requests.
+func (h *Checker) Drain() {
+	h.draining.Store(true)
+}
+
+// Draining reports whether Drain has been called
+func (h *Checker) Draining() bool {
+	return h.draining.Load()
+}
+
+// Ready runs all checks concurrently and reports whether the server can serve
+// requests. The report is not ready if any check fails or the server is draining.
+func (h *Checker) Ready(ctx context.Context) (*Report, bool) {
+	h.mu.RLock()
+	names := append([]string(nil), h.names...)
+	checks := make([]CheckFunc, len(names))
+	for i, name := range names {
+		checks[i] = h.checks[name]
+	}
+	h.mu.RUnlock()
+
+	results := make([]CheckResult, len(names))
+	var wg sync.WaitGroup
+	for i := range checks {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = h.run(ctx, checks[i])
+		}(i)
+	}
+	wg.Wait()
+
+	report := &Report{Status: StatusOK, Checks: make(map[string]CheckResult, len(names))}
+	for i, name := range names {
+		report.Checks[name] = results[i]
+		if results[i].Status != StatusOK {
+			report.Status = StatusFail
+		}
+	}
+	if h.Draining() {
+		report.Status = StatusDraining
+	}
+	return report, report.Status == StatusOK
+}
+
+// run runs a single check with the checker's timeout
+func (h *Checker) run(ctx context.Context, check CheckFunc) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() { done <- check(ctx) }()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	result := CheckResult{Status: StatusOK, LatencyMS: time.Since(start).Milliseconds()}
+	if err != nil {
+		result.Status = StatusFail
+		result.Error = err.Error()
+	}
+	return result
+}
@@ -0,0 +1,96 @@
+// Package metrics defines the Prometheus metrics exported on /metrics
+package metrics
+
+import (
+	"database/sql"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+// namespace prefixes every metric name
+const namespace = "pfss"
+
+var (
+	// HTTPRequests counts handled requests by method, route and status
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by method, route and status.",
+	}, []string{"method", "route", "status"})
+
+	// HTTPDuration observes request latency by method, route and status
+	HTTPDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by method, route and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	// UploadBytes counts the bytes of file content stored by uploads
+	UploadBytes = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "upload_bytes_total",
+		Help:      "Bytes of file content received by uploads.",
+	})
+
+	// DownloadBytes counts the bytes of file content sent to clients
+	DownloadBytes = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "download_bytes_total",
+		Help:      "Bytes of file content sent by downloads.",
+	})
+
+	// ActiveUploads is the number of uploads currently being stored
+	ActiveUploads = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "active_uploads",
+		Help:      "Uploads currently in progress.",
+	})
+
+	// AuthFailures counts rejected authentication attempts by method
+	// (password, oidc, token) and reason
+	AuthFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "auth_failures_total",
+		Help:      "Failed authentication attempts by method and reason.",
+	}, []string{"method", "reason"})
+
+	// BucketBytes is the sampled size of the files stored in each bucket
+	BucketBytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "bucket_storage_bytes",
+		Help:      "Bytes stored per bucket, sampled periodically.",
+	}, []string{"bucket"})
+
+	// BucketFiles is the sampled number of files stored in each bucket
+	BucketFiles = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "bucket_files",
+		Help:      "Files stored per bucket, sampled periodically.",
+	}, []string{"bucket"})
+)
+
+// Registry holds the PFSS metrics together with the Go runtime, process and
+// database pool collectors
+var Registry = prometheus.NewRegistry()
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests,
+		HTTPDuration,
+		UploadBytes,
+		DownloadBytes,
+		ActiveUploads,
+		AuthFailures,
+		BucketBytes,
+		BucketFiles,
+	)
+}
+
+// RegisterDB exports the connection pool statistics of db
+func RegisterDB(db *sql.DB, name string) error {
+	return Registry.Register(collectors.NewDBStatsCollector(db, name))
+}
@@ -1,17 +1,26 @@
 package middleware
 
 import (
+	"crypto/x509"
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/minorcell/pfss/pkg/metrics"
 	"github.com/minorcell/pfss/pkg/util"
 )
 
 // AuthMiddleware validates JWT tokens and sets user information in the context
 func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		// Already authenticated by ClientCertAuth
+		if c.GetString("auth_method") == authMethodCertificate {
+			c.Next()
+			return
+		}
+
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
+			metrics.AuthFailures.WithLabelValues("token", "missing").Inc()
 			util.SendError(c, util.ErrUnauthorized)
 			c.Abort()
 			return
@@ -20,6 +29,7 @@ func AuthMiddleware() gin.HandlerFunc {
 		// Extract token from Bearer schema
 		parts := strings.Split(authHeader, " ")
 		if len(parts) != 2 || parts[0] != "Bearer" {
+			metrics.AuthFailures.WithLabelValues("token", "malformed").Inc()
 			util.SendError(c, util.NewError(401, "Invalid authorization header format"))
 			c.Abort()
 			return
@@ -28,16 +38,63 @@ func AuthMiddleware() gin.HandlerFunc {
 		// Parse and validate token
 		claims, err := util.ParseToken(parts[1])
 		if err != nil {
+			metrics.AuthFailures.WithLabelValues("token", "invalid").Inc()
 			util.SendError(c, util.NewError(401, "Invalid token: "+err.Error()))
 			c.Abort()
 			return
 		}
 
-		// Set user information in context
-		c.Set("user_id", claims.UserID)
-		c.Set("username", claims.Username)
-		c.Set("is_root", claims.IsRoot)
+		setClaims(c, claims)
+		c.Next()
+	}
+}
+
+// authMethodCertificate marks requests authenticated by a TLS client certificate
+const authMethodCertificate = "certificate"
+
+// ClientCertAuth authenticates requests that carry a verified TLS client
+// certificate and no Authorization header as the user authenticate maps the
+// certificate to. It must be registered before AuthMiddleware, which then
+// accepts these requests; other requests are left to AuthMiddleware.
+func ClientCertAuth(authenticate func(cert *x509.Certificate) (*util.Claims, error)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tlsState := c.Request.TLS
+		if c.GetHeader("Authorization") != "" || tlsState == nil || len(tlsState.VerifiedChains) == 0 {
+			c.Next()
+			return
+		}
+
+		claims, err := authenticate(tlsState.VerifiedChains[0][0])
+		if err != nil {
+			metrics.AuthFailures.WithLabelValues("certificate", "rejected").Inc()
+			util.SendError(c, util.NewError(401, "Invalid client certificate: "+err.Error()))
+			c.Abort()
+			return
+		}
+
+		setClaims(c, claims)
+		c.Set("auth_method", authMethodCertificate)
+		c.Next()
+	}
+}
 
+// setClaims sets the user information of claims in the context
+func setClaims(c *gin.Context, claims *util.Claims) {
+	c.Set("user_id", claims.UserID)
+	c.Set("username", claims.Username)
+	c.Set("is_root", claims.IsRoot)
+	c.Set("password_change_required", claims.PasswordChange)
+}
+
+// PasswordChangeEnforced rejects tokens that were issued only for a forced
+// password change. Routes registered before it remain reachable with such tokens.
+func PasswordChangeEnforced() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetBool("password_change_required") {
+			util.SendError(c, util.NewError(403, "Password change required"))
+			c.Abort()
+			return
+		}
 		c.Next()
 	}
 }
@@ -2,86 +2,285 @@ package middleware
 
 import (
 	"bytes"
-	"fmt"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
 	"io"
+	"log/slog"
+	"mime"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
 )
 
-// LoggerMiddleware logs detailed request and response information
-func LoggerMiddleware() gin.HandlerFunc {
+// RequestIDHeader carries the ID of a request in both directions
+const RequestIDHeader = "X-Request-ID"
+
+// redacted replaces the value of sensitive fields in logged bodies and query strings
+const redacted = "[REDACTED]"
+
+// DefaultRedactFields are the JSON fields and query parameters that are never
+// logged in plain text. Matching is case-insensitive.
+var DefaultRedactFields = []string{
+	"password", "current_password", "new_password", "old_password",
+	"token", "access_token", "refresh_token", "id_token", "setup_token",
+	"reset_token", "invite_token",
+	"secret", "client_secret", "authorization", "code", "state",
+}
+
+// sensitiveKeyParts redact the string value of any field or parameter whose
+// name contains one of them, so that new secrets are masked without being
+// listed in the redact fields
+var sensitiveKeyParts = []string{"password", "secret", "token"}
+
+// LoggerConfig configures the request logger
+type LoggerConfig struct {
+	// Logger receives one record per request; nil uses slog.Default()
+	Logger *slog.Logger
+	// LogBodies enables logging of request and response bodies. Only JSON
+	// bodies of at most MaxBodyBytes are logged, with RedactFields masked.
+	LogBodies    bool
+	MaxBodyBytes int64
+	RedactFields []string
+}
+
+// DefaultLoggerConfig returns the default request logger configuration
+func DefaultLoggerConfig() LoggerConfig {
+	return LoggerConfig{
+		MaxBodyBytes: 4 << 10,
+		RedactFields: append([]string(nil), DefaultRedactFields...),
+	}
+}
+
+// LoggerMiddleware logs one structured record per request with its request ID,
+// numeric status, latency and bytes in and out. Requests with a valid
+// X-Request-ID keep it; others get a new one, which is also sent back.
+func LoggerMiddleware(config LoggerConfig) gin.HandlerFunc {
+	logger := config.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	redact := make(map[string]bool, len(config.RedactFields))
+	for _, field := range config.RedactFields {
+		redact[strings.ToLower(field)] = true
+	}
+
 	return func(c *gin.Context) {
 		// Start timer
 		start := time.Now()
 
-		// Read the request body
-		var requestBody []byte
+		requestID := c.GetHeader(RequestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = newRequestID()
+		}
+		c.Set("request_id", requestID)
+		c.Header(RequestIDHeader, requestID)
+
+		// Count the request body as it is read and keep the start of small JSON bodies
+		body := &countingBody{ReadCloser: c.Request.Body}
+		if config.LogBodies && isJSON(c.GetHeader("Content-Type")) &&
+			c.Request.ContentLength >= 0 && c.Request.ContentLength <= config.MaxBodyBytes {
+			body.capture = &bytes.Buffer{}
+			body.limit = config.MaxBodyBytes
+		}
 		if c.Request.Body != nil {
-			requestBody, _ = io.ReadAll(c.Request.Body)
-			// Restore the body for later use
-			c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
+			c.Request.Body = body
 		}
 
-		// Create a custom response writer to capture the response
-		blw := &bodyLogWriter{body: bytes.NewBufferString(""), ResponseWriter: c.Writer}
-		c.Writer = blw
+		writer := &captureWriter{ResponseWriter: c.Writer}
+		if config.LogBodies {
+			writer.limit = config.MaxBodyBytes
+		}
+		c.Writer = writer
 
 		// Process request
 		c.Next()
 
-		// Calculate latency
-		latency := time.Since(start)
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		switch {
+		case status >= 500:
+			level = slog.LevelError
+		case status >= 400:
+			level = slog.LevelWarn
+		}
+
+		attrs := []slog.Attr{
+			slog.String("request_id", requestID),
+			slog.String("method", c.Request.Method),
+			slog.String("path", c.Request.URL.Path),
+			slog.Int("status", status),
+			slog.Duration("latency", time.Since(start)),
+			slog.String("ip", c.ClientIP()),
+			slog.Int64("bytes_in", body.n),
+			slog.Int("bytes_out", c.Writer.Size()),
+		}
+		if query := c.Request.URL.RawQuery; query != "" {
+			attrs = append(attrs, slog.String("query", redactQuery(query, redact)))
+		}
+		if span := trace.SpanContextFromContext(c.Request.Context()); span.IsValid() {
+			attrs = append(attrs, slog.String("trace_id", span.TraceID().String()))
+		}
+		if route := c.FullPath(); route != "" {
+			attrs = append(attrs, slog.String("route", route))
+		}
+		if userID, ok := c.Get("user_id"); ok {
+			attrs = append(attrs, slog.Any("user_id", userID))
+		}
+		if username := c.GetString("username"); username != "" {
+			attrs = append(attrs, slog.String("username", username))
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, slog.String("errors", c.Errors.String()))
+		}
+		if body.capture != nil && !body.truncated {
+			attrs = append(attrs, slog.String("request_body", redactJSON(body.capture.Bytes(), redact)))
+		}
+		if writer.capture != nil && !writer.truncated && isJSON(c.Writer.Header().Get("Content-Type")) {
+			attrs = append(attrs, slog.String("response_body", redactJSON(writer.capture.Bytes(), redact)))
+		}
+
+		logger.LogAttrs(c.Request.Context(), level, "request", attrs...)
+	}
+}
 
-		// Get user information if available
-		userID, _ := c.Get("user_id")
-		username, _ := c.Get("username")
+// countingBody counts the bytes read from a request body and captures up to limit of them
+type countingBody struct {
+	io.ReadCloser
+	n         int64
+	capture   *bytes.Buffer
+	limit     int64
+	truncated bool
+}
 
-		// Log the request details
-		gin.DefaultWriter.Write([]byte(formatLog(
-			c.Request.Method,
-			c.Request.URL.Path,
-			c.ClientIP(),
-			userID,
-			username,
-			c.Writer.Status(),
-			latency,
-			string(requestBody),
-			blw.body.String(),
-		)))
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	if b.capture != nil && !b.truncated {
+		if int64(b.capture.Len()+n) > b.limit {
+			b.truncated = true
+		} else {
+			b.capture.Write(p[:n])
+		}
 	}
+	return n, err
 }
 
-// bodyLogWriter is a custom response writer that captures the response body
-type bodyLogWriter struct {
+// captureWriter is a response writer that keeps responses of up to limit bytes
+type captureWriter struct {
 	gin.ResponseWriter
-	body *bytes.Buffer
+	capture   *bytes.Buffer
+	limit     int64
+	truncated bool
 }
 
-func (w *bodyLogWriter) Write(b []byte) (int, error) {
-	w.body.Write(b)
+func (w *captureWriter) Write(b []byte) (int, error) {
+	if w.limit > 0 && !w.truncated {
+		if w.capture == nil {
+			w.capture = &bytes.Buffer{}
+		}
+		if int64(w.capture.Len()+len(b)) > w.limit {
+			w.truncated = true
+		} else {
+			w.capture.Write(b)
+		}
+	}
 	return w.ResponseWriter.Write(b)
 }
 
-// formatLog formats the log entry
-func formatLog(method, path, clientIP interface{}, userID, username interface{}, status int, latency time.Duration, requestBody, responseBody string) string {
-	return time.Now().Format("2006/01/02 - 15:04:05") + " | " +
-		"Method: " + method.(string) + " | " +
-		"Path: " + path.(string) + " | " +
-		"IP: " + clientIP.(string) + " | " +
-		"UserID: " + formatInterface(userID) + " | " +
-		"Username: " + formatInterface(username) + " | " +
-		"Status: " + string(rune(status)) + " | " +
-		"Latency: " + latency.String() + "\n" +
-		"Request: " + requestBody + "\n" +
-		"Response: " + responseBody + "\n" +
-		"--------------------------------------------------\n"
+func (w *captureWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// isJSON reports whether a Content-Type header denotes JSON
+func isJSON(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && (mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"))
+}
+
+// redactJSON returns body with the values of redacted fields masked at any
+// depth. Bodies that are not valid JSON are not logged.
+func redactJSON(body []byte, redact map[string]bool) string {
+	if len(body) == 0 {
+		return ""
+	}
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return "[invalid JSON]"
+	}
+	data, err := json.Marshal(redactValue(v, redact))
+	if err != nil {
+		return "[invalid JSON]"
+	}
+	return string(data)
 }
 
-// formatInterface formats an interface for logging
-func formatInterface(v interface{}) string {
-	if v == nil {
-		return "nil"
+// redactValue masks redacted fields of decoded JSON in place
+func redactValue(v interface{}, redact map[string]bool) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			_, isString := value.(string)
+			if redact[strings.ToLower(key)] || isString && sensitiveKey(key) {
+				v[key] = redacted
+			} else {
+				v[key] = redactValue(value, redact)
+			}
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = redactValue(v[i], redact)
+		}
+	}
+	return v
+}
+
+// redactQuery returns a query string with the values of redacted parameters masked
+func redactQuery(query string, redact map[string]bool) string {
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return "[invalid query]"
+	}
+	for key := range values {
+		if redact[strings.ToLower(key)] || sensitiveKey(key) {
+			values[key] = []string{redacted}
+		}
+	}
+	return values.Encode()
+}
+
+// sensitiveKey reports whether key contains one of sensitiveKeyParts
+func sensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, part := range sensitiveKeyParts {
+		if strings.Contains(key, part) {
+			return true
+		}
+	}
+	return false
+}
+
+// newRequestID returns a random request ID
+func newRequestID() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(buf)
+}
+
+// validRequestID reports whether a client-supplied request ID is safe to log and echo
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, r := range id {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.') {
+			return false
+		}
 	}
-	return fmt.Sprintf("%v", v)
+	return true
 }
@@ -0,0 +1,129 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// testRedactFields returns the redact set the logger builds from the default fields
+func testRedactFields() map[string]bool {
+	redact := make(map[string]bool)
+	for _, field := range DefaultRedactFields {
+		redact[field] = true
+	}
+	return redact
+}
+
+func TestRedactJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"empty", ``, ``},
+		{"invalid", `{"password":`, `[invalid JSON]`},
+		{"no secrets", `{"username":"alice","size":3}`, `{"size":3,"username":"alice"}`},
+		{"listed field", `{"username":"alice","password":"hunter2"}`, `{"password":"[REDACTED]","username":"alice"}`},
+		{"case-insensitive", `{"Password":"hunter2"}`, `{"Password":"[REDACTED]"}`},
+		{"nested", `{"token":{"token":"abc","expires_at":"2026-01-01"}}`, `{"token":"[REDACTED]"}`},
+		{"arrays", `[{"client_secret":"s"},{"name":"b"}]`, `[{"client_secret":"[REDACTED]"},{"name":"b"}]`},
+		{"deep", `{"a":{"b":[{"refresh_token":"r"}]}}`, `{"a":{"b":[{"refresh_token":"[REDACTED]"}]}}`},
+		{"listed non-string", `{"code":1234}`, `{"code":"[REDACTED]"}`},
+		{"unlisted secret string", `{"ldap_bind_password":"p","api_token":"t"}`, `{"api_token":"[REDACTED]","ldap_bind_password":"[REDACTED]"}`},
+		{"unlisted secret object", `{"token_info":{"user":"alice"}}`, `{"token_info":{"user":"alice"}}`},
+		{"unlisted secret number", `{"token_count":3}`, `{"token_count":3}`},
+		{"scalar", `"password"`, `"password"`},
+	}
+	redact := testRedactFields()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := redactJSON([]byte(tt.body), redact); got != tt.want {
+				t.Errorf("redactJSON(%s) = %s, want %s", tt.body, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactQuery(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		redacted []string
+		kept     map[string]string
+	}{
+		{"no secrets", "page=2&page_size=10", nil, map[string]string{"page": "2", "page_size": "10"}},
+		{"listed parameters", "code=abc&state=xyz&page=1", []string{"code", "state"}, map[string]string{"page": "1"}},
+		{"case-insensitive", "Token=abc", []string{"Token"}, nil},
+		{"unlisted secret", "x_api_token=abc&bucket=1", []string{"x_api_token"}, map[string]string{"bucket": "1"}},
+		{"repeated values", "password=a&password=b", []string{"password"}, nil},
+	}
+	redact := testRedactFields()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := redactQuery(tt.query, redact)
+			values, err := url.ParseQuery(got)
+			if err != nil {
+				t.Fatalf("redactQuery(%s) = %s, not a query: %v", tt.query, got, err)
+			}
+			for _, key := range tt.redacted {
+				if v := values[key]; len(v) != 1 || v[0] != redacted {
+					t.Errorf("redactQuery(%s) = %s, want %s redacted", tt.query, got, key)
+				}
+			}
+			for key, want := range tt.kept {
+				if v := values.Get(key); v != want {
+					t.Errorf("redactQuery(%s) = %s, want %s=%s", tt.query, got, key, want)
+				}
+			}
+			for _, secret := range []string{"abc", "xyz"} {
+				if strings.Contains(got, secret) {
+					t.Errorf("redactQuery(%s) = %s, leaks %s", tt.query, got, secret)
+				}
+			}
+		})
+	}
+
+	if got := redactQuery("a=%zz", testRedactFields()); got != "[invalid query]" {
+		t.Errorf("redactQuery of an invalid query = %s", got)
+	}
+}
+
+func TestLoggerMiddlewareRedactsBodiesAndQuery(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var out bytes.Buffer
+	config := DefaultLoggerConfig()
+	config.Logger = slog.New(slog.NewJSONHandler(&out, nil))
+	config.LogBodies = true
+
+	router := gin.New()
+	router.Use(LoggerMiddleware(config))
+	router.POST("/login", func(c *gin.Context) {
+		io.Copy(io.Discard, c.Request.Body)
+		c.JSON(http.StatusOK, gin.H{"username": "alice", "token": gin.H{"token": "issued-jwt"}})
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/login?state=oauth-state&page=1",
+		strings.NewReader(`{"username":"alice","password":"hunter2"}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	logged := out.String()
+	for _, secret := range []string{"hunter2", "issued-jwt", "oauth-state"} {
+		if strings.Contains(logged, secret) {
+			t.Errorf("log record leaks %s: %s", secret, logged)
+		}
+	}
+	for _, want := range []string{`\"username\":\"alice\"`, "page=1"} {
+		if !strings.Contains(logged, want) {
+			t.Errorf("log record %s does not contain %s", logged, want)
+		}
+	}
+}
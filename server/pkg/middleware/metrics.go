@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/minorcell/pfss/pkg/metrics"
+	"github.com/minorcell/pfss/pkg/util"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// MetricsMiddleware records request counts and latency per route and status.
+// Requests that match no route share the "unmatched" route label so that
+// scanners cannot inflate the number of series.
+func MetricsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		status := strconv.Itoa(c.Writer.Status())
+		metrics.HTTPRequests.WithLabelValues(c.Request.Method, route, status).Inc()
+		metrics.HTTPDuration.WithLabelValues(c.Request.Method, route, status).Observe(time.Since(start).Seconds())
+
+		// Stored files are served by the file content route
+		if route == "/api/v1/files/:id/content" && c.Writer.Size() > 0 {
+			metrics.DownloadBytes.Add(float64(c.Writer.Size()))
+		}
+	}
+}
+
+// MetricsHandler serves the metrics in the Prometheus exposition format.
+// Scrapers must send token as a bearer token; with an empty token every
+// request is rejected.
+func MetricsHandler(token string) gin.HandlerFunc {
+	handler := promhttp.HandlerFor(metrics.Registry, promhttp.HandlerOpts{})
+	return func(c *gin.Context) {
+		given := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if token == "" || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			util.SendError(c, util.ErrUnauthorized)
+			c.Abort()
+			return
+		}
+		handler.ServeHTTP(c.Writer, c.Request)
+	}
+}
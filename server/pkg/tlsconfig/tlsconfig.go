@@ -0,0 +1,227 @@
+// Package tlsconfig builds the TLS configuration of the server and reloads
+// its certificates when the files on disk change
+package tlsconfig
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Client authentication modes
+const (
+	ClientAuthNone     = "none"
+	ClientAuthOptional = "optional"
+	ClientAuthRequire  = "require"
+)
+
+// Config configures TLS
+type Config struct {
+	CertFile string
+	KeyFile  string
+	// MinVersion is the lowest accepted protocol version, "1.2" or "1.3"
+	MinVersion string
+	// CipherSuites restricts the TLS 1.2 cipher suites by their IANA names,
+	// e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256. TLS 1.3 suites are not
+	// configurable. Empty means Go's defaults.
+	CipherSuites []string
+	// ClientCAFile is a PEM bundle of the CAs that client certificates are
+	// verified against. Empty disables client certificates.
+	ClientCAFile string
+	// ClientAuth is one of none, optional (verify a certificate if one is
+	// presented) or require
+	ClientAuth string
+}
+
+// DefaultConfig returns the default TLS configuration
+func DefaultConfig() Config {
+	return Config{
+		MinVersion: "1.2",
+		ClientAuth: ClientAuthOptional,
+	}
+}
+
+// Reloader serves the current TLS configuration and reloads the certificate,
+// key and client CAs when their files change
+type Reloader struct {
+	config  Config
+	base    *tls.Config
+	current atomic.Pointer[tls.Config]
+	stamps  map[string]fileStamp
+}
+
+// fileStamp identifies a version of a file
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// New validates config and loads the certificate files
+func New(config Config) (*Reloader, error) {
+	if config.CertFile == "" || config.KeyFile == "" {
+		return nil, errors.New("TLS needs both a certificate and a key file")
+	}
+
+	base := &tls.Config{NextProtos: []string{"h2", "http/1.1"}}
+	switch config.MinVersion {
+	case "", "1.2":
+		base.MinVersion = tls.VersionTLS12
+	case "1.3":
+		base.MinVersion = tls.VersionTLS13
+	default:
+		return nil, fmt.Errorf("invalid TLS minimum version %q: must be 1.2 or 1.3", config.MinVersion)
+	}
+
+	suites, err := cipherSuites(config.CipherSuites)
+	if err != nil {
+		return nil, err
+	}
+	base.CipherSuites = suites
+
+	switch {
+	case config.ClientCAFile == "" || config.ClientAuth == ClientAuthNone:
+		base.ClientAuth = tls.NoClientCert
+	case config.ClientAuth == "" || config.ClientAuth == ClientAuthOptional:
+		base.ClientAuth = tls.VerifyClientCertIfGiven
+	case config.ClientAuth == ClientAuthRequire:
+		base.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, fmt.Errorf("invalid TLS client auth %q: must be none, optional or require", config.ClientAuth)
+	}
+
+	r := &Reloader{config: config, base: base}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// TLSConfig returns the configuration to serve with. Each handshake uses the
+// most recently loaded certificates.
+func (r *Reloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		NextProtos: r.base.NextProtos,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return r.current.Load(), nil
+		},
+	}
+}
+
+// Run reloads the certificates every interval if their files changed, until
+// ctx is done. A failed reload is logged and the previous certificates stay
+// in use.
+func (r *Reloader) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !r.changed() {
+				continue
+			}
+			if err := r.reload(); err != nil {
+				log.Printf("Failed to reload TLS certificates: %v", err)
+				continue
+			}
+			log.Printf("Reloaded TLS certificates from %s", r.config.CertFile)
+		}
+	}
+}
+
+// reload loads the certificate files and makes them the current configuration
+func (r *Reloader) reload() error {
+	// Stat before reading so a write racing the read is picked up next time
+	stamps := make(map[string]fileStamp)
+	for _, name := range r.files() {
+		stamp, err := stat(name)
+		if err != nil {
+			return err
+		}
+		stamps[name] = stamp
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.config.CertFile, r.config.KeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS certificate: %v", err)
+	}
+
+	config := r.base.Clone()
+	config.Certificates = []tls.Certificate{cert}
+	if config.ClientAuth != tls.NoClientCert {
+		pem, err := os.ReadFile(r.config.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read TLS client CA file: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in TLS client CA file %s", r.config.ClientCAFile)
+		}
+		config.ClientCAs = pool
+	}
+
+	r.current.Store(config)
+	r.stamps = stamps
+	return nil
+}
+
+// changed reports whether any certificate file differs from the loaded one
+func (r *Reloader) changed() bool {
+	for _, name := range r.files() {
+		stamp, err := stat(name)
+		if err != nil || stamp != r.stamps[name] {
+			return true
+		}
+	}
+	return false
+}
+
+// files returns the files the configuration is loaded from
+func (r *Reloader) files() []string {
+	files := []string{r.config.CertFile, r.config.KeyFile}
+	if r.base.ClientAuth != tls.NoClientCert {
+		files = append(files, r.config.ClientCAFile)
+	}
+	return files
+}
+
+// stat returns the stamp of the file name refers to, following symlinks so
+// that certificates swapped by replacing a symlink are noticed
+func stat(name string) (fileStamp, error) {
+	info, err := os.Stat(name)
+	if err != nil {
+		return fileStamp{}, err
+	}
+	return fileStamp{modTime: info.ModTime(), size: info.Size()}, nil
+}
+
+// cipherSuites resolves cipher suite names to their IDs. Suites Go considers
+// insecure are rejected.
+func cipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	known := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		known[suite.Name] = suite.ID
+	}
+
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := known[strings.TrimSpace(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown or insecure TLS cipher suite %q", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
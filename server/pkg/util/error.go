@@ -10,11 +10,12 @@ type ErrorResponse struct {
 
 // Common error codes
 const (
-	ErrorCodeUnauthorized     = 401
-	ErrorCodeForbidden        = 403
-	ErrorCodeNotFound         = 404
-	ErrorCodeInvalidInput     = 400
-	ErrorCodeInternalError    = 500
+	ErrorCodeUnauthorized       = 401
+	ErrorCodeForbidden          = 403
+	ErrorCodeNotFound           = 404
+	ErrorCodeInvalidInput       = 400
+	ErrorCodeTooManyRequests    = 429
+	ErrorCodeInternalError      = 500
 	ErrorCodeServiceUnavailable = 503
 )
 
@@ -33,10 +34,10 @@ func SendError(c *gin.Context, err *ErrorResponse) {
 
 // Common errors
 var (
-	ErrUnauthorized     = NewError(ErrorCodeUnauthorized, "Unauthorized access")
-	ErrForbidden        = NewError(ErrorCodeForbidden, "Access forbidden")
-	ErrNotFound         = NewError(ErrorCodeNotFound, "Resource not found")
-	ErrInvalidInput     = NewError(ErrorCodeInvalidInput, "Invalid input")
-	ErrInternalServer   = NewError(ErrorCodeInternalError, "Internal server error")
+	ErrUnauthorized       = NewError(ErrorCodeUnauthorized, "Unauthorized access")
+	ErrForbidden          = NewError(ErrorCodeForbidden, "Access forbidden")
+	ErrNotFound           = NewError(ErrorCodeNotFound, "Resource not found")
+	ErrInvalidInput       = NewError(ErrorCodeInvalidInput, "Invalid input")
+	ErrInternalServer     = NewError(ErrorCodeInternalError, "Internal server error")
 	ErrServiceUnavailable = NewError(ErrorCodeServiceUnavailable, "Service unavailable")
 )
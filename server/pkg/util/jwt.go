@@ -2,47 +2,84 @@ package util
 
 import (
 	"errors"
-	"os"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// jwtConfig holds the signing secret and token lifetime set by ConfigureJWT
+var jwtConfig struct {
+	sync.RWMutex
+	secret     string
+	expiration time.Duration
+}
+
+// ConfigureJWT sets the secret tokens are signed with and how long they are valid
+func ConfigureJWT(secret string, expiration time.Duration) {
+	jwtConfig.Lock()
+	defer jwtConfig.Unlock()
+	jwtConfig.secret = secret
+	jwtConfig.expiration = expiration
+}
+
+// jwtSettings returns the configured secret and token lifetime, which
+// defaults to 24 hours
+func jwtSettings() (string, time.Duration, error) {
+	jwtConfig.RLock()
+	defer jwtConfig.RUnlock()
+	if jwtConfig.secret == "" {
+		return "", 0, errors.New("JWT secret not configured")
+	}
+	expiration := jwtConfig.expiration
+	if expiration <= 0 {
+		expiration = 24 * time.Hour
+	}
+	return jwtConfig.secret, expiration, nil
+}
+
 type Claims struct {
 	UserID   uint   `json:"user_id"`
 	Username string `json:"username"`
 	IsRoot   bool   `json:"is_root"`
+	// PasswordChange marks a token that may only be used to change the password
+	PasswordChange bool `json:"pwd_change,omitempty"`
 	jwt.RegisteredClaims
 }
 
 // GenerateToken generates a new JWT token for a user
 func GenerateToken(userID uint, username string, isRoot bool) (string, error) {
-	// Get secret key from environment
-	secretKey := os.Getenv("JWT_SECRET")
-	if secretKey == "" {
-		return "", errors.New("JWT_SECRET not set")
-	}
+	return generateToken(&Claims{
+		UserID:   userID,
+		Username: username,
+		IsRoot:   isRoot,
+	})
+}
 
-	// Parse expiration duration
-	expirationStr := os.Getenv("JWT_EXPIRATION")
-	if expirationStr == "" {
-		expirationStr = "24h" // default to 24 hours
-	}
-	expiration, err := time.ParseDuration(expirationStr)
+// GeneratePasswordChangeToken generates a JWT token that is only accepted
+// by the change password endpoint, used when a password change is forced
+func GeneratePasswordChangeToken(userID uint, username string, isRoot bool) (string, error) {
+	return generateToken(&Claims{
+		UserID:         userID,
+		Username:       username,
+		IsRoot:         isRoot,
+		PasswordChange: true,
+	})
+}
+
+// generateToken fills in the registered claims and signs the token
+func generateToken(claims *Claims) (string, error) {
+	// Get secret key and expiration from the configuration
+	secretKey, expiration, err := jwtSettings()
 	if err != nil {
 		return "", err
 	}
 
-	// Create claims
-	claims := &Claims{
-		UserID:   userID,
-		Username: username,
-		IsRoot:   isRoot,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiration)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			NotBefore: jwt.NewNumericDate(time.Now()),
-		},
+	// Set registered claims
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiration)),
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
+		NotBefore: jwt.NewNumericDate(time.Now()),
 	}
 
 	// Create token
@@ -54,10 +91,10 @@ func GenerateToken(userID uint, username string, isRoot bool) (string, error) {
 
 // ParseToken parses and validates a JWT token
 func ParseToken(tokenString string) (*Claims, error) {
-	// Get secret key from environment
-	secretKey := os.Getenv("JWT_SECRET")
-	if secretKey == "" {
-		return nil, errors.New("JWT_SECRET not set")
+	// Get secret key from the configuration
+	secretKey, _, err := jwtSettings()
+	if err != nil {
+		return nil, err
 	}
 
 	// Parse token
@@ -40,3 +40,16 @@ func ValidatePassword(password, hash string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 	return err == nil
 }
+
+// IsPasswordHash reports whether hash looks like a bcrypt hash
+func IsPasswordHash(hash string) bool {
+	_, err := bcrypt.Cost([]byte(hash))
+	return err == nil
+}
+
+// PasswordNeedsRehash reports whether hash was created with a different cost
+// than the current default and should be rehashed on the next successful login
+func PasswordNeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err == nil && cost != defaultBcryptCost
+}
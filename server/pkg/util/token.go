@@ -0,0 +1,33 @@
+package util
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+)
+
+// Length of generated one-time tokens in bytes
+const oneTimeTokenLength = 32
+
+// GenerateOneTimeToken generates a random URL-safe token for single-use flows
+// such as setup, invitations and password resets
+func GenerateOneTimeToken() (string, error) {
+	buf := make([]byte, oneTimeTokenLength)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// HashOneTimeToken returns the hash under which a one-time token is stored
+func HashOneTimeToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CompareOneTimeToken checks a token against its stored hash in constant time
+func CompareOneTimeToken(token, hash string) bool {
+	return subtle.ConstantTimeCompare([]byte(HashOneTimeToken(token)), []byte(hash)) == 1
+}